@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/pion/rtcp"
+
+	"github.com/arsperger/slowcast/pkg/ratecontrol"
+)
+
+// onCCFeedback matches RFC 8888 feedback against the sent packets, hands the per-packet delay
+// and loss samples to the controller and logs an RTCP_CCFB entry
+func (s *SlowCast) onCCFeedback(now time.Time, elapsed float64, fb *rtcp.CCFeedbackReport) {
+	report := s.sentHistory.Match(fb)
+	if len(report.Packets) == 0 {
+		return
+	}
+	if consumer, ok := s.controller.(ratecontrol.PacketFeedbackConsumer); ok {
+		consumer.OnPacketFeedback(now, report)
+	}
+
+	var lost, marked, delays int
+	var minDelay, maxDelay time.Duration
+	for _, pkt := range report.Packets {
+		switch {
+		case !pkt.Received:
+			lost++
+			continue
+		case pkt.ECN == rtcp.ECNCE:
+			marked++
+		}
+		if !pkt.HasArrival {
+			continue
+		}
+		if delays == 0 || pkt.Delay < minDelay {
+			minDelay = pkt.Delay
+		}
+		if delays == 0 || pkt.Delay > maxDelay {
+			maxDelay = pkt.Delay
+		}
+		delays++
+	}
+
+	logEntry := map[string]interface{}{
+		"type":     "RTCP_CCFB",
+		"receiver": report.ReceiverSSRC,
+		"elapsed":  fmt.Sprintf("%.3f", elapsed),
+		"packets":  len(report.Packets),
+		"lost":     lost,
+		"ecn_ce":   marked,
+	}
+	if delays > 0 {
+		// one-way delays include the clock offset of the receiver, their spread is the queuing variation
+		logEntry["delay_spread"] = fmt.Sprintf("%.4f", (maxDelay - minDelay).Seconds())
+	}
+	if jsonEntry, err := json.Marshal(logEntry); err == nil {
+		fmt.Println(string(jsonEntry))
+	}
+}
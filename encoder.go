@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/go-gst/go-gst/gst"
+
+	"github.com/arsperger/slowcast/pkg/encoder"
+)
+
+// setupEncoder selects the encoder backend and logs how it takes the target bitrate
+func (s *SlowCast) setupEncoder(backend encoder.Backend) {
+	s.encoder = backend
+
+	unit := "kbps"
+	if backend.BitsPerSecond {
+		unit = "bps"
+	}
+	logEntry := map[string]interface{}{
+		"type":             "encoder",
+		"encoder":          backend.Element,
+		"payloader":        backend.Payloader,
+		"encoding_name":    backend.EncodingName,
+		"bitrate_property": backend.BitrateProperty,
+		"bitrate_unit":     unit,
+		"runtime_bitrate":  backend.Runtime,
+	}
+	if jsonEntry, err := json.Marshal(logEntry); err == nil {
+		fmt.Println(string(jsonEntry))
+	}
+}
+
+// newEncoder creates the encoder element named "encoder" at the current bitrate and its RTP payloader
+func (s *SlowCast) newEncoder() (*gst.Element, *gst.Element, error) {
+	enc, err := gst.NewElementWithProperties(s.encoder.Element, map[string]interface{}{
+		"name":                    "encoder",
+		s.encoder.BitrateProperty: s.encoder.BitrateValue(s.currentBitrate),
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create %s: %w", s.encoder.Element, err)
+	}
+	for name, value := range s.encoder.Properties {
+		enc.SetArg(name, value)
+	}
+
+	pay, err := gst.NewElementWithProperties(s.encoder.Payloader, map[string]interface{}{"pt": uint(96)})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create %s: %w", s.encoder.Payloader, err)
+	}
+	for name, value := range s.encoder.PayloaderProperties {
+		pay.SetArg(name, value)
+	}
+	return enc, pay, nil
+}
+
+// setEncoderBitrate sets kbps on the bitrate property of the encoder
+func (s *SlowCast) setEncoderBitrate(kbps int) error {
+	enc, err := s.stream.GetElementByName("encoder")
+	if err != nil {
+		return fmt.Errorf("encoder element lookup error: %w", err)
+	}
+	if err = enc.Set(s.encoder.BitrateProperty, s.encoder.BitrateValue(kbps)); err != nil {
+		return fmt.Errorf("error setting encoder bitrate: %w", err)
+	}
+	return nil
+}
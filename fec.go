@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/go-gst/go-gst/gst"
+
+	"github.com/arsperger/slowcast/pkg/fec"
+	"github.com/arsperger/slowcast/pkg/ratecontrol"
+)
+
+// setupFEC enables ULPFEC in RED sized from the controller loss event rate
+func (s *SlowCast) setupFEC(maxPercentage int) error {
+	cfg := fec.DefaultConfig()
+	cfg.MaxPercentage = maxPercentage
+	redundancy, err := fec.New(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create FEC: %w", err)
+	}
+	s.fec = redundancy
+
+	logEntry := map[string]interface{}{
+		"type":   "fec",
+		"pt":     cfg.MediaPayloadType,
+		"fec_pt": cfg.PayloadType,
+		"red_pt": cfg.REDPayloadType,
+		"sdp":    cfg.SDP(),
+	}
+	if jsonEntry, err := json.Marshal(logEntry); err == nil {
+		fmt.Println(string(jsonEntry))
+	}
+	return nil
+}
+
+// newFECEncoders creates the rtpulpfecenc adding FEC packets to the media and the rtpredenc
+// wrapping both in RED, FEC starts off until the first loss
+func (s *SlowCast) newFECEncoders() (*gst.Element, *gst.Element, error) {
+	cfg := s.fec.Config()
+	fecEnc, err := gst.NewElementWithProperties("rtpulpfecenc", map[string]interface{}{
+		"name":        "fecenc",
+		"pt":          uint(cfg.PayloadType),
+		"percentage":  uint(0),
+		"multipacket": true,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create rtpulpfecenc: %w", err)
+	}
+	redEnc, err := gst.NewElementWithProperties("rtpredenc", map[string]interface{}{
+		"pt":                  int(cfg.REDPayloadType),
+		"allow-no-red-blocks": true,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create rtpredenc: %w", err)
+	}
+	return fecEnc, redEnc, nil
+}
+
+// updateFEC sizes the FEC for the loss event rate of the controller and returns the share
+// of targetKbps left to the encoder
+func (s *SlowCast) updateFEC(elapsed float64, targetKbps int) int {
+	lossRate := s.controller.State().LossRate
+	if estimator, ok := s.controller.(ratecontrol.LossEstimator); ok {
+		lossRate = estimator.LossEventRate()
+	}
+
+	percentage, changed := s.fec.Update(lossRate)
+	if changed {
+		fecEnc, err := s.stream.GetElementByName("fecenc")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "FEC encoder element lookup error: %v\n", err)
+		} else if err = fecEnc.Set("percentage", uint(percentage)); err != nil { //nolint:gosec
+			fmt.Fprintf(os.Stderr, "Error setting FEC percentage: %v\n", err)
+		}
+
+		logEntry := map[string]interface{}{
+			"type":       "fec_percentage",
+			"elapsed":    fmt.Sprintf("%.3f", elapsed),
+			"loss":       fmt.Sprintf("%.6f", lossRate),
+			"percentage": percentage,
+		}
+		if jsonEntry, err := json.Marshal(logEntry); err == nil {
+			fmt.Println(string(jsonEntry))
+		}
+	}
+	return s.fec.MediaBitrate(targetKbps)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/go-gst/go-gst/gst"
+	"github.com/pion/rtcp"
+
+	"github.com/arsperger/slowcast/pkg/keyframe"
+)
+
+const (
+	// forceKeyUnit is the upstream event asking the encoder for a key frame
+	forceKeyUnit = "GstForceKeyUnit"
+
+	// keyUnitLimited marks the force key unit events that went through the key frame limiter
+	keyUnitLimited = "rate-limited"
+)
+
+// setupKeyframes forces a key frame on PLI and FIR at most once per minInterval
+func (s *SlowCast) setupKeyframes(minInterval time.Duration) error {
+	limiter, err := keyframe.New(keyframe.Config{MinInterval: minInterval})
+	if err != nil {
+		return fmt.Errorf("failed to create key frame limiter: %w", err)
+	}
+	s.keyframes = limiter
+	return nil
+}
+
+// addKeyUnitProbe routes the force key unit events rtpsession sends upstream on PLI and FIR
+// through the key frame limiter
+func (s *SlowCast) addKeyUnitProbe(encoder *gst.Element) error {
+	srcPad := encoder.GetStaticPad("src")
+	if srcPad == nil {
+		return fmt.Errorf("failed to get encoder src pad")
+	}
+	srcPad.AddProbe(gst.PadProbeTypeEventUpstream,
+		func(_ *gst.Pad, info *gst.PadProbeInfo) gst.PadProbeReturn {
+			ev := info.GetEvent()
+			if ev == nil || ev.Type() != gst.EventTypeCustomUpstream {
+				return gst.PadProbeOK
+			}
+			st := ev.GetStructure()
+			if st == nil || st.Name() != forceKeyUnit {
+				return gst.PadProbeOK
+			}
+			if _, err := st.GetValue(keyUnitLimited); err == nil {
+				return gst.PadProbeOK
+			}
+			delay, force := s.keyframes.Request(time.Now())
+			if force && delay == 0 {
+				return gst.PadProbeOK
+			}
+			if force {
+				time.AfterFunc(delay, s.forceKeyUnit)
+			}
+			return gst.PadProbeDrop
+		})
+	return nil
+}
+
+// onKeyframeRequest forces a key frame for a PLI or FIR, now or once the min interval has passed,
+// and logs an RTCP_PLI or RTCP_FIR entry
+func (s *SlowCast) onKeyframeRequest(now time.Time, elapsed float64, pkt rtcp.Packet) {
+	delay, force := s.keyframes.OnRTCP(now, pkt)
+	switch {
+	case force && delay == 0:
+		s.forceKeyUnit()
+	case force:
+		time.AfterFunc(delay, s.forceKeyUnit)
+	}
+
+	logEntry := map[string]interface{}{
+		"elapsed": fmt.Sprintf("%.3f", elapsed),
+		"forced":  force,
+		"delay":   fmt.Sprintf("%.3f", delay.Seconds()),
+	}
+	switch p := pkt.(type) {
+	case *rtcp.PictureLossIndication:
+		logEntry["type"] = "RTCP_PLI"
+		logEntry["receiver"] = p.SenderSSRC
+		logEntry["SSRC"] = p.MediaSSRC
+	case *rtcp.FullIntraRequest:
+		logEntry["type"] = "RTCP_FIR"
+		logEntry["receiver"] = p.SenderSSRC
+		logEntry["SSRC"] = p.MediaSSRC
+	}
+	if jsonEntry, err := json.Marshal(logEntry); err == nil {
+		fmt.Println(string(jsonEntry))
+	}
+}
+
+// forceKeyUnit sends the encoder an upstream force key unit event asking for a key frame
+// with SPS and PPS
+func (s *SlowCast) forceKeyUnit() {
+	encoder, err := s.stream.GetElementByName("encoder")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Encoder element lookup error: %v\n", err)
+		return
+	}
+	srcPad := encoder.GetStaticPad("src")
+	if srcPad == nil {
+		fmt.Fprintf(os.Stderr, "Failed to get encoder src pad\n")
+		return
+	}
+
+	st := gst.NewStructure(forceKeyUnit)
+	for field, value := range map[string]interface{}{
+		"all-headers":  true,
+		"count":        uint(0),
+		keyUnitLimited: true,
+	} {
+		if err := st.SetValue(field, value); err != nil {
+			fmt.Fprintf(os.Stderr, "Force key unit event error: %v\n", err)
+			return
+		}
+	}
+	if !srcPad.SendEvent(gst.NewCustomEvent(gst.EventTypeCustomUpstream, st)) {
+		fmt.Fprintf(os.Stderr, "Encoder did not handle the force key unit event\n")
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/go-gst/go-gst/gst"
+
+	"github.com/arsperger/slowcast/pkg/ladder"
+)
+
+// setupLadder scales the encoded resolution and framerate with the bitrate, starting at the
+// rung of the initial bitrate
+func (s *SlowCast) setupLadder(cfg ladder.Config) error {
+	l, err := ladder.New(cfg, s.currentBitrate)
+	if err != nil {
+		return fmt.Errorf("failed to create bitrate ladder: %w", err)
+	}
+	s.ladder = l
+	return nil
+}
+
+// ladderCaps returns the encoder input caps of a rung, the framerate is capped by videorate
+// so a source slower than the rung still negotiates
+func ladderCaps(r ladder.Rung) *gst.Caps {
+	return gst.NewCapsFromString(fmt.Sprintf("video/x-raw,format=I420,width=%d,height=%d", r.Width, r.Height))
+}
+
+// applyLadder moves to the rung of kbps and, when it changed, sets the max rate of videorate
+// and the caps of the encoder input capsfilter, videoscale, videorate and the encoder
+// renegotiate without a restart
+func (s *SlowCast) applyLadder(kbps int) {
+	rung, changed := s.ladder.Update(kbps)
+	if !changed {
+		return
+	}
+	if !s.encoder.Runtime {
+		// the encoder reads its bitrate when the new caps configure it
+		if err := s.setEncoderBitrate(kbps); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+		}
+	}
+	rate, err := s.stream.GetElementByName("rate")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Videorate element lookup error: %v\n", err)
+		return
+	}
+	if err = rate.Set("max-rate", rung.FPS); err != nil {
+		fmt.Fprintf(os.Stderr, "Error setting videorate max rate: %v\n", err)
+		return
+	}
+	capsFilter, err := s.stream.GetElementByName("scalecaps")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Scale capsfilter element lookup error: %v\n", err)
+		return
+	}
+	if err = capsFilter.Set("caps", ladderCaps(rung)); err != nil {
+		fmt.Fprintf(os.Stderr, "Error setting scale caps: %v\n", err)
+		return
+	}
+
+	logEntry := map[string]interface{}{
+		"type":    "ladder",
+		"bitrate": kbps,
+		"width":   rung.Width,
+		"height":  rung.Height,
+		"fps":     rung.FPS,
+	}
+	if jsonEntry, err := json.Marshal(logEntry); err == nil {
+		fmt.Println(string(jsonEntry))
+	}
+}
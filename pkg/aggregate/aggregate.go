@@ -0,0 +1,492 @@
+// Package aggregate keeps one rate controller per receiver of a multicast session
+// and picks the sending rate from their targets with an aggregation policy.
+package aggregate
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pion/rtcp"
+
+	"github.com/arsperger/slowcast/pkg/ratecontrol"
+)
+
+const (
+	defaultPercentile  = 0.1
+	defaultIdleTimeout = 30 * time.Second
+
+	// tfmccPacketSize and tfmccDefaultRTT bound the TFMCC increase to one packet per RTT per RTT
+	tfmccPacketSize = 1200
+	tfmccDefaultRTT = 0.1
+)
+
+var (
+	_ ratecontrol.RateController         = (*Aggregator)(nil)
+	_ ratecontrol.ProbeConsumer          = (*Aggregator)(nil)
+	_ ratecontrol.SendStatsConsumer      = (*Aggregator)(nil)
+	_ ratecontrol.StateSnapshotter       = (*Aggregator)(nil)
+	_ ratecontrol.PacketFeedbackConsumer = (*Aggregator)(nil)
+	_ ratecontrol.LossEstimator          = (*Aggregator)(nil)
+)
+
+// Config selects the aggregation policy, zero values use the defaults
+type Config struct {
+	Policy Policy
+	// Percentile of the receiver targets followed by PolicyPercentile, 0.1 by default
+	Percentile float64
+	// IdleTimeout expires receivers without feedback for this long, 30s by default
+	IdleTimeout time.Duration
+}
+
+// DefaultConfig follows the slowest receiver
+func DefaultConfig() Config {
+	return Config{
+		Policy:      PolicyMin,
+		Percentile:  defaultPercentile,
+		IdleTimeout: defaultIdleTimeout,
+	}
+}
+
+// ReceiverKey identifies the feedback of one receiver about one media stream
+type ReceiverKey struct {
+	ReceiverSSRC uint32
+	MediaSSRC    uint32
+}
+
+// Receiver is a snapshot of one receiver controller
+type Receiver struct {
+	Key ReceiverKey
+	// Target is the last bitrate in Kbps computed by the receiver controller
+	Target     int
+	State      ratecontrol.State
+	LastReport time.Time
+	// Limiting is set on the receiver the sending rate follows
+	Limiting bool
+}
+
+// ReceiverLister is implemented by every controller returned by New
+type ReceiverLister interface {
+	Receivers() []Receiver
+}
+
+type receiver struct {
+	controller ratecontrol.RateController
+	target     int
+	lastReport time.Time
+	// dirty is set when feedback arrived since the last target
+	dirty bool
+}
+
+// Aggregator is a ratecontrol.RateController fanning the feedback out to one controller per receiver
+type Aggregator struct {
+	mu sync.Mutex
+
+	cfg     Config
+	factory ratecontrol.Factory
+	limits  ratecontrol.Config
+	clock   ratecontrol.Clock
+
+	receivers map[ReceiverKey]*receiver
+	// spare is created up front and adopted by the first receiver, so it has seen every packet sent
+	spare ratecontrol.RateController
+
+	bitrate     int
+	limiting    ReceiverKey
+	hasLimiting bool
+	lastUpdate  time.Time
+}
+
+// New creates an aggregator creating the receiver controllers with factory. The returned
+// controller also implements the PacketObserver or SendLimiter interfaces of the controllers
+// factory creates, packets are reported to every receiver and sent only when all windows allow it.
+func New(cfg Config, factory ratecontrol.Factory, limits ratecontrol.Config) (ratecontrol.RateController, error) {
+	if cfg.Percentile == 0 {
+		cfg.Percentile = defaultPercentile
+	}
+	if cfg.IdleTimeout == 0 {
+		cfg.IdleTimeout = defaultIdleTimeout
+	}
+	if cfg.Percentile < 0 || cfg.Percentile > 1 {
+		return nil, fmt.Errorf("percentile %v must be in (0, 1]", cfg.Percentile)
+	}
+	if cfg.IdleTimeout < 0 {
+		return nil, fmt.Errorf("idle timeout %v must not be negative", cfg.IdleTimeout)
+	}
+
+	spare, err := factory(limits)
+	if err != nil {
+		return nil, err
+	}
+	a := &Aggregator{
+		cfg:       cfg,
+		factory:   factory,
+		limits:    limits,
+		clock:     ratecontrol.ClockOrSystem(limits.Clock),
+		receivers: make(map[ReceiverKey]*receiver),
+		spare:     spare,
+		bitrate:   limits.InitBitrate,
+	}
+	switch spare.(type) {
+	case ratecontrol.SendLimiter:
+		return &limitingAggregator{a}, nil
+	case ratecontrol.PacketObserver:
+		return &observingAggregator{a}, nil
+	default:
+		return a, nil
+	}
+}
+
+// NewFactory wraps factory so that every controller it creates is an aggregator
+func NewFactory(cfg Config, factory ratecontrol.Factory) ratecontrol.Factory {
+	return func(limits ratecontrol.Config) (ratecontrol.RateController, error) {
+		return New(cfg, factory, limits)
+	}
+}
+
+// OnRTCP splits receiver reports by report block and routes feedback by its sender SSRC,
+// a BYE removes the receivers it names
+func (a *Aggregator) OnRTCP(now time.Time, pkt rtcp.Packet) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	switch p := pkt.(type) {
+	case *rtcp.ReceiverReport:
+		for _, block := range p.Reports {
+			r := a.receiver(now, ReceiverKey{ReceiverSSRC: p.SSRC, MediaSSRC: block.SSRC})
+			if r == nil {
+				continue
+			}
+			r.controller.OnRTCP(now, &rtcp.ReceiverReport{
+				SSRC:              p.SSRC,
+				Reports:           []rtcp.ReceptionReport{block},
+				ProfileExtensions: p.ProfileExtensions,
+			})
+			r.lastReport = now
+			r.dirty = true
+		}
+	case *rtcp.Goodbye:
+		for _, ssrc := range p.Sources {
+			for key := range a.receivers {
+				if key.ReceiverSSRC == ssrc {
+					a.remove(key)
+				}
+			}
+		}
+	default:
+		a.route(now, pkt)
+	}
+	a.expire(now)
+}
+
+// route feeds a feedback packet to the receivers of its sender SSRC,
+// packets without one go to every receiver
+func (a *Aggregator) route(now time.Time, pkt rtcp.Packet) {
+	fbKey, ok := feedbackKey(pkt)
+	if !ok {
+		for _, r := range a.receivers {
+			r.controller.OnRTCP(now, pkt)
+		}
+		return
+	}
+
+	routed := false
+	for key, r := range a.receivers {
+		if key.ReceiverSSRC != fbKey.ReceiverSSRC {
+			continue
+		}
+		r.controller.OnRTCP(now, pkt)
+		r.lastReport = now
+		r.dirty = true
+		routed = true
+	}
+	if routed {
+		return
+	}
+	if r := a.receiver(now, fbKey); r != nil {
+		r.controller.OnRTCP(now, pkt)
+		r.lastReport = now
+		r.dirty = true
+	}
+}
+
+// feedbackKey returns the sender and the first media SSRC of the feedback packets
+func feedbackKey(pkt rtcp.Packet) (ReceiverKey, bool) {
+	switch p := pkt.(type) {
+	case *rtcp.TransportLayerCC:
+		return ReceiverKey{ReceiverSSRC: p.SenderSSRC, MediaSSRC: p.MediaSSRC}, true
+	case *rtcp.CCFeedbackReport:
+		key := ReceiverKey{ReceiverSSRC: p.SenderSSRC}
+		if len(p.ReportBlocks) > 0 {
+			key.MediaSSRC = p.ReportBlocks[0].MediaSSRC
+		}
+		return key, true
+	case *rtcp.ReceiverEstimatedMaximumBitrate:
+		key := ReceiverKey{ReceiverSSRC: p.SenderSSRC}
+		if len(p.SSRCs) > 0 {
+			key.MediaSSRC = p.SSRCs[0]
+		}
+		return key, true
+	case *rtcp.ExtendedReport:
+		key := ReceiverKey{ReceiverSSRC: p.SenderSSRC}
+		for _, block := range p.Reports {
+			if ssrcs := block.DestinationSSRC(); len(ssrcs) > 0 {
+				key.MediaSSRC = ssrcs[0]
+				break
+			}
+		}
+		return key, true
+	default:
+		return ReceiverKey{}, false
+	}
+}
+
+// receiver returns the controller of key, creating it at the current sending rate
+func (a *Aggregator) receiver(now time.Time, key ReceiverKey) *receiver {
+	if r, ok := a.receivers[key]; ok {
+		return r
+	}
+
+	controller := a.spare
+	a.spare = nil
+	if controller == nil {
+		limits := a.limits
+		limits.InitBitrate = max(limits.MinBitrate, min(a.bitrate, limits.MaxBitrate))
+		var err error
+		if controller, err = a.factory(limits); err != nil {
+			return nil
+		}
+	}
+	r := &receiver{controller: controller, target: a.bitrate, lastReport: now}
+	a.receivers[key] = r
+	return r
+}
+
+// expire drops the receivers without feedback for the idle timeout
+func (a *Aggregator) expire(now time.Time) {
+	for key, r := range a.receivers {
+		if now.Sub(r.lastReport) > a.cfg.IdleTimeout {
+			a.remove(key)
+		}
+	}
+}
+
+func (a *Aggregator) remove(key ReceiverKey) {
+	delete(a.receivers, key)
+	if a.hasLimiting && a.limiting == key {
+		a.hasLimiting = false
+	}
+}
+
+// TargetBitrate updates the receivers with new feedback and aggregates their targets in Kbps
+func (a *Aggregator) TargetBitrate() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := a.clock.Now()
+	a.expire(now)
+	if len(a.receivers) == 0 {
+		return a.bitrate
+	}
+
+	keys := make([]ReceiverKey, 0, len(a.receivers))
+	for key, r := range a.receivers {
+		if r.dirty {
+			r.target = r.controller.TargetBitrate()
+			r.dirty = false
+		}
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		ti, tj := a.receivers[keys[i]].target, a.receivers[keys[j]].target
+		if ti != tj {
+			return ti < tj
+		}
+		return keyLess(keys[i], keys[j])
+	})
+
+	var rate int
+	switch a.cfg.Policy {
+	case PolicyMin:
+		a.setLimiting(keys[0])
+		rate = a.receivers[keys[0]].target
+	case PolicyPercentile:
+		// nearest rank
+		rank := int(math.Ceil(a.cfg.Percentile*float64(len(keys)))) - 1
+		key := keys[max(0, min(rank, len(keys)-1))]
+		a.setLimiting(key)
+		rate = a.receivers[key].target
+	case PolicyTFMCC:
+		rate = a.tfmccRate(now, keys[0])
+	}
+
+	a.lastUpdate = now
+	a.bitrate = max(a.limits.MinBitrate, min(rate, a.limits.MaxBitrate))
+	return a.bitrate
+}
+
+// tfmccRate keeps the current limiting receiver until it leaves or another receiver asks for less
+// than the sending rate, increases toward its target by at most one packet per RTT per RTT
+func (a *Aggregator) tfmccRate(now time.Time, lowest ReceiverKey) int {
+	if !a.hasLimiting || a.receivers[lowest].target < a.bitrate {
+		a.setLimiting(lowest)
+	}
+	clr := a.receivers[a.limiting]
+	if clr.target <= a.bitrate || a.lastUpdate.IsZero() {
+		return clr.target
+	}
+
+	rtt := clr.controller.State().SmoothedRTT
+	if rtt <= 0 {
+		rtt = tfmccDefaultRTT
+	}
+	elapsed := now.Sub(a.lastUpdate).Seconds()
+	increaseKbps := float64(tfmccPacketSize*8) / 1000 / rtt * elapsed / rtt
+	return min(clr.target, a.bitrate+int(increaseKbps))
+}
+
+func (a *Aggregator) setLimiting(key ReceiverKey) {
+	a.limiting = key
+	a.hasLimiting = true
+}
+
+func keyLess(a, b ReceiverKey) bool {
+	if a.ReceiverSSRC != b.ReceiverSSRC {
+		return a.ReceiverSSRC < b.ReceiverSSRC
+	}
+	return a.MediaSSRC < b.MediaSSRC
+}
+
+// State returns the estimates of the limiting receiver with the aggregated bitrate
+func (a *Aggregator) State() ratecontrol.State {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	state := ratecontrol.State{}
+	if r, ok := a.receivers[a.limiting]; ok && a.hasLimiting {
+		state = r.controller.State()
+	}
+	state.Bitrate = a.bitrate
+	return state
+}
+
+// Receivers returns a snapshot of every receiver ordered by SSRCs
+func (a *Aggregator) Receivers() []Receiver {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	receivers := make([]Receiver, 0, len(a.receivers))
+	for key, r := range a.receivers {
+		receivers = append(receivers, Receiver{
+			Key:        key,
+			Target:     r.target,
+			State:      r.controller.State(),
+			LastReport: r.lastReport,
+			Limiting:   a.hasLimiting && a.limiting == key,
+		})
+	}
+	sort.Slice(receivers, func(i, j int) bool { return keyLess(receivers[i].Key, receivers[j].Key) })
+	return receivers
+}
+
+// OnProbeResult reports a probed rate to every receiver controller
+func (a *Aggregator) OnProbeResult(now time.Time, deliveredKbps int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.forEach(func(c ratecontrol.RateController) {
+		if consumer, ok := c.(ratecontrol.ProbeConsumer); ok {
+			consumer.OnProbeResult(now, deliveredKbps)
+		}
+	})
+}
+
+// OnSendStats reports the measured packet size and sending rate to every receiver controller
+func (a *Aggregator) OnSendStats(now time.Time, stats ratecontrol.SendStats) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.forEach(func(c ratecontrol.RateController) {
+		if consumer, ok := c.(ratecontrol.SendStatsConsumer); ok {
+			consumer.OnSendStats(now, stats)
+		}
+	})
+}
+
+// OnPacketFeedback reports matched RFC 8888 feedback to the controllers of the receiver that sent it
+func (a *Aggregator) OnPacketFeedback(now time.Time, report ratecontrol.FeedbackReport) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for key, r := range a.receivers {
+		if key.ReceiverSSRC != report.ReceiverSSRC {
+			continue
+		}
+		if consumer, ok := r.controller.(ratecontrol.PacketFeedbackConsumer); ok {
+			consumer.OnPacketFeedback(now, report)
+			r.lastReport = now
+			r.dirty = true
+		}
+	}
+}
+
+// LossEventRate returns the highest loss event rate of the receiver controllers,
+// FEC sized for it protects every receiver
+func (a *Aggregator) LossEventRate() float64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	highest := 0.0
+	for _, r := range a.receivers {
+		if estimator, ok := r.controller.(ratecontrol.LossEstimator); ok {
+			highest = max(highest, estimator.LossEventRate())
+		}
+	}
+	return highest
+}
+
+// MarshalState encodes the state of the limiting receiver controller,
+// or of the spare before any receiver reported
+func (a *Aggregator) MarshalState() ([]byte, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	controller := a.spare
+	if r, ok := a.receivers[a.limiting]; ok && a.hasLimiting {
+		controller = r.controller
+	}
+	snapshotter, ok := controller.(ratecontrol.StateSnapshotter)
+	if !ok {
+		return nil, ratecontrol.ErrStateUnsupported
+	}
+	return snapshotter.MarshalState()
+}
+
+// UnmarshalState restores the spare adopted by the first receiver and resumes from its bitrate
+func (a *Aggregator) UnmarshalState(data []byte) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.spare == nil {
+		return errors.New("state must be restored before the first receiver reports")
+	}
+	snapshotter, ok := a.spare.(ratecontrol.StateSnapshotter)
+	if !ok {
+		return ratecontrol.ErrStateUnsupported
+	}
+	if err := snapshotter.UnmarshalState(data); err != nil {
+		return err
+	}
+	a.bitrate = a.spare.State().Bitrate
+	return nil
+}
+
+// forEach calls f for the spare and every receiver controller
+func (a *Aggregator) forEach(f func(c ratecontrol.RateController)) {
+	if a.spare != nil {
+		f(a.spare)
+	}
+	for _, r := range a.receivers {
+		f(r.controller)
+	}
+}
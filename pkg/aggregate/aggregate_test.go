@@ -0,0 +1,354 @@
+package aggregate
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pion/rtcp"
+
+	"github.com/arsperger/slowcast/pkg/ratecontrol"
+	"github.com/arsperger/slowcast/pkg/tfrc"
+)
+
+// stubController targets the jitter of its last report block, so tests pick each receiver rate,
+// and takes the fraction lost as its loss event rate
+type stubController struct {
+	target   int
+	loss     float64
+	reports  []rtcp.ReceptionReport
+	feedback []ratecontrol.FeedbackReport
+	rtt      float64
+}
+
+func (s *stubController) OnRTCP(_ time.Time, pkt rtcp.Packet) {
+	if rr, ok := pkt.(*rtcp.ReceiverReport); ok {
+		s.reports = append(s.reports, rr.Reports...)
+		s.target = int(rr.Reports[len(rr.Reports)-1].Jitter)
+		s.loss = float64(rr.Reports[len(rr.Reports)-1].FractionLost) / 256
+	}
+}
+
+func (s *stubController) LossEventRate() float64 { return s.loss }
+
+func (s *stubController) OnPacketFeedback(_ time.Time, report ratecontrol.FeedbackReport) {
+	s.feedback = append(s.feedback, report)
+}
+
+func (s *stubController) TargetBitrate() int { return s.target }
+
+func (s *stubController) State() ratecontrol.State {
+	return ratecontrol.State{Bitrate: s.target, SmoothedRTT: s.rtt}
+}
+
+type fixedClock struct {
+	now time.Time
+}
+
+func (c *fixedClock) Now() time.Time { return c.now }
+
+func stubFactory(created *[]*stubController) ratecontrol.Factory {
+	return func(cfg ratecontrol.Config) (ratecontrol.RateController, error) {
+		s := &stubController{target: cfg.InitBitrate, rtt: 0.1}
+		*created = append(*created, s)
+		return s, nil
+	}
+}
+
+func limits(clock ratecontrol.Clock) ratecontrol.Config {
+	return ratecontrol.Config{InitBitrate: 1000, MinBitrate: 500, MaxBitrate: 8000, Clock: clock}
+}
+
+// report sends an RR from receiver about media with the given target
+func report(a ratecontrol.RateController, now time.Time, receiver, media uint32, target uint32) {
+	a.OnRTCP(now, &rtcp.ReceiverReport{
+		SSRC:    receiver,
+		Reports: []rtcp.ReceptionReport{{SSRC: media, Jitter: target}},
+	})
+}
+
+func TestAggregator_separateReceivers(t *testing.T) {
+	var created []*stubController
+	clock := &fixedClock{now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	a, err := New(DefaultConfig(), stubFactory(&created), limits(clock))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	// one RR carrying blocks about two media streams, and a second receiver
+	a.OnRTCP(clock.now, &rtcp.ReceiverReport{
+		SSRC: 1,
+		Reports: []rtcp.ReceptionReport{
+			{SSRC: 100, Jitter: 3000},
+			{SSRC: 200, Jitter: 2500},
+		},
+	})
+	report(a, clock.now, 2, 100, 4000)
+
+	receivers := a.(ReceiverLister).Receivers()
+	if len(receivers) != 3 {
+		t.Fatalf("got %d receivers, want 3", len(receivers))
+	}
+	want := []ReceiverKey{{1, 100}, {1, 200}, {2, 100}}
+	for i, r := range receivers {
+		if r.Key != want[i] {
+			t.Errorf("receiver %d = %+v, want %+v", i, r.Key, want[i])
+		}
+	}
+	// the spare and two more controllers, each fed only its own block
+	if len(created) != 3 {
+		t.Fatalf("created %d controllers, want 3", len(created))
+	}
+	for _, c := range created {
+		if len(c.reports) != 1 {
+			t.Errorf("controller got %d report blocks, want 1", len(c.reports))
+		}
+	}
+	if got := a.TargetBitrate(); got != 2500 {
+		t.Errorf("TargetBitrate() = %d, want the slowest 2500", got)
+	}
+}
+
+func TestAggregator_policies(t *testing.T) {
+	targets := []uint32{600, 3000, 3200, 3500, 4000, 4100, 4200, 4300, 4400, 4500}
+	tests := []struct {
+		name string
+		cfg  Config
+		want int
+	}{
+		{"min follows the slowest", Config{Policy: PolicyMin}, 600},
+		{"10th percentile is still the slowest of ten", Config{Policy: PolicyPercentile, Percentile: 0.1}, 600},
+		{"20th percentile ignores one outlier", Config{Policy: PolicyPercentile, Percentile: 0.2}, 3000},
+		{"median", Config{Policy: PolicyPercentile, Percentile: 0.5}, 4000},
+		{"tfmcc drops to the limiting receiver", Config{Policy: PolicyTFMCC}, 600},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var created []*stubController
+			clock := &fixedClock{now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+			a, err := New(tt.cfg, stubFactory(&created), limits(clock))
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			for i, target := range targets {
+				report(a, clock.now, uint32(i+1), 100, target) //nolint:gosec
+			}
+			if got := a.TargetBitrate(); got != tt.want {
+				t.Errorf("TargetBitrate() = %d, want %d", got, tt.want)
+			}
+			if got := a.State().Bitrate; got != tt.want {
+				t.Errorf("State().Bitrate = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAggregator_tfmcc(t *testing.T) {
+	var created []*stubController
+	clock := &fixedClock{now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	a, err := New(Config{Policy: PolicyTFMCC}, stubFactory(&created), limits(clock))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	report(a, clock.now, 1, 100, 2000)
+	report(a, clock.now, 2, 100, 3000)
+	if got := a.TargetBitrate(); got != 2000 {
+		t.Fatalf("TargetBitrate() = %d, want 2000", got)
+	}
+
+	// the limiting receiver recovers, the increase is paced at one packet per RTT per RTT
+	clock.now = clock.now.Add(100 * time.Millisecond)
+	report(a, clock.now, 1, 100, 6000)
+	if got := a.TargetBitrate(); got != 2095 {
+		t.Errorf("paced increase = %d, want 2095", got)
+	}
+	if r := a.(ReceiverLister).Receivers()[0]; !r.Limiting {
+		t.Error("receiver 1 should stay the limiting receiver")
+	}
+
+	// the second receiver asks for less than the sending rate and takes over
+	clock.now = clock.now.Add(100 * time.Millisecond)
+	report(a, clock.now, 2, 100, 1500)
+	if got := a.TargetBitrate(); got != 1500 {
+		t.Errorf("TargetBitrate() = %d, want 1500", got)
+	}
+	if r := a.(ReceiverLister).Receivers()[1]; !r.Limiting {
+		t.Error("receiver 2 should be the limiting receiver")
+	}
+}
+
+func TestAggregator_expire(t *testing.T) {
+	var created []*stubController
+	clock := &fixedClock{now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	a, err := New(Config{IdleTimeout: 10 * time.Second}, stubFactory(&created), limits(clock))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	lister := a.(ReceiverLister)
+
+	report(a, clock.now, 1, 100, 800)
+	report(a, clock.now, 2, 100, 3000)
+	report(a, clock.now, 3, 100, 3500)
+	if got := a.TargetBitrate(); got != 800 {
+		t.Fatalf("TargetBitrate() = %d, want 800", got)
+	}
+
+	// receiver 1 goes idle
+	clock.now = clock.now.Add(8 * time.Second)
+	report(a, clock.now, 2, 100, 3000)
+	report(a, clock.now, 3, 100, 3500)
+	clock.now = clock.now.Add(4 * time.Second)
+	if got := a.TargetBitrate(); got != 3000 {
+		t.Errorf("TargetBitrate() after idle = %d, want 3000", got)
+	}
+	if got := len(lister.Receivers()); got != 2 {
+		t.Errorf("got %d receivers, want 2", got)
+	}
+
+	// receiver 2 leaves with a BYE
+	a.OnRTCP(clock.now, &rtcp.Goodbye{Sources: []uint32{2}})
+	if got := a.TargetBitrate(); got != 3500 {
+		t.Errorf("TargetBitrate() after BYE = %d, want 3500", got)
+	}
+
+	// a receiver joining later starts from the current rate
+	a.OnRTCP(clock.now, &rtcp.TransportLayerCC{SenderSSRC: 4, MediaSSRC: 100})
+	if got := created[len(created)-1].target; got != 3500 {
+		t.Errorf("new receiver init bitrate = %d, want 3500", got)
+	}
+}
+
+func TestAggregator_routeFeedback(t *testing.T) {
+	var created []*stubController
+	clock := &fixedClock{now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	a, err := New(DefaultConfig(), stubFactory(&created), limits(clock))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	report(a, clock.now, 1, 100, 2000)
+
+	// feedback from an unknown receiver creates it
+	a.OnRTCP(clock.now, &rtcp.TransportLayerCC{SenderSSRC: 2, MediaSSRC: 100})
+	receivers := a.(ReceiverLister).Receivers()
+	if len(receivers) != 2 || receivers[1].Key != (ReceiverKey{2, 100}) {
+		t.Errorf("receivers = %+v, want receiver 2 added", receivers)
+	}
+
+	// extended reports are keyed by their sender and the first block source
+	a.OnRTCP(clock.now, &rtcp.ExtendedReport{
+		SenderSSRC: 3,
+		Reports:    []rtcp.ReportBlock{&rtcp.StatisticsSummaryReportBlock{SSRC: 100}},
+	})
+	receivers = a.(ReceiverLister).Receivers()
+	if len(receivers) != 3 || receivers[2].Key != (ReceiverKey{3, 100}) {
+		t.Errorf("receivers = %+v, want receiver 3 added", receivers)
+	}
+
+	// matched RFC 8888 feedback only reaches the receiver that sent it
+	a.(ratecontrol.PacketFeedbackConsumer).OnPacketFeedback(clock.now, ratecontrol.FeedbackReport{ReceiverSSRC: 2})
+	for i, want := range []int{0, 1, 0} {
+		if got := len(created[i].feedback); got != want {
+			t.Errorf("receiver %d got %d feedback reports, want %d", i+1, got, want)
+		}
+	}
+}
+
+func TestAggregator_tfrcReceivers(t *testing.T) {
+	clock := &fixedClock{now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	a, err := New(DefaultConfig(), tfrc.NewController, limits(clock))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	// the same SR reaches a near and a far receiver, each echoes it with its own delay
+	lsr := ratecontrol.NTPMiddle32(clock.now)
+	clock.now = clock.now.Add(time.Second)
+	for _, rx := range []struct {
+		ssrc uint32
+		rtt  time.Duration
+	}{{1, 20 * time.Millisecond}, {2, 200 * time.Millisecond}} {
+		dlsr := uint32((time.Second - rx.rtt).Seconds() * 65536)
+		a.OnRTCP(clock.now, &rtcp.ReceiverReport{
+			SSRC:    rx.ssrc,
+			Reports: []rtcp.ReceptionReport{{SSRC: 100, LastSenderReport: lsr, Delay: dlsr}},
+		})
+	}
+
+	receivers := a.(ReceiverLister).Receivers()
+	if len(receivers) != 2 {
+		t.Fatalf("got %d receivers, want 2", len(receivers))
+	}
+	near, far := receivers[0].State.RTTSample, receivers[1].State.RTTSample
+	if near < 0.015 || near > 0.025 {
+		t.Errorf("near receiver RTT = %.4f, want 0.02", near)
+	}
+	if far < 0.195 || far > 0.205 {
+		t.Errorf("far receiver RTT = %.4f, want 0.2", far)
+	}
+}
+
+func TestAggregator_lossEventRate(t *testing.T) {
+	var created []*stubController
+	clock := &fixedClock{now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	a, err := New(DefaultConfig(), stubFactory(&created), limits(clock))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	clock.now = clock.now.Add(time.Second)
+	for ssrc, fractionLost := range map[uint32]uint8{1: 0, 2: 64} {
+		a.OnRTCP(clock.now, &rtcp.ReceiverReport{
+			SSRC:    ssrc,
+			Reports: []rtcp.ReceptionReport{{SSRC: 100, FractionLost: fractionLost, Jitter: 1000}},
+		})
+	}
+
+	// FEC covers the receiver losing a quarter of the packets
+	if got := a.(ratecontrol.LossEstimator).LossEventRate(); got != 0.25 {
+		t.Errorf("LossEventRate() = %v, want 0.25", got)
+	}
+}
+
+func TestNew_invalidConfig(t *testing.T) {
+	var created []*stubController
+	for _, cfg := range []Config{{Percentile: 1.5}, {Percentile: -0.1}, {IdleTimeout: -time.Second}} {
+		if _, err := New(cfg, stubFactory(&created), limits(nil)); err == nil {
+			t.Errorf("New(%+v) succeeded, want an error", cfg)
+		}
+	}
+}
+
+func TestAggregator_state(t *testing.T) {
+	clock := &fixedClock{now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	saved, err := New(DefaultConfig(), tfrc.NewController, limits(clock))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	saved.(ratecontrol.ProbeConsumer).OnProbeResult(clock.now, 3000)
+	data, err := saved.(ratecontrol.StateSnapshotter).MarshalState()
+	if err != nil {
+		t.Fatalf("MarshalState() error = %v", err)
+	}
+
+	restored, err := New(DefaultConfig(), tfrc.NewController, limits(clock))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if err := restored.(ratecontrol.StateSnapshotter).UnmarshalState(data); err != nil {
+		t.Fatalf("UnmarshalState() error = %v", err)
+	}
+	if got := restored.State().Bitrate; got != 3000 {
+		t.Errorf("restored bitrate = %d, want 3000", got)
+	}
+
+	// controllers without state
+	var created []*stubController
+	stub, err := New(DefaultConfig(), stubFactory(&created), limits(clock))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if _, err := stub.(ratecontrol.StateSnapshotter).MarshalState(); !errors.Is(err, ratecontrol.ErrStateUnsupported) {
+		t.Errorf("MarshalState() error = %v, want ErrStateUnsupported", err)
+	}
+}
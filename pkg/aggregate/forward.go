@@ -0,0 +1,83 @@
+package aggregate
+
+import (
+	"time"
+
+	"github.com/arsperger/slowcast/pkg/ratecontrol"
+)
+
+var (
+	_ ratecontrol.PacketObserver = (*observingAggregator)(nil)
+	_ ratecontrol.SendLimiter    = (*limitingAggregator)(nil)
+)
+
+// observingAggregator aggregates controllers that observe the packets sent
+type observingAggregator struct {
+	*Aggregator
+}
+
+// OnPacketSent reports the packet to every receiver controller
+func (a *observingAggregator) OnPacketSent(pkt ratecontrol.SentPacket) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.forEach(func(c ratecontrol.RateController) {
+		if observer, ok := c.(ratecontrol.PacketObserver); ok {
+			observer.OnPacketSent(pkt)
+		}
+	})
+}
+
+// limitingAggregator aggregates window-based controllers, the one encode reaches every
+// receiver so a packet leaves only when it fits all the congestion windows
+type limitingAggregator struct {
+	*Aggregator
+}
+
+// OnPacketSent reports the packet to every receiver controller
+func (a *limitingAggregator) OnPacketSent(pkt ratecontrol.SentPacket) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.forEach(func(c ratecontrol.RateController) {
+		if limiter, ok := c.(ratecontrol.SendLimiter); ok {
+			limiter.OnPacketSent(pkt)
+		}
+	})
+}
+
+// OnPacketQueued reports the queued packet to every receiver controller
+func (a *limitingAggregator) OnPacketQueued(now time.Time, ssrc uint32, seq uint16, size int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.forEach(func(c ratecontrol.RateController) {
+		if limiter, ok := c.(ratecontrol.SendLimiter); ok {
+			limiter.OnPacketQueued(now, ssrc, seq, size)
+		}
+	})
+}
+
+// OnPacketDequeued reports the dequeued packet to every receiver controller, it is dropped
+// when any of them discards it
+func (a *limitingAggregator) OnPacketDequeued(now time.Time, ssrc uint32, seq uint16) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	keep := true
+	a.forEach(func(c ratecontrol.RateController) {
+		if limiter, ok := c.(ratecontrol.SendLimiter); ok && !limiter.OnPacketDequeued(now, ssrc, seq) {
+			keep = false
+		}
+	})
+	return keep
+}
+
+// CanSend is true when every receiver window has room, the spare decides until a receiver shows up
+func (a *limitingAggregator) CanSend(now time.Time) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	canSend := true
+	a.forEach(func(c ratecontrol.RateController) {
+		if limiter, ok := c.(ratecontrol.SendLimiter); ok && !limiter.CanSend(now) {
+			canSend = false
+		}
+	})
+	return canSend
+}
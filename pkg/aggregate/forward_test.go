@@ -0,0 +1,99 @@
+package aggregate
+
+import (
+	"testing"
+	"time"
+
+	"github.com/arsperger/slowcast/pkg/ratecontrol"
+)
+
+// stubLimiter is a stub window controller with a window of packets
+type stubLimiter struct {
+	stubController
+	sent   int
+	window int
+}
+
+func (s *stubLimiter) OnPacketSent(_ ratecontrol.SentPacket) { s.sent++ }
+
+func (s *stubLimiter) OnPacketQueued(_ time.Time, _ uint32, _ uint16, _ int) {}
+
+func (s *stubLimiter) OnPacketDequeued(_ time.Time, _ uint32, _ uint16) bool { return true }
+
+func (s *stubLimiter) CanSend(_ time.Time) bool { return s.sent < s.window }
+
+type stubObserver struct {
+	stubController
+	sent int
+}
+
+func (s *stubObserver) OnPacketSent(_ ratecontrol.SentPacket) { s.sent++ }
+
+func TestNew_forwardedInterfaces(t *testing.T) {
+	plain := func(cfg ratecontrol.Config) (ratecontrol.RateController, error) {
+		return &stubController{target: cfg.InitBitrate}, nil
+	}
+	observer := func(cfg ratecontrol.Config) (ratecontrol.RateController, error) {
+		return &stubObserver{stubController: stubController{target: cfg.InitBitrate}}, nil
+	}
+	limiter := func(cfg ratecontrol.Config) (ratecontrol.RateController, error) {
+		return &stubLimiter{stubController: stubController{target: cfg.InitBitrate}}, nil
+	}
+	tests := []struct {
+		name         string
+		factory      ratecontrol.Factory
+		wantObserver bool
+		wantLimiter  bool
+	}{
+		{"plain", plain, false, false},
+		{"observer", observer, true, false},
+		{"limiter", limiter, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := New(DefaultConfig(), tt.factory, limits(nil))
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			if _, ok := a.(ratecontrol.PacketObserver); ok != tt.wantObserver {
+				t.Errorf("PacketObserver = %v, want %v", ok, tt.wantObserver)
+			}
+			if _, ok := a.(ratecontrol.SendLimiter); ok != tt.wantLimiter {
+				t.Errorf("SendLimiter = %v, want %v", ok, tt.wantLimiter)
+			}
+		})
+	}
+}
+
+func TestLimitingAggregator_CanSend(t *testing.T) {
+	var created []*stubLimiter
+	factory := func(cfg ratecontrol.Config) (ratecontrol.RateController, error) {
+		// the first receiver has a window of 2 packets, the second of 4
+		s := &stubLimiter{stubController: stubController{target: cfg.InitBitrate}, window: 2 * (len(created) + 1)}
+		created = append(created, s)
+		return s, nil
+	}
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	a, err := New(DefaultConfig(), factory, limits(&fixedClock{now: now}))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	limiter, ok := a.(ratecontrol.SendLimiter)
+	if !ok {
+		t.Fatal("aggregator of window controllers is not a SendLimiter")
+	}
+
+	report(a, now, 1, 100, 1000)
+	report(a, now, 2, 100, 1000)
+	for i := range 3 {
+		if got, want := limiter.CanSend(now), i < 2; got != want {
+			t.Errorf("CanSend() after %d packets = %v, want %v", i, got, want)
+		}
+		limiter.OnPacketSent(ratecontrol.SentPacket{SendTime: now, Size: 1200})
+	}
+	for i, c := range created {
+		if c.sent != 3 {
+			t.Errorf("receiver %d saw %d packets, want 3", i, c.sent)
+		}
+	}
+}
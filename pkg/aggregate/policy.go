@@ -0,0 +1,45 @@
+package aggregate
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrUnknownPolicy is returned by ParsePolicy for an unsupported policy name
+var ErrUnknownPolicy = errors.New("unknown aggregation policy")
+
+// Policy picks the sending rate from the per-receiver targets
+type Policy int
+
+const (
+	// PolicyMin follows the slowest receiver
+	PolicyMin Policy = iota
+	// PolicyPercentile follows Config.Percentile of the receiver targets, ignoring the worst outliers
+	PolicyPercentile
+	// PolicyTFMCC follows an RFC 4654 style current limiting receiver with a paced increase
+	PolicyTFMCC
+)
+
+// String returns the configuration name of the policy
+func (p Policy) String() string {
+	switch p {
+	case PolicyMin:
+		return "min"
+	case PolicyPercentile:
+		return "percentile"
+	case PolicyTFMCC:
+		return "tfmcc"
+	default:
+		return fmt.Sprintf("policy(%d)", int(p))
+	}
+}
+
+// ParsePolicy parses min, percentile or tfmcc
+func ParsePolicy(s string) (Policy, error) {
+	for _, p := range []Policy{PolicyMin, PolicyPercentile, PolicyTFMCC} {
+		if p.String() == s {
+			return p, nil
+		}
+	}
+	return PolicyMin, fmt.Errorf("%w: %q", ErrUnknownPolicy, s)
+}
@@ -0,0 +1,40 @@
+package aggregate
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParsePolicy(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Policy
+		wantErr bool
+	}{
+		{"min", PolicyMin, false},
+		{"percentile", PolicyPercentile, false},
+		{"tfmcc", PolicyTFMCC, false},
+		{"max", PolicyMin, true},
+		{"", PolicyMin, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParsePolicy(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParsePolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrUnknownPolicy) {
+				t.Errorf("ParsePolicy() error = %v, want ErrUnknownPolicy", err)
+			}
+			if got != tt.want {
+				t.Errorf("ParsePolicy() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicy_String(t *testing.T) {
+	if got := Policy(7).String(); got != "policy(7)" {
+		t.Errorf("String() = %q, want policy(7)", got)
+	}
+}
@@ -0,0 +1,79 @@
+package circuitbreaker
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrUnknownAction is returned by ParseAction for an unsupported action name
+var ErrUnknownAction = errors.New("unknown circuit breaker action")
+
+// Action is what the sender does when a circuit breaker trips
+type Action int
+
+const (
+	// ActionNone only reports the trip
+	ActionNone Action = iota
+	// ActionPause stops sending media until the retry delay expires
+	ActionPause
+	// ActionMinRate drops the encoder to the minimum bitrate until the retry delay expires
+	ActionMinRate
+	// ActionStop stops the pipeline
+	ActionStop
+)
+
+// String returns the configuration name of the action
+func (a Action) String() string {
+	switch a {
+	case ActionNone:
+		return "none"
+	case ActionPause:
+		return "pause"
+	case ActionMinRate:
+		return "min-rate"
+	case ActionStop:
+		return "stop"
+	default:
+		return fmt.Sprintf("action(%d)", int(a))
+	}
+}
+
+// ParseAction parses none, pause, min-rate or stop
+func ParseAction(s string) (Action, error) {
+	for _, a := range []Action{ActionNone, ActionPause, ActionMinRate, ActionStop} {
+		if a.String() == s {
+			return a, nil
+		}
+	}
+	return ActionNone, fmt.Errorf("%w: %q", ErrUnknownAction, s)
+}
+
+// Breaker identifies one of the RFC 8083 circuit breakers
+type Breaker int
+
+const (
+	// MediaTimeout trips when reports show the receiver gets no new RTP packets
+	MediaTimeout Breaker = iota
+	// RTCPTimeout trips when no reception reports arrive at all
+	RTCPTimeout
+	// Congestion trips when the sending rate exceeds ten times the TFRC rate
+	Congestion
+	// MediaUsability trips when loss or RTT make the media unusable
+	MediaUsability
+)
+
+// String returns the log name of the breaker
+func (b Breaker) String() string {
+	switch b {
+	case MediaTimeout:
+		return "media_timeout"
+	case RTCPTimeout:
+		return "rtcp_timeout"
+	case Congestion:
+		return "congestion"
+	case MediaUsability:
+		return "media_usability"
+	default:
+		return fmt.Sprintf("breaker(%d)", int(b))
+	}
+}
@@ -0,0 +1,50 @@
+package circuitbreaker
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseAction(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Action
+		wantErr bool
+	}{
+		{"none", ActionNone, false},
+		{"pause", ActionPause, false},
+		{"min-rate", ActionMinRate, false},
+		{"stop", ActionStop, false},
+		{"halt", ActionNone, true},
+		{"", ActionNone, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseAction(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseAction() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrUnknownAction) {
+				t.Errorf("ParseAction() error = %v, want ErrUnknownAction", err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseAction() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBreaker_String(t *testing.T) {
+	want := map[Breaker]string{
+		MediaTimeout:   "media_timeout",
+		RTCPTimeout:    "rtcp_timeout",
+		Congestion:     "congestion",
+		MediaUsability: "media_usability",
+		Breaker(9):     "breaker(9)",
+	}
+	for b, s := range want {
+		if got := b.String(); got != s {
+			t.Errorf("Breaker(%d).String() = %q, want %q", int(b), got, s)
+		}
+	}
+}
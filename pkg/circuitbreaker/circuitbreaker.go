@@ -0,0 +1,335 @@
+// Package circuitbreaker implements the RTP/AVP circuit breakers of RFC 8083:
+// media timeout, RTCP timeout, congestion and media usability.
+package circuitbreaker
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/pion/rtcp"
+
+	"github.com/arsperger/slowcast/pkg/tfrc"
+)
+
+const (
+	// congestionFactor is the RFC 8083 4.3 margin over the TCP-friendly rate
+	congestionFactor = 10
+
+	// rtcpTimeoutIntervals is the RFC 3550 6.3.5 participant timeout in reporting intervals
+	rtcpTimeoutIntervals = 5
+
+	// reportIntervalAlpha smooths the observed receiver reporting interval Tdr
+	reportIntervalAlpha = 0.25
+
+	// maxWindow bounds the report history, CB_INTERVAL is normally a handful of reports
+	maxWindow = 64
+
+	// maxBackoffShift caps the retry delay at 16 times RetryDelay
+	maxBackoffShift = 4
+)
+
+// ErrInvalidConfig is returned by New for unusable parameters
+var ErrInvalidConfig = errors.New("invalid circuit breaker config")
+
+// Config selects the action of every breaker and the parameters of the RFC 8083 checks
+type Config struct {
+	MediaTimeoutAction Action
+	RTCPTimeoutAction  Action
+	CongestionAction   Action
+	UsabilityAction    Action
+
+	// RTCPInterval is the deterministic RTCP reporting interval Td
+	RTCPInterval time.Duration
+	// FrameInterval is the media framing interval Tf
+	FrameInterval time.Duration
+	// FramesPerPacket is the number of frames G sent in one packet group
+	FramesPerPacket int
+	// PacketSize is the mean RTP packet size in bytes used in the TFRC equation
+	PacketSize float64
+
+	// UsabilityMaxLoss is the mean fraction lost over CB_INTERVAL that makes the media unusable, 0 disables it
+	UsabilityMaxLoss float64
+	// UsabilityMaxRTT is the mean RTT over CB_INTERVAL that makes the media unusable, 0 disables it
+	UsabilityMaxRTT time.Duration
+
+	// RetryDelay is how long pause and min-rate are held, doubled on consecutive trips
+	RetryDelay time.Duration
+}
+
+// DefaultConfig pauses the media on the RFC 8083 breakers and drops to the minimum rate
+// when the media becomes unusable
+func DefaultConfig() Config {
+	return Config{
+		MediaTimeoutAction: ActionPause,
+		RTCPTimeoutAction:  ActionPause,
+		CongestionAction:   ActionPause,
+		UsabilityAction:    ActionMinRate,
+		RTCPInterval:       5 * time.Second,
+		FrameInterval:      time.Second / 30,
+		FramesPerPacket:    1,
+		PacketSize:         1200,
+		UsabilityMaxLoss:   0.3,
+		RetryDelay:         10 * time.Second,
+	}
+}
+
+// Trip describes a tripped circuit breaker
+type Trip struct {
+	Breaker Breaker
+	Action  Action
+	Reason  string
+	// Key is the receiver and media stream of a Group breaker, zero for the RTCP timeout
+	Key Key
+	// RetryAfter is how long pause and min-rate should be held before Reset
+	RetryAfter time.Duration
+}
+
+// report is one reception report in the CB_INTERVAL window
+type report struct {
+	fraction    float64
+	rtt         float64
+	sendingKbps float64
+}
+
+// CircuitBreaker evaluates the RFC 8083 circuit breakers on every reception report
+type CircuitBreaker struct {
+	mu  sync.Mutex
+	cfg Config
+
+	tripped          bool
+	consecutiveTrips int
+	healthyReports   int
+
+	lastRTCP   time.Time
+	lastReport time.Time
+	// reportInterval is the observed receiver reporting interval Tdr in seconds
+	reportInterval float64
+	lastRTT        float64
+
+	seenSeq        bool
+	highestSeq     uint32
+	stalledReports int
+
+	window []report
+}
+
+// New creates a circuit breaker, the RTCP timeout starts counting at now
+func New(cfg Config, now time.Time) (*CircuitBreaker, error) {
+	switch {
+	case cfg.RTCPInterval <= 0 || cfg.FrameInterval <= 0 || cfg.RetryDelay <= 0:
+		return nil, fmt.Errorf("%w: intervals must be positive", ErrInvalidConfig)
+	case cfg.FramesPerPacket < 1:
+		return nil, fmt.Errorf("%w: frames per packet %d", ErrInvalidConfig, cfg.FramesPerPacket)
+	case cfg.PacketSize <= 0:
+		return nil, fmt.Errorf("%w: packet size %.0f", ErrInvalidConfig, cfg.PacketSize)
+	case cfg.UsabilityMaxLoss < 0 || cfg.UsabilityMaxLoss > 1:
+		return nil, fmt.Errorf("%w: usability max loss %.2f", ErrInvalidConfig, cfg.UsabilityMaxLoss)
+	}
+	return &CircuitBreaker{
+		cfg:            cfg,
+		lastRTCP:       now,
+		reportInterval: cfg.RTCPInterval.Seconds(),
+	}, nil
+}
+
+// Interval returns CB_INTERVAL, the number of reports the congestion and media checks span
+func (cb *CircuitBreaker) Interval() int {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.interval()
+}
+
+// interval computes CB_INTERVAL as per RFC 8083 4.3:
+// ceil(3*min(max(10*G*Tf, 10*Tr, 3*Tdr), max(15, 3*Td))/(3*Tdr))
+func (cb *CircuitBreaker) interval() int {
+	g := float64(cb.cfg.FramesPerPacket)
+	tf := cb.cfg.FrameInterval.Seconds()
+	td := cb.cfg.RTCPInterval.Seconds()
+	tdr := cb.reportInterval
+	span := 3 * min(max(10*g*tf, 10*cb.lastRTT, 3*tdr), max(15, 3*td))
+	return max(1, int(math.Ceil(span/(3*tdr))))
+}
+
+// Tripped reports whether a breaker holds pause or min-rate
+func (cb *CircuitBreaker) Tripped() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.tripped
+}
+
+// Reset lifts a held trip, the checks start over from now
+func (cb *CircuitBreaker) Reset(now time.Time) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.tripped = false
+	cb.lastRTCP = now
+	cb.lastReport = time.Time{}
+	cb.clear()
+}
+
+// heard restarts the RTCP timeout at now
+func (cb *CircuitBreaker) heard(now time.Time) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.lastRTCP = now
+}
+
+// clear drops the report history after a trip or a reset
+func (cb *CircuitBreaker) clear() {
+	cb.seenSeq = false
+	cb.stalledReports = 0
+	cb.healthyReports = 0
+	cb.window = nil
+}
+
+// OnReport evaluates a reception report block for the media sent at sendingKbps,
+// rtt is the RTT sample in seconds and 0 when unknown
+func (cb *CircuitBreaker) OnReport(now time.Time, block rtcp.ReceptionReport, rtt float64, sendingKbps int) *Trip {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if cb.tripped {
+		return nil
+	}
+
+	if !cb.lastReport.IsZero() {
+		if d := now.Sub(cb.lastReport).Seconds(); d > 0 {
+			cb.reportInterval = (1-reportIntervalAlpha)*cb.reportInterval + reportIntervalAlpha*d
+		}
+	}
+	cb.lastReport = now
+	cb.lastRTCP = now
+	if rtt > 0 {
+		cb.lastRTT = rtt
+	}
+
+	cb.window = append(cb.window, report{
+		fraction:    float64(block.FractionLost) / 256.0,
+		rtt:         rtt,
+		sendingKbps: float64(sendingKbps),
+	})
+	if len(cb.window) > maxWindow {
+		cb.window = cb.window[len(cb.window)-maxWindow:]
+	}
+	n := cb.interval()
+
+	// Media timeout: the extended highest sequence number stops increasing
+	if cb.seenSeq && block.LastSequenceNumber <= cb.highestSeq {
+		cb.stalledReports++
+	} else {
+		cb.stalledReports = 0
+		cb.highestSeq = block.LastSequenceNumber
+	}
+	cb.seenSeq = true
+	if cb.stalledReports >= n {
+		return cb.trip(MediaTimeout, fmt.Sprintf("extended highest sequence number %d did not increase over %d reports",
+			cb.highestSeq, cb.stalledReports))
+	}
+
+	if len(cb.window) < n {
+		return nil
+	}
+	m := cb.mean(n)
+	p, meanRTT, sending := m.fraction, m.rtt, m.sendingKbps
+
+	// Congestion: sending more than ten times the TCP-friendly rate over CB_INTERVAL
+	if p > 0 && meanRTT > 0 {
+		tfrcKbps := tfrc.Throughput(cb.cfg.PacketSize, meanRTT, p) * 8 / 1000
+		if sending > congestionFactor*tfrcKbps {
+			return cb.trip(Congestion, fmt.Sprintf("sending %.0f Kbps above %d times the TFRC rate %.0f Kbps (p=%.4f, rtt=%.3fs)",
+				sending, congestionFactor, tfrcKbps, p, meanRTT))
+		}
+	}
+
+	// Media usability
+	if cb.cfg.UsabilityMaxLoss > 0 && p > cb.cfg.UsabilityMaxLoss {
+		return cb.trip(MediaUsability, fmt.Sprintf("mean loss %.4f above %.4f over %d reports", p, cb.cfg.UsabilityMaxLoss, n))
+	}
+	if cb.cfg.UsabilityMaxRTT > 0 && meanRTT > cb.cfg.UsabilityMaxRTT.Seconds() {
+		return cb.trip(MediaUsability, fmt.Sprintf("mean RTT %.3fs above %v over %d reports", meanRTT, cb.cfg.UsabilityMaxRTT, n))
+	}
+
+	// a full healthy CB_INTERVAL ends the retry backoff
+	cb.healthyReports++
+	if cb.healthyReports >= n {
+		cb.consecutiveTrips = 0
+	}
+	return nil
+}
+
+// mean averages the last n reports, the RTT over the reports that carried one
+func (cb *CircuitBreaker) mean(n int) report {
+	var m report
+	rttSamples := 0
+	for _, r := range cb.window[len(cb.window)-n:] {
+		m.fraction += r.fraction
+		m.sendingKbps += r.sendingKbps
+		if r.rtt > 0 {
+			m.rtt += r.rtt
+			rttSamples++
+		}
+	}
+	if rttSamples > 0 {
+		m.rtt /= float64(rttSamples)
+	}
+	m.fraction /= float64(n)
+	m.sendingKbps /= float64(n)
+	return m
+}
+
+// Check evaluates the RTCP timeout, it is called periodically between reports
+func (cb *CircuitBreaker) Check(now time.Time) *Trip {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if cb.tripped {
+		return nil
+	}
+	if silence := now.Sub(cb.lastRTCP); silence > cb.rtcpTimeout() {
+		cb.lastRTCP = now
+		return cb.trip(RTCPTimeout, fmt.Sprintf("no reception report for %v", silence.Round(time.Millisecond)))
+	}
+	return nil
+}
+
+// rtcpTimeout is the RFC 3550 participant timeout of five reporting intervals
+func (cb *CircuitBreaker) rtcpTimeout() time.Duration {
+	return time.Duration(rtcpTimeoutIntervals * max(cb.cfg.RTCPInterval.Seconds(), cb.reportInterval) * float64(time.Second))
+}
+
+// timedOut reports whether no reception report arrived for the RTCP timeout
+func (cb *CircuitBreaker) timedOut(now time.Time) bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return now.Sub(cb.lastRTCP) > cb.rtcpTimeout()
+}
+
+// trip records a trip of breaker b, pause and min-rate are held until Reset
+func (cb *CircuitBreaker) trip(b Breaker, reason string) *Trip {
+	action := cb.action(b)
+	cb.clear()
+	t := &Trip{Breaker: b, Action: action, Reason: reason}
+	if action == ActionPause || action == ActionMinRate {
+		cb.tripped = true
+		t.RetryAfter = cb.cfg.RetryDelay << min(cb.consecutiveTrips, maxBackoffShift)
+		cb.consecutiveTrips++
+	}
+	return t
+}
+
+// action returns the configured action of breaker b
+func (cb *CircuitBreaker) action(b Breaker) Action {
+	switch b {
+	case MediaTimeout:
+		return cb.cfg.MediaTimeoutAction
+	case RTCPTimeout:
+		return cb.cfg.RTCPTimeoutAction
+	case Congestion:
+		return cb.cfg.CongestionAction
+	case MediaUsability:
+		return cb.cfg.UsabilityAction
+	default:
+		return ActionNone
+	}
+}
@@ -0,0 +1,215 @@
+package circuitbreaker
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pion/rtcp"
+)
+
+var start = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC) //nolint:gochecknoglobals
+
+func newBreaker(t *testing.T, cfg Config) *CircuitBreaker {
+	t.Helper()
+	cb, err := New(cfg, start)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	return cb
+}
+
+// feed sends n reports one RTCP interval apart, returning the first trip
+func feed(cb *CircuitBreaker, from time.Time, n int, seq *uint32, seqStep uint32, fractionLost uint8, rtt float64, sendingKbps int) (*Trip, time.Time) {
+	now := from
+	for range n {
+		now = now.Add(5 * time.Second)
+		*seq += seqStep
+		block := rtcp.ReceptionReport{FractionLost: fractionLost, LastSequenceNumber: *seq}
+		if trip := cb.OnReport(now, block, rtt, sendingKbps); trip != nil {
+			return trip, now
+		}
+	}
+	return nil, now
+}
+
+func TestNew_InvalidConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*Config)
+	}{
+		{"no rtcp interval", func(c *Config) { c.RTCPInterval = 0 }},
+		{"no frame interval", func(c *Config) { c.FrameInterval = 0 }},
+		{"no retry delay", func(c *Config) { c.RetryDelay = 0 }},
+		{"no frames per packet", func(c *Config) { c.FramesPerPacket = 0 }},
+		{"no packet size", func(c *Config) { c.PacketSize = 0 }},
+		{"loss above one", func(c *Config) { c.UsabilityMaxLoss = 1.5 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			tt.modify(&cfg)
+			if _, err := New(cfg, start); !errors.Is(err, ErrInvalidConfig) {
+				t.Errorf("New() error = %v, want ErrInvalidConfig", err)
+			}
+		})
+	}
+}
+
+func TestCircuitBreaker_Interval(t *testing.T) {
+	cb := newBreaker(t, DefaultConfig())
+	// Td = Tdr = 5s: ceil(3*min(max(0.33, 0, 15), max(15, 15))/15) = 3
+	if got := cb.Interval(); got != 3 {
+		t.Errorf("Interval() = %d, want 3", got)
+	}
+
+	// receiver reporting every second: ceil(3*min(max(0.33, 1, 3), 15)/3) = 3
+	cb.reportInterval = 1
+	if got := cb.Interval(); got != 3 {
+		t.Errorf("Interval() = %d, want 3", got)
+	}
+
+	// long RTT dominates: ceil(3*min(max(0.33, 20, 3), 15)/3) = 15
+	cb.lastRTT = 2
+	if got := cb.Interval(); got != 15 {
+		t.Errorf("Interval() = %d, want 15", got)
+	}
+}
+
+func TestCircuitBreaker_Healthy(t *testing.T) {
+	cb := newBreaker(t, DefaultConfig())
+	var seq uint32
+	if trip, _ := feed(cb, start, 50, &seq, 100, 2, 0.05, 2000); trip != nil {
+		t.Errorf("healthy session tripped: %+v", trip)
+	}
+	if cb.Tripped() {
+		t.Error("Tripped() = true for a healthy session")
+	}
+}
+
+func TestCircuitBreaker_MediaTimeout(t *testing.T) {
+	cb := newBreaker(t, DefaultConfig())
+	var seq uint32
+	_, now := feed(cb, start, 3, &seq, 100, 0, 0.05, 1000)
+
+	trip, _ := feed(cb, now, 10, &seq, 0, 0, 0.05, 1000)
+	if trip == nil || trip.Breaker != MediaTimeout {
+		t.Fatalf("trip = %+v, want media timeout", trip)
+	}
+	if trip.Action != ActionPause || trip.RetryAfter != 10*time.Second {
+		t.Errorf("trip action = %v retry %v, want pause 10s", trip.Action, trip.RetryAfter)
+	}
+	if !cb.Tripped() {
+		t.Error("Tripped() = false after a pause trip")
+	}
+}
+
+func TestCircuitBreaker_RTCPTimeout(t *testing.T) {
+	cb := newBreaker(t, DefaultConfig())
+	if trip := cb.Check(start.Add(25 * time.Second)); trip != nil {
+		t.Errorf("Check() tripped at the timeout boundary: %+v", trip)
+	}
+	trip := cb.Check(start.Add(26 * time.Second))
+	if trip == nil || trip.Breaker != RTCPTimeout {
+		t.Fatalf("Check() = %+v, want RTCP timeout", trip)
+	}
+
+	// held until reset
+	if trip := cb.Check(start.Add(time.Minute)); trip != nil {
+		t.Errorf("Check() tripped while held: %+v", trip)
+	}
+	cb.Reset(start.Add(time.Minute))
+	if trip := cb.Check(start.Add(time.Minute + 10*time.Second)); trip != nil {
+		t.Errorf("Check() tripped right after Reset: %+v", trip)
+	}
+}
+
+func TestCircuitBreaker_Congestion(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.UsabilityMaxLoss = 0
+	cb := newBreaker(t, cfg)
+	var seq uint32
+
+	// 5% loss at 100ms RTT allows ~350 Kbps, 3000 Kbps stays below ten times that
+	if trip, _ := feed(cb, start, 10, &seq, 100, 13, 0.1, 3000); trip != nil {
+		t.Fatalf("tripped below the congestion limit: %+v", trip)
+	}
+	trip, _ := feed(cb, start.Add(time.Minute), 10, &seq, 100, 13, 0.1, 4000)
+	if trip == nil || trip.Breaker != Congestion {
+		t.Fatalf("trip = %+v, want congestion", trip)
+	}
+}
+
+func TestCircuitBreaker_MediaUsability(t *testing.T) {
+	tests := []struct {
+		name         string
+		maxRTT       time.Duration
+		fractionLost uint8
+		rtt          float64
+	}{
+		{"loss", 0, 100, 0.05},
+		{"rtt", time.Second, 0, 1.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.CongestionAction = ActionNone
+			cfg.UsabilityMaxRTT = tt.maxRTT
+			cb := newBreaker(t, cfg)
+			var seq uint32
+			trip, _ := feed(cb, start, 20, &seq, 100, tt.fractionLost, tt.rtt, 100)
+			if trip == nil || trip.Breaker != MediaUsability {
+				t.Fatalf("trip = %+v, want media usability", trip)
+			}
+			if trip.Action != ActionMinRate {
+				t.Errorf("trip action = %v, want min-rate", trip.Action)
+			}
+		})
+	}
+}
+
+func TestCircuitBreaker_Backoff(t *testing.T) {
+	cb := newBreaker(t, DefaultConfig())
+	now := start
+	want := []time.Duration{10 * time.Second, 20 * time.Second, 40 * time.Second, 80 * time.Second, 160 * time.Second, 160 * time.Second}
+	for i, w := range want {
+		now = now.Add(time.Minute)
+		trip := cb.Check(now)
+		if trip == nil {
+			t.Fatalf("trip %d missing", i)
+		}
+		if trip.RetryAfter != w {
+			t.Errorf("trip %d RetryAfter = %v, want %v", i, trip.RetryAfter, w)
+		}
+		cb.Reset(now)
+	}
+
+	// a healthy CB_INTERVAL after the window refills ends the backoff
+	var seq uint32
+	_, now = feed(cb, now, 6, &seq, 100, 0, 0.05, 1000)
+	if trip := cb.Check(now.Add(time.Minute)); trip == nil || trip.RetryAfter != 10*time.Second {
+		t.Errorf("trip after recovery = %+v, want RetryAfter 10s", trip)
+	}
+}
+
+func TestCircuitBreaker_ActionNoneAndStop(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.RTCPTimeoutAction = ActionNone
+	cb := newBreaker(t, cfg)
+	trip := cb.Check(start.Add(time.Minute))
+	if trip == nil || trip.Action != ActionNone || trip.RetryAfter != 0 {
+		t.Fatalf("trip = %+v, want an unheld none trip", trip)
+	}
+	if cb.Tripped() {
+		t.Error("Tripped() = true for action none")
+	}
+	if trip := cb.Check(start.Add(time.Minute + time.Second)); trip != nil {
+		t.Errorf("none trip repeated immediately: %+v", trip)
+	}
+
+	cfg.RTCPTimeoutAction = ActionStop
+	cb = newBreaker(t, cfg)
+	if trip := cb.Check(start.Add(time.Minute)); trip == nil || trip.Action != ActionStop {
+		t.Errorf("trip = %+v, want stop", trip)
+	}
+}
@@ -0,0 +1,130 @@
+package circuitbreaker
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pion/rtcp"
+)
+
+// Key identifies the reports of one receiver about one media stream
+type Key struct {
+	ReceiverSSRC uint32
+	MediaSSRC    uint32
+}
+
+// Group keeps one circuit breaker per receiver and media stream, a trip of any of them
+// holds all of them until Reset
+type Group struct {
+	mu  sync.Mutex
+	cfg Config
+
+	breakers map[Key]*CircuitBreaker
+	// idle hears every report and times out the RTCP of the whole session
+	idle *CircuitBreaker
+}
+
+// NewGroup creates an empty group, the RTCP timeout starts counting at now
+func NewGroup(cfg Config, now time.Time) (*Group, error) {
+	idle, err := New(cfg, now)
+	if err != nil {
+		return nil, err
+	}
+	return &Group{
+		cfg:      cfg,
+		breakers: make(map[Key]*CircuitBreaker),
+		idle:     idle,
+	}, nil
+}
+
+// OnReport evaluates a reception report block on the breaker of key, creating it on the first report
+func (g *Group) OnReport(now time.Time, key Key, block rtcp.ReceptionReport, rtt float64, sendingKbps int) *Trip {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.tripped() {
+		return nil
+	}
+	g.idle.heard(now)
+
+	cb, ok := g.breakers[key]
+	if !ok {
+		var err error
+		if cb, err = New(g.cfg, now); err != nil {
+			return nil
+		}
+		g.breakers[key] = cb
+	}
+	trip := cb.OnReport(now, block, rtt, sendingKbps)
+	if trip != nil {
+		trip.Key = key
+	}
+	return trip
+}
+
+// Check evaluates the RTCP timeout, it is called periodically between reports. A receiver
+// silent for the RTCP timeout left the session like an RFC 3550 participant and its breaker is
+// dropped, the RTCP timeout trips only when no receiver reports at all
+func (g *Group) Check(now time.Time) *Trip {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.tripped() {
+		return nil
+	}
+	for key, cb := range g.breakers {
+		if cb.timedOut(now) {
+			delete(g.breakers, key)
+		}
+	}
+	return g.idle.Check(now)
+}
+
+// Retain drops the breakers of the receivers not in keys, the ones that left the session
+func (g *Group) Retain(keys []Key) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	live := make(map[Key]bool, len(keys))
+	for _, key := range keys {
+		live[key] = true
+	}
+	for key := range g.breakers {
+		if !live[key] {
+			delete(g.breakers, key)
+		}
+	}
+}
+
+// Len returns the number of breakers
+func (g *Group) Len() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return len(g.breakers)
+}
+
+// Tripped reports whether a breaker holds pause or min-rate
+func (g *Group) Tripped() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.tripped()
+}
+
+func (g *Group) tripped() bool {
+	if g.idle.Tripped() {
+		return true
+	}
+	for _, cb := range g.breakers {
+		if cb.Tripped() {
+			return true
+		}
+	}
+	return false
+}
+
+// Reset lifts a held trip, the checks of every breaker start over from now
+func (g *Group) Reset(now time.Time) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.idle.Reset(now)
+	for _, cb := range g.breakers {
+		cb.Reset(now)
+	}
+}
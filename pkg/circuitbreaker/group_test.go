@@ -0,0 +1,120 @@
+package circuitbreaker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pion/rtcp"
+)
+
+func newGroup(t *testing.T) *Group {
+	t.Helper()
+	g, err := NewGroup(DefaultConfig(), start)
+	if err != nil {
+		t.Fatalf("NewGroup() error = %v", err)
+	}
+	return g
+}
+
+func TestGroup_PerReceiver(t *testing.T) {
+	g := newGroup(t)
+	healthy := Key{ReceiverSSRC: 1, MediaSSRC: 10}
+	stalled := Key{ReceiverSSRC: 2, MediaSSRC: 10}
+
+	// one receiver keeps getting media while the other one stalls, interleaved reports
+	// of both would look healthy to a single breaker
+	now := start
+	var trip *Trip
+	for i := range 10 {
+		now = now.Add(5 * time.Second)
+		seq := uint32(100 * (i + 1)) //nolint:gosec
+		if trip = g.OnReport(now, healthy, rtcp.ReceptionReport{LastSequenceNumber: seq}, 0.05, 1000); trip != nil {
+			break
+		}
+		if trip = g.OnReport(now, stalled, rtcp.ReceptionReport{LastSequenceNumber: 100}, 0.05, 1000); trip != nil {
+			break
+		}
+	}
+	if trip == nil || trip.Breaker != MediaTimeout || trip.Key != stalled {
+		t.Fatalf("trip = %+v, want a media timeout of %+v", trip, stalled)
+	}
+	if !g.Tripped() {
+		t.Error("Tripped() = false after a pause trip")
+	}
+	if trip := g.OnReport(now.Add(5*time.Second), healthy, rtcp.ReceptionReport{LastSequenceNumber: 5000}, 0.05, 1000); trip != nil {
+		t.Errorf("OnReport() tripped while held: %+v", trip)
+	}
+
+	g.Reset(now.Add(10 * time.Second))
+	if g.Tripped() {
+		t.Error("Tripped() = true after Reset")
+	}
+}
+
+func TestGroup_Retain(t *testing.T) {
+	g := newGroup(t)
+	a := Key{ReceiverSSRC: 1, MediaSSRC: 10}
+	b := Key{ReceiverSSRC: 2, MediaSSRC: 10}
+	now := start.Add(5 * time.Second)
+	g.OnReport(now, a, rtcp.ReceptionReport{LastSequenceNumber: 100}, 0.05, 1000)
+	g.OnReport(now, b, rtcp.ReceptionReport{LastSequenceNumber: 100}, 0.05, 1000)
+	if g.Len() != 2 {
+		t.Fatalf("Len() = %d, want 2", g.Len())
+	}
+
+	// b left the session, its silence must not trip the RTCP timeout
+	g.Retain([]Key{a})
+	if g.Len() != 1 {
+		t.Fatalf("Len() after Retain = %d, want 1", g.Len())
+	}
+	for i := range 6 {
+		now = now.Add(5 * time.Second)
+		g.OnReport(now, a, rtcp.ReceptionReport{LastSequenceNumber: uint32(200 + 100*i)}, 0.05, 1000) //nolint:gosec
+		if trip := g.Check(now); trip != nil {
+			t.Fatalf("Check() = %+v, want no trip while a reports", trip)
+		}
+	}
+}
+
+func TestGroup_RTCPTimeout(t *testing.T) {
+	t.Run("before any report", func(t *testing.T) {
+		g := newGroup(t)
+		trip := g.Check(start.Add(26 * time.Second))
+		if trip == nil || trip.Breaker != RTCPTimeout || trip.Key != (Key{}) {
+			t.Fatalf("Check() = %+v, want RTCP timeout without a key", trip)
+		}
+	})
+
+	t.Run("every receiver silent", func(t *testing.T) {
+		g := newGroup(t)
+		key := Key{ReceiverSSRC: 1, MediaSSRC: 10}
+		g.OnReport(start, key, rtcp.ReceptionReport{LastSequenceNumber: 100}, 0.05, 1000)
+		trip := g.Check(start.Add(26 * time.Second))
+		if trip == nil || trip.Breaker != RTCPTimeout {
+			t.Fatalf("Check() = %+v, want RTCP timeout", trip)
+		}
+	})
+}
+
+func TestGroup_SilentReceiverLeaves(t *testing.T) {
+	g := newGroup(t)
+	staying := Key{ReceiverSSRC: 1, MediaSSRC: 10}
+	leaving := Key{ReceiverSSRC: 2, MediaSSRC: 10}
+	g.OnReport(start, staying, rtcp.ReceptionReport{LastSequenceNumber: 100}, 0.05, 1000)
+	g.OnReport(start, leaving, rtcp.ReceptionReport{LastSequenceNumber: 100}, 0.05, 1000)
+
+	// leaving stops reporting without a BYE, checked every second like the sender does
+	now := start
+	for i := range 60 {
+		now = now.Add(time.Second)
+		if i%5 == 4 {
+			g.OnReport(now, staying, rtcp.ReceptionReport{LastSequenceNumber: uint32(200 + 100*i)}, 0.05, 1000) //nolint:gosec
+		}
+		if trip := g.Check(now); trip != nil {
+			t.Fatalf("Check() = %+v at %v, want no trip while a receiver reports", trip, now.Sub(start))
+		}
+	}
+	if g.Len() != 1 {
+		t.Errorf("Len() = %d, want the silent receiver dropped", g.Len())
+	}
+}
@@ -0,0 +1,167 @@
+// Package encoder describes the GStreamer video encoders slowcast can drive: the encoder element,
+// its RTP payloader and encoding name, and the property taking the target bitrate with its unit and
+// type. The controllers work in Kbps, a backend translates that into the value its element expects
+// and tells whether the element accepts a new bitrate while playing.
+package encoder
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrUnknownBackend is returned by ParseBackend for an unsupported encoder name
+var ErrUnknownBackend = errors.New("unknown encoder")
+
+// Backend is a GStreamer encoder and its payloader
+type Backend struct {
+	// Name is the configuration name of the backend
+	Name string
+	// Element is the encoder factory and Properties its low latency settings, in gst-launch syntax
+	Element    string
+	Properties map[string]string
+	// Payloader is the RTP payloader factory and PayloaderProperties its settings
+	Payloader           string
+	PayloaderProperties map[string]string
+	// EncodingName is the RTP encoding name of the payloaded stream
+	EncodingName string
+	// BitrateProperty takes the target bitrate, in bits per second when BitsPerSecond is set and
+	// in Kbps otherwise, as a gint when Signed is set and as a guint otherwise
+	BitrateProperty string
+	BitsPerSecond   bool
+	Signed          bool
+	// Runtime is set when the element applies a bitrate set while playing, the others only read
+	// it when they are configured for new caps
+	Runtime bool
+}
+
+// backends are the supported encoders, the first one is the default
+var backends = []Backend{
+	{
+		Name:                "x264",
+		Element:             "x264enc",
+		Properties:          map[string]string{"tune": "zerolatency"},
+		Payloader:           "rtph264pay",
+		PayloaderProperties: map[string]string{"config-interval": "1"},
+		EncodingName:        "H264",
+		BitrateProperty:     "bitrate",
+		Runtime:             true,
+	},
+	{
+		Name:                "openh264",
+		Element:             "openh264enc",
+		Properties:          map[string]string{"rate-control": "bitrate", "complexity": "low"},
+		Payloader:           "rtph264pay",
+		PayloaderProperties: map[string]string{"config-interval": "1"},
+		EncodingName:        "H264",
+		BitrateProperty:     "bitrate",
+		BitsPerSecond:       true,
+		Runtime:             true,
+	},
+	{
+		Name:                "x265",
+		Element:             "x265enc",
+		Properties:          map[string]string{"tune": "zerolatency", "speed-preset": "ultrafast"},
+		Payloader:           "rtph265pay",
+		PayloaderProperties: map[string]string{"config-interval": "1"},
+		EncodingName:        "H265",
+		BitrateProperty:     "bitrate",
+		Runtime:             true,
+	},
+	{
+		Name:            "vp8",
+		Element:         "vp8enc",
+		Properties:      map[string]string{"deadline": "1", "end-usage": "cbr", "lag-in-frames": "0"},
+		Payloader:       "rtpvp8pay",
+		EncodingName:    "VP8",
+		BitrateProperty: "target-bitrate",
+		BitsPerSecond:   true,
+		Signed:          true,
+		Runtime:         true,
+	},
+	{
+		Name:            "vp9",
+		Element:         "vp9enc",
+		Properties:      map[string]string{"deadline": "1", "end-usage": "cbr", "lag-in-frames": "0"},
+		Payloader:       "rtpvp9pay",
+		EncodingName:    "VP9",
+		BitrateProperty: "target-bitrate",
+		BitsPerSecond:   true,
+		Signed:          true,
+		Runtime:         true,
+	},
+	{
+		Name:            "svtav1",
+		Element:         "svtav1enc",
+		Properties:      map[string]string{"preset": "10"},
+		Payloader:       "rtpav1pay",
+		EncodingName:    "AV1",
+		BitrateProperty: "target-bitrate",
+	},
+	{
+		Name:            "rav1e",
+		Element:         "rav1enc",
+		Properties:      map[string]string{"speed-preset": "10", "low-latency": "true"},
+		Payloader:       "rtpav1pay",
+		EncodingName:    "AV1",
+		BitrateProperty: "bitrate",
+		BitsPerSecond:   true,
+		Signed:          true,
+	},
+}
+
+// Names returns the configuration names of the supported encoders
+func Names() []string {
+	names := make([]string, 0, len(backends))
+	for _, b := range backends {
+		names = append(names, b.Name)
+	}
+	return names
+}
+
+// DefaultBackend returns the x264 backend
+func DefaultBackend() Backend {
+	return backends[0]
+}
+
+// ParseBackend returns the backend of an encoder name
+func ParseBackend(name string) (Backend, error) {
+	for _, b := range backends {
+		if b.Name == name {
+			return b, nil
+		}
+	}
+	return DefaultBackend(), fmt.Errorf("%w: %q", ErrUnknownBackend, name)
+}
+
+// BitrateValue returns kbps in the unit and type of the bitrate property
+//
+//nolint:gosec
+func (b Backend) BitrateValue(kbps int) interface{} {
+	value := max(kbps, 0)
+	if b.BitsPerSecond {
+		value *= 1000
+	}
+	if b.Signed {
+		return value
+	}
+	return uint(value)
+}
+
+// Kbps converts a bitrate property value back to Kbps
+//
+//nolint:gosec
+func (b Backend) Kbps(value interface{}) (int, bool) {
+	var v int
+	switch n := value.(type) {
+	case int:
+		v = n
+	case uint:
+		v = int(n)
+	default:
+		return 0, false
+	}
+	if b.BitsPerSecond {
+		v /= 1000
+	}
+	return v, true
+}
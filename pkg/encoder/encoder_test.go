@@ -0,0 +1,100 @@
+package encoder
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseBackend(t *testing.T) {
+	tests := []struct {
+		in            string
+		wantElement   string
+		wantPayloader string
+		wantErr       bool
+	}{
+		{"x264", "x264enc", "rtph264pay", false},
+		{"openh264", "openh264enc", "rtph264pay", false},
+		{"x265", "x265enc", "rtph265pay", false},
+		{"vp8", "vp8enc", "rtpvp8pay", false},
+		{"vp9", "vp9enc", "rtpvp9pay", false},
+		{"svtav1", "svtav1enc", "rtpav1pay", false},
+		{"rav1e", "rav1enc", "rtpav1pay", false},
+		{"h264", "x264enc", "rtph264pay", true},
+		{"", "x264enc", "rtph264pay", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseBackend(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseBackend() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrUnknownBackend) {
+				t.Errorf("ParseBackend() error = %v, want ErrUnknownBackend", err)
+			}
+			if got.Element != tt.wantElement || got.Payloader != tt.wantPayloader {
+				t.Errorf("ParseBackend() = %s/%s, want %s/%s", got.Element, got.Payloader, tt.wantElement, tt.wantPayloader)
+			}
+		})
+	}
+}
+
+func TestNames(t *testing.T) {
+	names := Names()
+	if len(names) != len(backends) || names[0] != DefaultBackend().Name {
+		t.Fatalf("Names() = %v", names)
+	}
+	for _, name := range names {
+		if _, err := ParseBackend(name); err != nil {
+			t.Errorf("ParseBackend(%q) error = %v", name, err)
+		}
+	}
+}
+
+func TestBackend_BitrateValue(t *testing.T) {
+	tests := []struct {
+		name string
+		kbps int
+		want interface{}
+	}{
+		{"x264", 500, uint(500)},
+		{"x265", 1200, uint(1200)},
+		{"openh264", 500, uint(500000)},
+		{"vp8", 500, 500000},
+		{"vp9", 2500, 2500000},
+		{"svtav1", 800, uint(800)},
+		{"rav1e", 800, 800000},
+		{"vp8", -1, 0},
+	}
+	for _, tt := range tests {
+		b, err := ParseBackend(tt.name)
+		if err != nil {
+			t.Fatalf("ParseBackend(%q) error = %v", tt.name, err)
+		}
+		got := b.BitrateValue(tt.kbps)
+		if got != tt.want {
+			t.Errorf("%s BitrateValue(%d) = %v (%T), want %v (%T)", tt.name, tt.kbps, got, got, tt.want, tt.want)
+		}
+		if tt.kbps < 0 {
+			continue
+		}
+		if kbps, ok := b.Kbps(got); !ok || kbps != tt.kbps {
+			t.Errorf("%s Kbps(%v) = %d, %v, want %d", tt.name, got, kbps, ok, tt.kbps)
+		}
+	}
+}
+
+func TestBackend_Kbps_unexpectedType(t *testing.T) {
+	if _, ok := DefaultBackend().Kbps("500"); ok {
+		t.Error("Kbps() accepted a string")
+	}
+}
+
+func TestBackend_Runtime(t *testing.T) {
+	for _, b := range backends {
+		// the AV1 encoders only read the bitrate when they are configured
+		want := b.EncodingName != "AV1"
+		if b.Runtime != want {
+			t.Errorf("%s Runtime = %v, want %v", b.Name, b.Runtime, want)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+// Package fec sizes the ULPFEC (RFC 5109) redundancy sent in RED (RFC 2198) from the loss event rate
+// of the rate controller and splits the target bitrate between the encoder and the FEC packets,
+// so the encoder output plus its FEC stays within the target.
+package fec
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+)
+
+// rtpClockRate is the RTP clock rate of the video stream and its RED and FEC packets
+const rtpClockRate = 90000
+
+// ErrInvalidConfig is returned by New for unusable parameters
+var ErrInvalidConfig = errors.New("invalid fec config")
+
+// Config describes the FEC stream and how much redundancy a loss rate gets
+type Config struct {
+	// MediaPayloadType is the payload type of the protected stream
+	MediaPayloadType uint8
+	// PayloadType of the ULPFEC packets and REDPayloadType of the RED packets carrying media and FEC
+	PayloadType    uint8
+	REDPayloadType uint8
+	// Multiplier of the loss event rate gives the FEC packets as a share of the media packets,
+	// an XOR FEC packet recovers one loss in its group so it takes more than the loss rate
+	Multiplier float64
+	// MinLoss is the loss event rate below which no FEC is sent
+	MinLoss float64
+	// Step is the granularity of the percentage, which drops with half a step of hysteresis
+	Step int
+	// MaxPercentage caps the FEC packets as a percentage of the media packets
+	MaxPercentage int
+}
+
+// DefaultConfig sends FEC packets for twice the loss event rate above 0.5% loss, in 5% steps up to 50%
+func DefaultConfig() Config {
+	return Config{
+		MediaPayloadType: 96,
+		PayloadType:      122,
+		REDPayloadType:   123,
+		Multiplier:       2,
+		MinLoss:          0.005,
+		Step:             5,
+		MaxPercentage:    50,
+	}
+}
+
+// SDP returns the SDP attribute lines a receiver needs to decode RED and ULPFEC
+func (c Config) SDP() []string {
+	return []string{
+		fmt.Sprintf("a=rtpmap:%d red/%d", c.REDPayloadType, rtpClockRate),
+		fmt.Sprintf("a=rtpmap:%d ulpfec/%d", c.PayloadType, rtpClockRate),
+		fmt.Sprintf("a=fmtp:%d %d/%d", c.REDPayloadType, c.MediaPayloadType, c.PayloadType),
+	}
+}
+
+// Redundancy tracks the FEC percentage, it is safe for concurrent use
+type Redundancy struct {
+	mu  sync.Mutex
+	cfg Config
+
+	percentage int
+}
+
+// New creates a redundancy tracker starting without FEC
+func New(cfg Config) (*Redundancy, error) {
+	switch {
+	case cfg.PayloadType > 127 || cfg.REDPayloadType > 127 || cfg.PayloadType == cfg.REDPayloadType ||
+		cfg.PayloadType == cfg.MediaPayloadType || cfg.REDPayloadType == cfg.MediaPayloadType:
+		return nil, fmt.Errorf("%w: payload types %d, %d and %d",
+			ErrInvalidConfig, cfg.MediaPayloadType, cfg.PayloadType, cfg.REDPayloadType)
+	case cfg.Multiplier <= 0:
+		return nil, fmt.Errorf("%w: multiplier %v must be positive", ErrInvalidConfig, cfg.Multiplier)
+	case cfg.MinLoss < 0 || cfg.MinLoss >= 1:
+		return nil, fmt.Errorf("%w: min loss %v must be in [0, 1)", ErrInvalidConfig, cfg.MinLoss)
+	case cfg.Step <= 0 || cfg.MaxPercentage < cfg.Step || cfg.MaxPercentage > 100:
+		return nil, fmt.Errorf("%w: step %d, max percentage %d", ErrInvalidConfig, cfg.Step, cfg.MaxPercentage)
+	}
+	return &Redundancy{cfg: cfg}, nil
+}
+
+// Config returns the configuration of the tracker
+func (r *Redundancy) Config() Config {
+	return r.cfg
+}
+
+// Update sets the percentage for the loss event rate and reports whether it changed
+func (r *Redundancy) Update(lossEventRate float64) (int, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	need := 0.0
+	if lossEventRate >= r.cfg.MinLoss {
+		need = lossEventRate * r.cfg.Multiplier * 100
+	}
+	prev := r.percentage
+	switch up, down := r.round(need), r.round(need+float64(r.cfg.Step)/2); {
+	case up > r.percentage || need == 0:
+		r.percentage = up
+	case down < r.percentage:
+		// half a step of hysteresis keeps a loss rate at a step boundary from flapping
+		r.percentage = down
+	}
+	return r.percentage, r.percentage != prev
+}
+
+// round returns the smallest step multiple covering percent, capped at the max percentage
+func (r *Redundancy) round(percent float64) int {
+	if percent <= 0 {
+		return 0
+	}
+	steps := int(math.Ceil(percent / float64(r.cfg.Step)))
+	return min(steps*r.cfg.Step, r.cfg.MaxPercentage)
+}
+
+// Percentage returns the FEC packets as a percentage of the media packets
+func (r *Redundancy) Percentage() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.percentage
+}
+
+// MediaBitrate returns the share of targetKbps left to the encoder once the FEC packets are sent
+func (r *Redundancy) MediaBitrate(targetKbps int) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return targetKbps * 100 / (100 + r.percentage)
+}
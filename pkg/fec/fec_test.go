@@ -0,0 +1,126 @@
+package fec
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(c *Config)
+		wantErr bool
+	}{
+		{"defaults", func(*Config) {}, false},
+		{"same payload types", func(c *Config) { c.REDPayloadType = c.PayloadType }, true},
+		{"FEC payload type is the media one", func(c *Config) { c.PayloadType = c.MediaPayloadType }, true},
+		{"payload type out of range", func(c *Config) { c.PayloadType = 128 }, true},
+		{"zero multiplier", func(c *Config) { c.Multiplier = 0 }, true},
+		{"zero step", func(c *Config) { c.Step = 0 }, true},
+		{"max above 100", func(c *Config) { c.MaxPercentage = 150 }, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			tt.modify(&cfg)
+			_, err := New(cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !errors.Is(err, ErrInvalidConfig) {
+				t.Errorf("error %v does not wrap ErrInvalidConfig", err)
+			}
+		})
+	}
+}
+
+func TestConfig_SDP(t *testing.T) {
+	want := []string{
+		"a=rtpmap:123 red/90000",
+		"a=rtpmap:122 ulpfec/90000",
+		"a=fmtp:123 96/122",
+	}
+	got := DefaultConfig().SDP()
+	if len(got) != len(want) {
+		t.Fatalf("SDP() = %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("SDP()[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestRedundancy_Update(t *testing.T) {
+	type step struct {
+		loss        float64
+		want        int
+		wantChanged bool
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name:  "no loss",
+			steps: []step{{0, 0, false}},
+		},
+		{
+			name:  "below the min loss",
+			steps: []step{{0.004, 0, false}},
+		},
+		{
+			name:  "rounded up to a step",
+			steps: []step{{0.03, 10, true}},
+		},
+		{
+			name:  "capped",
+			steps: []step{{0.4, 50, true}},
+		},
+		{
+			name: "hysteresis",
+			steps: []step{
+				{0.05, 10, true},
+				// needs 9% down to 6%, more than half a step above 5%, so 10% is kept
+				{0.045, 10, false},
+				{0.04, 10, false},
+				{0.035, 10, false},
+				{0.03, 10, false},
+				// needs 2%, half a step below 5%
+				{0.01, 5, true},
+				{0, 0, true},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := New(DefaultConfig())
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			for i, s := range tt.steps {
+				got, changed := r.Update(s.loss)
+				if got != s.want || changed != s.wantChanged {
+					t.Errorf("step %d: Update(%v) = %d, %v, want %d, %v", i, s.loss, got, changed, s.want, s.wantChanged)
+				}
+			}
+		})
+	}
+}
+
+func TestRedundancy_MediaBitrate(t *testing.T) {
+	r, err := New(DefaultConfig())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if got := r.MediaBitrate(1000); got != 1000 {
+		t.Errorf("MediaBitrate() without FEC = %d, want 1000", got)
+	}
+	r.Update(0.1)
+	// 20% FEC: 1000 Kbps of media and FEC leave 833 Kbps to the encoder
+	if got := r.MediaBitrate(1000); got != 833 {
+		t.Errorf("MediaBitrate() with 20%% FEC = %d, want 833", got)
+	}
+}
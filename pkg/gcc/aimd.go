@@ -0,0 +1,143 @@
+package gcc
+
+import (
+	"math"
+	"time"
+)
+
+// rateControlState is the state of the AIMD rate controller
+type rateControlState int
+
+const (
+	stateHold rateControlState = iota
+	stateIncrease
+	stateDecrease
+)
+
+const (
+	// beta is the multiplicative decrease factor applied to the received rate
+	beta = 0.85
+
+	// multiplicative increase of 8% per second while far from the link capacity
+	increaseFactor = 1.08
+
+	// avgPacketSizeBits is used for the additive increase near the link capacity
+	avgPacketSizeBits = 1200 * 8
+
+	// linkCapacitySmoothing weights the newest link capacity sample
+	linkCapacitySmoothing = 0.05
+
+	defaultRTT = 100 * time.Millisecond
+)
+
+// aimdRateController implements the delay-based AIMD rate controller of GCC, all rates in Kbps
+type aimdRateController struct {
+	state      rateControlState
+	rate       float64
+	minRate    float64
+	maxRate    float64
+	lastUpdate time.Time
+	rtt        time.Duration
+
+	// link capacity estimate built from the received rate at each decrease
+	linkCapacity    float64
+	linkCapacityVar float64
+}
+
+func newAimdRateController(init, minRate, maxRate float64) *aimdRateController {
+	return &aimdRateController{
+		state:           stateIncrease,
+		rate:            init,
+		minRate:         minRate,
+		maxRate:         maxRate,
+		rtt:             defaultRTT,
+		linkCapacity:    -1,
+		linkCapacityVar: 0.4,
+	}
+}
+
+// update moves the state machine with the detector output and returns the new rate
+func (c *aimdRateController) update(usage bandwidthUsage, receivedRate float64, now time.Time) float64 {
+	if c.lastUpdate.IsZero() {
+		c.lastUpdate = now
+	}
+	elapsed := now.Sub(c.lastUpdate)
+	c.lastUpdate = now
+
+	c.transition(usage)
+
+	switch c.state {
+	case stateHold:
+		// keep the rate until the queues drain
+	case stateIncrease:
+		if c.nearLinkCapacity() {
+			c.rate += c.additiveIncrease(elapsed)
+		} else {
+			c.rate *= math.Pow(increaseFactor, math.Min(elapsed.Seconds(), 1.0))
+		}
+		if receivedRate > 0 {
+			// never run far ahead of what actually reaches the receiver
+			c.rate = math.Min(c.rate, 1.5*receivedRate+10)
+		}
+	case stateDecrease:
+		decreased := beta * c.rate
+		if receivedRate > 0 {
+			decreased = beta * receivedRate
+			c.updateLinkCapacity(receivedRate)
+		}
+		c.rate = math.Min(c.rate, decreased)
+		c.state = stateHold
+	}
+
+	c.rate = math.Max(c.minRate, math.Min(c.rate, c.maxRate))
+	return c.rate
+}
+
+// transition applies the GCC state table: overuse always decreases,
+// underuse holds, normal usage resumes increasing
+func (c *aimdRateController) transition(usage bandwidthUsage) {
+	switch usage {
+	case usageOverusing:
+		c.state = stateDecrease
+	case usageUnderusing:
+		c.state = stateHold
+	case usageNormal:
+		if c.state == stateHold {
+			c.state = stateIncrease
+		}
+	}
+}
+
+// nearLinkCapacity is true when the rate is within three standard deviations of the estimate
+func (c *aimdRateController) nearLinkCapacity() bool {
+	if c.linkCapacity <= 0 {
+		return false
+	}
+	stdDev := math.Sqrt(c.linkCapacityVar * c.linkCapacity)
+	return math.Abs(c.rate-c.linkCapacity) <= 3*stdDev
+}
+
+// additiveIncrease adds about one packet per response time
+func (c *aimdRateController) additiveIncrease(elapsed time.Duration) float64 {
+	responseTime := c.rtt + 100*time.Millisecond
+	perSecond := float64(avgPacketSizeBits) / 1000 / responseTime.Seconds()
+	return math.Max(1, perSecond*elapsed.Seconds())
+}
+
+func (c *aimdRateController) updateLinkCapacity(sample float64) {
+	if c.linkCapacity <= 0 {
+		c.linkCapacity = sample
+		return
+	}
+	c.linkCapacity = (1-linkCapacitySmoothing)*c.linkCapacity + linkCapacitySmoothing*sample
+	norm := math.Max(c.linkCapacity, 1)
+	errSample := c.linkCapacity - sample
+	c.linkCapacityVar = (1-linkCapacitySmoothing)*c.linkCapacityVar + linkCapacitySmoothing*errSample*errSample/norm
+	c.linkCapacityVar = math.Max(0.4, math.Min(c.linkCapacityVar, 2.5))
+}
+
+func (c *aimdRateController) setRTT(rtt time.Duration) {
+	if rtt > 0 {
+		c.rtt = rtt
+	}
+}
@@ -0,0 +1,77 @@
+package gcc
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAimdRateController_Update(t *testing.T) {
+	t.Run("multiplicative increase", func(t *testing.T) {
+		c := newAimdRateController(1000, 100, 4000)
+		now := time.Now()
+		c.update(usageNormal, 0, now)
+		rate := c.update(usageNormal, 0, now.Add(time.Second))
+		if abs(rate-1080) > 1 {
+			t.Errorf("update() = %v, want approximately %v", rate, 1080)
+		}
+	})
+
+	t.Run("increase capped by received rate", func(t *testing.T) {
+		c := newAimdRateController(1000, 100, 4000)
+		now := time.Now()
+		c.update(usageNormal, 500, now)
+		rate := c.update(usageNormal, 500, now.Add(time.Second))
+		if rate != 760 {
+			t.Errorf("update() = %v, want %v", rate, 760)
+		}
+	})
+
+	t.Run("decrease on overuse", func(t *testing.T) {
+		c := newAimdRateController(1000, 100, 4000)
+		rate := c.update(usageOverusing, 800, time.Now())
+		if rate != beta*800 {
+			t.Errorf("update() = %v, want %v", rate, beta*800)
+		}
+		if c.state != stateHold {
+			t.Errorf("state after decrease = %v, want %v", c.state, stateHold)
+		}
+		if c.linkCapacity != 800 {
+			t.Errorf("linkCapacity = %v, want %v", c.linkCapacity, 800)
+		}
+	})
+
+	t.Run("hold on underuse", func(t *testing.T) {
+		c := newAimdRateController(1000, 100, 4000)
+		now := time.Now()
+		c.update(usageUnderusing, 0, now)
+		if rate := c.update(usageUnderusing, 0, now.Add(time.Second)); rate != 1000 {
+			t.Errorf("update() = %v, want %v", rate, 1000)
+		}
+	})
+
+	t.Run("clamped to limits", func(t *testing.T) {
+		c := newAimdRateController(1000, 900, 1050)
+		now := time.Now()
+		c.update(usageNormal, 0, now)
+		if rate := c.update(usageNormal, 0, now.Add(time.Second)); rate != 1050 {
+			t.Errorf("update() = %v, want %v", rate, 1050)
+		}
+		if rate := c.update(usageOverusing, 100, now.Add(2*time.Second)); rate != 900 {
+			t.Errorf("update() = %v, want %v", rate, 900)
+		}
+	})
+}
+
+func TestAimdRateController_AdditiveIncrease(t *testing.T) {
+	c := newAimdRateController(1000, 100, 4000)
+	c.linkCapacity = 1000
+	c.setRTT(100 * time.Millisecond)
+
+	if !c.nearLinkCapacity() {
+		t.Fatal("nearLinkCapacity() = false, want true")
+	}
+	// one 1200 byte packet per 200ms response time = 48 Kbps per second
+	if got := c.additiveIncrease(time.Second); abs(got-48) > 0.01 {
+		t.Errorf("additiveIncrease() = %v, want %v", got, 48)
+	}
+}
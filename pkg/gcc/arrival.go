@@ -0,0 +1,176 @@
+package gcc
+
+import (
+	"time"
+)
+
+const (
+	// burstInterval groups packets sent within this time into one packet group
+	burstInterval = 5 * time.Millisecond
+
+	trendlineWindowSize = 20
+	trendlineSmoothing  = 0.9
+	trendlineGain       = 4.0
+	maxTrendDeltas      = 60
+
+	receiveRateWindow = 500 * time.Millisecond
+)
+
+// packetGroup is a burst of packets sent close together
+type packetGroup struct {
+	firstSend   time.Time
+	lastSend    time.Time
+	lastArrival time.Duration
+	size        int
+}
+
+// interArrival computes the send and arrival deltas between consecutive packet groups
+type interArrival struct {
+	current  *packetGroup
+	previous *packetGroup
+}
+
+// add appends a received packet, ok is true when a group was completed and deltas are valid
+func (a *interArrival) add(send time.Time, arrival time.Duration, size int) (time.Duration, time.Duration, bool) {
+	if a.current == nil {
+		a.current = &packetGroup{firstSend: send, lastSend: send, lastArrival: arrival, size: size}
+		return 0, 0, false
+	}
+
+	// reordered packet from an older group
+	if send.Before(a.current.firstSend) {
+		return 0, 0, false
+	}
+
+	if send.Sub(a.current.firstSend) <= burstInterval {
+		if send.After(a.current.lastSend) {
+			a.current.lastSend = send
+		}
+		if arrival > a.current.lastArrival {
+			a.current.lastArrival = arrival
+		}
+		a.current.size += size
+		return 0, 0, false
+	}
+
+	var sendDelta, arrivalDelta time.Duration
+	ok := false
+	if a.previous != nil {
+		sendDelta = a.current.lastSend.Sub(a.previous.lastSend)
+		arrivalDelta = a.current.lastArrival - a.previous.lastArrival
+		ok = true
+	}
+	a.previous = a.current
+	a.current = &packetGroup{firstSend: send, lastSend: send, lastArrival: arrival, size: size}
+	return sendDelta, arrivalDelta, ok
+}
+
+type trendSample struct {
+	arrivalMs     float64
+	smoothedDelay float64
+}
+
+// trendlineEstimator fits a line through the smoothed accumulated delay variation,
+// a positive slope means queues are building up along the path
+type trendlineEstimator struct {
+	firstArrival     time.Duration
+	started          bool
+	accumulatedDelay float64
+	smoothedDelay    float64
+	numDeltas        int
+	samples          []trendSample
+	trend            float64
+}
+
+func newTrendlineEstimator() *trendlineEstimator {
+	return &trendlineEstimator{
+		samples: make([]trendSample, 0, trendlineWindowSize),
+	}
+}
+
+// update adds one group delta and returns the modified trend used by the overuse detector
+func (e *trendlineEstimator) update(sendDelta, arrivalDelta, arrival time.Duration) float64 {
+	if !e.started {
+		e.firstArrival = arrival
+		e.started = true
+	}
+	e.numDeltas = min(e.numDeltas+1, maxTrendDeltas)
+
+	delayMs := float64(arrivalDelta-sendDelta) / float64(time.Millisecond)
+	e.accumulatedDelay += delayMs
+	e.smoothedDelay = trendlineSmoothing*e.smoothedDelay + (1-trendlineSmoothing)*e.accumulatedDelay
+
+	if len(e.samples) >= trendlineWindowSize {
+		e.samples = e.samples[1:]
+	}
+	e.samples = append(e.samples, trendSample{
+		arrivalMs:     float64(arrival-e.firstArrival) / float64(time.Millisecond),
+		smoothedDelay: e.smoothedDelay,
+	})
+
+	if len(e.samples) == trendlineWindowSize {
+		if slope, ok := linearFitSlope(e.samples); ok {
+			e.trend = slope
+		}
+	}
+	return e.modifiedTrend()
+}
+
+// modifiedTrend scales the slope the same way as the WebRTC trendline estimator
+func (e *trendlineEstimator) modifiedTrend() float64 {
+	return float64(e.numDeltas) * e.trend * trendlineGain
+}
+
+// linearFitSlope returns the least squares slope of the samples
+func linearFitSlope(samples []trendSample) (float64, bool) {
+	var sumX, sumY float64
+	for _, s := range samples {
+		sumX += s.arrivalMs
+		sumY += s.smoothedDelay
+	}
+	n := float64(len(samples))
+	avgX := sumX / n
+	avgY := sumY / n
+
+	var num, den float64
+	for _, s := range samples {
+		num += (s.arrivalMs - avgX) * (s.smoothedDelay - avgY)
+		den += (s.arrivalMs - avgX) * (s.arrivalMs - avgX)
+	}
+	if den == 0 {
+		return 0, false
+	}
+	return num / den, true
+}
+
+type receivedSample struct {
+	arrival time.Duration
+	size    int
+}
+
+// receiveRate measures the rate the receiver got over a sliding window of arrival times
+type receiveRate struct {
+	samples []receivedSample
+	bytes   int
+}
+
+func (r *receiveRate) add(arrival time.Duration, size int) {
+	r.samples = append(r.samples, receivedSample{arrival: arrival, size: size})
+	r.bytes += size
+	for len(r.samples) > 0 && arrival-r.samples[0].arrival > receiveRateWindow {
+		r.bytes -= r.samples[0].size
+		r.samples = r.samples[1:]
+	}
+}
+
+// kbps returns the received rate in Kbps, 0 until the window holds enough data
+func (r *receiveRate) kbps() float64 {
+	if len(r.samples) < 2 {
+		return 0
+	}
+	span := r.samples[len(r.samples)-1].arrival - r.samples[0].arrival
+	if span < receiveRateWindow/2 {
+		return 0
+	}
+	return float64(r.bytes) * 8 / 1000 / span.Seconds()
+}
@@ -0,0 +1,110 @@
+package gcc
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInterArrival_Add(t *testing.T) {
+	a := &interArrival{}
+	start := time.Now()
+
+	// group 1: two packets inside the burst interval
+	if _, _, ok := a.add(start, 50*time.Millisecond, 100); ok {
+		t.Error("add() completed a group on the first packet")
+	}
+	if _, _, ok := a.add(start.Add(2*time.Millisecond), 52*time.Millisecond, 100); ok {
+		t.Error("add() completed a group inside the burst interval")
+	}
+
+	// group 2 starts, but there is no previous group to compare with yet
+	if _, _, ok := a.add(start.Add(20*time.Millisecond), 75*time.Millisecond, 100); ok {
+		t.Error("add() returned deltas without a previous group")
+	}
+
+	// group 3 starts, deltas between group 1 and 2 are reported
+	sendDelta, arrivalDelta, ok := a.add(start.Add(40*time.Millisecond), 95*time.Millisecond, 100)
+	if !ok {
+		t.Fatal("add() did not complete a group")
+	}
+	if sendDelta != 18*time.Millisecond {
+		t.Errorf("add() sendDelta = %v, want %v", sendDelta, 18*time.Millisecond)
+	}
+	if arrivalDelta != 23*time.Millisecond {
+		t.Errorf("add() arrivalDelta = %v, want %v", arrivalDelta, 23*time.Millisecond)
+	}
+
+	// reordered packet from an old group is ignored
+	if _, _, ok := a.add(start.Add(10*time.Millisecond), 96*time.Millisecond, 100); ok {
+		t.Error("add() accepted a reordered packet")
+	}
+}
+
+func TestTrendlineEstimator_Update(t *testing.T) {
+	tests := []struct {
+		name       string
+		extraDelay time.Duration
+		wantSign   int
+	}{
+		{name: "stable delay", extraDelay: 0, wantSign: 0},
+		{name: "growing delay", extraDelay: 2 * time.Millisecond, wantSign: 1},
+		{name: "shrinking delay", extraDelay: -2 * time.Millisecond, wantSign: -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTrendlineEstimator()
+			sendDelta := 20 * time.Millisecond
+			arrival := time.Duration(0)
+			var trend float64
+			for i := 0; i < 2*trendlineWindowSize; i++ {
+				arrival += sendDelta + tt.extraDelay
+				trend = e.update(sendDelta, sendDelta+tt.extraDelay, arrival)
+			}
+
+			switch {
+			case tt.wantSign == 0 && trend != 0:
+				t.Errorf("update() trend = %v, want 0", trend)
+			case tt.wantSign > 0 && trend <= 0:
+				t.Errorf("update() trend = %v, want positive", trend)
+			case tt.wantSign < 0 && trend >= 0:
+				t.Errorf("update() trend = %v, want negative", trend)
+			}
+		})
+	}
+}
+
+func TestLinearFitSlope(t *testing.T) {
+	samples := []trendSample{{0, 1}, {1, 3}, {2, 5}, {3, 7}}
+	slope, ok := linearFitSlope(samples)
+	if !ok || abs(slope-2) > 1e-9 {
+		t.Errorf("linearFitSlope() = %v, %v, want 2, true", slope, ok)
+	}
+
+	if _, ok := linearFitSlope([]trendSample{{1, 1}, {1, 2}}); ok {
+		t.Error("linearFitSlope() with identical x values should fail")
+	}
+}
+
+func TestReceiveRate(t *testing.T) {
+	r := &receiveRate{}
+	if r.kbps() != 0 {
+		t.Errorf("kbps() with no samples = %v, want 0", r.kbps())
+	}
+
+	// 1250 bytes every 10ms = 1000 Kbps
+	for i := 0; i <= 100; i++ {
+		r.add(time.Duration(i)*10*time.Millisecond, 1250)
+	}
+	if got := r.kbps(); abs(got-1000) > 25 {
+		t.Errorf("kbps() = %v, want approximately %v", got, 1000)
+	}
+}
+
+// Helper function for floating point comparison
+func abs(x float64) float64 {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,46 @@
+package gcc
+
+import (
+	"time"
+
+	"github.com/arsperger/slowcast/pkg/ratecontrol"
+)
+
+// maxHistoryAge is how long sent packets are kept waiting for feedback
+const maxHistoryAge = 5 * time.Second
+
+// sendHistory keeps sent packets indexed by transport-wide sequence number
+type sendHistory struct {
+	packets map[uint16]ratecontrol.SentPacket
+	order   []uint16
+}
+
+func newSendHistory() *sendHistory {
+	return &sendHistory{
+		packets: make(map[uint16]ratecontrol.SentPacket),
+		order:   make([]uint16, 0, 1024),
+	}
+}
+
+// add records pkt and forgets packets older than maxHistoryAge
+func (h *sendHistory) add(pkt ratecontrol.SentPacket) {
+	for len(h.order) > 0 {
+		oldest, ok := h.packets[h.order[0]]
+		if ok && pkt.SendTime.Sub(oldest.SendTime) < maxHistoryAge {
+			break
+		}
+		delete(h.packets, h.order[0])
+		h.order = h.order[1:]
+	}
+	h.packets[pkt.TransportSequenceNumber] = pkt
+	h.order = append(h.order, pkt.TransportSequenceNumber)
+}
+
+func (h *sendHistory) get(seq uint16) (ratecontrol.SentPacket, bool) {
+	pkt, ok := h.packets[seq]
+	return pkt, ok
+}
+
+func (h *sendHistory) len() int {
+	return len(h.packets)
+}
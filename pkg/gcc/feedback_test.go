@@ -0,0 +1,32 @@
+package gcc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/arsperger/slowcast/pkg/ratecontrol"
+)
+
+func TestSendHistory(t *testing.T) {
+	h := newSendHistory()
+	start := time.Now()
+
+	h.add(ratecontrol.SentPacket{SendTime: start, TransportSequenceNumber: 1, Size: 100})
+	h.add(ratecontrol.SentPacket{SendTime: start.Add(time.Second), TransportSequenceNumber: 2, Size: 200})
+
+	if pkt, ok := h.get(2); !ok || pkt.Size != 200 {
+		t.Errorf("get(2) = %+v, %v, want size 200", pkt, ok)
+	}
+	if _, ok := h.get(3); ok {
+		t.Error("get(3) found a packet that was never sent")
+	}
+
+	// adding a packet past maxHistoryAge evicts the old ones
+	h.add(ratecontrol.SentPacket{SendTime: start.Add(maxHistoryAge + 500*time.Millisecond), TransportSequenceNumber: 3})
+	if _, ok := h.get(1); ok {
+		t.Error("get(1) should have been evicted")
+	}
+	if h.len() != 2 {
+		t.Errorf("len() = %v, want %v", h.len(), 2)
+	}
+}
@@ -0,0 +1,233 @@
+package gcc
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/pion/rtcp"
+
+	"github.com/arsperger/slowcast/pkg/ratecontrol"
+)
+
+// Name is the registry name of the GCC controller
+const Name = "gcc"
+
+const (
+	// loss-based controller thresholds, see draft-ietf-rmcat-gcc-02 section 6
+	lossIncreaseThreshold = 0.02
+	lossDecreaseThreshold = 0.10
+	lossIncreaseFactor    = 1.05
+
+	rttSmoothing = 0.2
+)
+
+var (
+	_ ratecontrol.RateController = (*Gcc)(nil)
+	_ ratecontrol.PacketObserver = (*Gcc)(nil)
+	_ ratecontrol.ProbeConsumer  = (*Gcc)(nil)
+
+	_ ratecontrol.PacketFeedbackConsumer = (*Gcc)(nil)
+)
+
+// Gcc is a Google Congestion Control sender, the delay-based estimate comes from
+// transport-wide CC feedback and the loss-based one from the losses it reports
+type Gcc struct {
+	mu sync.Mutex
+
+	history   *sendHistory
+	arrival   *interArrival
+	trendline *trendlineEstimator
+	detector  *overuseDetector
+	aimd      *aimdRateController
+	received  *receiveRate
+
+	// rate limits Kbps
+	minBitrate int
+	maxBitrate int
+
+	lossBasedRate  float64
+	currentBitrate int
+	usage          bandwidthUsage
+
+	lossRate    float64
+	rttSample   float64
+	smoothedRTT float64
+
+	// senderReports matches the LSR of receiver reports, nil uses the LSR arithmetic
+	senderReports *ratecontrol.SenderReportHistory
+}
+
+// New creates a GCC controller, bitrates in Kbps
+func New(init, min, max int) (*Gcc, error) { //nolint:predeclared
+	if min <= 0 || min > max || init < min || init > max {
+		return nil, fmt.Errorf("invalid bitrate limits: init %d, min %d, max %d", init, min, max)
+	}
+	return &Gcc{
+		history:        newSendHistory(),
+		arrival:        &interArrival{},
+		trendline:      newTrendlineEstimator(),
+		detector:       newOveruseDetector(),
+		aimd:           newAimdRateController(float64(init), float64(min), float64(max)),
+		received:       &receiveRate{},
+		minBitrate:     min,
+		maxBitrate:     max,
+		lossBasedRate:  float64(init),
+		currentBitrate: init,
+		usage:          usageNormal,
+		smoothedRTT:    defaultRTT.Seconds(),
+	}, nil
+}
+
+// NewController is a ratecontrol.Factory creating a GCC controller
+func NewController(cfg ratecontrol.Config) (ratecontrol.RateController, error) {
+	g, err := New(cfg.InitBitrate, cfg.MinBitrate, cfg.MaxBitrate)
+	if err != nil {
+		return nil, err
+	}
+	g.senderReports = cfg.SenderReports
+	return g, nil
+}
+
+// OnPacketSent records packets carrying a transport-wide sequence number
+func (g *Gcc) OnPacketSent(pkt ratecontrol.SentPacket) {
+	if !pkt.HasTransportSequence {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.history.add(pkt)
+}
+
+// OnRTCP handles transport-wide CC feedback and takes RTT samples from receiver reports
+func (g *Gcc) OnRTCP(now time.Time, pkt rtcp.Packet) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	switch p := pkt.(type) {
+	case *rtcp.TransportLayerCC:
+		g.onTransportCC(now, p)
+	case *rtcp.ReceiverReport:
+		for _, report := range p.Reports {
+			if rtt, ok := g.senderReports.RTT(now, report.LastSenderReport, report.Delay); ok {
+				g.updateRTT(rtt)
+			}
+		}
+	}
+}
+
+func (g *Gcc) onTransportCC(now time.Time, fb *rtcp.TransportLayerCC) {
+	results := ratecontrol.DecodeTransportCC(fb)
+
+	var lost, total int
+	for _, result := range results {
+		sent, ok := g.history.get(result.SequenceNumber)
+		if !ok {
+			continue
+		}
+		total++
+		if !result.Received {
+			lost++
+			continue
+		}
+		g.onArrival(now, sent, result.Arrival)
+	}
+	g.updateRate(now, lost, total)
+}
+
+// OnPacketFeedback runs the delay-based and loss-based estimators on RFC 8888 feedback
+// matched against the send times, for receivers without transport-wide CC
+func (g *Gcc) OnPacketFeedback(now time.Time, report ratecontrol.FeedbackReport) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var lost, total int
+	for _, pkt := range report.Packets {
+		total++
+		if !pkt.Received {
+			lost++
+			continue
+		}
+		if pkt.HasArrival {
+			g.onArrival(now, pkt.Sent, pkt.Arrival)
+		}
+	}
+	g.updateRate(now, lost, total)
+}
+
+// onArrival feeds a received packet into the receive rate and the trendline
+func (g *Gcc) onArrival(now time.Time, sent ratecontrol.SentPacket, arrival time.Duration) {
+	g.received.add(arrival, sent.Size)
+	sendDelta, arrivalDelta, ok := g.arrival.add(sent.SendTime, arrival, sent.Size)
+	if !ok {
+		return
+	}
+	trend := g.trendline.update(sendDelta, arrivalDelta, arrival)
+	g.usage = g.detector.detect(trend, sendDelta, now)
+}
+
+// updateRate combines the delay-based and loss-based rates after a feedback report
+func (g *Gcc) updateRate(now time.Time, lost, total int) {
+	if total == 0 {
+		return
+	}
+	g.lossRate = float64(lost) / float64(total)
+
+	delayBased := g.aimd.update(g.usage, g.received.kbps(), now)
+	lossBased := g.updateLossBasedRate(delayBased)
+
+	rate := math.Min(delayBased, lossBased)
+	rate = math.Max(float64(g.minBitrate), math.Min(rate, float64(g.maxBitrate)))
+	g.currentBitrate = int(rate)
+}
+
+// OnProbeResult raises the delay-based and loss-based estimates to a probed rate
+func (g *Gcc) OnProbeResult(_ time.Time, deliveredKbps int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if deliveredKbps <= g.currentBitrate {
+		return
+	}
+	rate := math.Min(float64(deliveredKbps), float64(g.maxBitrate))
+	g.aimd.rate = math.Max(g.aimd.rate, rate)
+	g.lossBasedRate = math.Max(g.lossBasedRate, rate)
+	g.currentBitrate = int(rate)
+}
+
+// updateLossBasedRate applies the loss-based controller, it never exceeds the delay-based rate
+func (g *Gcc) updateLossBasedRate(delayBased float64) float64 {
+	switch {
+	case g.lossRate > lossDecreaseThreshold:
+		g.lossBasedRate *= 1 - 0.5*g.lossRate
+	case g.lossRate < lossIncreaseThreshold:
+		g.lossBasedRate *= lossIncreaseFactor
+	}
+	g.lossBasedRate = math.Max(float64(g.minBitrate), math.Min(g.lossBasedRate, delayBased))
+	return g.lossBasedRate
+}
+
+func (g *Gcc) updateRTT(rtt float64) {
+	g.rttSample = rtt
+	g.smoothedRTT = (1-rttSmoothing)*g.smoothedRTT + rttSmoothing*rtt
+	g.aimd.setRTT(time.Duration(g.smoothedRTT * float64(time.Second)))
+}
+
+// TargetBitrate returns the last GCC estimate in Kbps
+func (g *Gcc) TargetBitrate() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.currentBitrate
+}
+
+// State returns the current GCC estimates
+func (g *Gcc) State() ratecontrol.State {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return ratecontrol.State{
+		Bitrate:     g.currentBitrate,
+		RTTSample:   g.rttSample,
+		SmoothedRTT: g.smoothedRTT,
+		LossRate:    g.lossRate,
+	}
+}
@@ -0,0 +1,226 @@
+package gcc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pion/rtcp"
+
+	"github.com/arsperger/slowcast/pkg/ratecontrol"
+)
+
+// simulatePath sends n packets every 10ms through g and returns a TWCC feedback
+// every 10 packets, queueGrowth is added to the one-way delay of each packet
+// and every lossEvery-th packet is reported lost (0 disables loss)
+func simulatePath(g *Gcc, start time.Time, n int, queueGrowth time.Duration, lossEvery int) time.Time {
+	const interval = 10 * time.Millisecond
+	const batch = 10
+
+	now := start
+	for first := 0; first < n; first += batch {
+		fb := &rtcp.TransportLayerCC{
+			BaseSequenceNumber: uint16(first), //nolint:gosec
+			PacketStatusCount:  batch,
+		}
+		var lastArrival time.Duration
+		for i := first; i < first+batch; i++ {
+			now = start.Add(time.Duration(i) * interval)
+			g.OnPacketSent(ratecontrol.SentPacket{
+				SendTime:                now,
+				TransportSequenceNumber: uint16(i), //nolint:gosec
+				HasTransportSequence:    true,
+				Size:                    1200,
+			})
+
+			symbol := rtcp.TypeTCCPacketReceivedSmallDelta
+			if lossEvery > 0 && i%lossEvery == 0 {
+				symbol = rtcp.TypeTCCPacketNotReceived
+			}
+			fb.PacketChunks = append(fb.PacketChunks, &rtcp.RunLengthChunk{
+				Type:               rtcp.TypeTCCRunLengthChunk,
+				PacketStatusSymbol: symbol,
+				RunLength:          1,
+			})
+			if symbol == rtcp.TypeTCCPacketNotReceived {
+				continue
+			}
+			arrival := time.Duration(i)*interval + 20*time.Millisecond + time.Duration(i)*queueGrowth
+			fb.RecvDeltas = append(fb.RecvDeltas, &rtcp.RecvDelta{
+				Type:  symbol,
+				Delta: (arrival - lastArrival).Microseconds(),
+			})
+			lastArrival = arrival
+		}
+		g.OnRTCP(now, fb)
+	}
+	return now
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		init    int
+		min     int
+		max     int
+		wantErr bool
+	}{
+		{name: "valid parameters", init: 1000, min: 100, max: 4000, wantErr: false},
+		{name: "init below min", init: 50, min: 100, max: 4000, wantErr: true},
+		{name: "min greater than max", init: 1000, min: 5000, max: 4000, wantErr: true},
+		{name: "zero min", init: 1000, min: 0, max: 4000, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := New(tt.init, tt.min, tt.max)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && g.TargetBitrate() != tt.init {
+				t.Errorf("New() bitrate = %v, want %v", g.TargetBitrate(), tt.init)
+			}
+		})
+	}
+}
+
+func TestGcc_OnPacketSent(t *testing.T) {
+	g, _ := New(1000, 100, 4000)
+
+	g.OnPacketSent(ratecontrol.SentPacket{SendTime: time.Now(), Size: 1200})
+	if g.history.len() != 0 {
+		t.Errorf("OnPacketSent() recorded a packet without transport sequence number")
+	}
+
+	g.OnPacketSent(ratecontrol.SentPacket{SendTime: time.Now(), HasTransportSequence: true, Size: 1200})
+	if g.history.len() != 1 {
+		t.Errorf("OnPacketSent() history len = %v, want %v", g.history.len(), 1)
+	}
+}
+
+func TestGcc_OnRTCP(t *testing.T) {
+	t.Run("uncongested path ramps up", func(t *testing.T) {
+		g, _ := New(1000, 100, 4000)
+		simulatePath(g, time.Now(), 500, 0, 0)
+
+		if got := g.TargetBitrate(); got <= 1000 {
+			t.Errorf("TargetBitrate() = %v, want above %v", got, 1000)
+		}
+		if g.State().LossRate != 0 {
+			t.Errorf("State() LossRate = %v, want 0", g.State().LossRate)
+		}
+	})
+
+	t.Run("growing queue backs off before any loss", func(t *testing.T) {
+		g, _ := New(1000, 100, 4000)
+		simulatePath(g, time.Now(), 500, time.Millisecond, 0)
+
+		if got := g.TargetBitrate(); got >= 1000 {
+			t.Errorf("TargetBitrate() = %v, want below %v", got, 1000)
+		}
+		if g.State().LossRate != 0 {
+			t.Errorf("State() LossRate = %v, want 0", g.State().LossRate)
+		}
+	})
+
+	t.Run("heavy loss backs off", func(t *testing.T) {
+		g, _ := New(1000, 100, 4000)
+		simulatePath(g, time.Now(), 500, 0, 5)
+
+		if got := g.TargetBitrate(); got >= 1000 {
+			t.Errorf("TargetBitrate() = %v, want below %v", got, 1000)
+		}
+		if got := g.State().LossRate; abs(got-0.2) > 0.01 {
+			t.Errorf("State() LossRate = %v, want approximately %v", got, 0.2)
+		}
+	})
+
+	t.Run("receiver report RTT", func(t *testing.T) {
+		g, _ := New(1000, 100, 4000)
+		now := time.Now()
+		rr := &rtcp.ReceiverReport{
+			Reports: []rtcp.ReceptionReport{
+				{LastSenderReport: ratecontrol.NTPMiddle32(now.Add(-200 * time.Millisecond))},
+			},
+		}
+		g.OnRTCP(now, rr)
+
+		if got := g.State().RTTSample; abs(got-0.2) > 0.001 {
+			t.Errorf("State() RTTSample = %v, want approximately %v", got, 0.2)
+		}
+	})
+}
+
+func TestGcc_OnProbeResult(t *testing.T) {
+	g, err := New(1000, 300, 4000)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	g.OnProbeResult(time.Now(), 800)
+	if got := g.TargetBitrate(); got != 1000 {
+		t.Errorf("TargetBitrate() = %d after a lower probe, want 1000", got)
+	}
+	g.OnProbeResult(time.Now(), 3000)
+	if got := g.TargetBitrate(); got != 3000 {
+		t.Errorf("TargetBitrate() = %d, want 3000", got)
+	}
+	if g.aimd.rate != 3000 || g.lossBasedRate != 3000 {
+		t.Errorf("estimates = %.0f/%.0f, want 3000", g.aimd.rate, g.lossBasedRate)
+	}
+}
+
+// simulateCCFBPath sends n packets every 10ms, matches an RFC 8888 report every 10 packets
+// against the send history and feeds it to g, queueGrowth is added to the one-way delay of each packet
+func simulateCCFBPath(g *Gcc, start time.Time, n int, queueGrowth time.Duration) {
+	const interval = 10 * time.Millisecond
+	const batch = 10
+
+	history := ratecontrol.NewSentHistory(ratecontrol.DefaultFeedbackHistoryAge)
+	for first := 0; first < n; first += batch {
+		block := rtcp.CCFeedbackReportBlock{MediaSSRC: 1, BeginSequence: uint16(first)} //nolint:gosec
+		arrivals := make([]time.Time, 0, batch)
+		for i := first; i < first+batch; i++ {
+			sent := start.Add(time.Duration(i) * interval)
+			seq := uint16(i) //nolint:gosec
+			history.OnPacketSent(ratecontrol.SentPacket{SendTime: sent, SSRC: 1, SequenceNumber: seq, Size: 1200})
+			arrivals = append(arrivals, sent.Add(20*time.Millisecond+time.Duration(i)*queueGrowth))
+		}
+		reportTime := arrivals[len(arrivals)-1].Add(5 * time.Millisecond)
+		for _, arrival := range arrivals {
+			block.MetricBlocks = append(block.MetricBlocks, rtcp.CCFeedbackMetricBlock{
+				Received:          true,
+				ArrivalTimeOffset: uint16(reportTime.Sub(arrival) * 1024 / time.Second), //nolint:gosec
+			})
+		}
+		fb := &rtcp.CCFeedbackReport{
+			SenderSSRC:      2,
+			ReportBlocks:    []rtcp.CCFeedbackReportBlock{block},
+			ReportTimestamp: ratecontrol.NTPMiddle32(reportTime),
+		}
+		g.OnPacketFeedback(reportTime, history.Match(fb))
+	}
+}
+
+func TestGcc_OnPacketFeedback(t *testing.T) {
+	tests := []struct {
+		name        string
+		queueGrowth time.Duration
+		wantAbove   bool
+	}{
+		{"uncongested path ramps up", 0, true},
+		{"growing queue backs off before any loss", time.Millisecond, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, _ := New(1000, 100, 4000)
+			simulateCCFBPath(g, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), 500, tt.queueGrowth)
+
+			if got := g.TargetBitrate(); (got > 1000) != tt.wantAbove {
+				t.Errorf("TargetBitrate() = %v, want above 1000 %v", got, tt.wantAbove)
+			}
+			if g.State().LossRate != 0 {
+				t.Errorf("State() LossRate = %v, want 0", g.State().LossRate)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package gcc
+
+import (
+	"math"
+	"time"
+)
+
+// bandwidthUsage is the output of the overuse detector
+type bandwidthUsage int
+
+const (
+	usageNormal bandwidthUsage = iota
+	usageOverusing
+	usageUnderusing
+)
+
+const (
+	initialThreshold = 12.5
+	minThreshold     = 6.0
+	maxThreshold     = 600.0
+
+	// adaptation gains of the threshold, per ms
+	thresholdGainUp   = 0.0087
+	thresholdGainDown = 0.039
+
+	// overuseTimeThreshold is how long the trend must stay above the threshold, in ms
+	overuseTimeThreshold = 10.0
+	maxThresholdSpike    = 15.0
+	maxAdaptInterval     = 100.0
+)
+
+func (u bandwidthUsage) String() string {
+	switch u {
+	case usageOverusing:
+		return "overusing"
+	case usageUnderusing:
+		return "underusing"
+	default:
+		return "normal"
+	}
+}
+
+// overuseDetector compares the delay trend against an adaptive threshold
+type overuseDetector struct {
+	threshold    float64
+	lastUpdate   time.Time
+	overuseTime  float64
+	overuseCount int
+	prevTrend    float64
+	state        bandwidthUsage
+}
+
+func newOveruseDetector() *overuseDetector {
+	return &overuseDetector{
+		threshold:   initialThreshold,
+		overuseTime: -1,
+		state:       usageNormal,
+	}
+}
+
+// detect classifies the modified trend, sendDelta is the inter-group send delta
+func (d *overuseDetector) detect(trend float64, sendDelta time.Duration, now time.Time) bandwidthUsage {
+	tsDelta := float64(sendDelta) / float64(time.Millisecond)
+
+	switch {
+	case trend > d.threshold:
+		if d.overuseTime < 0 {
+			// start at half the delta, the overuse began somewhere in between
+			d.overuseTime = tsDelta / 2
+		} else {
+			d.overuseTime += tsDelta
+		}
+		d.overuseCount++
+		if d.overuseTime > overuseTimeThreshold && d.overuseCount > 1 && trend >= d.prevTrend {
+			d.overuseTime = 0
+			d.overuseCount = 0
+			d.state = usageOverusing
+		}
+	case trend < -d.threshold:
+		d.overuseTime = -1
+		d.overuseCount = 0
+		d.state = usageUnderusing
+	default:
+		d.overuseTime = -1
+		d.overuseCount = 0
+		d.state = usageNormal
+	}
+	d.prevTrend = trend
+
+	d.updateThreshold(trend, now)
+	return d.state
+}
+
+// updateThreshold adapts the threshold toward |trend|, slower upward than downward
+func (d *overuseDetector) updateThreshold(trend float64, now time.Time) {
+	if d.lastUpdate.IsZero() {
+		d.lastUpdate = now
+	}
+
+	absTrend := math.Abs(trend)
+	if absTrend > d.threshold+maxThresholdSpike {
+		// ignore spikes such as route changes
+		d.lastUpdate = now
+		return
+	}
+
+	gain := thresholdGainDown
+	if absTrend > d.threshold {
+		gain = thresholdGainUp
+	}
+	elapsedMs := math.Min(float64(now.Sub(d.lastUpdate))/float64(time.Millisecond), maxAdaptInterval)
+	d.threshold += gain * (absTrend - d.threshold) * elapsedMs
+	d.threshold = math.Max(minThreshold, math.Min(d.threshold, maxThreshold))
+	d.lastUpdate = now
+}
@@ -0,0 +1,66 @@
+package gcc
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOveruseDetector_Detect(t *testing.T) {
+	sendDelta := 20 * time.Millisecond
+
+	t.Run("normal", func(t *testing.T) {
+		d := newOveruseDetector()
+		if got := d.detect(1.0, sendDelta, time.Now()); got != usageNormal {
+			t.Errorf("detect() = %v, want %v", got, usageNormal)
+		}
+	})
+
+	t.Run("underusing", func(t *testing.T) {
+		d := newOveruseDetector()
+		if got := d.detect(-20.0, sendDelta, time.Now()); got != usageUnderusing {
+			t.Errorf("detect() = %v, want %v", got, usageUnderusing)
+		}
+	})
+
+	t.Run("sustained overuse", func(t *testing.T) {
+		d := newOveruseDetector()
+		now := time.Now()
+		// a single sample above the threshold is not enough
+		if got := d.detect(20.0, sendDelta, now); got != usageNormal {
+			t.Errorf("detect() first sample = %v, want %v", got, usageNormal)
+		}
+		now = now.Add(sendDelta)
+		if got := d.detect(21.0, sendDelta, now); got != usageOverusing {
+			t.Errorf("detect() second sample = %v, want %v", got, usageOverusing)
+		}
+	})
+
+	t.Run("decreasing trend is not overuse", func(t *testing.T) {
+		d := newOveruseDetector()
+		now := time.Now()
+		d.detect(25.0, sendDelta, now)
+		if got := d.detect(20.0, sendDelta, now.Add(sendDelta)); got == usageOverusing {
+			t.Errorf("detect() = %v, want not %v", got, usageOverusing)
+		}
+	})
+}
+
+func TestOveruseDetector_UpdateThreshold(t *testing.T) {
+	d := newOveruseDetector()
+	now := time.Now()
+	d.updateThreshold(0, now)
+
+	// small trends pull the threshold down to the floor
+	for i := 1; i <= 100; i++ {
+		d.updateThreshold(0, now.Add(time.Duration(i)*100*time.Millisecond))
+	}
+	if d.threshold != minThreshold {
+		t.Errorf("threshold = %v, want %v", d.threshold, minThreshold)
+	}
+
+	// a spike far above the threshold is ignored
+	d.updateThreshold(500, now.Add(20*time.Second))
+	if d.threshold != minThreshold {
+		t.Errorf("threshold after spike = %v, want %v", d.threshold, minThreshold)
+	}
+}
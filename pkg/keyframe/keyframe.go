@@ -0,0 +1,128 @@
+// Package keyframe turns PLI and FIR feedback (RFC 4585, RFC 5104) into forced key frames,
+// at most one per minimum interval so a misbehaving receiver can't keep the encoder sending
+// key frames. A request inside the interval is deferred to its end instead of dropped, so the
+// receiver still recovers.
+package keyframe
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pion/rtcp"
+)
+
+// ErrInvalidConfig is returned by New for unusable parameters
+var ErrInvalidConfig = errors.New("invalid keyframe config")
+
+// Config bounds how often key frames are forced
+type Config struct {
+	// MinInterval is the shortest time between two forced key frames
+	MinInterval time.Duration
+}
+
+// DefaultConfig forces at most one key frame per second
+func DefaultConfig() Config {
+	return Config{MinInterval: time.Second}
+}
+
+// Stats counts the key frame requests
+type Stats struct {
+	Requests int
+	Forced   int
+	// Coalesced requests arrived while a key frame was already scheduled
+	Coalesced int
+	// Repeated FIRs carried a sequence number already seen
+	Repeated int
+}
+
+type firKey struct {
+	sender uint32
+	media  uint32
+}
+
+// Limiter decides when to force key frames, it is safe for concurrent use
+type Limiter struct {
+	mu  sync.Mutex
+	cfg Config
+
+	// last is the time of the last forced key frame, in the future while one is scheduled
+	last   time.Time
+	firSeq map[firKey]uint8
+	stats  Stats
+}
+
+// New creates a limiter
+func New(cfg Config) (*Limiter, error) {
+	if cfg.MinInterval < 0 {
+		return nil, fmt.Errorf("%w: min interval %v", ErrInvalidConfig, cfg.MinInterval)
+	}
+	return &Limiter{
+		cfg:    cfg,
+		firSeq: make(map[firKey]uint8),
+	}, nil
+}
+
+// OnRTCP handles PLI and FIR packets. It returns whether a key frame has to be forced
+// and after which delay, zero meaning right away
+func (l *Limiter) OnRTCP(now time.Time, pkt rtcp.Packet) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	switch p := pkt.(type) {
+	case *rtcp.PictureLossIndication:
+		return l.request(now)
+	case *rtcp.FullIntraRequest:
+		fresh := false
+		for _, entry := range p.FIR {
+			// a FIR is repeated with the same sequence number until the key frame arrives
+			key := firKey{sender: p.SenderSSRC, media: entry.SSRC}
+			if seq, ok := l.firSeq[key]; ok && seq == entry.SequenceNumber {
+				l.stats.Repeated++
+				continue
+			}
+			l.firSeq[key] = entry.SequenceNumber
+			fresh = true
+		}
+		if !fresh {
+			return 0, false
+		}
+		return l.request(now)
+	default:
+		return 0, false
+	}
+}
+
+// Request handles a key frame request of another origin, such as one rtpsession sends upstream,
+// like a PLI
+func (l *Limiter) Request(now time.Time) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.request(now)
+}
+
+// request forces a key frame now if the last one is at least MinInterval old, or schedules one
+// at the end of the interval unless one is already scheduled
+func (l *Limiter) request(now time.Time) (time.Duration, bool) {
+	l.stats.Requests++
+	next := l.last.Add(l.cfg.MinInterval)
+	switch {
+	case l.last.IsZero() || !now.Before(next):
+		l.last = now
+	case now.Before(l.last):
+		l.stats.Coalesced++
+		return 0, false
+	default:
+		l.last = next
+	}
+	l.stats.Forced++
+	return l.last.Sub(now), true
+}
+
+// Stats returns the request counters
+func (l *Limiter) Stats() Stats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.stats
+}
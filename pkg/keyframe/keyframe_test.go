@@ -0,0 +1,84 @@
+package keyframe
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pion/rtcp"
+)
+
+func TestNew(t *testing.T) {
+	if _, err := New(Config{MinInterval: -time.Second}); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("New() error = %v, want ErrInvalidConfig", err)
+	}
+}
+
+func TestLimiter_OnRTCP(t *testing.T) {
+	pli := &rtcp.PictureLossIndication{SenderSSRC: 1, MediaSSRC: 2}
+	fir := func(seq uint8) *rtcp.FullIntraRequest {
+		return &rtcp.FullIntraRequest{SenderSSRC: 1, FIR: []rtcp.FIREntry{{SSRC: 2, SequenceNumber: seq}}}
+	}
+
+	type request struct {
+		at        time.Duration
+		pkt       rtcp.Packet
+		wantDelay time.Duration
+		wantForce bool
+	}
+	tests := []struct {
+		name      string
+		requests  []request
+		wantStats Stats
+	}{
+		{
+			name:      "first PLI forces right away",
+			requests:  []request{{0, pli, 0, true}},
+			wantStats: Stats{Requests: 1, Forced: 1},
+		},
+		{
+			name: "PLI storm is deferred and coalesced",
+			requests: []request{
+				{0, pli, 0, true},
+				{100 * time.Millisecond, pli, 900 * time.Millisecond, true},
+				{200 * time.Millisecond, pli, 0, false},
+				{900 * time.Millisecond, pli, 0, false},
+				{2500 * time.Millisecond, pli, 0, true},
+			},
+			wantStats: Stats{Requests: 5, Forced: 3, Coalesced: 2},
+		},
+		{
+			name: "repeated FIR sequence number",
+			requests: []request{
+				{0, fir(1), 0, true},
+				{50 * time.Millisecond, fir(1), 0, false},
+				{2 * time.Second, fir(2), 0, true},
+			},
+			wantStats: Stats{Requests: 2, Forced: 2, Repeated: 1},
+		},
+		{
+			name:      "other feedback",
+			requests:  []request{{0, &rtcp.ReceiverReport{}, 0, false}},
+			wantStats: Stats{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := New(DefaultConfig())
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+			for i, r := range tt.requests {
+				delay, force := l.OnRTCP(start.Add(r.at), r.pkt)
+				if delay != r.wantDelay || force != r.wantForce {
+					t.Errorf("request %d: OnRTCP() = %v, %v, want %v, %v", i, delay, force, r.wantDelay, r.wantForce)
+				}
+			}
+			if got := l.Stats(); got != tt.wantStats {
+				t.Errorf("Stats() = %+v, want %+v", got, tt.wantStats)
+			}
+		})
+	}
+}
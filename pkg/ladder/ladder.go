@@ -0,0 +1,146 @@
+// Package ladder maps the target bitrate to an encoding resolution and framerate. A low bitrate
+// spread over fewer pixels looks better than a starved full resolution picture, and the
+// hysteresis around every rung keeps the encoder from renegotiating on every rate change.
+package ladder
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrInvalidConfig is returned by New for rungs that don't form a ladder and by Parse for
+// malformed rungs
+var ErrInvalidConfig = errors.New("invalid ladder config")
+
+// Rung is the resolution and framerate used from MinKbps up to the MinKbps of the next rung
+type Rung struct {
+	MinKbps int
+	Width   int
+	Height  int
+	FPS     int
+}
+
+// String formats the rung as kbps:WxH@fps
+func (r Rung) String() string {
+	return fmt.Sprintf("%d:%dx%d@%d", r.MinKbps, r.Width, r.Height, r.FPS)
+}
+
+// Config holds the rungs ordered by MinKbps and the hysteresis around them
+type Config struct {
+	Rungs []Rung
+	// Hysteresis is the fraction of its MinKbps the bitrate has to be above a rung to climb to it
+	// and below it to leave it
+	Hysteresis float64
+}
+
+// DefaultConfig drops to 424x240 below 800 Kbps and to 15 fps below 300 Kbps, with 10% hysteresis
+func DefaultConfig() Config {
+	return Config{
+		Rungs: []Rung{
+			{MinKbps: 0, Width: 320, Height: 240, FPS: 15},
+			{MinKbps: 300, Width: 424, Height: 240, FPS: 30},
+			{MinKbps: 800, Width: 640, Height: 480, FPS: 30},
+		},
+		Hysteresis: 0.1,
+	}
+}
+
+// Parse parses a comma separated list of kbps:WxH@fps rungs
+func Parse(s string) ([]Rung, error) {
+	var rungs []Rung
+	for _, field := range strings.Split(s, ",") {
+		var r Rung
+		kbps, rest, ok := strings.Cut(strings.TrimSpace(field), ":")
+		if !ok {
+			return nil, fmt.Errorf("%w: rung %q is not kbps:WxH@fps", ErrInvalidConfig, field)
+		}
+		size, fps, ok := strings.Cut(rest, "@")
+		if !ok {
+			return nil, fmt.Errorf("%w: rung %q is not kbps:WxH@fps", ErrInvalidConfig, field)
+		}
+		width, height, ok := strings.Cut(size, "x")
+		if !ok {
+			return nil, fmt.Errorf("%w: rung %q is not kbps:WxH@fps", ErrInvalidConfig, field)
+		}
+		for _, v := range []struct {
+			dst *int
+			src string
+		}{{&r.MinKbps, kbps}, {&r.Width, width}, {&r.Height, height}, {&r.FPS, fps}} {
+			n, err := strconv.Atoi(v.src)
+			if err != nil {
+				return nil, fmt.Errorf("%w: rung %q: %w", ErrInvalidConfig, field, err)
+			}
+			*v.dst = n
+		}
+		rungs = append(rungs, r)
+	}
+	return rungs, nil
+}
+
+// Ladder tracks the rung of the target bitrate, it is safe for concurrent use
+type Ladder struct {
+	mu         sync.Mutex
+	rungs      []Rung
+	hysteresis float64
+	current    int
+}
+
+// New creates a ladder starting at the rung of initKbps
+func New(cfg Config, initKbps int) (*Ladder, error) {
+	rungs := cfg.Rungs
+	switch {
+	case len(rungs) == 0:
+		return nil, fmt.Errorf("%w: no rungs", ErrInvalidConfig)
+	case cfg.Hysteresis < 0 || cfg.Hysteresis >= 1:
+		return nil, fmt.Errorf("%w: hysteresis %v must be in [0, 1)", ErrInvalidConfig, cfg.Hysteresis)
+	}
+	for i, r := range rungs {
+		if r.Width <= 0 || r.Height <= 0 || r.FPS <= 0 || r.MinKbps < 0 {
+			return nil, fmt.Errorf("%w: rung %v", ErrInvalidConfig, r)
+		}
+		if i > 0 && r.MinKbps <= rungs[i-1].MinKbps {
+			return nil, fmt.Errorf("%w: rung %v not above %v", ErrInvalidConfig, r, rungs[i-1])
+		}
+	}
+	l := &Ladder{
+		rungs:      append([]Rung(nil), rungs...),
+		hysteresis: cfg.Hysteresis,
+	}
+	l.current = l.rungOf(float64(initKbps))
+	return l, nil
+}
+
+// rungOf returns the highest rung whose MinKbps is at most kbps, or the lowest one
+func (l *Ladder) rungOf(kbps float64) int {
+	i := 0
+	for j, r := range l.rungs {
+		if float64(r.MinKbps) <= kbps {
+			i = j
+		}
+	}
+	return i
+}
+
+// Update moves to the rung of kbps and reports whether the rung changed
+func (l *Ladder) Update(kbps int) (Rung, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	prev := l.current
+	if up := l.rungOf(float64(kbps) / (1 + l.hysteresis)); up > l.current {
+		l.current = up
+	} else if down := l.rungOf(float64(kbps) / (1 - l.hysteresis)); down < l.current {
+		l.current = down
+	}
+	return l.rungs[l.current], l.current != prev
+}
+
+// Current returns the rung in use
+func (l *Ladder) Current() Rung {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rungs[l.current]
+}
@@ -0,0 +1,166 @@
+package ladder
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(c *Config)
+		wantErr bool
+	}{
+		{"defaults", func(*Config) {}, false},
+		{"no rungs", func(c *Config) { c.Rungs = nil }, true},
+		{"negative hysteresis", func(c *Config) { c.Hysteresis = -0.1 }, true},
+		{"hysteresis of one", func(c *Config) { c.Hysteresis = 1 }, true},
+		{"zero width", func(c *Config) { c.Rungs[1].Width = 0 }, true},
+		{"zero fps", func(c *Config) { c.Rungs[1].FPS = 0 }, true},
+		{"unordered", func(c *Config) { c.Rungs[0], c.Rungs[1] = c.Rungs[1], c.Rungs[0] }, true},
+		{"duplicate min", func(c *Config) { c.Rungs[1].MinKbps = c.Rungs[2].MinKbps }, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			tt.modify(&cfg)
+			_, err := New(cfg, 1000)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !errors.Is(err, ErrInvalidConfig) {
+				t.Errorf("error %v does not wrap ErrInvalidConfig", err)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    []Rung
+		wantErr bool
+	}{
+		{"single", "0:640x480@30", []Rung{{0, 640, 480, 30}}, false},
+		{"defaults", "0:320x240@15, 300:424x240@30,800:640x480@30", DefaultConfig().Rungs, false},
+		{"missing fps", "0:640x480", nil, true},
+		{"missing kbps", "640x480@30", nil, true},
+		{"missing height", "0:640@30", nil, true},
+		{"not a number", "0:640xabc@30", nil, true},
+		{"empty", "", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidConfig) {
+					t.Errorf("error %v does not wrap ErrInvalidConfig", err)
+				}
+				return
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Parse() = %v, want %v", got, tt.want)
+			}
+			for i := range tt.want {
+				if got[i] != tt.want[i] {
+					t.Errorf("Parse()[%d] = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestNew_initialRung(t *testing.T) {
+	tests := []struct {
+		initKbps int
+		want     Rung
+	}{
+		{100, DefaultConfig().Rungs[0]},
+		{500, DefaultConfig().Rungs[1]},
+		{800, DefaultConfig().Rungs[2]},
+		{5000, DefaultConfig().Rungs[2]},
+	}
+
+	for _, tt := range tests {
+		l, err := New(DefaultConfig(), tt.initKbps)
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+		if got := l.Current(); got != tt.want {
+			t.Errorf("New(%d).Current() = %v, want %v", tt.initKbps, got, tt.want)
+		}
+	}
+}
+
+func TestLadder_Update(t *testing.T) {
+	type step struct {
+		kbps        int
+		wantMin     int
+		wantChanged bool
+	}
+	tests := []struct {
+		name  string
+		init  int
+		steps []step
+	}{
+		{
+			name: "climbs past the hysteresis",
+			init: 200,
+			steps: []step{
+				{300, 0, false},
+				{329, 0, false},
+				{330, 300, true},
+				{2000, 800, true},
+			},
+		},
+		{
+			name: "descends past the hysteresis",
+			init: 1000,
+			steps: []step{
+				{800, 800, false},
+				{721, 800, false},
+				{719, 300, true},
+				{280, 300, false},
+				{100, 0, true},
+			},
+		},
+		{
+			name: "skips rungs on a large drop",
+			init: 1000,
+			steps: []step{
+				{150, 0, true},
+			},
+		},
+		{
+			name: "holds between the thresholds",
+			init: 500,
+			steps: []step{
+				{290, 300, false},
+				{860, 300, false},
+				{300, 300, false},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := New(DefaultConfig(), tt.init)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			for i, s := range tt.steps {
+				got, changed := l.Update(s.kbps)
+				if got.MinKbps != s.wantMin || changed != s.wantChanged {
+					t.Errorf("step %d: Update(%d) = %v, %v, want rung %d, %v",
+						i, s.kbps, got, changed, s.wantMin, s.wantChanged)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,253 @@
+package nada
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/pion/rtcp"
+
+	"github.com/arsperger/slowcast/pkg/ratecontrol"
+	"github.com/arsperger/slowcast/pkg/tfrc"
+)
+
+// Name is the registry name of the NADA controller
+const Name = "nada"
+
+// Default parameters of RFC 8698 Figure 3, delays in ms
+const (
+	prio     = 1.0
+	xRef     = 10.0
+	kappa    = 0.5
+	eta      = 2.0
+	tau      = 500.0
+	deltaMax = 500.0
+
+	qeps     = 10.0
+	dfilt    = 120.0
+	gammaMax = 0.5
+	qbound   = 50.0
+
+	// non-linear warping of the queuing delay under loss
+	qth    = 50.0
+	lambda = 0.5
+
+	dmark = 200.0
+	dloss = 1000.0
+
+	// baseDelayWindow is how long the minimum RTT is kept as the base delay
+	baseDelayWindow = 10 * time.Minute
+)
+
+var (
+	_ ratecontrol.RateController    = (*Nada)(nil)
+	_ ratecontrol.ProbeConsumer     = (*Nada)(nil)
+	_ ratecontrol.SendStatsConsumer = (*Nada)(nil)
+)
+
+// Nada is a Network-Assisted Dynamic Adaptation (RFC 8698) sender, RTT and loss
+// bookkeeping is delegated to a Tfrc instance fed with the same receiver reports
+type Nada struct {
+	mu sync.Mutex
+
+	feedback *tfrc.Tfrc
+
+	// rate limits Kbps
+	minBitrate int
+	maxBitrate int
+	refRate    float64
+	// sendRate is the measured sending rate in Kbps, the ramp-up base until X_recv is known
+	sendRate int
+
+	baseDelay     float64
+	baseDelayTime time.Time
+	queueDelay    float64
+	markRate      float64
+	xPrev         float64
+	xCurr         float64
+	rampUp        bool
+	lastFeedback  time.Time
+}
+
+// New creates a NADA controller, bitrates in Kbps
+func New(init, min, max int) (*Nada, error) { //nolint:predeclared
+	return NewWithClock(init, min, max, nil)
+}
+
+// NewWithClock creates a NADA controller whose TFRC feedback reads the time from clock
+func NewWithClock(init, min, max int, clock ratecontrol.Clock) (*Nada, error) { //nolint:predeclared
+	return newNada(ratecontrol.Config{
+		InitBitrate: init,
+		MinBitrate:  min,
+		MaxBitrate:  max,
+		Clock:       clock,
+	})
+}
+
+// newNada creates a NADA controller whose TFRC feedback gets the clock and sender reports of cfg
+func newNada(cfg ratecontrol.Config) (*Nada, error) {
+	init, min, max := cfg.InitBitrate, cfg.MinBitrate, cfg.MaxBitrate //nolint:predeclared
+	if min <= 0 || min > max || init < min || init > max {
+		return nil, fmt.Errorf("invalid bitrate limits: init %d, min %d, max %d", init, min, max)
+	}
+	controller, err := tfrc.NewController(cfg)
+	if err != nil {
+		return nil, err
+	}
+	feedback, ok := controller.(*tfrc.Tfrc)
+	if !ok {
+		return nil, fmt.Errorf("unexpected TFRC controller type %T", controller)
+	}
+	return &Nada{
+		feedback:   feedback,
+		minBitrate: min,
+		maxBitrate: max,
+		refRate:    float64(init),
+		baseDelay:  math.Inf(1),
+		rampUp:     true,
+	}, nil
+}
+
+// NewController is a ratecontrol.Factory creating a NADA controller
+func NewController(cfg ratecontrol.Config) (ratecontrol.RateController, error) {
+	return newNada(cfg)
+}
+
+// OnRTCP updates the reference rate on every receiver report,
+// RFC 8888 feedback only contributes the ECN marking ratio
+func (n *Nada) OnRTCP(now time.Time, pkt rtcp.Packet) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	switch p := pkt.(type) {
+	case *rtcp.ReceiverReport:
+		if len(p.Reports) == 0 {
+			return
+		}
+		n.feedback.OnRTCP(now, p)
+		n.updateQueueDelay(now, n.feedback.GetRttSample()*1000)
+		n.updateRate(now)
+	case *rtcp.CCFeedbackReport:
+		n.updateMarkRate(p)
+	}
+}
+
+// updateQueueDelay derives the queuing delay from the RTT above its minimum, in ms
+func (n *Nada) updateQueueDelay(now time.Time, rtt float64) {
+	if rtt <= 0 {
+		return
+	}
+	if rtt < n.baseDelay || now.Sub(n.baseDelayTime) > baseDelayWindow {
+		n.baseDelay = rtt
+		n.baseDelayTime = now
+	}
+	n.queueDelay = rtt - n.baseDelay
+}
+
+// updateMarkRate computes the fraction of received packets carrying an ECN-CE mark
+func (n *Nada) updateMarkRate(fb *rtcp.CCFeedbackReport) {
+	var marked, received int
+	for _, block := range fb.ReportBlocks {
+		for _, metric := range block.MetricBlocks {
+			if !metric.Received {
+				continue
+			}
+			received++
+			if metric.ECN == rtcp.ECNCE {
+				marked++
+			}
+		}
+	}
+	if received > 0 {
+		n.markRate = float64(marked) / float64(received)
+	}
+}
+
+// congestionSignal returns the aggregated congestion signal x_curr of RFC 8698 section 4.2, in ms
+func (n *Nada) congestionSignal(lossRate float64) float64 {
+	dTilde := n.queueDelay
+	if lossRate > 0 && n.queueDelay > qth {
+		// warp the delay so that loss dominates the signal once queues overflow
+		dTilde = qth * math.Exp(-lambda*(n.queueDelay-qth)/qth)
+	}
+	return dTilde + dmark*n.markRate + dloss*lossRate
+}
+
+// updateRate runs the accelerated ramp-up or the gradual update of RFC 8698 section 4.3
+func (n *Nada) updateRate(now time.Time) {
+	delta := deltaMax
+	if !n.lastFeedback.IsZero() {
+		delta = math.Min(float64(now.Sub(n.lastFeedback))/float64(time.Millisecond), deltaMax)
+	}
+	n.lastFeedback = now
+
+	lossRate := n.feedback.LossEventRate()
+	n.xPrev = n.xCurr
+	n.xCurr = n.congestionSignal(lossRate)
+
+	// ramp up fast only while there is no loss, no marking and no queue
+	n.rampUp = lossRate == 0 && n.markRate == 0 && n.queueDelay < qeps
+
+	rtt := n.feedback.GetSmoothedRTT() * 1000
+	if n.rampUp {
+		// r_ref = max(r_ref, (1+gamma)*r_recv), held until a rate was measured
+		gamma := math.Min(gammaMax, qbound/(rtt+deltaMax+dfilt))
+		if recvRate, ok := n.receiveRate(); ok {
+			n.refRate = math.Max(n.refRate, (1+gamma)*float64(recvRate))
+		}
+	} else {
+		rmax := float64(n.maxBitrate)
+		xOffset := n.xCurr - prio*xRef*rmax/n.refRate
+		xDiff := n.xCurr - n.xPrev
+		n.refRate -= kappa * (delta / tau) * (xOffset / tau) * n.refRate
+		n.refRate -= kappa * eta * (xDiff / tau) * n.refRate
+	}
+	n.refRate = math.Max(float64(n.minBitrate), math.Min(n.refRate, float64(n.maxBitrate)))
+}
+
+// receiveRate returns r_recv in Kbps, the sending rate stands in before the receiver reports
+// carried sequence counters
+func (n *Nada) receiveRate() (int, bool) {
+	if rate, ok := n.feedback.ReceiveRate(); ok {
+		return rate, true
+	}
+	return n.sendRate, n.sendRate > 0
+}
+
+// OnSendStats records the sending rate and passes the packet size on to the TFRC feedback
+func (n *Nada) OnSendStats(now time.Time, stats ratecontrol.SendStats) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.sendRate = stats.RateKbps
+	n.feedback.OnSendStats(now, stats)
+}
+
+// OnProbeResult raises the reference rate to a probed rate while ramping up
+func (n *Nada) OnProbeResult(_ time.Time, deliveredKbps int) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if !n.rampUp {
+		return
+	}
+	n.refRate = math.Max(n.refRate, math.Min(float64(deliveredKbps), float64(n.maxBitrate)))
+}
+
+// TargetBitrate returns the reference rate in Kbps
+func (n *Nada) TargetBitrate() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return int(n.refRate)
+}
+
+// State returns the current NADA estimates
+func (n *Nada) State() ratecontrol.State {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return ratecontrol.State{
+		Bitrate:     int(n.refRate),
+		RTTSample:   n.feedback.GetRttSample(),
+		SmoothedRTT: n.feedback.GetSmoothedRTT(),
+		LossRate:    n.feedback.GetLastFraction(),
+	}
+}
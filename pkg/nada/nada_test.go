@@ -0,0 +1,219 @@
+package nada
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pion/rtcp"
+
+	"github.com/arsperger/slowcast/pkg/ratecontrol"
+)
+
+// receiverReport builds a report whose LSR/DLSR yield the given RTT against the wall clock
+func receiverReport(rtt time.Duration, fractionLost uint8) *rtcp.ReceiverReport {
+	return &rtcp.ReceiverReport{
+		Reports: []rtcp.ReceptionReport{{
+			SSRC:             1,
+			FractionLost:     fractionLost,
+			LastSenderReport: ratecontrol.NTPMiddle32(time.Now().Add(-rtt)),
+		}},
+	}
+}
+
+// receiverReportSeq is receiverReport with the extended highest sequence number received
+func receiverReportSeq(rtt time.Duration, fractionLost uint8, seq uint32) *rtcp.ReceiverReport {
+	rr := receiverReport(rtt, fractionLost)
+	rr.Reports[0].LastSequenceNumber = seq
+	return rr
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		init    int
+		min     int
+		max     int
+		wantErr bool
+	}{
+		{name: "valid parameters", init: 1000, min: 500, max: 4000, wantErr: false},
+		{name: "init above max", init: 5000, min: 500, max: 4000, wantErr: true},
+		{name: "min greater than max", init: 1000, min: 5000, max: 4000, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := New(tt.init, tt.min, tt.max)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && n.TargetBitrate() != tt.init {
+				t.Errorf("New() bitrate = %v, want %v", n.TargetBitrate(), tt.init)
+			}
+		})
+	}
+}
+
+func TestNada_CongestionSignal(t *testing.T) {
+	n, _ := New(1000, 500, 4000)
+
+	tests := []struct {
+		name       string
+		queueDelay float64
+		markRate   float64
+		lossRate   float64
+		expected   float64
+	}{
+		{name: "queuing delay only", queueDelay: 30, expected: 30},
+		{name: "marking", queueDelay: 10, markRate: 0.1, expected: 10 + dmark*0.1},
+		{name: "loss below threshold", queueDelay: 40, lossRate: 0.01, expected: 40 + dloss*0.01},
+		{name: "loss warps large delay", queueDelay: qth, lossRate: 0.01, expected: qth + dloss*0.01},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n.queueDelay = tt.queueDelay
+			n.markRate = tt.markRate
+			if got := n.congestionSignal(tt.lossRate); abs(got-tt.expected) > 1e-9 {
+				t.Errorf("congestionSignal() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+
+	t.Run("warped delay shrinks", func(t *testing.T) {
+		n.markRate = 0
+		n.queueDelay = 200
+		if got := n.congestionSignal(0.01); got >= qth+dloss*0.01 {
+			t.Errorf("congestionSignal() = %v, want below %v", got, qth+dloss*0.01)
+		}
+	})
+}
+
+func TestNada_UpdateMarkRate(t *testing.T) {
+	n, _ := New(1000, 500, 4000)
+	fb := &rtcp.CCFeedbackReport{
+		ReportBlocks: []rtcp.CCFeedbackReportBlock{{
+			MetricBlocks: []rtcp.CCFeedbackMetricBlock{
+				{Received: true, ECN: rtcp.ECNCE},
+				{Received: true, ECN: rtcp.ECNECT0},
+				{Received: true, ECN: rtcp.ECNECT0},
+				{Received: true, ECN: rtcp.ECNECT0},
+				{Received: false},
+			},
+		}},
+	}
+	n.OnRTCP(time.Now(), fb)
+
+	if n.markRate != 0.25 {
+		t.Errorf("markRate = %v, want %v", n.markRate, 0.25)
+	}
+}
+
+func TestNada_OnRTCP(t *testing.T) {
+	t.Run("accelerated ramp-up without congestion", func(t *testing.T) {
+		n, _ := New(1000, 500, 4000)
+		n.OnSendStats(time.Now(), ratecontrol.SendStats{AvgPacketSize: 1000, RateKbps: 1000})
+		now := time.Now()
+		var seq uint32
+		for i := 0; i < 5; i++ {
+			now = now.Add(time.Second)
+			seq += 125 // 1000 Kbps of 1000 byte packets
+			n.OnRTCP(now, receiverReportSeq(50*time.Millisecond, 0, seq))
+		}
+
+		if !n.rampUp {
+			t.Error("rampUp = false, want true")
+		}
+		if got := n.TargetBitrate(); got <= 1000 || got > int((1+gammaMax)*1000) {
+			t.Errorf("TargetBitrate() = %v, want in (1000, %v]", got, (1+gammaMax)*1000)
+		}
+	})
+
+	t.Run("ramp-up anchored to the received rate", func(t *testing.T) {
+		n, _ := New(1000, 500, 4000)
+		n.OnSendStats(time.Now(), ratecontrol.SendStats{AvgPacketSize: 1000, RateKbps: 1000})
+		now := time.Now()
+		var seq uint32
+		for i := 0; i < 20; i++ {
+			now = now.Add(time.Second)
+			seq += 50 // the receiver only gets 400 Kbps
+			n.OnRTCP(now, receiverReportSeq(50*time.Millisecond, 0, seq))
+		}
+
+		// only the first report, before X_recv is known, ramps up from the sending rate
+		if got := n.TargetBitrate(); got > int((1+gammaMax)*1000) {
+			t.Errorf("TargetBitrate() = %v, want at most %v", got, (1+gammaMax)*1000)
+		}
+	})
+
+	t.Run("ramp-up holds without a rate measurement", func(t *testing.T) {
+		n, _ := New(1000, 500, 4000)
+		n.OnRTCP(time.Now(), receiverReport(50*time.Millisecond, 0))
+		if got := n.TargetBitrate(); got != 1000 {
+			t.Errorf("TargetBitrate() = %v, want 1000", got)
+		}
+	})
+
+	t.Run("gradual decrease on queuing delay", func(t *testing.T) {
+		n, _ := New(3000, 500, 4000)
+		now := time.Now()
+		n.OnRTCP(now, receiverReport(50*time.Millisecond, 0))
+		start := n.TargetBitrate()
+		for i := 0; i < 5; i++ {
+			now = now.Add(time.Second)
+			n.OnRTCP(now, receiverReport(250*time.Millisecond, 0))
+		}
+
+		if n.rampUp {
+			t.Error("rampUp = true, want false")
+		}
+		if got := n.TargetBitrate(); got >= start {
+			t.Errorf("TargetBitrate() = %v, want below %v", got, start)
+		}
+	})
+
+	t.Run("loss drives the rate down", func(t *testing.T) {
+		n, _ := New(3000, 500, 4000)
+		now := time.Now()
+		var seq uint32
+		for i := 0; i < 5; i++ {
+			now = now.Add(time.Second)
+			seq += 256
+			rr := receiverReportSeq(50*time.Millisecond, 25, seq)
+			rr.Reports[0].TotalLost = uint32(25 * (i + 1)) //nolint:gosec
+			n.OnRTCP(now, rr)
+		}
+
+		if got := n.TargetBitrate(); got >= 3000 {
+			t.Errorf("TargetBitrate() = %v, want below %v", got, 3000)
+		}
+		if got := n.State().LossRate; got != 25.0/256.0 {
+			t.Errorf("State() LossRate = %v, want %v", got, 25.0/256.0)
+		}
+	})
+}
+
+// Helper function for floating point comparison
+func abs(x float64) float64 {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func TestNada_OnProbeResult(t *testing.T) {
+	n, err := New(1000, 500, 4000)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	n.OnProbeResult(time.Now(), 6000)
+	if got := n.TargetBitrate(); got != 4000 {
+		t.Errorf("TargetBitrate() = %d, want the 4000 cap", got)
+	}
+
+	n.rampUp = false
+	n.refRate = 1000
+	n.OnProbeResult(time.Now(), 3000)
+	if got := n.TargetBitrate(); got != 1000 {
+		t.Errorf("TargetBitrate() = %d outside ramp up, want 1000", got)
+	}
+}
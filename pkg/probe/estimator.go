@@ -0,0 +1,117 @@
+package probe
+
+import "time"
+
+const (
+	// minReceivedRatio is the share of a cluster that must arrive for the estimate to count
+	minReceivedRatio = 0.8
+
+	// maxRecvSendRatio rejects clusters whose packets were bunched on the way
+	maxRecvSendRatio = 2.0
+)
+
+// probePacket is a sent probe packet waiting for its feedback
+type probePacket struct {
+	sendTime time.Time
+	size     int
+	received bool
+	verdict  bool
+	arrival  time.Duration
+}
+
+// cluster is a burst of probe packets paced at targetKbps over the media rate
+type cluster struct {
+	id         int
+	targetKbps int
+	mediaKbps  int
+
+	start time.Time
+	// scheduled bytes and packets
+	bytes    int
+	packets  int
+	finished bool
+
+	// sent packets by transport-wide sequence number
+	sent map[uint16]*probePacket
+}
+
+// Result is the outcome of a probe cluster
+type Result struct {
+	ClusterID  int
+	TargetKbps int
+	// DeliveredKbps is the media rate plus the probe rate that reached the receiver
+	DeliveredKbps int
+	// Confirmed is false when too many probe packets were lost or the timing was unusable
+	Confirmed bool
+}
+
+// complete reports whether every sent packet of a finished cluster has a verdict
+func (c *cluster) complete() bool {
+	if !c.finished || len(c.sent) < c.packets {
+		return false
+	}
+	for _, p := range c.sent {
+		if !p.verdict {
+			return false
+		}
+	}
+	return true
+}
+
+// estimate computes the delivered rate as the smaller of the send and receive rates
+// of the probe packets, the last packet of the send side and the first of the receive
+// side only bound the intervals
+func (c *cluster) estimate() Result {
+	result := Result{ClusterID: c.id, TargetKbps: c.targetKbps}
+	if len(c.sent) == 0 {
+		return result
+	}
+
+	var (
+		firstSend, lastSend         time.Time
+		firstArrival, lastArrival   time.Duration
+		sentBytes, recvBytes        int
+		lastSendSize, firstRecvSize int
+		received                    int
+	)
+	for _, p := range c.sent {
+		sentBytes += p.size
+		if firstSend.IsZero() || p.sendTime.Before(firstSend) {
+			firstSend = p.sendTime
+		}
+		if p.sendTime.After(lastSend) {
+			lastSend = p.sendTime
+			lastSendSize = p.size
+		}
+		if !p.received {
+			continue
+		}
+		if received == 0 || p.arrival < firstArrival {
+			firstArrival = p.arrival
+			firstRecvSize = p.size
+		}
+		if received == 0 || p.arrival > lastArrival {
+			lastArrival = p.arrival
+		}
+		recvBytes += p.size
+		received++
+	}
+
+	if float64(received) < minReceivedRatio*float64(len(c.sent)) {
+		return result
+	}
+	sendInterval := lastSend.Sub(firstSend).Seconds()
+	recvInterval := (lastArrival - firstArrival).Seconds()
+	if sendInterval <= 0 || recvInterval <= 0 {
+		return result
+	}
+	sendKbps := float64(sentBytes-lastSendSize) * 8 / 1000 / sendInterval
+	recvKbps := float64(recvBytes-firstRecvSize) * 8 / 1000 / recvInterval
+	if recvKbps > maxRecvSendRatio*sendKbps {
+		return result
+	}
+
+	result.DeliveredKbps = c.mediaKbps + int(min(sendKbps, recvKbps))
+	result.Confirmed = true
+	return result
+}
@@ -0,0 +1,67 @@
+package probe
+
+import (
+	"testing"
+	"time"
+)
+
+// newTestCluster sends n probe packets every sendGap, arriving every recvGap,
+// dropping the packets in lost
+func newTestCluster(n int, sendGap, recvGap time.Duration, lost map[int]bool) *cluster {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := &cluster{id: 1, targetKbps: 3000, mediaKbps: 1000, start: start, packets: n, finished: true,
+		sent: make(map[uint16]*probePacket)}
+	for i := range n {
+		c.sent[uint16(i)] = &probePacket{ //nolint:gosec
+			sendTime: start.Add(time.Duration(i) * sendGap),
+			size:     PacketSize,
+			verdict:  true,
+			received: !lost[i],
+			arrival:  time.Duration(i) * recvGap,
+		}
+	}
+	return c
+}
+
+func TestCluster_Estimate(t *testing.T) {
+	// 275 bytes every 1ms is 2200 Kbps
+	tests := []struct {
+		name          string
+		cluster       *cluster
+		wantConfirmed bool
+		wantKbps      int
+	}{
+		{"uncongested", newTestCluster(20, time.Millisecond, time.Millisecond, nil), true, 3200},
+		{"bottleneck halves the rate", newTestCluster(20, time.Millisecond, 2*time.Millisecond, nil), true, 2100},
+		{"too much loss", newTestCluster(20, time.Millisecond, time.Millisecond, map[int]bool{1: true, 3: true, 5: true, 7: true, 9: true}), false, 0},
+		{"bunched arrivals", newTestCluster(20, time.Millisecond, 100*time.Microsecond, nil), false, 0},
+		{"no packets", &cluster{}, false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.cluster.estimate()
+			if got.Confirmed != tt.wantConfirmed {
+				t.Fatalf("estimate() = %+v, want confirmed %v", got, tt.wantConfirmed)
+			}
+			if got.DeliveredKbps != tt.wantKbps {
+				t.Errorf("DeliveredKbps = %d, want %d", got.DeliveredKbps, tt.wantKbps)
+			}
+		})
+	}
+}
+
+func TestCluster_Complete(t *testing.T) {
+	c := newTestCluster(5, time.Millisecond, time.Millisecond, nil)
+	if !c.complete() {
+		t.Error("complete() = false with every verdict in")
+	}
+	c.sent[2].verdict = false
+	if c.complete() {
+		t.Error("complete() = true with a verdict missing")
+	}
+	c = newTestCluster(5, time.Millisecond, time.Millisecond, nil)
+	c.finished = false
+	if c.complete() {
+		t.Error("complete() = true while still sending")
+	}
+}
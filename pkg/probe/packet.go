@@ -0,0 +1,35 @@
+package probe
+
+import "encoding/binary"
+
+const (
+	rtpHeaderSize = 12
+
+	// oneByteExtensionSize is the 0xBEDE header plus one 2 byte element padded to 32 bits
+	oneByteExtensionSize = 8
+
+	// maxPaddingSize is the largest padding the one byte RTP padding count can describe
+	maxPaddingSize = 255
+
+	// PacketSize is the size of every probe packet
+	PacketSize = rtpHeaderSize + oneByteExtensionSize + maxPaddingSize
+)
+
+// paddingPacket builds a padding-only RTP packet carrying an empty transport-wide
+// sequence number extension, rtpsession fills in the sequence number on the way out
+func paddingPacket(ssrc uint32, seq uint16, timestamp uint32, payloadType, twccExtID uint8) []byte {
+	pkt := make([]byte, PacketSize)
+	pkt[0] = 0x80 | 0x20 | 0x10 // version 2, padding, extension
+	pkt[1] = payloadType & 0x7F
+	binary.BigEndian.PutUint16(pkt[2:], seq)
+	binary.BigEndian.PutUint32(pkt[4:], timestamp)
+	binary.BigEndian.PutUint32(pkt[8:], ssrc)
+
+	ext := pkt[rtpHeaderSize:]
+	binary.BigEndian.PutUint16(ext[0:], 0xBEDE)
+	binary.BigEndian.PutUint16(ext[2:], 1) // length in 32 bit words
+	ext[4] = twccExtID<<4 | 1              // 2 byte element
+
+	pkt[len(pkt)-1] = maxPaddingSize
+	return pkt
+}
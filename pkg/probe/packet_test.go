@@ -0,0 +1,36 @@
+package probe
+
+import (
+	"testing"
+	"time"
+
+	"github.com/arsperger/slowcast/pkg/ratecontrol"
+)
+
+func TestPaddingPacket(t *testing.T) {
+	pkt := paddingPacket(0xCAFE, 42, 9000, 96, 3)
+	if len(pkt) != PacketSize {
+		t.Fatalf("len = %d, want %d", len(pkt), PacketSize)
+	}
+	if pkt[0]&0x20 == 0 {
+		t.Error("padding bit not set")
+	}
+	if pkt[1] != 96 {
+		t.Errorf("payload type = %d, want 96", pkt[1])
+	}
+	if pkt[len(pkt)-1] != maxPaddingSize {
+		t.Errorf("padding count = %d, want %d", pkt[len(pkt)-1], maxPaddingSize)
+	}
+
+	parsed, err := ratecontrol.ParseRTP(time.Now(), pkt, 3)
+	if err != nil {
+		t.Fatalf("ParseRTP() error = %v", err)
+	}
+	if parsed.SSRC != 0xCAFE || parsed.SequenceNumber != 42 {
+		t.Errorf("ParseRTP() SSRC/seq = %x/%d, want cafe/42", parsed.SSRC, parsed.SequenceNumber)
+	}
+	if !parsed.HasTransportSequence || parsed.TransportSequenceNumber != 0 {
+		t.Errorf("ParseRTP() transport seq = %v/%d, want an empty placeholder",
+			parsed.HasTransportSequence, parsed.TransportSequenceNumber)
+	}
+}
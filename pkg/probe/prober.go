@@ -0,0 +1,283 @@
+// Package probe sends short paced bursts of padding RTP packets above the media rate
+// and measures from transport-wide CC feedback which rate reached the receiver,
+// letting the rate controller jump to a confirmed rate instead of ramping up.
+package probe
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pion/rtcp"
+
+	"github.com/arsperger/slowcast/pkg/ratecontrol"
+)
+
+const (
+	// rtpClockRate is the timestamp rate of the probe packets
+	rtpClockRate = 90000
+
+	// defaultPayloadType keeps the padding apart from the media, RTX and FEC payload types
+	defaultPayloadType = 124
+
+	// clusterTimeout closes a cluster whose feedback is incomplete, missing packets count as lost
+	clusterTimeout = time.Second
+
+	// dropFactor is the rate decrease that marks a loss episode
+	dropFactor = 0.9
+)
+
+// ErrInvalidConfig is returned by New for unusable parameters
+var ErrInvalidConfig = errors.New("invalid probe config")
+
+var _ ratecontrol.PacketObserver = (*Prober)(nil)
+
+// Config describes the probe stream and when to probe
+type Config struct {
+	// SSRC, PayloadType and TWCCExtensionID of the padding packets
+	SSRC            uint32
+	PayloadType     uint8
+	TWCCExtensionID uint8
+	// MaxBitrate caps the probed rate in Kbps
+	MaxBitrate int
+	// InitialMultipliers of the media rate are probed at startup
+	InitialMultipliers []float64
+	// RecoveryMultiplier of the media rate is probed once loss clears after a rate drop
+	RecoveryMultiplier float64
+	// RecoveryDelay is how long the loss has to stay at zero before the recovery probe
+	RecoveryDelay time.Duration
+	// ClusterDuration and MinPackets bound the length of a cluster
+	ClusterDuration time.Duration
+	MinPackets      int
+}
+
+// DefaultConfig probes 3 and 6 times the initial rate and twice the rate after a loss episode
+func DefaultConfig(ssrc uint32, maxBitrate int) Config {
+	return Config{
+		SSRC:               ssrc,
+		PayloadType:        defaultPayloadType,
+		TWCCExtensionID:    1,
+		MaxBitrate:         maxBitrate,
+		InitialMultipliers: []float64{3, 6},
+		RecoveryMultiplier: 2,
+		RecoveryDelay:      2 * time.Second,
+		ClusterDuration:    50 * time.Millisecond,
+		MinPackets:         5,
+	}
+}
+
+// Prober schedules probe clusters, paces their packets and turns feedback into results
+type Prober struct {
+	mu  sync.Mutex
+	cfg Config
+
+	started   bool
+	mediaKbps int
+	// transportFeedback is set by the first transport-wide CC feedback, without it no
+	// cluster can be confirmed so none is sent
+	transportFeedback bool
+	dropped           bool
+	lossClear         time.Time
+
+	nextID   int
+	pending  []*cluster
+	active   *cluster
+	awaiting []*cluster
+
+	// RTP sequence number of every probe packet mapped to its cluster
+	seq       uint16
+	byRTPSeq  map[uint16]*cluster
+	byTWCCSeq map[uint16]*probePacket
+}
+
+// New creates a prober
+func New(cfg Config) (*Prober, error) {
+	switch {
+	case cfg.MaxBitrate <= 0:
+		return nil, fmt.Errorf("%w: max bitrate %d", ErrInvalidConfig, cfg.MaxBitrate)
+	case cfg.ClusterDuration <= 0 || cfg.MinPackets < 2:
+		return nil, fmt.Errorf("%w: cluster of %v and %d packets", ErrInvalidConfig, cfg.ClusterDuration, cfg.MinPackets)
+	case cfg.TWCCExtensionID == 0 || cfg.TWCCExtensionID > 14:
+		return nil, fmt.Errorf("%w: extension id %d", ErrInvalidConfig, cfg.TWCCExtensionID)
+	case cfg.PayloadType > 127:
+		return nil, fmt.Errorf("%w: payload type %d", ErrInvalidConfig, cfg.PayloadType)
+	}
+	return &Prober{
+		cfg:       cfg,
+		byRTPSeq:  make(map[uint16]*cluster),
+		byTWCCSeq: make(map[uint16]*probePacket),
+	}, nil
+}
+
+// Config returns the configuration of the prober
+func (p *Prober) Config() Config {
+	return p.cfg
+}
+
+// FilterFeedback removes what pkt reports about the padding stream and returns nil when nothing
+// is left, its report blocks would count padding only as a media stream of its own
+func (p *Prober) FilterFeedback(pkt rtcp.Packet) rtcp.Packet {
+	return ratecontrol.FilterFeedback(pkt, p.cfg.SSRC)
+}
+
+// OnBitrate follows the media rate and schedules the startup probes and the
+// recovery probe once the loss clears after a rate drop
+func (p *Prober) OnBitrate(now time.Time, kbps int, lossRate float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.started {
+		p.started = true
+		p.mediaKbps = kbps
+		for _, m := range p.cfg.InitialMultipliers {
+			p.schedule(int(float64(kbps) * m))
+		}
+		return
+	}
+
+	if float64(kbps) < dropFactor*float64(p.mediaKbps) {
+		p.dropped = true
+	}
+	p.mediaKbps = kbps
+
+	switch {
+	case lossRate > 0:
+		p.lossClear = time.Time{}
+	case p.lossClear.IsZero():
+		p.lossClear = now
+	}
+	if p.dropped && !p.lossClear.IsZero() && now.Sub(p.lossClear) >= p.cfg.RecoveryDelay && p.idle() {
+		p.dropped = false
+		p.schedule(int(float64(kbps) * p.cfg.RecoveryMultiplier))
+	}
+}
+
+// idle reports whether no cluster is being sent or waiting for feedback
+func (p *Prober) idle() bool {
+	return len(p.pending) == 0 && p.active == nil && len(p.awaiting) == 0
+}
+
+// schedule queues a cluster probing targetKbps, capped at the max bitrate
+func (p *Prober) schedule(targetKbps int) {
+	targetKbps = min(targetKbps, p.cfg.MaxBitrate)
+	if targetKbps <= p.mediaKbps {
+		return
+	}
+	p.nextID++
+	p.pending = append(p.pending, &cluster{
+		id:         p.nextID,
+		targetKbps: targetKbps,
+		sent:       make(map[uint16]*probePacket),
+	})
+}
+
+// NextPacket returns the next probe packet due at now, the caller loops until ok is false.
+// Probing waits for the receiver to send transport-wide CC feedback, receiver reports can't
+// time a cluster.
+func (p *Prober) NextPacket(now time.Time) ([]byte, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.transportFeedback {
+		return nil, false
+	}
+	if p.active == nil {
+		if len(p.pending) == 0 {
+			return nil, false
+		}
+		p.active = p.pending[0]
+		p.pending = p.pending[1:]
+		p.active.start = now
+		p.active.mediaKbps = p.mediaKbps
+	}
+	c := p.active
+
+	// padding fills the gap between the media rate and the probed rate
+	paddingKbps := float64(c.targetKbps - c.mediaKbps)
+	elapsed := now.Sub(c.start)
+	budget := int(paddingKbps * 1000 / 8 * elapsed.Seconds())
+	total := int(paddingKbps * 1000 / 8 * p.cfg.ClusterDuration.Seconds())
+
+	if c.bytes >= total && c.packets >= p.cfg.MinPackets {
+		c.finished = true
+		p.awaiting = append(p.awaiting, c)
+		p.active = nil
+		return nil, false
+	}
+	if c.packets > 0 && c.bytes >= budget {
+		return nil, false
+	}
+
+	p.seq++
+	timestamp := uint32(now.UnixMicro() / 100 * (rtpClockRate / 10000)) //nolint:gosec // wraps like RTP timestamps
+	pkt := paddingPacket(p.cfg.SSRC, p.seq, timestamp, p.cfg.PayloadType, p.cfg.TWCCExtensionID)
+	p.byRTPSeq[p.seq] = c
+	c.bytes += len(pkt)
+	c.packets++
+	return pkt, true
+}
+
+// OnPacketSent records the transport-wide sequence number rtpsession gave a probe packet
+func (p *Prober) OnPacketSent(pkt ratecontrol.SentPacket) {
+	if pkt.SSRC != p.cfg.SSRC || !pkt.HasTransportSequence {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	seq := pkt.SequenceNumber
+	c, ok := p.byRTPSeq[seq]
+	if !ok {
+		return
+	}
+	delete(p.byRTPSeq, seq)
+	probe := &probePacket{sendTime: pkt.SendTime, size: pkt.Size}
+	c.sent[pkt.TransportSequenceNumber] = probe
+	p.byTWCCSeq[pkt.TransportSequenceNumber] = probe
+}
+
+// OnRTCP takes the probe packet verdicts from transport-wide CC feedback and
+// returns the results of the clusters that are complete or timed out
+func (p *Prober) OnRTCP(now time.Time, pkt rtcp.Packet) []Result {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if fb, ok := pkt.(*rtcp.TransportLayerCC); ok {
+		p.transportFeedback = true
+		for _, r := range ratecontrol.DecodeTransportCC(fb) {
+			probe, ok := p.byTWCCSeq[r.SequenceNumber]
+			if !ok {
+				continue
+			}
+			probe.verdict = true
+			probe.received = r.Received
+			probe.arrival = r.Arrival
+		}
+	}
+
+	var results []Result
+	remaining := p.awaiting[:0]
+	for _, c := range p.awaiting {
+		if !c.complete() && now.Sub(c.start) < clusterTimeout {
+			remaining = append(remaining, c)
+			continue
+		}
+		results = append(results, c.estimate())
+		p.forget(c)
+	}
+	p.awaiting = remaining
+	return results
+}
+
+// forget drops the lookup entries of a closed cluster
+func (p *Prober) forget(c *cluster) {
+	for seq := range c.sent {
+		delete(p.byTWCCSeq, seq)
+	}
+	for seq, owner := range p.byRTPSeq {
+		if owner == c {
+			delete(p.byRTPSeq, seq)
+		}
+	}
+}
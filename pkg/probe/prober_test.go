@@ -0,0 +1,239 @@
+package probe
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pion/rtcp"
+
+	"github.com/arsperger/slowcast/pkg/ratecontrol"
+)
+
+type sentProbe struct {
+	twccSeq  uint16
+	sendTime time.Time
+}
+
+// runClusters paces every scheduled cluster in 1ms steps, numbering the packets
+// the way rtpsession would, and returns the sent packets
+func runClusters(t *testing.T, p *Prober, now time.Time) ([]sentProbe, time.Time) {
+	t.Helper()
+	var sent []sentProbe
+	var twccSeq uint16 = 100
+	// the receiver sends transport-wide CC feedback about the media
+	p.OnRTCP(now, &rtcp.TransportLayerCC{})
+	for range 1000 {
+		for {
+			pkt, ok := p.NextPacket(now)
+			if !ok {
+				break
+			}
+			parsed, err := ratecontrol.ParseRTP(now, pkt, 1)
+			if err != nil {
+				t.Fatalf("ParseRTP() error = %v", err)
+			}
+			parsed.TransportSequenceNumber = twccSeq
+			p.OnPacketSent(parsed)
+			sent = append(sent, sentProbe{twccSeq: twccSeq, sendTime: now})
+			twccSeq++
+		}
+		p.mu.Lock()
+		done := p.active == nil && len(p.pending) == 0
+		p.mu.Unlock()
+		if done {
+			break
+		}
+		now = now.Add(time.Millisecond)
+	}
+	return sent, now
+}
+
+// feedback reports every sent packet as received through a bottleneck of bottleneckKbps
+func feedback(sent []sentProbe, bottleneckKbps float64) *rtcp.TransportLayerCC {
+	fb := &rtcp.TransportLayerCC{
+		BaseSequenceNumber: sent[0].twccSeq,
+		PacketStatusCount:  uint16(len(sent)), //nolint:gosec
+	}
+	perPacket := time.Duration(float64(PacketSize*8) / bottleneckKbps * float64(time.Millisecond))
+	var busy, last time.Duration
+	start := sent[0].sendTime
+	for _, s := range sent {
+		arrival := max(s.sendTime.Sub(start), busy) + perPacket
+		busy = arrival
+		fb.PacketChunks = append(fb.PacketChunks, &rtcp.RunLengthChunk{
+			Type:               rtcp.TypeTCCRunLengthChunk,
+			PacketStatusSymbol: rtcp.TypeTCCPacketReceivedSmallDelta,
+			RunLength:          1,
+		})
+		fb.RecvDeltas = append(fb.RecvDeltas, &rtcp.RecvDelta{
+			Type:  rtcp.TypeTCCPacketReceivedSmallDelta,
+			Delta: (arrival - last).Microseconds(),
+		})
+		last = arrival
+	}
+	return fb
+}
+
+func TestNew_InvalidConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*Config)
+	}{
+		{"no max", func(c *Config) { c.MaxBitrate = 0 }},
+		{"no duration", func(c *Config) { c.ClusterDuration = 0 }},
+		{"one packet", func(c *Config) { c.MinPackets = 1 }},
+		{"bad extension id", func(c *Config) { c.TWCCExtensionID = 15 }},
+		{"bad payload type", func(c *Config) { c.PayloadType = 128 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig(1, 4000)
+			tt.modify(&cfg)
+			if _, err := New(cfg); !errors.Is(err, ErrInvalidConfig) {
+				t.Errorf("New() error = %v, want ErrInvalidConfig", err)
+			}
+		})
+	}
+}
+
+func TestProber_StartupProbe(t *testing.T) {
+	cfg := DefaultConfig(0xBEEF, 4000)
+	cfg.InitialMultipliers = []float64{3}
+	p, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	p.OnBitrate(now, 1000, 0)
+
+	sent, now := runClusters(t, p, now)
+	// 2000 Kbps of padding over 50ms is 12500 bytes
+	if len(sent) < 45 || len(sent) > 47 {
+		t.Fatalf("sent %d probe packets, want ~46", len(sent))
+	}
+
+	// nothing yet without feedback
+	if results := p.OnRTCP(now, &rtcp.ReceiverReport{}); len(results) != 0 {
+		t.Fatalf("OnRTCP() = %+v before feedback", results)
+	}
+
+	// the bottleneck leaves 1500 Kbps next to the media
+	results := p.OnRTCP(now.Add(100*time.Millisecond), feedback(sent, 1500))
+	if len(results) != 1 {
+		t.Fatalf("OnRTCP() returned %d results, want 1", len(results))
+	}
+	got := results[0]
+	if !got.Confirmed || got.TargetKbps != 3000 {
+		t.Fatalf("result = %+v, want a confirmed 3000 Kbps cluster", got)
+	}
+	if got.DeliveredKbps < 2400 || got.DeliveredKbps > 2600 {
+		t.Errorf("DeliveredKbps = %d, want ~2500", got.DeliveredKbps)
+	}
+	if len(p.byTWCCSeq) != 0 || len(p.byRTPSeq) != 0 {
+		t.Errorf("lookups not cleared: %d/%d", len(p.byTWCCSeq), len(p.byRTPSeq))
+	}
+}
+
+func TestProber_Timeout(t *testing.T) {
+	p, err := New(DefaultConfig(0xBEEF, 4000))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	p.OnBitrate(now, 1000, 0)
+	_, now = runClusters(t, p, now)
+
+	results := p.OnRTCP(now.Add(2*clusterTimeout), &rtcp.ReceiverReport{})
+	if len(results) != 2 {
+		t.Fatalf("OnRTCP() returned %d results, want 2", len(results))
+	}
+	for _, r := range results {
+		if r.Confirmed {
+			t.Errorf("result %+v confirmed without feedback", r)
+		}
+	}
+	// 6x is capped at the max bitrate
+	if results[1].TargetKbps != 4000 {
+		t.Errorf("TargetKbps = %d, want 4000", results[1].TargetKbps)
+	}
+}
+
+func TestProber_RecoveryProbe(t *testing.T) {
+	cfg := DefaultConfig(0xBEEF, 4000)
+	cfg.InitialMultipliers = nil
+	p, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	p.OnBitrate(now, 2000, 0)
+
+	// loss episode drops the rate
+	now = now.Add(time.Second)
+	p.OnBitrate(now, 1200, 0.05)
+	now = now.Add(time.Second)
+	p.OnBitrate(now, 1000, 0)
+	if !p.idle() {
+		t.Fatal("probed before the loss cleared for RecoveryDelay")
+	}
+	now = now.Add(cfg.RecoveryDelay)
+	p.OnBitrate(now, 1000, 0)
+	if len(p.pending) != 1 || p.pending[0].targetKbps != 2000 {
+		t.Fatalf("pending = %+v, want one 2000 Kbps cluster", p.pending)
+	}
+
+	// only once per episode
+	p.pending = nil
+	p.OnBitrate(now.Add(time.Minute), 1000, 0)
+	if !p.idle() {
+		t.Error("probed again without a new drop")
+	}
+}
+
+func TestProber_IgnoresMediaPackets(t *testing.T) {
+	p, err := New(DefaultConfig(0xBEEF, 4000))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	p.OnPacketSent(ratecontrol.SentPacket{SSRC: 0x1234, SequenceNumber: 1, HasTransportSequence: true})
+	if len(p.byTWCCSeq) != 0 {
+		t.Error("recorded a media packet")
+	}
+}
+
+func TestProber_WaitsForTransportFeedback(t *testing.T) {
+	p, err := New(DefaultConfig(0xBEEF, 4000))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	p.OnBitrate(now, 1000, 0)
+
+	// a receiver sending receiver reports only gets no padding
+	p.OnRTCP(now, &rtcp.ReceiverReport{})
+	if _, ok := p.NextPacket(now.Add(time.Millisecond)); ok {
+		t.Fatal("NextPacket() sent padding without transport-wide CC feedback")
+	}
+
+	p.OnRTCP(now, &rtcp.TransportLayerCC{})
+	if _, ok := p.NextPacket(now.Add(2 * time.Millisecond)); !ok {
+		t.Error("NextPacket() sent nothing after transport-wide CC feedback")
+	}
+}
+
+func TestProber_FilterFeedback(t *testing.T) {
+	p, err := New(DefaultConfig(0xBEEF, 4000))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	rr := &rtcp.ReceiverReport{SSRC: 1, Reports: []rtcp.ReceptionReport{{SSRC: 0x1234}, {SSRC: 0xBEEF}}}
+	got, ok := p.FilterFeedback(rr).(*rtcp.ReceiverReport)
+	if !ok || len(got.Reports) != 1 || got.Reports[0].SSRC != 0x1234 {
+		t.Errorf("FilterFeedback() = %+v, want the media report block only", got)
+	}
+	twcc := &rtcp.TransportLayerCC{SenderSSRC: 1, MediaSSRC: 0xBEEF}
+	if got := p.FilterFeedback(twcc); got != twcc {
+		t.Errorf("FilterFeedback() = %+v, want the transport-wide feedback kept", got)
+	}
+}
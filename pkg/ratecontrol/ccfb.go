@@ -0,0 +1,170 @@
+package ratecontrol
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pion/rtcp"
+)
+
+const (
+	// DefaultFeedbackHistoryAge is how long sent packets wait for RFC 8888 feedback
+	DefaultFeedbackHistoryAge = 5 * time.Second
+
+	// ccfbArrivalUnavailable is the RFC 8888 arrival time offset of packets without a timestamp
+	ccfbArrivalUnavailable = 0x1FFF
+)
+
+// PacketFeedback is the receiver verdict on one sent RTP packet
+type PacketFeedback struct {
+	Sent     SentPacket
+	Received bool
+	ECN      rtcp.ECN
+	// Arrival is the receive time on the receiver clock and Delay the one-way delay,
+	// which includes the unknown offset between the clocks so only its changes are meaningful.
+	// Both are only valid if HasArrival is set
+	Arrival    time.Duration
+	Delay      time.Duration
+	HasArrival bool
+}
+
+// FeedbackReport holds the packets of one RFC 8888 report matched against their send times,
+// ordered by send time
+type FeedbackReport struct {
+	ReceiverSSRC uint32
+	Packets      []PacketFeedback
+}
+
+// PacketFeedbackConsumer is implemented by controllers that use per-packet delay and loss samples
+type PacketFeedbackConsumer interface {
+	OnPacketFeedback(now time.Time, report FeedbackReport)
+}
+
+type sentKey struct {
+	ssrc uint32
+	seq  uint16
+}
+
+type sentRecord struct {
+	pkt SentPacket
+	// reported holds, per receiver SSRC, whether the packet was reported received
+	reported map[uint32]bool
+}
+
+// receiverClock unwraps the 32 bit compact NTP arrival times of one receiver
+type receiverClock struct {
+	primed  bool
+	last    uint32
+	arrival time.Duration
+}
+
+func (c *receiverClock) unwrap(ntp uint32) time.Duration {
+	if c.primed {
+		c.arrival += compactNTPDelta(ntp - c.last)
+	} else {
+		c.primed = true
+		c.arrival = compactNTPDelta(ntp)
+	}
+	c.last = ntp
+	return c.arrival
+}
+
+// compactNTPDelta converts the difference of two compact NTP timestamps, 1/65536 seconds
+// with wraparound, into a signed duration
+func compactNTPDelta(d uint32) time.Duration {
+	return time.Duration(int32(d)) * time.Second / 65536 //nolint:gosec
+}
+
+// SentHistory records the send time of RTP packets by SSRC and sequence number so that
+// RFC 8888 congestion control feedback can be matched against them, it is safe for concurrent use
+type SentHistory struct {
+	mu      sync.Mutex
+	maxAge  time.Duration
+	packets map[sentKey]*sentRecord
+	order   []sentKey
+	clocks  map[uint32]*receiverClock
+}
+
+// NewSentHistory returns a history keeping packets for maxAge
+func NewSentHistory(maxAge time.Duration) *SentHistory {
+	return &SentHistory{
+		maxAge:  maxAge,
+		packets: make(map[sentKey]*sentRecord),
+		order:   make([]sentKey, 0, 1024),
+		clocks:  make(map[uint32]*receiverClock),
+	}
+}
+
+// OnPacketSent records pkt and forgets packets older than the max age
+func (h *SentHistory) OnPacketSent(pkt SentPacket) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for len(h.order) > 0 {
+		oldest, ok := h.packets[h.order[0]]
+		if ok && pkt.SendTime.Sub(oldest.pkt.SendTime) < h.maxAge {
+			break
+		}
+		delete(h.packets, h.order[0])
+		h.order = h.order[1:]
+	}
+	key := sentKey{ssrc: pkt.SSRC, seq: pkt.SequenceNumber}
+	h.packets[key] = &sentRecord{pkt: pkt}
+	h.order = append(h.order, key)
+}
+
+// Len returns the number of packets waiting for feedback
+func (h *SentHistory) Len() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.packets)
+}
+
+// Match looks up the packets of an RFC 8888 report. Packets not in the history are skipped, and so
+// are packets the same receiver already reported, RFC 8888 reports overlap, unless a loss turned
+// into a late arrival
+func (h *SentHistory) Match(fb *rtcp.CCFeedbackReport) FeedbackReport {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	report := FeedbackReport{ReceiverSSRC: fb.SenderSSRC}
+	clock, ok := h.clocks[fb.SenderSSRC]
+	if !ok {
+		clock = &receiverClock{}
+		h.clocks[fb.SenderSSRC] = clock
+	}
+
+	for _, block := range fb.ReportBlocks {
+		for i, metric := range block.MetricBlocks {
+			key := sentKey{ssrc: block.MediaSSRC, seq: block.BeginSequence + uint16(i)} //nolint:gosec
+			rec, ok := h.packets[key]
+			if !ok {
+				continue
+			}
+			received, seen := rec.reported[fb.SenderSSRC]
+			if seen && (received || !metric.Received) {
+				continue
+			}
+			if rec.reported == nil {
+				rec.reported = make(map[uint32]bool, 1)
+			}
+			rec.reported[fb.SenderSSRC] = metric.Received
+
+			result := PacketFeedback{Sent: rec.pkt, Received: metric.Received, ECN: metric.ECN}
+			if metric.Received && metric.ArrivalTimeOffset != ccfbArrivalUnavailable {
+				// arrival in receiver compact NTP time, ATO is in 1/1024 seconds
+				arrival := fb.ReportTimestamp - uint32(metric.ArrivalTimeOffset)*64
+				result.Arrival = clock.unwrap(arrival)
+				result.Delay = compactNTPDelta(arrival - NTPMiddle32(rec.pkt.SendTime))
+				result.HasArrival = true
+			}
+			report.Packets = append(report.Packets, result)
+		}
+	}
+
+	sort.SliceStable(report.Packets, func(i, j int) bool {
+		return report.Packets[i].Sent.SendTime.Before(report.Packets[j].Sent.SendTime)
+	})
+	return report
+}
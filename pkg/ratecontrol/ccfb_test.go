@@ -0,0 +1,92 @@
+package ratecontrol
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pion/rtcp"
+)
+
+func TestSentHistory_Match(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	h := NewSentHistory(DefaultFeedbackHistoryAge)
+	for i := range 4 {
+		h.OnPacketSent(SentPacket{SendTime: start.Add(time.Duration(i) * 10 * time.Millisecond), SSRC: 1,
+			SequenceNumber: uint16(100 + i), Size: 1000}) //nolint:gosec
+	}
+
+	// reported 250ms after the first send, packets arrived 50ms after being sent
+	reportTime := start.Add(250 * time.Millisecond)
+	ato := func(sent int) uint16 {
+		arrival := start.Add(time.Duration(sent)*10*time.Millisecond + 50*time.Millisecond)
+		return uint16(reportTime.Sub(arrival) * 1024 / time.Second) //nolint:gosec
+	}
+	fb := &rtcp.CCFeedbackReport{
+		SenderSSRC:      7,
+		ReportTimestamp: NTPMiddle32(reportTime),
+		ReportBlocks: []rtcp.CCFeedbackReportBlock{{
+			MediaSSRC:     1,
+			BeginSequence: 99, // not in the history
+			MetricBlocks: []rtcp.CCFeedbackMetricBlock{
+				{Received: true, ArrivalTimeOffset: 0},
+				{Received: true, ECN: rtcp.ECNCE, ArrivalTimeOffset: ato(0)},
+				{Received: false},
+				{Received: true, ArrivalTimeOffset: ccfbArrivalUnavailable},
+			},
+		}},
+	}
+
+	report := h.Match(fb)
+	if report.ReceiverSSRC != 7 || len(report.Packets) != 3 {
+		t.Fatalf("Match() = %+v, want 3 packets from receiver 7", report)
+	}
+	first := report.Packets[0]
+	if !first.Received || !first.HasArrival || first.ECN != rtcp.ECNCE || first.Sent.SequenceNumber != 100 {
+		t.Errorf("first packet = %+v, want 100 received with arrival and ECN-CE", first)
+	}
+	if d := first.Delay - 50*time.Millisecond; d < -time.Millisecond || d > time.Millisecond {
+		t.Errorf("first packet delay = %v, want 50ms", first.Delay)
+	}
+	if report.Packets[1].Received || report.Packets[1].HasArrival {
+		t.Errorf("second packet = %+v, want lost", report.Packets[1])
+	}
+	if !report.Packets[2].Received || report.Packets[2].HasArrival {
+		t.Errorf("third packet = %+v, want received without arrival time", report.Packets[2])
+	}
+
+	// the next report overlaps, only the late arrival of the lost packet is new
+	fb.ReportBlocks[0].MetricBlocks[2] = rtcp.CCFeedbackMetricBlock{Received: true, ArrivalTimeOffset: ato(1)}
+	report = h.Match(fb)
+	if len(report.Packets) != 1 || report.Packets[0].Sent.SequenceNumber != 101 || !report.Packets[0].Received {
+		t.Errorf("overlapping Match() = %+v, want only packet 101 received", report.Packets)
+	}
+
+	// another receiver gets its own verdicts
+	fb.SenderSSRC = 8
+	if report = h.Match(fb); len(report.Packets) != 3 {
+		t.Errorf("Match() for a second receiver = %d packets, want 3", len(report.Packets))
+	}
+}
+
+func TestSentHistory_maxAge(t *testing.T) {
+	start := time.Now()
+	h := NewSentHistory(time.Second)
+	for i := range 30 {
+		h.OnPacketSent(SentPacket{SendTime: start.Add(time.Duration(i) * 100 * time.Millisecond), SSRC: 1,
+			SequenceNumber: uint16(i)}) //nolint:gosec
+	}
+	if got := h.Len(); got != 10 {
+		t.Errorf("Len() = %d, want 10", got)
+	}
+}
+
+func TestReceiverClock_unwrap(t *testing.T) {
+	var c receiverClock
+	first := c.unwrap(0xFFFF0000)
+	if got := c.unwrap(0x00010000) - first; got != 2*time.Second {
+		t.Errorf("arrival across the wraparound advanced %v, want 2s", got)
+	}
+	if got := c.unwrap(0x00008000) - first; got != 1500*time.Millisecond {
+		t.Errorf("earlier arrival = %v, want 1.5s", got)
+	}
+}
@@ -0,0 +1,24 @@
+package ratecontrol
+
+import "time"
+
+// Clock provides the current time to controllers, replaced by a simulated clock in tests and simulations
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock is the wall clock
+type SystemClock struct{}
+
+// Now returns time.Now()
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+// ClockOrSystem returns c, or the wall clock when c is nil
+func ClockOrSystem(c Clock) Clock {
+	if c == nil {
+		return SystemClock{}
+	}
+	return c
+}
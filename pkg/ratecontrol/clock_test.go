@@ -0,0 +1,30 @@
+package ratecontrol
+
+import (
+	"testing"
+	"time"
+)
+
+type fixedClock struct {
+	now time.Time
+}
+
+func (c fixedClock) Now() time.Time {
+	return c.now
+}
+
+func TestClockOrSystem(t *testing.T) {
+	if _, ok := ClockOrSystem(nil).(SystemClock); !ok {
+		t.Error("ClockOrSystem(nil) did not return SystemClock")
+	}
+
+	fixed := fixedClock{now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	if got := ClockOrSystem(fixed).Now(); !got.Equal(fixed.now) {
+		t.Errorf("ClockOrSystem(fixed).Now() = %v, want %v", got, fixed.now)
+	}
+
+	before := time.Now()
+	if got := (SystemClock{}).Now(); got.Before(before) {
+		t.Errorf("SystemClock.Now() = %v, before %v", got, before)
+	}
+}
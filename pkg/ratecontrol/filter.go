@@ -0,0 +1,77 @@
+package ratecontrol
+
+import "github.com/pion/rtcp"
+
+// FilterFeedback removes what pkt reports about ssrc and returns nil when nothing is left.
+// Streams sent next to the media, like retransmissions or probe padding, must not reach the
+// rate controllers and circuit breakers as a media stream of their own. Transport-wide and
+// RFC 8888 feedback are kept, they cover every packet sent.
+func FilterFeedback(pkt rtcp.Packet, ssrc uint32) rtcp.Packet {
+	switch p := pkt.(type) {
+	case *rtcp.ReceiverReport:
+		reports := make([]rtcp.ReceptionReport, 0, len(p.Reports))
+		for _, block := range p.Reports {
+			if block.SSRC != ssrc {
+				reports = append(reports, block)
+			}
+		}
+		if len(reports) == len(p.Reports) {
+			return pkt
+		}
+		if len(reports) == 0 {
+			return nil
+		}
+		filtered := *p
+		filtered.Reports = reports
+		return &filtered
+	case *rtcp.ExtendedReport:
+		blocks := make([]rtcp.ReportBlock, 0, len(p.Reports))
+		for _, block := range p.Reports {
+			if !onlyAbout(block.DestinationSSRC(), ssrc) {
+				blocks = append(blocks, block)
+			}
+		}
+		if len(blocks) == len(p.Reports) {
+			return pkt
+		}
+		if len(blocks) == 0 {
+			return nil
+		}
+		return &rtcp.ExtendedReport{SenderSSRC: p.SenderSSRC, Reports: blocks}
+	case *rtcp.TransportLayerNack:
+		if p.MediaSSRC == ssrc {
+			return nil
+		}
+	case *rtcp.PictureLossIndication:
+		if p.MediaSSRC == ssrc {
+			return nil
+		}
+	case *rtcp.FullIntraRequest:
+		entries := make([]rtcp.FIREntry, 0, len(p.FIR))
+		for _, entry := range p.FIR {
+			if entry.SSRC != ssrc {
+				entries = append(entries, entry)
+			}
+		}
+		if len(entries) == len(p.FIR) {
+			return pkt
+		}
+		if len(entries) == 0 {
+			return nil
+		}
+		filtered := *p
+		filtered.FIR = entries
+		return &filtered
+	}
+	return pkt
+}
+
+// onlyAbout reports whether a report block refers to ssrc and no other stream
+func onlyAbout(ssrcs []uint32, ssrc uint32) bool {
+	for _, s := range ssrcs {
+		if s != ssrc {
+			return false
+		}
+	}
+	return len(ssrcs) > 0
+}
@@ -0,0 +1,94 @@
+package ratecontrol
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/pion/rtcp"
+)
+
+func TestFilterFeedback(t *testing.T) {
+	const (
+		mediaSSRC = 0x11111111
+		rtxSSRC   = 0x22222222
+	)
+	rrtr := &rtcp.ReceiverReferenceTimeReportBlock{NTPTimestamp: 1}
+	mediaRLE := &rtcp.LossRLEReportBlock{SSRC: mediaSSRC}
+	rtxRLE := &rtcp.LossRLEReportBlock{SSRC: rtxSSRC}
+
+	tests := []struct {
+		name string
+		in   rtcp.Packet
+		want rtcp.Packet
+	}{
+		{
+			name: "media report block kept",
+			in:   &rtcp.ReceiverReport{SSRC: 1, Reports: []rtcp.ReceptionReport{{SSRC: mediaSSRC}}},
+			want: &rtcp.ReceiverReport{SSRC: 1, Reports: []rtcp.ReceptionReport{{SSRC: mediaSSRC}}},
+		},
+		{
+			name: "rtx report block removed",
+			in:   &rtcp.ReceiverReport{SSRC: 1, Reports: []rtcp.ReceptionReport{{SSRC: mediaSSRC}, {SSRC: rtxSSRC}}},
+			want: &rtcp.ReceiverReport{SSRC: 1, Reports: []rtcp.ReceptionReport{{SSRC: mediaSSRC}}},
+		},
+		{
+			name: "rtx only receiver report dropped",
+			in:   &rtcp.ReceiverReport{SSRC: 1, Reports: []rtcp.ReceptionReport{{SSRC: rtxSSRC}}},
+			want: nil,
+		},
+		{
+			name: "empty receiver report kept",
+			in:   &rtcp.ReceiverReport{SSRC: 1},
+			want: &rtcp.ReceiverReport{SSRC: 1},
+		},
+		{
+			name: "rtx xr block removed",
+			in:   &rtcp.ExtendedReport{SenderSSRC: 1, Reports: []rtcp.ReportBlock{rrtr, mediaRLE, rtxRLE}},
+			want: &rtcp.ExtendedReport{SenderSSRC: 1, Reports: []rtcp.ReportBlock{rrtr, mediaRLE}},
+		},
+		{
+			name: "rtx only xr dropped",
+			in:   &rtcp.ExtendedReport{SenderSSRC: 1, Reports: []rtcp.ReportBlock{rtxRLE}},
+			want: nil,
+		},
+		{
+			name: "rtx nack dropped",
+			in:   &rtcp.TransportLayerNack{SenderSSRC: 1, MediaSSRC: rtxSSRC},
+			want: nil,
+		},
+		{
+			name: "media nack kept",
+			in:   &rtcp.TransportLayerNack{SenderSSRC: 1, MediaSSRC: mediaSSRC},
+			want: &rtcp.TransportLayerNack{SenderSSRC: 1, MediaSSRC: mediaSSRC},
+		},
+		{
+			name: "rtx pli dropped",
+			in:   &rtcp.PictureLossIndication{SenderSSRC: 1, MediaSSRC: rtxSSRC},
+			want: nil,
+		},
+		{
+			name: "rtx fir entry removed",
+			in:   &rtcp.FullIntraRequest{SenderSSRC: 1, FIR: []rtcp.FIREntry{{SSRC: rtxSSRC}, {SSRC: mediaSSRC}}},
+			want: &rtcp.FullIntraRequest{SenderSSRC: 1, FIR: []rtcp.FIREntry{{SSRC: mediaSSRC}}},
+		},
+		{
+			name: "transport feedback kept",
+			in:   &rtcp.TransportLayerCC{SenderSSRC: 1, MediaSSRC: rtxSSRC},
+			want: &rtcp.TransportLayerCC{SenderSSRC: 1, MediaSSRC: rtxSSRC},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := FilterFeedback(tt.in, rtxSSRC)
+			if tt.want == nil {
+				if got != nil {
+					t.Errorf("FilterFeedback() = %+v, want nil", got)
+				}
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FilterFeedback() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package ratecontrol
+
+import "time"
+
+const ntpEpochOffset = 2208988800
+
+// NTPTime returns the 64 bit NTP timestamp of t: 32 bits of seconds since 1900 and 32 bits of fraction
+//
+//nolint:gosec
+func NTPTime(t time.Time) uint64 {
+	t = t.UTC()
+	secs := uint64(t.Unix()) + ntpEpochOffset
+	frac := uint64(t.Nanosecond()) * (1 << 32) / 1e9
+	return secs<<32 | frac
+}
+
+// NTPMiddle32 returns the compact NTP timestamp used by the LSR field:
+// low 16 bits of the NTP seconds and high 16 bits of the fraction
+func NTPMiddle32(t time.Time) uint32 {
+	return uint32(NTPTime(t) >> 16) //nolint:gosec
+}
+
+// RTTFromReport computes the RTT in seconds from the LSR and DLSR fields of a report block,
+// ok is false when the receiver has not seen a sender report yet
+func RTTFromReport(now time.Time, lsr, delay uint32) (float64, bool) {
+	if lsr == 0 {
+		return 0, false
+	}
+	// modular arithmetic copes with the 16 bit seconds wraparound
+	rtt := int32(NTPMiddle32(now) - lsr - delay) //nolint:gosec
+	if rtt < 0 {
+		return 0, false
+	}
+	return float64(rtt) / 65536.0, true
+}
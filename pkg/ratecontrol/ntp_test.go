@@ -0,0 +1,89 @@
+package ratecontrol
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNTPMiddle32(t *testing.T) {
+	// 2025-01-01 00:00:00.5 UTC
+	now := time.Date(2025, 1, 1, 0, 0, 0, 500000000, time.UTC)
+	secs := uint32((uint64(now.Unix()) + ntpEpochOffset) & 0xFFFF)
+
+	got := NTPMiddle32(now)
+	if got>>16 != secs {
+		t.Errorf("NTPMiddle32() seconds = %d, want %d", got>>16, secs)
+	}
+	if got&0xFFFF != 0x8000 {
+		t.Errorf("NTPMiddle32() fraction = %#x, want %#x", got&0xFFFF, 0x8000)
+	}
+}
+
+func TestRTTFromReport(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 10, 0, time.UTC)
+	sent := now.Add(-300 * time.Millisecond)
+	delay := uint32(6554) // receiver held the report for ~100ms
+
+	tests := []struct {
+		name   string
+		lsr    uint32
+		delay  uint32
+		want   float64
+		wantOk bool
+	}{
+		{
+			name:   "valid report",
+			lsr:    NTPMiddle32(sent),
+			delay:  delay,
+			want:   0.2,
+			wantOk: true,
+		},
+		{
+			name:   "no sender report yet",
+			lsr:    0,
+			delay:  0,
+			want:   0,
+			wantOk: false,
+		},
+		{
+			name:   "delay larger than elapsed time",
+			lsr:    NTPMiddle32(sent),
+			delay:  uint32(65536),
+			want:   0,
+			wantOk: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := RTTFromReport(now, tt.lsr, tt.delay)
+			if ok != tt.wantOk {
+				t.Fatalf("RTTFromReport() ok = %v, want %v", ok, tt.wantOk)
+			}
+			if abs(got-tt.want) > 0.001 {
+				t.Errorf("RTTFromReport() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("seconds wraparound", func(t *testing.T) {
+		// now lands right after the 16 bit NTP seconds counter wrapped to zero
+		wrap := time.Unix(int64(56*65536-ntpEpochOffset), 250000000)
+		lsr := NTPMiddle32(wrap.Add(-500 * time.Millisecond))
+		if lsr>>16 != 0xFFFF {
+			t.Fatalf("LSR seconds = %#x, want %#x", lsr>>16, 0xFFFF)
+		}
+		got, ok := RTTFromReport(wrap, lsr, 0)
+		if !ok || abs(got-0.5) > 0.001 {
+			t.Errorf("RTTFromReport() = %v, %v, want %v, true", got, ok, 0.5)
+		}
+	})
+}
+
+// Helper function for floating point comparison
+func abs(x float64) float64 {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,133 @@
+package ratecontrol
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+// TransportWideCCURI identifies the transport-wide sequence number RTP header extension
+const TransportWideCCURI = "http://www.ietf.org/id/draft-holmer-rmcat-transport-wide-cc-extensions-01"
+
+const (
+	rtpHeaderSize         = 12
+	oneByteExtProfile     = 0xBEDE
+	twoByteExtProfileMask = 0xFFF0
+	twoByteExtProfile     = 0x1000
+)
+
+// ErrInvalidRTP is returned when a buffer does not hold a valid RTP packet
+var ErrInvalidRTP = errors.New("invalid RTP packet")
+
+// SentPacket describes an RTP packet handed to the network
+type SentPacket struct {
+	SendTime       time.Time
+	SSRC           uint32
+	SequenceNumber uint16
+	// TransportSequenceNumber is only valid when HasTransportSequence is set
+	TransportSequenceNumber uint16
+	HasTransportSequence    bool
+	// Size is the RTP packet size in bytes, header included
+	Size int
+}
+
+// PacketObserver is implemented by controllers that need to see every RTP packet sent
+type PacketObserver interface {
+	OnPacketSent(pkt SentPacket)
+}
+
+// SendLimiter is implemented by window-based controllers that hold packets
+// in a sender queue until the congestion window has room for them
+type SendLimiter interface {
+	PacketObserver
+	// OnPacketQueued is called when an RTP packet of size bytes enters the sender queue
+	OnPacketQueued(now time.Time, ssrc uint32, seq uint16, size int)
+	// OnPacketDequeued is called when a packet leaves the sender queue, before it waits for
+	// CanSend. It returns false when the packet waited so long it has to be dropped instead
+	OnPacketDequeued(now time.Time, ssrc uint32, seq uint16) bool
+	// CanSend reports whether the next queued packet may be transmitted
+	CanSend(now time.Time) bool
+}
+
+// ParseRTP reads the fields of a SentPacket from a raw RTP packet,
+// the transport-wide sequence number is looked up under extension id twccExtID (0 disables it)
+func ParseRTP(now time.Time, buf []byte, twccExtID uint8) (SentPacket, error) {
+	if len(buf) < rtpHeaderSize || buf[0]>>6 != 2 {
+		return SentPacket{}, ErrInvalidRTP
+	}
+
+	pkt := SentPacket{
+		SendTime:       now,
+		SSRC:           binary.BigEndian.Uint32(buf[8:12]),
+		SequenceNumber: binary.BigEndian.Uint16(buf[2:4]),
+		Size:           len(buf),
+	}
+
+	offset := rtpHeaderSize + int(buf[0]&0x0F)*4
+	if len(buf) < offset {
+		return SentPacket{}, ErrInvalidRTP
+	}
+
+	hasExtension := buf[0]&0x10 != 0
+	if !hasExtension || twccExtID == 0 {
+		return pkt, nil
+	}
+
+	if len(buf) < offset+4 {
+		return SentPacket{}, ErrInvalidRTP
+	}
+	profile := binary.BigEndian.Uint16(buf[offset : offset+2])
+	extLen := int(binary.BigEndian.Uint16(buf[offset+2:offset+4])) * 4
+	offset += 4
+	if len(buf) < offset+extLen {
+		return SentPacket{}, ErrInvalidRTP
+	}
+
+	if payload := findExtension(profile, buf[offset:offset+extLen], twccExtID); len(payload) >= 2 {
+		pkt.TransportSequenceNumber = binary.BigEndian.Uint16(payload)
+		pkt.HasTransportSequence = true
+	}
+	return pkt, nil
+}
+
+// findExtension returns the payload of the RFC 8285 header extension element with the given id
+func findExtension(profile uint16, ext []byte, id uint8) []byte {
+	oneByte := profile == oneByteExtProfile
+	if !oneByte && profile&twoByteExtProfileMask != twoByteExtProfile {
+		return nil
+	}
+
+	for i := 0; i < len(ext); {
+		if ext[i] == 0 { // padding
+			i++
+			continue
+		}
+
+		var elemID uint8
+		var elemLen int
+		if oneByte {
+			elemID = ext[i] >> 4
+			elemLen = int(ext[i]&0x0F) + 1
+			if elemID == 15 { // reserved, stop parsing
+				return nil
+			}
+			i++
+		} else {
+			if i+1 >= len(ext) {
+				return nil
+			}
+			elemID = ext[i]
+			elemLen = int(ext[i+1])
+			i += 2
+		}
+
+		if i+elemLen > len(ext) {
+			return nil
+		}
+		if elemID == id {
+			return ext[i : i+elemLen]
+		}
+		i += elemLen
+	}
+	return nil
+}
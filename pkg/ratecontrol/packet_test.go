@@ -0,0 +1,84 @@
+package ratecontrol
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseRTP(t *testing.T) {
+	now := time.Now()
+
+	// V=2, X=1, PT=96, seq=0x1234, SSRC=0xCAFEBABE, one-byte extension id=3 with seq 0x0102
+	withOneByteExt := []byte{
+		0x90, 0x60, 0x12, 0x34,
+		0x00, 0x00, 0x00, 0x01,
+		0xCA, 0xFE, 0xBA, 0xBE,
+		0xBE, 0xDE, 0x00, 0x01,
+		0x31, 0x01, 0x02, 0x00,
+		0xAA, 0xBB,
+	}
+
+	// Same packet with a two-byte extension header
+	withTwoByteExt := []byte{
+		0x90, 0x60, 0x12, 0x34,
+		0x00, 0x00, 0x00, 0x01,
+		0xCA, 0xFE, 0xBA, 0xBE,
+		0x10, 0x00, 0x00, 0x01,
+		0x03, 0x02, 0x01, 0x02,
+		0xAA, 0xBB,
+	}
+
+	// No extension at all
+	plain := []byte{
+		0x80, 0x60, 0x12, 0x34,
+		0x00, 0x00, 0x00, 0x01,
+		0xCA, 0xFE, 0xBA, 0xBE,
+		0xAA, 0xBB,
+	}
+
+	tests := []struct {
+		name      string
+		buf       []byte
+		extID     uint8
+		wantTWCC  bool
+		wantSeq   uint16
+		wantErr   error
+		wantBytes int
+	}{
+		{name: "one-byte extension", buf: withOneByteExt, extID: 3, wantTWCC: true, wantSeq: 0x0102, wantBytes: 22},
+		{name: "two-byte extension", buf: withTwoByteExt, extID: 3, wantTWCC: true, wantSeq: 0x0102, wantBytes: 22},
+		{name: "other extension id", buf: withOneByteExt, extID: 5, wantTWCC: false, wantBytes: 22},
+		{name: "extension lookup disabled", buf: withOneByteExt, extID: 0, wantTWCC: false, wantBytes: 22},
+		{name: "no extension", buf: plain, extID: 3, wantTWCC: false, wantBytes: 14},
+		{name: "too short", buf: plain[:8], extID: 3, wantErr: ErrInvalidRTP},
+		{name: "truncated extension", buf: withOneByteExt[:16], extID: 3, wantErr: ErrInvalidRTP},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pkt, err := ParseRTP(now, tt.buf, tt.extID)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ParseRTP() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if pkt.SSRC != 0xCAFEBABE {
+				t.Errorf("ParseRTP() SSRC = %#x, want %#x", pkt.SSRC, 0xCAFEBABE)
+			}
+			if pkt.SequenceNumber != 0x1234 {
+				t.Errorf("ParseRTP() SequenceNumber = %#x, want %#x", pkt.SequenceNumber, 0x1234)
+			}
+			if pkt.Size != tt.wantBytes {
+				t.Errorf("ParseRTP() Size = %v, want %v", pkt.Size, tt.wantBytes)
+			}
+			if pkt.HasTransportSequence != tt.wantTWCC {
+				t.Fatalf("ParseRTP() HasTransportSequence = %v, want %v", pkt.HasTransportSequence, tt.wantTWCC)
+			}
+			if tt.wantTWCC && pkt.TransportSequenceNumber != tt.wantSeq {
+				t.Errorf("ParseRTP() TransportSequenceNumber = %#x, want %#x", pkt.TransportSequenceNumber, tt.wantSeq)
+			}
+		})
+	}
+}
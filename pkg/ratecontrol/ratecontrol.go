@@ -0,0 +1,72 @@
+package ratecontrol
+
+import (
+	"errors"
+	"time"
+
+	"github.com/pion/rtcp"
+)
+
+// Config holds the bitrate limits a controller starts with, all in Kbps
+type Config struct {
+	InitBitrate int
+	MinBitrate  int
+	MaxBitrate  int
+	// Clock is the time source of the controller, nil means the wall clock
+	Clock Clock
+	// SenderReports matches the LSR of receiver reports against the sent sender reports,
+	// nil falls back to the LSR arithmetic of RTTFromReport
+	SenderReports *SenderReportHistory
+	// ReferenceTimes matches the LastRR of DLRR sub-blocks against the sent XR Receiver
+	// Reference Time blocks, nil ignores DLRR blocks
+	ReferenceTimes *SenderReportHistory
+}
+
+// State is a snapshot of the controller estimates
+type State struct {
+	// Bitrate is the current target bitrate in Kbps
+	Bitrate int
+	// RTTSample is the last RTT sample in seconds
+	RTTSample float64
+	// SmoothedRTT is the smoothed RTT in seconds
+	SmoothedRTT float64
+	// LossRate is the last loss fraction reported by the receiver
+	LossRate float64
+}
+
+// RateController is a congestion controller driving the encoder target bitrate
+type RateController interface {
+	// OnRTCP feeds a received RTCP packet, packets the controller does not use are ignored
+	OnRTCP(now time.Time, pkt rtcp.Packet)
+	// TargetBitrate computes the new target bitrate in Kbps
+	TargetBitrate() int
+	// State returns the current controller estimates
+	State() State
+}
+
+// ProbeConsumer is implemented by controllers that can jump to a bitrate confirmed by bandwidth probing
+type ProbeConsumer interface {
+	// OnProbeResult reports the rate in Kbps a probe cluster got through to the receiver
+	OnProbeResult(now time.Time, deliveredKbps int)
+}
+
+// LossEstimator is implemented by controllers that estimate a loss event rate, which sizes
+// the forward error correction
+type LossEstimator interface {
+	// LossEventRate returns the loss event rate in [0, 1]
+	LossEventRate() float64
+}
+
+// ErrStateUnsupported is returned when a controller has no state to persist
+var ErrStateUnsupported = errors.New("controller state cannot be persisted")
+
+// StateSnapshotter is implemented by controllers whose estimates can be persisted across restarts
+type StateSnapshotter interface {
+	// MarshalState encodes the current estimates
+	MarshalState() ([]byte, error)
+	// UnmarshalState resumes from estimates encoded by MarshalState
+	UnmarshalState(data []byte) error
+}
+
+// Factory creates a RateController with the given limits
+type Factory func(cfg Config) (RateController, error)
@@ -0,0 +1,65 @@
+package ratecontrol
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+var (
+	// ErrUnknownController is returned when no factory is registered under the requested name
+	ErrUnknownController = errors.New("unknown rate controller")
+	// ErrDuplicateController is returned when a factory is registered twice under the same name
+	ErrDuplicateController = errors.New("rate controller already registered")
+)
+
+// Registry maps algorithm names to controller factories
+type Registry struct {
+	factories map[string]Factory
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		factories: make(map[string]Factory),
+	}
+}
+
+// Register adds a factory under name
+func (r *Registry) Register(name string, factory Factory) error {
+	if name == "" || factory == nil {
+		return fmt.Errorf("invalid registration for %q", name)
+	}
+	if _, ok := r.factories[name]; ok {
+		return fmt.Errorf("%w: %s", ErrDuplicateController, name)
+	}
+	r.factories[name] = factory
+	return nil
+}
+
+// New creates the controller registered under name
+func (r *Registry) New(name string, cfg Config) (RateController, error) {
+	factory, err := r.Factory(name)
+	if err != nil {
+		return nil, err
+	}
+	return factory(cfg)
+}
+
+// Factory returns the factory registered under name
+func (r *Registry) Factory(name string) (Factory, error) {
+	factory, ok := r.factories[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s (available: %v)", ErrUnknownController, name, r.Names())
+	}
+	return factory, nil
+}
+
+// Names returns the registered algorithm names in sorted order
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.factories))
+	for name := range r.factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,130 @@
+package ratecontrol
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pion/rtcp"
+)
+
+type fakeController struct {
+	cfg Config
+}
+
+func (f *fakeController) OnRTCP(_ time.Time, _ rtcp.Packet) {}
+func (f *fakeController) TargetBitrate() int                { return f.cfg.InitBitrate }
+func (f *fakeController) State() State                      { return State{Bitrate: f.cfg.InitBitrate} }
+
+func newFakeController(cfg Config) (RateController, error) {
+	return &fakeController{cfg: cfg}, nil
+}
+
+func TestRegistry_Register(t *testing.T) {
+	tests := []struct {
+		name    string
+		algo    string
+		factory Factory
+		wantErr bool
+	}{
+		{
+			name:    "valid factory",
+			algo:    "fake",
+			factory: newFakeController,
+			wantErr: false,
+		},
+		{
+			name:    "empty name",
+			algo:    "",
+			factory: newFakeController,
+			wantErr: true,
+		},
+		{
+			name:    "nil factory",
+			algo:    "fake",
+			factory: nil,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRegistry()
+			err := r.Register(tt.algo, tt.factory)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Register() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("duplicate name", func(t *testing.T) {
+		r := NewRegistry()
+		if err := r.Register("fake", newFakeController); err != nil {
+			t.Fatalf("Register() unexpected error: %v", err)
+		}
+		if err := r.Register("fake", newFakeController); !errors.Is(err, ErrDuplicateController) {
+			t.Errorf("Register() error = %v, want %v", err, ErrDuplicateController)
+		}
+	})
+}
+
+func TestRegistry_New(t *testing.T) {
+	r := NewRegistry()
+	if err := r.Register("fake", newFakeController); err != nil {
+		t.Fatalf("Register() unexpected error: %v", err)
+	}
+
+	t.Run("known controller", func(t *testing.T) {
+		c, err := r.New("fake", Config{InitBitrate: 1000, MinBitrate: 500, MaxBitrate: 4000})
+		if err != nil {
+			t.Fatalf("New() unexpected error: %v", err)
+		}
+		if got := c.TargetBitrate(); got != 1000 {
+			t.Errorf("TargetBitrate() = %v, want %v", got, 1000)
+		}
+	})
+
+	t.Run("unknown controller", func(t *testing.T) {
+		if _, err := r.New("missing", Config{}); !errors.Is(err, ErrUnknownController) {
+			t.Errorf("New() error = %v, want %v", err, ErrUnknownController)
+		}
+	})
+}
+
+func TestRegistry_Factory(t *testing.T) {
+	r := NewRegistry()
+	if err := r.Register("fake", newFakeController); err != nil {
+		t.Fatalf("Register() unexpected error: %v", err)
+	}
+
+	factory, err := r.Factory("fake")
+	if err != nil {
+		t.Fatalf("Factory() unexpected error: %v", err)
+	}
+	c, err := factory(Config{InitBitrate: 1500, MinBitrate: 500, MaxBitrate: 4000})
+	if err != nil {
+		t.Fatalf("factory() unexpected error: %v", err)
+	}
+	if got := c.TargetBitrate(); got != 1500 {
+		t.Errorf("TargetBitrate() = %v, want %v", got, 1500)
+	}
+
+	if _, err := r.Factory("missing"); !errors.Is(err, ErrUnknownController) {
+		t.Errorf("Factory() error = %v, want %v", err, ErrUnknownController)
+	}
+}
+
+func TestRegistry_Names(t *testing.T) {
+	r := NewRegistry()
+	for _, name := range []string{"tfrc", "gcc", "nada"} {
+		if err := r.Register(name, newFakeController); err != nil {
+			t.Fatalf("Register() unexpected error: %v", err)
+		}
+	}
+
+	expected := []string{"gcc", "nada", "tfrc"}
+	if got := r.Names(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Names() = %v, want %v", got, expected)
+	}
+}
@@ -0,0 +1,130 @@
+package ratecontrol
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pion/rtcp"
+)
+
+// DefaultSenderReportAge is how long a sent sender report can be referred to by an LSR,
+// a dozen RTCP intervals
+const DefaultSenderReportAge = time.Minute
+
+// SenderReportHistory records when every sender report was sent by its compact NTP timestamp,
+// so the LSR of a report block is matched exactly instead of trusting the LSR arithmetic.
+// The same history matches the LastRR of DLRR sub-blocks against the sent XR Receiver
+// Reference Time blocks. It is safe for concurrent use
+type SenderReportHistory struct {
+	mu     sync.Mutex
+	maxAge time.Duration
+	sent   map[uint32]sentReport
+	order  []uint32
+}
+
+// sentReport is when a report was sent and the SSRC it was sent as
+type sentReport struct {
+	at   time.Time
+	ssrc uint32
+}
+
+// NewSenderReportHistory returns a history keeping sender reports for maxAge
+func NewSenderReportHistory(maxAge time.Duration) *SenderReportHistory {
+	return &SenderReportHistory{
+		maxAge: maxAge,
+		sent:   make(map[uint32]sentReport),
+	}
+}
+
+// OnSenderReport records sr as sent at now and forgets the reports older than the max age
+func (h *SenderReportHistory) OnSenderReport(now time.Time, sr *rtcp.SenderReport) {
+	h.record(now, sr.SSRC, sr.NTPTime)
+}
+
+// OnReferenceTime records an XR Receiver Reference Time block with the NTP timestamp ntp
+// sent as ssrc at now
+func (h *SenderReportHistory) OnReferenceTime(now time.Time, ssrc uint32, ntp uint64) {
+	h.record(now, ssrc, ntp)
+}
+
+// record keeps the compact form of the NTP timestamp ntp sent as ssrc at now
+// and forgets the reports older than the max age
+func (h *SenderReportHistory) record(now time.Time, ssrc uint32, ntp uint64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for len(h.order) > 0 && now.Sub(h.sent[h.order[0]].at) > h.maxAge {
+		delete(h.sent, h.order[0])
+		h.order = h.order[1:]
+	}
+	compact := uint32(ntp >> 16) //nolint:gosec
+	if _, ok := h.sent[compact]; ok {
+		// the SRs of every SSRC in one compound packet carry the same timestamp
+		return
+	}
+	h.sent[compact] = sentReport{at: now, ssrc: ssrc}
+	h.order = append(h.order, compact)
+}
+
+// Len returns the number of sender reports recorded
+func (h *SenderReportHistory) Len() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.sent)
+}
+
+// RTT computes the RTT in seconds from the LSR and DLSR fields of a report block. The LSR has
+// to match a recorded sender report, samples referring to an unknown or expired report are
+// rejected. A nil history falls back to RTTFromReport
+func (h *SenderReportHistory) RTT(now time.Time, lsr, delay uint32) (float64, bool) {
+	if h == nil {
+		return RTTFromReport(now, lsr, delay)
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	sent, ok := h.lookup(now, lsr)
+	if !ok {
+		return 0, false
+	}
+	return rttSince(now, sent.at, delay)
+}
+
+// DLRR computes the RTT in seconds from a DLRR sub-block. Its LastRR has to match a Receiver
+// Reference Time block recorded with OnReferenceTime and sent as the SSRC of the sub-block,
+// forged or expired references are rejected. A nil history has sent no reference time
+// and rejects every sub-block
+func (h *SenderReportHistory) DLRR(now time.Time, report rtcp.DLRRReport) (float64, bool) {
+	if h == nil {
+		return 0, false
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	sent, ok := h.lookup(now, report.LastRR)
+	if !ok || sent.ssrc != report.SSRC {
+		return 0, false
+	}
+	return rttSince(now, sent.at, report.DLRR)
+}
+
+// lookup returns the report with the compact NTP timestamp compact if it has not expired
+func (h *SenderReportHistory) lookup(now time.Time, compact uint32) (sentReport, bool) {
+	if compact == 0 {
+		return sentReport{}, false
+	}
+	sent, ok := h.sent[compact]
+	if !ok || now.Sub(sent.at) > h.maxAge {
+		return sentReport{}, false
+	}
+	return sent, true
+}
+
+// rttSince returns the time since sentAt less the delay held by the receiver,
+// in 1/65536 seconds, rejecting negative values
+func rttSince(now, sentAt time.Time, delay uint32) (float64, bool) {
+	rtt := now.Sub(sentAt) - time.Duration(delay)*time.Second/65536
+	if rtt < 0 {
+		return 0, false
+	}
+	return rtt.Seconds(), true
+}
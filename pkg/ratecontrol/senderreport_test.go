@@ -0,0 +1,62 @@
+package ratecontrol
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pion/rtcp"
+)
+
+func TestSenderReportHistory_RTT(t *testing.T) {
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	// sender reports every 5 seconds, their NTP time runs 1 hour ahead of the local clock
+	h := NewSenderReportHistory(DefaultSenderReportAge)
+	for i := range 4 {
+		sentAt := start.Add(time.Duration(i) * 5 * time.Second)
+		h.OnSenderReport(sentAt, &rtcp.SenderReport{SSRC: 1, NTPTime: NTPTime(sentAt.Add(time.Hour))})
+		// the SR of another SSRC in the same compound packet
+		h.OnSenderReport(sentAt, &rtcp.SenderReport{SSRC: 2, NTPTime: NTPTime(sentAt.Add(time.Hour))})
+	}
+	if got := h.Len(); got != 4 {
+		t.Fatalf("Len() = %d, want 4", got)
+	}
+
+	lsrOf := func(i int) uint32 {
+		return NTPMiddle32(start.Add(time.Duration(i)*5*time.Second + time.Hour))
+	}
+	dlsr := uint32(50 * 65536 / 1000)
+
+	tests := []struct {
+		name   string
+		lsr    uint32
+		delay  uint32
+		at     time.Duration
+		want   float64
+		wantOK bool
+	}{
+		{"latest SR", lsrOf(3), dlsr, 15*time.Second + 150*time.Millisecond, 0.1, true},
+		{"older SR", lsrOf(1), dlsr, 15*time.Second + 150*time.Millisecond, 10.1, true},
+		{"no SR seen", 0, 0, 16 * time.Second, 0, false},
+		{"unknown LSR", lsrOf(3) + 1, dlsr, 16 * time.Second, 0, false},
+		{"delay longer than the time since the SR", lsrOf(3), 65536, 15*time.Second + 500*time.Millisecond, 0, false},
+		{"expired SR", lsrOf(0), dlsr, 2 * time.Minute, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := h.RTT(start.Add(tt.at), tt.lsr, tt.delay)
+			if ok != tt.wantOK || (ok && (got < tt.want-0.001 || got > tt.want+0.001)) {
+				t.Errorf("RTT() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestSenderReportHistory_nil(t *testing.T) {
+	var h *SenderReportHistory
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	lsr := NTPMiddle32(now.Add(-100 * time.Millisecond))
+	if got, ok := h.RTT(now, lsr, 0); !ok || got < 0.099 || got > 0.101 {
+		t.Errorf("nil history RTT() = %v, %v, want the LSR arithmetic 0.1", got, ok)
+	}
+}
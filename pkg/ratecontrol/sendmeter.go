@@ -0,0 +1,101 @@
+package ratecontrol
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultSendWindow is the window the packet size and sending rate are averaged over
+const DefaultSendWindow = time.Second
+
+// SendStats is a snapshot of the RTP traffic leaving the sender
+type SendStats struct {
+	// Packets and Bytes count every RTP packet sent so far
+	Packets uint64
+	Bytes   uint64
+	// AvgPacketSize is the mean RTP packet size in bytes over the window, header included
+	AvgPacketSize float64
+	// RateKbps is the sending rate over the window
+	RateKbps int
+}
+
+// SendStatsConsumer is implemented by controllers that use the measured packet size and sending rate
+type SendStatsConsumer interface {
+	OnSendStats(now time.Time, stats SendStats)
+}
+
+type sentSample struct {
+	time time.Time
+	size int
+}
+
+// SendMeter measures the packet size and sending rate of the RTP packets it observes,
+// it is safe for concurrent use from the streaming threads
+type SendMeter struct {
+	mu sync.Mutex
+
+	window  time.Duration
+	samples []sentSample
+	// windowBytes is the sum of the sample sizes
+	windowBytes int
+	first       time.Time
+
+	packets uint64
+	bytes   uint64
+	// lastAvgSize is kept when the window runs empty
+	lastAvgSize float64
+}
+
+// NewSendMeter creates a meter averaging over window, DefaultSendWindow when zero
+func NewSendMeter(window time.Duration) *SendMeter {
+	if window <= 0 {
+		window = DefaultSendWindow
+	}
+	return &SendMeter{window: window}
+}
+
+// OnPacketSent records an RTP packet
+func (m *SendMeter) OnPacketSent(pkt SentPacket) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.first.IsZero() {
+		m.first = pkt.SendTime
+	}
+	m.packets++
+	m.bytes += uint64(pkt.Size) //nolint:gosec // sizes are never negative
+	m.samples = append(m.samples, sentSample{time: pkt.SendTime, size: pkt.Size})
+	m.windowBytes += pkt.Size
+	m.prune(pkt.SendTime)
+	m.lastAvgSize = float64(m.windowBytes) / float64(len(m.samples))
+}
+
+// prune drops the samples older than the window
+func (m *SendMeter) prune(now time.Time) {
+	i := 0
+	for i < len(m.samples) && now.Sub(m.samples[i].time) > m.window {
+		m.windowBytes -= m.samples[i].size
+		i++
+	}
+	m.samples = m.samples[i:]
+}
+
+// Stats returns the counters and the window averages at now
+func (m *SendMeter) Stats(now time.Time) SendStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.prune(now)
+	stats := SendStats{Packets: m.packets, Bytes: m.bytes}
+	if len(m.samples) > 0 {
+		m.lastAvgSize = float64(m.windowBytes) / float64(len(m.samples))
+	}
+	stats.AvgPacketSize = m.lastAvgSize
+
+	// the first window is only partly filled
+	span := min(m.window, now.Sub(m.first))
+	if !m.first.IsZero() && span > 0 {
+		stats.RateKbps = int(float64(m.windowBytes*8) / 1000 / span.Seconds())
+	}
+	return stats
+}
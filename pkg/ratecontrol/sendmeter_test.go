@@ -0,0 +1,83 @@
+package ratecontrol
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSendMeter_Stats(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		sizes    []int
+		interval time.Duration
+		at       time.Duration
+		expected SendStats
+	}{
+		{
+			name:     "nothing sent",
+			at:       time.Second,
+			expected: SendStats{},
+		},
+		{
+			name:     "full window",
+			sizes:    []int{1000, 1000, 1000, 1000, 1000, 1000, 1000, 1000, 1000, 1000},
+			interval: 100 * time.Millisecond,
+			at:       time.Second,
+			expected: SendStats{Packets: 10, Bytes: 10000, AvgPacketSize: 1000, RateKbps: 80},
+		},
+		{
+			name:     "partial window",
+			sizes:    []int{500, 1500},
+			interval: 250 * time.Millisecond,
+			at:       500 * time.Millisecond,
+			expected: SendStats{Packets: 2, Bytes: 2000, AvgPacketSize: 1000, RateKbps: 32},
+		},
+		{
+			name:     "empty window keeps the last packet size",
+			sizes:    []int{800, 1200},
+			interval: 10 * time.Millisecond,
+			at:       5 * time.Second,
+			expected: SendStats{Packets: 2, Bytes: 2000, AvgPacketSize: 1000},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewSendMeter(0)
+			for i, size := range tt.sizes {
+				m.OnPacketSent(SentPacket{SendTime: start.Add(time.Duration(i) * tt.interval), Size: size})
+			}
+			if got := m.Stats(start.Add(tt.at)); got != tt.expected {
+				t.Errorf("Stats() = %+v, want %+v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSendMeter_varyingPacketSize(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	m := NewSendMeter(time.Second)
+
+	// a static scene with small packets followed by high motion with full packets
+	now := start
+	for range 100 {
+		m.OnPacketSent(SentPacket{SendTime: now, Size: 300})
+		now = now.Add(10 * time.Millisecond)
+	}
+	if got := m.Stats(now).AvgPacketSize; got != 300 {
+		t.Errorf("static scene AvgPacketSize = %v, want 300", got)
+	}
+	for range 200 {
+		m.OnPacketSent(SentPacket{SendTime: now, Size: 1200})
+		now = now.Add(5 * time.Millisecond)
+	}
+	stats := m.Stats(now)
+	if stats.AvgPacketSize != 1200 {
+		t.Errorf("high motion AvgPacketSize = %v, want 1200", stats.AvgPacketSize)
+	}
+	if stats.RateKbps < 1900 || stats.RateKbps > 1930 {
+		t.Errorf("high motion RateKbps = %d, want about 1920", stats.RateKbps)
+	}
+}
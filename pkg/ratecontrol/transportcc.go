@@ -0,0 +1,58 @@
+package ratecontrol
+
+import (
+	"time"
+
+	"github.com/pion/rtcp"
+)
+
+// TransportCCReferenceUnit is the resolution of the TWCC reference time field
+const TransportCCReferenceUnit = 64 * time.Millisecond
+
+// TransportCCResult is the receiver verdict for one transport-wide sequence number
+type TransportCCResult struct {
+	SequenceNumber uint16
+	Received       bool
+	// Arrival is relative to the receiver clock base, only valid if Received
+	Arrival time.Duration
+}
+
+// DecodeTransportCC expands the status chunks and receive deltas of a TWCC feedback packet
+func DecodeTransportCC(fb *rtcp.TransportLayerCC) []TransportCCResult {
+	results := make([]TransportCCResult, 0, fb.PacketStatusCount)
+	seq := fb.BaseSequenceNumber
+	deltaIdx := 0
+	arrival := time.Duration(fb.ReferenceTime) * TransportCCReferenceUnit
+
+	appendStatus := func(symbol uint16) {
+		result := TransportCCResult{SequenceNumber: seq}
+		if symbol == rtcp.TypeTCCPacketReceivedSmallDelta || symbol == rtcp.TypeTCCPacketReceivedLargeDelta {
+			if deltaIdx < len(fb.RecvDeltas) {
+				arrival += time.Duration(fb.RecvDeltas[deltaIdx].Delta) * time.Microsecond
+				deltaIdx++
+				result.Received = true
+				result.Arrival = arrival
+			}
+		}
+		results = append(results, result)
+		seq++
+	}
+
+	for _, chunk := range fb.PacketChunks {
+		remaining := int(fb.PacketStatusCount) - len(results)
+		if remaining <= 0 {
+			break
+		}
+		switch c := chunk.(type) {
+		case *rtcp.RunLengthChunk:
+			for i := 0; i < int(c.RunLength) && i < remaining; i++ {
+				appendStatus(c.PacketStatusSymbol)
+			}
+		case *rtcp.StatusVectorChunk:
+			for i := 0; i < len(c.SymbolList) && i < remaining; i++ {
+				appendStatus(c.SymbolList[i])
+			}
+		}
+	}
+	return results
+}
@@ -0,0 +1,58 @@
+package ratecontrol
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pion/rtcp"
+)
+
+func TestDecodeTransportCC(t *testing.T) {
+	fb := &rtcp.TransportLayerCC{
+		BaseSequenceNumber: 65534,
+		PacketStatusCount:  5,
+		ReferenceTime:      10,
+		PacketChunks: []rtcp.PacketStatusChunk{
+			&rtcp.RunLengthChunk{
+				Type:               rtcp.TypeTCCRunLengthChunk,
+				PacketStatusSymbol: rtcp.TypeTCCPacketReceivedSmallDelta,
+				RunLength:          2,
+			},
+			&rtcp.StatusVectorChunk{
+				Type:       rtcp.TypeTCCStatusVectorChunk,
+				SymbolSize: rtcp.TypeTCCSymbolSizeTwoBit,
+				SymbolList: []uint16{
+					rtcp.TypeTCCPacketNotReceived,
+					rtcp.TypeTCCPacketReceivedLargeDelta,
+					rtcp.TypeTCCPacketReceivedSmallDelta,
+					rtcp.TypeTCCPacketNotReceived, // beyond PacketStatusCount
+				},
+			},
+		},
+		RecvDeltas: []*rtcp.RecvDelta{
+			{Type: rtcp.TypeTCCPacketReceivedSmallDelta, Delta: 1000},
+			{Type: rtcp.TypeTCCPacketReceivedSmallDelta, Delta: 2000},
+			{Type: rtcp.TypeTCCPacketReceivedLargeDelta, Delta: -500},
+			{Type: rtcp.TypeTCCPacketReceivedSmallDelta, Delta: 250},
+		},
+	}
+
+	base := 10 * TransportCCReferenceUnit
+	expected := []TransportCCResult{
+		{SequenceNumber: 65534, Received: true, Arrival: base + 1*time.Millisecond},
+		{SequenceNumber: 65535, Received: true, Arrival: base + 3*time.Millisecond},
+		{SequenceNumber: 0, Received: false},
+		{SequenceNumber: 1, Received: true, Arrival: base + 2500*time.Microsecond},
+		{SequenceNumber: 2, Received: true, Arrival: base + 2750*time.Microsecond},
+	}
+
+	results := DecodeTransportCC(fb)
+	if len(results) != len(expected) {
+		t.Fatalf("DecodeTransportCC() returned %d results, want %d", len(results), len(expected))
+	}
+	for i := range expected {
+		if results[i] != expected[i] {
+			t.Errorf("DecodeTransportCC()[%d] = %+v, want %+v", i, results[i], expected[i])
+		}
+	}
+}
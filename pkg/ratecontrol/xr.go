@@ -0,0 +1,141 @@
+package ratecontrol
+
+import (
+	"github.com/pion/rtcp"
+)
+
+// DefaultGmin is the RFC 3611 section 4.7.2 minimum number of received packets
+// between two losses for them to fall into separate bursts
+const DefaultGmin = 16
+
+// LossPattern is the per-packet receive status of an RFC 3611 Loss RLE report block
+type LossPattern struct {
+	SSRC     uint32
+	BeginSeq uint16
+	// Step is the sequence number distance between two entries, 2^T with thinning T
+	Step int
+	// Received holds one entry per reported packet starting at BeginSeq
+	Received []bool
+}
+
+// EndSeq returns the sequence number following the last reported packet
+func (p LossPattern) EndSeq() uint16 {
+	return p.BeginSeq + uint16(len(p.Received)*p.Step) //nolint:gosec
+}
+
+// DecodeLossRLE expands the run length and bit vector chunks of a Loss RLE report block
+func DecodeLossRLE(b *rtcp.LossRLEReportBlock) LossPattern {
+	step := 1 << (b.T & 0x0F)
+	n := (int(b.EndSeq-b.BeginSeq) + step - 1) / step
+	p := LossPattern{SSRC: b.SSRC, BeginSeq: b.BeginSeq, Step: step, Received: make([]bool, 0, n)}
+
+	for _, chunk := range b.Chunks {
+		switch chunk.Type() {
+		case rtcp.RunLengthChunkType:
+			// run type 1 is a run of received packets, 0 a run of lost ones
+			runType, _ := chunk.RunType()
+			for i := uint(0); i < chunk.Value() && len(p.Received) < n; i++ {
+				p.Received = append(p.Received, runType == 1)
+			}
+		case rtcp.BitVectorChunkType:
+			// 15 packets, most significant bit first, 1 is received
+			v := chunk.Value()
+			for bit := 14; bit >= 0 && len(p.Received) < n; bit-- {
+				p.Received = append(p.Received, v>>bit&1 == 1)
+			}
+		default:
+			// terminating null chunk pads the block
+		}
+	}
+	return p
+}
+
+// LossBursts are the burst and gap metrics of a loss pattern, RFC 3611 section 4.7.2,
+// counts in packets
+type LossBursts struct {
+	Packets      int
+	Lost         int
+	Bursts       int
+	BurstPackets int
+	BurstLost    int
+	GapPackets   int
+	GapLost      int
+}
+
+// AnalyzeLoss splits a loss pattern into bursts, where losses are fewer than gmin received
+// packets apart, and the gaps between them, an isolated loss belongs to a gap
+func AnalyzeLoss(p LossPattern, gmin int) LossBursts {
+	var b LossBursts
+	first, last, count := -1, -1, 0
+	closeGroup := func() {
+		b.Lost += count
+		if count >= 2 {
+			b.Bursts++
+			b.BurstPackets += last - first + 1
+			b.BurstLost += count
+		}
+	}
+	for i, received := range p.Received {
+		if received {
+			continue
+		}
+		if last >= 0 && i-last-1 >= gmin {
+			closeGroup()
+			first, count = -1, 0
+		}
+		if first < 0 {
+			first = i
+		}
+		last = i
+		count++
+	}
+	if count > 0 {
+		closeGroup()
+	}
+
+	b.Packets = len(p.Received)
+	b.GapPackets = b.Packets - b.BurstPackets
+	b.GapLost = b.Lost - b.BurstLost
+
+	// with thinning every entry stands for Step packets
+	b.Packets *= p.Step
+	b.Lost *= p.Step
+	b.BurstPackets *= p.Step
+	b.BurstLost *= p.Step
+	b.GapPackets *= p.Step
+	b.GapLost *= p.Step
+	return b
+}
+
+// LossRate returns the fraction of lost packets
+func (b LossBursts) LossRate() float64 {
+	return ratio(b.Lost, b.Packets)
+}
+
+// BurstDensity returns the fraction of packets lost within bursts
+func (b LossBursts) BurstDensity() float64 {
+	return ratio(b.BurstLost, b.BurstPackets)
+}
+
+// GapDensity returns the fraction of packets lost within gaps
+func (b LossBursts) GapDensity() float64 {
+	return ratio(b.GapLost, b.GapPackets)
+}
+
+// MeanBurstLength returns the mean burst length in packets
+func (b LossBursts) MeanBurstLength() float64 {
+	return ratio(b.BurstPackets, b.Bursts)
+}
+
+// BurstLossShare returns the fraction of the losses that fell into bursts,
+// close to 1 for bursty loss such as Wi-Fi retries and close to 0 for random loss
+func (b LossBursts) BurstLossShare() float64 {
+	return ratio(b.BurstLost, b.Lost)
+}
+
+func ratio(num, den int) float64 {
+	if den <= 0 {
+		return 0
+	}
+	return float64(num) / float64(den)
+}
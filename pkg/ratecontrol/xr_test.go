@@ -0,0 +1,154 @@
+package ratecontrol
+
+import (
+	"testing"
+
+	"github.com/pion/rtcp"
+)
+
+// pattern builds a loss pattern from a string of '.' received and 'x' lost packets
+func pattern(s string) LossPattern {
+	p := LossPattern{Step: 1}
+	for _, c := range s {
+		p.Received = append(p.Received, c == '.')
+	}
+	return p
+}
+
+func TestDecodeLossRLE(t *testing.T) {
+	tests := []struct {
+		name  string
+		block *rtcp.LossRLEReportBlock
+		want  string
+		step  int
+	}{
+		{
+			name: "runs and a bit vector",
+			block: &rtcp.LossRLEReportBlock{
+				BeginSeq: 65530,
+				EndSeq:   22, // wraps, 28 packets
+				Chunks: []rtcp.Chunk{
+					0x4000 | 10,                // 10 received
+					3,                          // 3 lost
+					0x8000 | 0b101010101010101, // bit vector, 1 is received
+					0,                          // terminating null
+				},
+			},
+			want: "..........xxx.x.x.x.x.x.x.x.",
+			step: 1,
+		},
+		{
+			name: "chunks beyond end_seq are ignored",
+			block: &rtcp.LossRLEReportBlock{
+				BeginSeq: 100,
+				EndSeq:   104,
+				Chunks:   []rtcp.Chunk{0x4000 | 2, 5},
+			},
+			want: "..xx",
+			step: 1,
+		},
+		{
+			name: "thinning",
+			block: &rtcp.LossRLEReportBlock{
+				T:        2,
+				BeginSeq: 0,
+				EndSeq:   16,
+				Chunks:   []rtcp.Chunk{0x4000 | 3, 1},
+			},
+			want: "...x",
+			step: 4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := DecodeLossRLE(tt.block)
+			want := pattern(tt.want)
+			if got.Step != tt.step {
+				t.Errorf("Step = %d, want %d", got.Step, tt.step)
+			}
+			if len(got.Received) != len(want.Received) {
+				t.Fatalf("got %d entries, want %d", len(got.Received), len(want.Received))
+			}
+			for i := range want.Received {
+				if got.Received[i] != want.Received[i] {
+					t.Errorf("entry %d received = %v, want %v", i, got.Received[i], want.Received[i])
+				}
+			}
+			if got.EndSeq() != tt.block.EndSeq {
+				t.Errorf("EndSeq() = %d, want %d", got.EndSeq(), tt.block.EndSeq)
+			}
+		})
+	}
+}
+
+func TestAnalyzeLoss(t *testing.T) {
+	tests := []struct {
+		name      string
+		pattern   string
+		gmin      int
+		want      LossBursts
+		wantShare float64
+	}{
+		{
+			name:    "no loss",
+			pattern: "..........",
+			gmin:    4,
+			want:    LossBursts{Packets: 10, GapPackets: 10},
+		},
+		{
+			name:      "random isolated losses are gap losses",
+			pattern:   "....x.....x.....x...",
+			gmin:      4,
+			want:      LossBursts{Packets: 20, Lost: 3, GapPackets: 20, GapLost: 3},
+			wantShare: 0,
+		},
+		{
+			name:      "one burst",
+			pattern:   "....xx.x.x........",
+			gmin:      4,
+			want:      LossBursts{Packets: 18, Lost: 4, Bursts: 1, BurstPackets: 6, BurstLost: 4, GapPackets: 12},
+			wantShare: 1,
+		},
+		{
+			name:    "burst and an isolated loss",
+			pattern: "xxx.....x",
+			gmin:    4,
+			want: LossBursts{
+				Packets: 9, Lost: 4, Bursts: 1, BurstPackets: 3, BurstLost: 3, GapPackets: 6, GapLost: 1,
+			},
+			wantShare: 0.75,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := AnalyzeLoss(pattern(tt.pattern), tt.gmin)
+			if got != tt.want {
+				t.Errorf("AnalyzeLoss() = %+v, want %+v", got, tt.want)
+			}
+			if share := got.BurstLossShare(); share != tt.wantShare {
+				t.Errorf("BurstLossShare() = %v, want %v", share, tt.wantShare)
+			}
+		})
+	}
+}
+
+func TestLossBursts_densities(t *testing.T) {
+	b := LossBursts{Packets: 100, Lost: 10, Bursts: 2, BurstPackets: 20, BurstLost: 8, GapPackets: 80, GapLost: 2}
+	if got := b.LossRate(); got != 0.1 {
+		t.Errorf("LossRate() = %v, want 0.1", got)
+	}
+	if got := b.BurstDensity(); got != 0.4 {
+		t.Errorf("BurstDensity() = %v, want 0.4", got)
+	}
+	if got := b.GapDensity(); got != 0.025 {
+		t.Errorf("GapDensity() = %v, want 0.025", got)
+	}
+	if got := b.MeanBurstLength(); got != 10 {
+		t.Errorf("MeanBurstLength() = %v, want 10", got)
+	}
+	if got := (LossBursts{}).BurstDensity(); got != 0 {
+		t.Errorf("empty BurstDensity() = %v, want 0", got)
+	}
+}
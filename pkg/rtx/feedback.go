@@ -0,0 +1,13 @@
+package rtx
+
+import (
+	"github.com/pion/rtcp"
+
+	"github.com/arsperger/slowcast/pkg/ratecontrol"
+)
+
+// FilterFeedback removes what pkt reports about the RTX stream and returns nil when nothing is left,
+// the RTX stream only carries retransmissions
+func (r *Retransmitter) FilterFeedback(pkt rtcp.Packet) rtcp.Packet {
+	return ratecontrol.FilterFeedback(pkt, r.cfg.SSRC)
+}
@@ -0,0 +1,22 @@
+package rtx
+
+import (
+	"testing"
+
+	"github.com/pion/rtcp"
+)
+
+func TestRetransmitter_FilterFeedback(t *testing.T) {
+	r, err := New(DefaultConfig(mediaSSRC, rtxSSRC))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	rr := &rtcp.ReceiverReport{SSRC: 1, Reports: []rtcp.ReceptionReport{{SSRC: mediaSSRC}, {SSRC: rtxSSRC}}}
+	got, ok := r.FilterFeedback(rr).(*rtcp.ReceiverReport)
+	if !ok || len(got.Reports) != 1 || got.Reports[0].SSRC != mediaSSRC {
+		t.Errorf("FilterFeedback() = %+v, want the media report block only", got)
+	}
+	if got := r.FilterFeedback(&rtcp.TransportLayerNack{MediaSSRC: rtxSSRC}); got != nil {
+		t.Errorf("FilterFeedback() = %+v for an RTX NACK, want nil", got)
+	}
+}
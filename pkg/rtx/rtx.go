@@ -0,0 +1,208 @@
+// Package rtx decides which packets a Generic NACK asks for are retransmitted on an
+// RFC 4588 RTX stream, keeping the retransmissions within a share of the target bitrate
+// so they can't push the link into congestion.
+package rtx
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/arsperger/slowcast/pkg/ratecontrol"
+)
+
+const (
+	// osnSize is the original sequence number RFC 4588 prepends to the retransmitted payload
+	osnSize = 2
+
+	// rtpClockRate is the RTP clock rate of the video stream and its RTX stream
+	rtpClockRate = 90000
+)
+
+// ErrInvalidConfig is returned by New for unusable parameters
+var ErrInvalidConfig = errors.New("invalid rtx config")
+
+var _ ratecontrol.PacketObserver = (*Retransmitter)(nil)
+
+// Config describes the media and RTX streams and the retransmission budget
+type Config struct {
+	// MediaSSRC and MediaPayloadType identify the original stream
+	MediaSSRC        uint32
+	MediaPayloadType uint8
+	// SSRC and PayloadType of the RTX stream
+	SSRC        uint32
+	PayloadType uint8
+	// MaxShare is the share of the target bitrate retransmissions may use, in (0, 1)
+	MaxShare float64
+	// Window is the period over which the retransmitted bytes are counted
+	Window time.Duration
+	// MaxAge is the oldest packet retransmitted, older ones would arrive too late to be played
+	MaxAge time.Duration
+	// ResendInterval is how long a retransmitted packet isn't sent again
+	ResendInterval time.Duration
+}
+
+// DefaultConfig retransmits packets up to 1 second old with at most a quarter of the target bitrate
+func DefaultConfig(mediaSSRC, ssrc uint32) Config {
+	return Config{
+		MediaSSRC:        mediaSSRC,
+		MediaPayloadType: 96,
+		SSRC:             ssrc,
+		PayloadType:      97,
+		MaxShare:         0.25,
+		Window:           time.Second,
+		MaxAge:           time.Second,
+		ResendInterval:   100 * time.Millisecond,
+	}
+}
+
+// SDP returns the SDP attribute lines a receiver needs to associate the RTX stream with the media
+func (c Config) SDP() []string {
+	return []string{
+		fmt.Sprintf("a=rtpmap:%d rtx/%d", c.PayloadType, rtpClockRate),
+		fmt.Sprintf("a=fmtp:%d apt=%d", c.PayloadType, c.MediaPayloadType),
+		fmt.Sprintf("a=ssrc-group:FID %d %d", c.MediaSSRC, c.SSRC),
+	}
+}
+
+// Stats counts the retransmission requests
+type Stats struct {
+	Requested     int
+	Retransmitted int
+	// Unknown requests ask for packets not sent, too old or already retransmitted
+	Unknown int
+	// OverBudget requests were refused because the budget was used up
+	OverBudget int
+}
+
+type sentMedia struct {
+	sendTime time.Time
+	size     int
+	resent   time.Time
+}
+
+type spend struct {
+	at    time.Time
+	bytes int
+}
+
+// Retransmitter tracks the media packets sent and grants retransmission requests
+// within the budget, it is safe for concurrent use
+type Retransmitter struct {
+	mu  sync.Mutex
+	cfg Config
+
+	targetKbps int
+	sent       map[uint16]*sentMedia
+	order      []uint16
+	spent      []spend
+	spentBytes int
+	stats      Stats
+}
+
+// New creates a retransmitter
+func New(cfg Config) (*Retransmitter, error) {
+	switch {
+	case cfg.SSRC == cfg.MediaSSRC:
+		return nil, fmt.Errorf("%w: RTX SSRC %d is the media SSRC", ErrInvalidConfig, cfg.SSRC)
+	case cfg.PayloadType == cfg.MediaPayloadType || cfg.PayloadType > 127:
+		return nil, fmt.Errorf("%w: RTX payload type %d", ErrInvalidConfig, cfg.PayloadType)
+	case cfg.MaxShare <= 0 || cfg.MaxShare >= 1:
+		return nil, fmt.Errorf("%w: max share %v must be in (0, 1)", ErrInvalidConfig, cfg.MaxShare)
+	case cfg.Window <= 0 || cfg.MaxAge <= 0 || cfg.ResendInterval < 0:
+		return nil, fmt.Errorf("%w: window %v, max age %v, resend interval %v",
+			ErrInvalidConfig, cfg.Window, cfg.MaxAge, cfg.ResendInterval)
+	}
+	return &Retransmitter{
+		cfg:  cfg,
+		sent: make(map[uint16]*sentMedia),
+	}, nil
+}
+
+// Config returns the configuration of the retransmitter
+func (r *Retransmitter) Config() Config {
+	return r.cfg
+}
+
+// OnBitrate sets the target bitrate in Kbps the budget is a share of
+func (r *Retransmitter) OnBitrate(kbps int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.targetKbps = kbps
+}
+
+// OnPacketSent records the media packets that may be asked for, packets of other SSRCs are ignored
+func (r *Retransmitter) OnPacketSent(pkt ratecontrol.SentPacket) {
+	if pkt.SSRC != r.cfg.MediaSSRC {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for len(r.order) > 0 {
+		oldest, ok := r.sent[r.order[0]]
+		if ok && pkt.SendTime.Sub(oldest.sendTime) <= r.cfg.MaxAge {
+			break
+		}
+		delete(r.sent, r.order[0])
+		r.order = r.order[1:]
+	}
+	r.sent[pkt.SequenceNumber] = &sentMedia{sendTime: pkt.SendTime, size: pkt.Size}
+	r.order = append(r.order, pkt.SequenceNumber)
+}
+
+// Allow reports whether the media packet seq is retransmitted at now, and if so charges
+// its RTX size to the budget
+func (r *Retransmitter) Allow(now time.Time, ssrc uint32, seq uint16) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.stats.Requested++
+	pkt, ok := r.sent[seq]
+	if ssrc != r.cfg.MediaSSRC || !ok || now.Sub(pkt.sendTime) > r.cfg.MaxAge ||
+		(!pkt.resent.IsZero() && now.Sub(pkt.resent) < r.cfg.ResendInterval) {
+		r.stats.Unknown++
+		return false
+	}
+
+	size := pkt.size + osnSize
+	r.expire(now)
+	if r.spentBytes+size > r.budget() {
+		r.stats.OverBudget++
+		return false
+	}
+	r.spent = append(r.spent, spend{at: now, bytes: size})
+	r.spentBytes += size
+	pkt.resent = now
+	r.stats.Retransmitted++
+	return true
+}
+
+// budget returns the bytes retransmissions may use per window
+func (r *Retransmitter) budget() int {
+	return int(r.cfg.MaxShare * float64(r.targetKbps) * 1000 / 8 * r.cfg.Window.Seconds())
+}
+
+// expire forgets the retransmissions older than the window
+func (r *Retransmitter) expire(now time.Time) {
+	for len(r.spent) > 0 && now.Sub(r.spent[0].at) >= r.cfg.Window {
+		r.spentBytes -= r.spent[0].bytes
+		r.spent = r.spent[1:]
+	}
+}
+
+// RateKbps returns the retransmission rate over the last window
+func (r *Retransmitter) RateKbps(now time.Time) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.expire(now)
+	return int(float64(r.spentBytes) * 8 / 1000 / r.cfg.Window.Seconds())
+}
+
+// Stats returns the request counters
+func (r *Retransmitter) Stats() Stats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.stats
+}
@@ -0,0 +1,148 @@
+package rtx
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/arsperger/slowcast/pkg/ratecontrol"
+)
+
+const (
+	mediaSSRC = 0x11111111
+	rtxSSRC   = 0x22222222
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(c *Config)
+		wantErr bool
+	}{
+		{"defaults", func(*Config) {}, false},
+		{"RTX SSRC is the media SSRC", func(c *Config) { c.SSRC = c.MediaSSRC }, true},
+		{"RTX payload type is the media one", func(c *Config) { c.PayloadType = c.MediaPayloadType }, true},
+		{"payload type out of range", func(c *Config) { c.PayloadType = 128 }, true},
+		{"zero share", func(c *Config) { c.MaxShare = 0 }, true},
+		{"whole rate", func(c *Config) { c.MaxShare = 1 }, true},
+		{"zero window", func(c *Config) { c.Window = 0 }, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig(mediaSSRC, rtxSSRC)
+			tt.modify(&cfg)
+			_, err := New(cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !errors.Is(err, ErrInvalidConfig) {
+				t.Errorf("error %v does not wrap ErrInvalidConfig", err)
+			}
+		})
+	}
+}
+
+func TestConfig_SDP(t *testing.T) {
+	want := []string{
+		"a=rtpmap:97 rtx/90000",
+		"a=fmtp:97 apt=96",
+		"a=ssrc-group:FID 286331153 572662306",
+	}
+	got := DefaultConfig(mediaSSRC, rtxSSRC).SDP()
+	if len(got) != len(want) {
+		t.Fatalf("SDP() = %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("SDP()[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+// sendMedia records count 1000 byte media packets starting at seq 0, 1ms apart
+func sendMedia(r *Retransmitter, start time.Time, count int) {
+	for i := range count {
+		r.OnPacketSent(ratecontrol.SentPacket{
+			SendTime:       start.Add(time.Duration(i) * time.Millisecond),
+			SSRC:           mediaSSRC,
+			SequenceNumber: uint16(i), //nolint:gosec
+			Size:           1000,
+		})
+	}
+}
+
+func TestRetransmitter_Allow(t *testing.T) {
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		ssrc uint32
+		seq  uint16
+		at   time.Duration
+		want bool
+	}{
+		{"sent packet", mediaSSRC, 10, 100 * time.Millisecond, true},
+		{"other SSRC", rtxSSRC, 10, 100 * time.Millisecond, false},
+		{"never sent", mediaSSRC, 500, 100 * time.Millisecond, false},
+		{"too old", mediaSSRC, 10, 2 * time.Second, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := New(DefaultConfig(mediaSSRC, rtxSSRC))
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			r.OnBitrate(1000)
+			sendMedia(r, start, 100)
+
+			if got := r.Allow(start.Add(tt.at), tt.ssrc, tt.seq); got != tt.want {
+				t.Errorf("Allow() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetransmitter_budget(t *testing.T) {
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	r, err := New(DefaultConfig(mediaSSRC, rtxSSRC))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	// a quarter of 1000 Kbps over 1 second is 31250 bytes, 31 packets of 1002 bytes
+	r.OnBitrate(1000)
+	sendMedia(r, start, 100)
+
+	now := start.Add(100 * time.Millisecond)
+	allowed := 0
+	for seq := range uint16(100) {
+		if r.Allow(now, mediaSSRC, seq) {
+			allowed++
+		}
+	}
+	if allowed != 31 {
+		t.Errorf("allowed %d retransmissions, want 31", allowed)
+	}
+	if got := r.RateKbps(now); got != 248 {
+		t.Errorf("RateKbps() = %d, want 248", got)
+	}
+	if r.Allow(now.Add(50*time.Millisecond), mediaSSRC, 0) {
+		t.Error("packet retransmitted again within the resend interval")
+	}
+
+	stats := r.Stats()
+	if stats.Requested != 101 || stats.Retransmitted != 31 || stats.OverBudget != 69 || stats.Unknown != 1 {
+		t.Errorf("Stats() = %+v", stats)
+	}
+
+	// the budget is spent again once the window has passed
+	later := now.Add(time.Second)
+	if got := r.RateKbps(later); got != 0 {
+		t.Errorf("RateKbps() after the window = %d, want 0", got)
+	}
+	sendMedia(r, later, 1)
+	if !r.Allow(later, mediaSSRC, 0) {
+		t.Error("retransmission refused after the window")
+	}
+}
@@ -0,0 +1,46 @@
+package scream
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	baseOWDSlots        = 10
+	baseOWDSlotDuration = time.Minute
+)
+
+// baseOWDHistory tracks the minimum one-way delay over the last ten minutes,
+// one minimum per minute as in RFC 8298 section 4.1.1
+type baseOWDHistory struct {
+	slots     []float64
+	slotStart time.Time
+}
+
+func newBaseOWDHistory() *baseOWDHistory {
+	return &baseOWDHistory{
+		slots: make([]float64, 0, baseOWDSlots),
+	}
+}
+
+// update adds a one-way delay sample in seconds and returns the base delay
+func (h *baseOWDHistory) update(now time.Time, owd float64) float64 {
+	if len(h.slots) == 0 || now.Sub(h.slotStart) >= baseOWDSlotDuration {
+		if len(h.slots) >= baseOWDSlots {
+			h.slots = h.slots[1:]
+		}
+		h.slots = append(h.slots, owd)
+		h.slotStart = now
+	} else if owd < h.slots[len(h.slots)-1] {
+		h.slots[len(h.slots)-1] = owd
+	}
+	return h.base()
+}
+
+func (h *baseOWDHistory) base() float64 {
+	base := math.Inf(1)
+	for _, v := range h.slots {
+		base = math.Min(base, v)
+	}
+	return base
+}
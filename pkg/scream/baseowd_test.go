@@ -0,0 +1,39 @@
+package scream
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestBaseOWDHistory(t *testing.T) {
+	h := newBaseOWDHistory()
+	start := time.Now()
+
+	if !math.IsInf(h.base(), 1) {
+		t.Errorf("base() on empty history = %v, want +Inf", h.base())
+	}
+
+	h.update(start, 0.05)
+	if got := h.update(start.Add(time.Second), 0.03); got != 0.03 {
+		t.Errorf("update() = %v, want %v", got, 0.03)
+	}
+
+	// a larger sample in a new slot keeps the older minimum
+	if got := h.update(start.Add(baseOWDSlotDuration), 0.08); got != 0.03 {
+		t.Errorf("update() = %v, want %v", got, 0.03)
+	}
+
+	// the old minimum expires after baseOWDSlots minutes
+	now := start
+	for i := 1; i <= baseOWDSlots; i++ {
+		now = start.Add(time.Duration(i) * baseOWDSlotDuration)
+		h.update(now, 0.08)
+	}
+	if got := h.base(); got != 0.08 {
+		t.Errorf("base() after expiry = %v, want %v", got, 0.08)
+	}
+	if len(h.slots) != baseOWDSlots {
+		t.Errorf("slots = %v, want %v", len(h.slots), baseOWDSlots)
+	}
+}
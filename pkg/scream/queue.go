@@ -0,0 +1,55 @@
+package scream
+
+import "time"
+
+type queuedPacket struct {
+	key      flowKey
+	size     int
+	enqueued time.Time
+}
+
+// rtpQueue mirrors the packets waiting in the sender queue in front of the network,
+// its delay drives the media rate control
+type rtpQueue struct {
+	packets []queuedPacket
+	bytes   int
+}
+
+func newRTPQueue() *rtpQueue {
+	return &rtpQueue{
+		packets: make([]queuedPacket, 0, 256),
+	}
+}
+
+func (q *rtpQueue) push(now time.Time, key flowKey, size int) {
+	q.packets = append(q.packets, queuedPacket{key: key, size: size, enqueued: now})
+	q.bytes += size
+}
+
+// remove takes the packet of key out of the queue when it leaves for the network, along with
+// the older packets the queue let go unseen. Packets that never entered the queue are not found
+func (q *rtpQueue) remove(key flowKey) (queuedPacket, bool) {
+	for i, p := range q.packets {
+		if p.key != key {
+			continue
+		}
+		for _, skipped := range q.packets[:i+1] {
+			q.bytes -= skipped.size
+		}
+		q.packets = q.packets[i+1:]
+		return p, true
+	}
+	return queuedPacket{}, false
+}
+
+// delay returns how long the oldest packet has been waiting
+func (q *rtpQueue) delay(now time.Time) time.Duration {
+	if len(q.packets) == 0 {
+		return 0
+	}
+	return now.Sub(q.packets[0].enqueued)
+}
+
+func (q *rtpQueue) len() int {
+	return len(q.packets)
+}
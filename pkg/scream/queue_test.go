@@ -0,0 +1,45 @@
+package scream
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRTPQueue(t *testing.T) {
+	q := newRTPQueue()
+	start := time.Now()
+
+	if q.delay(start) != 0 {
+		t.Errorf("delay() on empty queue = %v, want 0", q.delay(start))
+	}
+	if _, ok := q.remove(flowKey{ssrc: 1, seq: 1}); ok {
+		t.Error("remove() found a packet in an empty queue")
+	}
+
+	q.push(start, flowKey{ssrc: 1, seq: 1}, 1000)
+	q.push(start.Add(10*time.Millisecond), flowKey{ssrc: 1, seq: 2}, 500)
+	q.push(start.Add(20*time.Millisecond), flowKey{ssrc: 1, seq: 3}, 200)
+
+	if q.bytes != 1700 || q.len() != 3 {
+		t.Errorf("push() bytes = %v, len = %v, want 1700, 3", q.bytes, q.len())
+	}
+	if got := q.delay(start.Add(30 * time.Millisecond)); got != 30*time.Millisecond {
+		t.Errorf("delay() = %v, want %v", got, 30*time.Millisecond)
+	}
+
+	// probe padding and retransmissions never went through the queue
+	if _, ok := q.remove(flowKey{ssrc: 2, seq: 1}); ok || q.len() != 3 {
+		t.Errorf("remove() of an unqueued packet = %v, len %v, want false, 3", ok, q.len())
+	}
+
+	p, ok := q.remove(flowKey{ssrc: 1, seq: 1})
+	if !ok || p.size != 1000 || q.bytes != 700 || q.len() != 2 {
+		t.Errorf("remove() = %v, %v, bytes = %v, len = %v, want 1000, true, 700, 2", p.size, ok, q.bytes, q.len())
+	}
+
+	// the packets ahead of the removed one left unseen
+	p, ok = q.remove(flowKey{ssrc: 1, seq: 3})
+	if !ok || p.size != 200 || q.bytes != 0 || q.len() != 0 {
+		t.Errorf("remove() = %v, %v, bytes = %v, len = %v, want 200, true, 0, 0", p.size, ok, q.bytes, q.len())
+	}
+}
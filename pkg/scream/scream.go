@@ -0,0 +1,401 @@
+package scream
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/pion/rtcp"
+
+	"github.com/arsperger/slowcast/pkg/ratecontrol"
+)
+
+// Name is the registry name of the SCReAM controller
+const Name = "scream"
+
+// Network congestion control constants, RFC 8298 section 4.1.1
+const (
+	mss          = 1200
+	minCwnd      = 3 * mss
+	qdelayTarget = 0.1 // seconds
+	betaLoss     = 0.8
+	betaECN      = 0.9
+	gain         = 1.0
+
+	// bytesInFlightHeadroom lets cwnd grow above what the encoder actually filled
+	bytesInFlightHeadroom = 1.5
+
+	// feedbackTimeout clears the window when the receiver stops sending feedback
+	feedbackTimeout = time.Second
+)
+
+// Media rate control constants, RFC 8298 section 4.1.2
+const (
+	rampUpSpeed        = 200.0 // Kbps per second
+	betaR              = 0.9
+	preCongestionGuard = 0.1
+
+	// rtpQueueDelayLimit triggers a rate reduction when the sender queue builds up
+	rtpQueueDelayLimit = 100 * time.Millisecond
+	// rtpQueueMaxAge discards packets that waited so long they are useless
+	rtpQueueMaxAge = 200 * time.Millisecond
+
+	transmitRateWindow = 500 * time.Millisecond
+	maxRateUpdateStep  = time.Second
+
+	// arrivalTimeUnavailable is the RFC 8888 arrival time offset of packets without a timestamp
+	arrivalTimeUnavailable = 0x1FFF
+)
+
+var _ ratecontrol.SendLimiter = (*Scream)(nil)
+
+type flowKey struct {
+	ssrc uint32
+	seq  uint16
+}
+
+type sentRecord struct {
+	sendTime time.Time
+	size     int
+}
+
+type transmitted struct {
+	at   time.Time
+	size int
+}
+
+// Scream is a self-clocked rate adaptation sender (RFC 8298): a congestion window
+// limits the bytes in flight and the encoder target follows the queuing delay
+type Scream struct {
+	mu sync.Mutex
+
+	// network congestion control
+	cwnd                 float64
+	inFlight             map[flowKey]sentRecord
+	bytesInFlight        int
+	maxBytesInFlight     int
+	maxBytesInFlightPrev int
+	lastMaxReset         time.Time
+	baseOWD              *baseOWDHistory
+	qdelay               float64
+	lastFeedback         time.Time
+	lastCongestion       time.Time
+	lossEvent            bool
+	ecnEvent             bool
+	totalLost            map[uint32]uint32
+
+	// sender queue and transmit rate
+	queue       *rtpQueue
+	transmitted []transmitted
+	txBytes     int
+	discarded   int
+
+	// media rate control, rate limits Kbps
+	minBitrate     int
+	maxBitrate     int
+	targetBitrate  float64
+	lastRateUpdate time.Time
+
+	lossRate    float64
+	rttSample   float64
+	smoothedRTT float64
+
+	// senderReports matches the LSR of receiver reports, nil uses the LSR arithmetic
+	senderReports *ratecontrol.SenderReportHistory
+}
+
+// New creates a SCReAM controller, bitrates in Kbps
+func New(init, min, max int) (*Scream, error) { //nolint:predeclared
+	if min <= 0 || min > max || init < min || init > max {
+		return nil, fmt.Errorf("invalid bitrate limits: init %d, min %d, max %d", init, min, max)
+	}
+	return &Scream{
+		cwnd:          minCwnd,
+		inFlight:      make(map[flowKey]sentRecord),
+		baseOWD:       newBaseOWDHistory(),
+		totalLost:     make(map[uint32]uint32),
+		queue:         newRTPQueue(),
+		minBitrate:    min,
+		maxBitrate:    max,
+		targetBitrate: float64(init),
+		smoothedRTT:   qdelayTarget,
+	}, nil
+}
+
+// NewController is a ratecontrol.Factory creating a SCReAM controller
+func NewController(cfg ratecontrol.Config) (ratecontrol.RateController, error) {
+	s, err := New(cfg.InitBitrate, cfg.MinBitrate, cfg.MaxBitrate)
+	if err != nil {
+		return nil, err
+	}
+	s.senderReports = cfg.SenderReports
+	return s, nil
+}
+
+// OnPacketQueued adds a packet to the sender queue
+func (s *Scream) OnPacketQueued(now time.Time, ssrc uint32, seq uint16, size int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queue.push(now, flowKey{ssrc: ssrc, seq: seq}, size)
+}
+
+// OnPacketDequeued takes a packet out of the sender queue, a packet that waited longer than
+// rtpQueueMaxAge is useless to the receiver and is discarded
+func (s *Scream) OnPacketDequeued(now time.Time, ssrc uint32, seq uint16) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.queue.remove(flowKey{ssrc: ssrc, seq: seq})
+	if ok && now.Sub(p.enqueued) > rtpQueueMaxAge {
+		s.discarded++
+		return false
+	}
+	return true
+}
+
+// Discarded returns the number of packets discarded from the sender queue
+func (s *Scream) Discarded() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.discarded
+}
+
+// CanSend reports whether the congestion window has room for another packet
+func (s *Scream) CanSend(now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.bytesInFlight > 0 && now.Sub(s.lastActivity()) > feedbackTimeout {
+		// no feedback for a long time, assume everything in flight is lost
+		s.inFlight = make(map[flowKey]sentRecord)
+		s.bytesInFlight = 0
+		s.cwnd = minCwnd
+	}
+	return float64(s.bytesInFlight) < s.cwnd
+}
+
+// lastActivity is the last feedback time, or the oldest packet in flight before any feedback
+func (s *Scream) lastActivity() time.Time {
+	if !s.lastFeedback.IsZero() {
+		return s.lastFeedback
+	}
+	oldest := time.Time{}
+	for _, rec := range s.inFlight {
+		if oldest.IsZero() || rec.sendTime.Before(oldest) {
+			oldest = rec.sendTime
+		}
+	}
+	return oldest
+}
+
+// OnPacketSent records a packet in flight, media from the sender queue as well as probe padding
+// and retransmissions
+func (s *Scream) OnPacketSent(pkt ratecontrol.SentPacket) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.inFlight[flowKey{ssrc: pkt.SSRC, seq: pkt.SequenceNumber}] = sentRecord{sendTime: pkt.SendTime, size: pkt.Size}
+	s.bytesInFlight += pkt.Size
+	s.maxBytesInFlight = max(s.maxBytesInFlight, s.bytesInFlight)
+
+	s.transmitted = append(s.transmitted, transmitted{at: pkt.SendTime, size: pkt.Size})
+	s.txBytes += pkt.Size
+	for len(s.transmitted) > 0 && pkt.SendTime.Sub(s.transmitted[0].at) > transmitRateWindow {
+		s.txBytes -= s.transmitted[0].size
+		s.transmitted = s.transmitted[1:]
+	}
+}
+
+// OnRTCP handles RFC 8888 congestion control feedback, receiver reports are
+// used as a coarser fallback when the receiver does not support it
+func (s *Scream) OnRTCP(now time.Time, pkt rtcp.Packet) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var acked int
+	switch p := pkt.(type) {
+	case *rtcp.CCFeedbackReport:
+		acked = s.onCCFeedback(now, p)
+	case *rtcp.ReceiverReport:
+		acked = s.onReceiverReport(now, p)
+	default:
+		return
+	}
+
+	s.lastFeedback = now
+	s.updateCwnd(now, acked)
+	s.updateTargetRate(now)
+}
+
+// onCCFeedback acknowledges the packets listed in the report and returns the bytes newly acked
+func (s *Scream) onCCFeedback(now time.Time, fb *rtcp.CCFeedbackReport) int {
+	var acked, lost, total int
+	var qdelaySum float64
+	var qdelaySamples int
+	var lastAcked time.Time
+
+	for _, block := range fb.ReportBlocks {
+		for i, metric := range block.MetricBlocks {
+			key := flowKey{ssrc: block.MediaSSRC, seq: block.BeginSequence + uint16(i)} //nolint:gosec
+			rec, ok := s.inFlight[key]
+			if !ok {
+				continue
+			}
+			total++
+			if !metric.Received {
+				lost++
+				s.removeInFlight(key, rec)
+				continue
+			}
+			acked += rec.size
+			s.removeInFlight(key, rec)
+			if rec.sendTime.After(lastAcked) {
+				lastAcked = rec.sendTime
+			}
+			if metric.ECN == rtcp.ECNCE {
+				s.ecnEvent = true
+			}
+			if metric.ArrivalTimeOffset == arrivalTimeUnavailable {
+				continue
+			}
+
+			// arrival in receiver compact NTP time, ATO is in 1/1024 seconds
+			arrival := fb.ReportTimestamp - uint32(metric.ArrivalTimeOffset)*64
+			owd := float64(int32(arrival-ratecontrol.NTPMiddle32(rec.sendTime))) / 65536.0 //nolint:gosec
+			base := s.baseOWD.update(now, owd)
+			qdelaySum += owd - base
+			qdelaySamples++
+		}
+	}
+
+	if qdelaySamples > 0 {
+		s.qdelay = qdelaySum / float64(qdelaySamples)
+	}
+	if !lastAcked.IsZero() {
+		s.updateRTT(now.Sub(lastAcked).Seconds())
+	}
+	if total > 0 {
+		s.lossRate = float64(lost) / float64(total)
+	}
+	if lost > 0 {
+		s.lossEvent = true
+	}
+	return acked
+}
+
+// onReceiverReport acknowledges everything up to the highest sequence number received,
+// the queuing delay is approximated from the RTT above its minimum
+func (s *Scream) onReceiverReport(now time.Time, rr *rtcp.ReceiverReport) int {
+	var acked int
+	for _, report := range rr.Reports {
+		highest := uint16(report.LastSequenceNumber) //nolint:gosec
+		for key, rec := range s.inFlight {
+			if key.ssrc == report.SSRC && int16(highest-key.seq) >= 0 { //nolint:gosec
+				acked += rec.size
+				s.removeInFlight(key, rec)
+			}
+		}
+
+		if prev, ok := s.totalLost[report.SSRC]; ok && report.TotalLost > prev {
+			s.lossEvent = true
+		}
+		s.totalLost[report.SSRC] = report.TotalLost
+		s.lossRate = float64(report.FractionLost) / 256.0
+
+		if rtt, ok := s.senderReports.RTT(now, report.LastSenderReport, report.Delay); ok {
+			s.updateRTT(rtt)
+			base := s.baseOWD.update(now, rtt)
+			s.qdelay = rtt - base
+		}
+	}
+	return acked
+}
+
+func (s *Scream) removeInFlight(key flowKey, rec sentRecord) {
+	delete(s.inFlight, key)
+	s.bytesInFlight -= rec.size
+}
+
+func (s *Scream) updateRTT(rtt float64) {
+	s.rttSample = rtt
+	s.smoothedRTT = 0.875*s.smoothedRTT + 0.125*rtt
+}
+
+// updateCwnd reacts to loss and ECN once per RTT and otherwise moves the window
+// toward the queuing delay target
+func (s *Scream) updateCwnd(now time.Time, bytesNewlyAcked int) {
+	congested := s.lossEvent || s.ecnEvent
+	if congested && now.Sub(s.lastCongestion).Seconds() > s.smoothedRTT {
+		if s.lossEvent {
+			s.cwnd *= betaLoss
+		} else {
+			s.cwnd *= betaECN
+		}
+		s.lastCongestion = now
+	} else if !congested {
+		offTarget := (qdelayTarget - s.qdelay) / qdelayTarget
+		s.cwnd += gain * offTarget * float64(bytesNewlyAcked) * mss / s.cwnd
+	}
+
+	// do not let the window grow far above what the encoder fills
+	if now.Sub(s.lastMaxReset).Seconds() > s.smoothedRTT {
+		s.maxBytesInFlightPrev = s.maxBytesInFlight
+		s.maxBytesInFlight = s.bytesInFlight
+		s.lastMaxReset = now
+	}
+	limit := bytesInFlightHeadroom * float64(max(s.maxBytesInFlight, s.maxBytesInFlightPrev))
+	s.cwnd = math.Max(minCwnd, math.Min(s.cwnd, math.Max(limit, minCwnd)))
+}
+
+// updateTargetRate adjusts the encoder target from congestion events,
+// sender queue delay and network queuing delay
+func (s *Scream) updateTargetRate(now time.Time) {
+	if s.lastRateUpdate.IsZero() {
+		s.lastRateUpdate = now
+	}
+	dt := min(now.Sub(s.lastRateUpdate), maxRateUpdateStep).Seconds()
+	s.lastRateUpdate = now
+
+	queueDelay := s.queue.delay(now)
+	switch {
+	case s.lossEvent || s.ecnEvent:
+		s.targetBitrate *= betaR
+	case queueDelay > rtpQueueDelayLimit:
+		// the encoder produces more than the window lets through
+		s.targetBitrate *= 1 - preCongestionGuard
+	case s.qdelay > qdelayTarget/2:
+		scale := math.Min(1, (s.qdelay-qdelayTarget/2)/(qdelayTarget/2))
+		s.targetBitrate *= 1 - preCongestionGuard*scale*dt
+	default:
+		s.targetBitrate += rampUpSpeed * dt
+	}
+	s.lossEvent = false
+	s.ecnEvent = false
+
+	// the encoder should not outrun what the window can carry per RTT
+	if s.smoothedRTT > 0 && s.maxBytesInFlightPrev > 0 {
+		windowRate := s.cwnd * 8 / 1000 / s.smoothedRTT
+		s.targetBitrate = math.Min(s.targetBitrate, bytesInFlightHeadroom*windowRate)
+	}
+	s.targetBitrate = math.Max(float64(s.minBitrate), math.Min(s.targetBitrate, float64(s.maxBitrate)))
+}
+
+// TargetBitrate returns the encoder target in Kbps
+func (s *Scream) TargetBitrate() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return int(s.targetBitrate)
+}
+
+// State returns the current SCReAM estimates
+func (s *Scream) State() ratecontrol.State {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return ratecontrol.State{
+		Bitrate:     int(s.targetBitrate),
+		RTTSample:   s.rttSample,
+		SmoothedRTT: s.smoothedRTT,
+		LossRate:    s.lossRate,
+	}
+}
@@ -0,0 +1,288 @@
+package scream
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pion/rtcp"
+
+	"github.com/arsperger/slowcast/pkg/ratecontrol"
+)
+
+const testSSRC = 0x1234
+
+// localReceiver simulates a bottleneck link in front of a receiver sending RFC 8888 feedback
+type localReceiver struct {
+	capacityKbps float64
+	propagation  time.Duration
+	linkFree     time.Time
+	dropEvery    int
+	arrivals     map[uint16]time.Time
+	pending      []uint16
+	maxQueue     time.Duration
+}
+
+func newLocalReceiver(capacityKbps float64, dropEvery int) *localReceiver {
+	return &localReceiver{
+		capacityKbps: capacityKbps,
+		propagation:  20 * time.Millisecond,
+		dropEvery:    dropEvery,
+		arrivals:     make(map[uint16]time.Time),
+	}
+}
+
+func (r *localReceiver) send(now time.Time, seq uint16, size int) {
+	r.pending = append(r.pending, seq)
+	if r.dropEvery > 0 && int(seq)%r.dropEvery == 0 {
+		return
+	}
+	start := now
+	if r.linkFree.After(now) {
+		start = r.linkFree
+	}
+	r.maxQueue = max(r.maxQueue, start.Sub(now))
+	r.linkFree = start.Add(time.Duration(float64(size*8) / r.capacityKbps * float64(time.Millisecond)))
+	r.arrivals[seq] = r.linkFree.Add(r.propagation)
+}
+
+// feedback reports every pending packet whose fate is known at now
+func (r *localReceiver) feedback(now time.Time) *rtcp.CCFeedbackReport {
+	if len(r.pending) == 0 {
+		return nil
+	}
+	block := rtcp.CCFeedbackReportBlock{MediaSSRC: testSSRC, BeginSequence: r.pending[0]}
+	n := 0
+	for _, seq := range r.pending {
+		arrival, received := r.arrivals[seq]
+		if received && arrival.After(now) {
+			break // still in the network
+		}
+		metric := rtcp.CCFeedbackMetricBlock{Received: received}
+		if received {
+			metric.ArrivalTimeOffset = uint16(now.Sub(arrival).Seconds() * 1024)
+		}
+		block.MetricBlocks = append(block.MetricBlocks, metric)
+		n++
+	}
+	r.pending = r.pending[n:]
+	return &rtcp.CCFeedbackReport{
+		SenderSSRC:      1,
+		ReportBlocks:    []rtcp.CCFeedbackReportBlock{block},
+		ReportTimestamp: ratecontrol.NTPMiddle32(now),
+	}
+}
+
+// runSession streams through the receiver for d and returns the sender's end time
+func runSession(t *testing.T, s *Scream, r *localReceiver, start time.Time, d time.Duration) time.Time {
+	t.Helper()
+	const step = time.Millisecond
+	const size = 1200
+
+	var credit float64
+	var queued []uint16
+	var nextSeq uint16
+	now := start
+	for now.Sub(start) < d {
+		now = now.Add(step)
+
+		// encoder produces the target rate
+		credit += float64(s.TargetBitrate()) * 1000 / 8 * step.Seconds()
+		for credit >= size {
+			s.OnPacketQueued(now, testSSRC, nextSeq, size)
+			queued = append(queued, nextSeq)
+			nextSeq++
+			credit -= size
+		}
+
+		for len(queued) > 0 && s.CanSend(now) {
+			seq := queued[0]
+			queued = queued[1:]
+			if !s.OnPacketDequeued(now, testSSRC, seq) {
+				continue
+			}
+			s.OnPacketSent(ratecontrol.SentPacket{SendTime: now, SSRC: testSSRC, SequenceNumber: seq, Size: size})
+			r.send(now, seq, size)
+			if float64(s.bytesInFlight) > s.cwnd+size {
+				t.Fatalf("bytes in flight %d exceed cwnd %.0f", s.bytesInFlight, s.cwnd)
+			}
+		}
+
+		if now.Sub(start)%(50*time.Millisecond) == 0 {
+			if fb := r.feedback(now); fb != nil {
+				s.OnRTCP(now, fb)
+			}
+		}
+	}
+	return now
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		init    int
+		min     int
+		max     int
+		wantErr bool
+	}{
+		{name: "valid parameters", init: 500, min: 100, max: 4000, wantErr: false},
+		{name: "init above max", init: 5000, min: 100, max: 4000, wantErr: true},
+		{name: "negative min", init: 500, min: -1, max: 4000, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := New(tt.init, tt.min, tt.max)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && s.TargetBitrate() != tt.init {
+				t.Errorf("New() bitrate = %v, want %v", s.TargetBitrate(), tt.init)
+			}
+		})
+	}
+}
+
+func TestScream_CanSend(t *testing.T) {
+	s, _ := New(500, 100, 4000)
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		if !s.CanSend(now) {
+			t.Fatalf("CanSend() = false with %d bytes in flight, cwnd %.0f", s.bytesInFlight, s.cwnd)
+		}
+		s.OnPacketSent(ratecontrol.SentPacket{SendTime: now, SSRC: testSSRC, SequenceNumber: uint16(i), Size: mss}) //nolint:gosec
+	}
+	if s.CanSend(now) {
+		t.Errorf("CanSend() = true with full window: %d bytes in flight", s.bytesInFlight)
+	}
+
+	// without any feedback the window is released after the timeout
+	if !s.CanSend(now.Add(feedbackTimeout + time.Millisecond)) {
+		t.Error("CanSend() = false after feedback timeout")
+	}
+	if s.bytesInFlight != 0 {
+		t.Errorf("bytesInFlight after timeout = %v, want 0", s.bytesInFlight)
+	}
+}
+
+func TestScream_OnPacketDequeued(t *testing.T) {
+	s, _ := New(500, 100, 4000)
+	now := time.Now()
+
+	s.OnPacketQueued(now, testSSRC, 1, mss)
+	s.OnPacketQueued(now.Add(100*time.Millisecond), testSSRC, 2, mss)
+
+	// probe padding and retransmissions are sent without passing the queue
+	s.OnPacketSent(ratecontrol.SentPacket{SendTime: now, SSRC: testSSRC + 1, SequenceNumber: 1, Size: mss})
+	if s.queue.len() != 2 {
+		t.Fatalf("queue length after an unqueued packet = %d, want 2", s.queue.len())
+	}
+
+	late := now.Add(rtpQueueMaxAge + time.Millisecond)
+	if s.OnPacketDequeued(late, testSSRC, 1) {
+		t.Error("OnPacketDequeued() kept a packet older than the max age")
+	}
+	if !s.OnPacketDequeued(late, testSSRC, 2) {
+		t.Error("OnPacketDequeued() discarded a fresh packet")
+	}
+	if !s.OnPacketDequeued(late, testSSRC+1, 2) {
+		t.Error("OnPacketDequeued() discarded a packet that was never queued")
+	}
+	if s.Discarded() != 1 || s.queue.len() != 0 {
+		t.Errorf("Discarded() = %d, queue length %d, want 1, 0", s.Discarded(), s.queue.len())
+	}
+}
+
+func TestScream_OnRTCP(t *testing.T) {
+	t.Run("feedback acknowledges packets", func(t *testing.T) {
+		s, _ := New(500, 100, 4000)
+		now := time.Now()
+		for i := 0; i < 3; i++ {
+			s.OnPacketSent(ratecontrol.SentPacket{SendTime: now, SSRC: testSSRC, SequenceNumber: uint16(i), Size: mss}) //nolint:gosec
+		}
+
+		now = now.Add(50 * time.Millisecond)
+		fb := &rtcp.CCFeedbackReport{
+			ReportBlocks: []rtcp.CCFeedbackReportBlock{{
+				MediaSSRC:     testSSRC,
+				BeginSequence: 0,
+				MetricBlocks: []rtcp.CCFeedbackMetricBlock{
+					{Received: true, ArrivalTimeOffset: 20},
+					{Received: false},
+					{Received: true, ECN: rtcp.ECNCE, ArrivalTimeOffset: arrivalTimeUnavailable},
+				},
+			}},
+			ReportTimestamp: ratecontrol.NTPMiddle32(now),
+		}
+		s.OnRTCP(now, fb)
+
+		if s.bytesInFlight != 0 {
+			t.Errorf("bytesInFlight = %v, want 0", s.bytesInFlight)
+		}
+		state := s.State()
+		if abs(state.LossRate-1.0/3.0) > 0.001 {
+			t.Errorf("State() LossRate = %v, want %v", state.LossRate, 1.0/3.0)
+		}
+		if abs(state.RTTSample-0.05) > 0.001 {
+			t.Errorf("State() RTTSample = %v, want %v", state.RTTSample, 0.05)
+		}
+		if state.Bitrate != int(500*betaR) {
+			t.Errorf("State() Bitrate = %v, want %v", state.Bitrate, int(500*betaR))
+		}
+	})
+
+	t.Run("receiver report fallback", func(t *testing.T) {
+		s, _ := New(500, 100, 4000)
+		now := time.Now()
+		for i := 0; i < 3; i++ {
+			s.OnPacketSent(ratecontrol.SentPacket{SendTime: now, SSRC: testSSRC, SequenceNumber: uint16(65534 + i), Size: mss}) //nolint:gosec
+		}
+
+		rr := &rtcp.ReceiverReport{Reports: []rtcp.ReceptionReport{{
+			SSRC:               testSSRC,
+			LastSequenceNumber: 1<<16 | 0,
+		}}}
+		s.OnRTCP(now.Add(50*time.Millisecond), rr)
+
+		if s.bytesInFlight != 0 {
+			t.Errorf("bytesInFlight = %v, want 0", s.bytesInFlight)
+		}
+	})
+}
+
+func TestScream_LocalReceiver(t *testing.T) {
+	tests := []struct {
+		name      string
+		capacity  float64
+		dropEvery int
+		minRate   int
+		maxRate   int
+	}{
+		{name: "fast link ramps up", capacity: 5000, minRate: 3000, maxRate: 4000},
+		{name: "bottleneck link", capacity: 1500, minRate: 700, maxRate: 1700},
+		{name: "lossy bottleneck", capacity: 1500, dropEvery: 50, minRate: 100, maxRate: 1500},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := New(500, 100, 4000)
+			r := newLocalReceiver(tt.capacity, tt.dropEvery)
+			runSession(t, s, r, time.Now(), 30*time.Second)
+
+			if got := s.TargetBitrate(); got < tt.minRate || got > tt.maxRate {
+				t.Errorf("TargetBitrate() = %v, want in [%v, %v]", got, tt.minRate, tt.maxRate)
+			}
+			if r.maxQueue > time.Second {
+				t.Errorf("bottleneck queue reached %v", r.maxQueue)
+			}
+		})
+	}
+}
+
+// Helper function for floating point comparison
+func abs(x float64) float64 {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,29 @@
+package sim
+
+import (
+	"time"
+
+	"github.com/arsperger/slowcast/pkg/ratecontrol"
+)
+
+var _ ratecontrol.Clock = (*Clock)(nil)
+
+// Clock is a manually advanced ratecontrol.Clock
+type Clock struct {
+	now time.Time
+}
+
+// NewClock creates a clock starting at start
+func NewClock(start time.Time) *Clock {
+	return &Clock{now: start}
+}
+
+// Now returns the simulated time
+func (c *Clock) Now() time.Time {
+	return c.now
+}
+
+// Advance moves the simulated time forward by d
+func (c *Clock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
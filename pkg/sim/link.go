@@ -0,0 +1,142 @@
+package sim
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// LinkConfig describes the forward bottleneck between the sender and the receiver
+type LinkConfig struct {
+	// CapacityKbps is the bottleneck rate
+	CapacityKbps int
+	// QueueBytes is the drop-tail queue size in front of the bottleneck
+	QueueBytes int
+	// PropagationDelay is the one-way delay, the return path adds the same delay without queueing
+	PropagationDelay time.Duration
+	// LossRate is the probability of an independent random loss per packet
+	LossRate float64
+	// Burst adds Gilbert-Elliott bursty loss, the zero value disables it
+	Burst GilbertElliott
+	// CapacityChanges switches the capacity at the given offsets from the start
+	CapacityChanges []CapacityChange
+}
+
+// GilbertElliott is a two-state bursty loss model, the transitions are evaluated per packet
+type GilbertElliott struct {
+	PGoodToBad float64
+	PBadToGood float64
+	// LossInBad is the loss probability while in the bad state
+	LossInBad float64
+}
+
+// CapacityChange sets the link capacity At an offset from the start of the run
+type CapacityChange struct {
+	At           time.Duration
+	CapacityKbps int
+}
+
+// linkPacket is a packet crossing the link
+type linkPacket struct {
+	seq       uint32
+	size      int
+	sendTime  time.Time
+	departure time.Time
+	arrival   time.Time
+}
+
+// link is a drop-tail queue served at capacityKbps followed by a fixed propagation delay
+type link struct {
+	cfg          LinkConfig
+	rng          *rand.Rand
+	capacityKbps int
+	busyUntil    time.Time
+	queue        []linkPacket
+	queuedBytes  int
+	wire         []linkPacket
+	bad          bool
+}
+
+func newLink(cfg LinkConfig, seed uint64) *link {
+	return &link{
+		cfg:          cfg,
+		rng:          rand.New(rand.NewPCG(seed, seed^0x9E3779B97F4A7C15)), //nolint:gosec // reproducible, not secret
+		capacityKbps: cfg.CapacityKbps,
+	}
+}
+
+// setCapacity changes the service rate for packets queued from now on
+func (l *link) setCapacity(kbps int) {
+	l.capacityKbps = kbps
+}
+
+// lost draws the random and bursty loss for one packet
+func (l *link) lost() bool {
+	burst := l.cfg.Burst
+	if burst.PGoodToBad > 0 {
+		if l.bad {
+			l.bad = l.rng.Float64() >= burst.PBadToGood
+		} else {
+			l.bad = l.rng.Float64() < burst.PGoodToBad
+		}
+		if l.bad && l.rng.Float64() < burst.LossInBad {
+			return true
+		}
+	}
+	return l.cfg.LossRate > 0 && l.rng.Float64() < l.cfg.LossRate
+}
+
+// send offers a packet to the link, returning false when it is dropped
+func (l *link) send(now time.Time, seq uint32, size int) bool {
+	l.advance(now)
+	if l.lost() {
+		return false
+	}
+	if l.cfg.QueueBytes > 0 && l.queuedBytes+size > l.cfg.QueueBytes {
+		return false
+	}
+
+	start := now
+	if l.busyUntil.After(now) {
+		start = l.busyUntil
+	}
+	departure := start.Add(time.Duration(float64(size*8) / float64(l.capacityKbps) * float64(time.Millisecond)))
+	l.busyUntil = departure
+	l.queue = append(l.queue, linkPacket{
+		seq:       seq,
+		size:      size,
+		sendTime:  now,
+		departure: departure,
+		arrival:   departure.Add(l.cfg.PropagationDelay),
+	})
+	l.queuedBytes += size
+	return true
+}
+
+// advance moves packets that finished serialization from the queue onto the wire
+func (l *link) advance(now time.Time) {
+	for len(l.queue) > 0 && !l.queue[0].departure.After(now) {
+		l.queuedBytes -= l.queue[0].size
+		l.wire = append(l.wire, l.queue[0])
+		l.queue = l.queue[1:]
+	}
+}
+
+// deliver returns the packets that reached the receiver by now
+func (l *link) deliver(now time.Time) []linkPacket {
+	l.advance(now)
+	n := 0
+	for n < len(l.wire) && !l.wire[n].arrival.After(now) {
+		n++
+	}
+	delivered := l.wire[:n]
+	l.wire = l.wire[n:]
+	return delivered
+}
+
+// queueDelay is the time a packet entering the link now would wait before serialization
+func (l *link) queueDelay(now time.Time) time.Duration {
+	if l.busyUntil.After(now) {
+		return l.busyUntil.Sub(now)
+	}
+	return 0
+}
@@ -0,0 +1,70 @@
+package sim
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLink_Serialization(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := newLink(LinkConfig{CapacityKbps: 960, QueueBytes: 3000, PropagationDelay: 20 * time.Millisecond}, 1)
+
+	// 1200 bytes at 960 Kbps take 10ms each
+	for i := range 3 {
+		if !l.send(start, uint32(i), 1200) && i < 2 { //nolint:gosec
+			t.Fatalf("packet %d dropped", i)
+		}
+	}
+	if got := l.queueDelay(start); got != 20*time.Millisecond {
+		t.Errorf("queueDelay() = %v, want 20ms", got)
+	}
+	if l.queuedBytes != 2400 {
+		t.Errorf("queuedBytes = %d, want 2400 after the tail drop", l.queuedBytes)
+	}
+
+	if got := l.deliver(start.Add(29 * time.Millisecond)); len(got) != 0 {
+		t.Errorf("deliver() before arrival returned %d packets", len(got))
+	}
+	got := l.deliver(start.Add(30 * time.Millisecond))
+	if len(got) != 1 || got[0].seq != 0 {
+		t.Fatalf("deliver() = %+v, want packet 0", got)
+	}
+	got = l.deliver(start.Add(40 * time.Millisecond))
+	if len(got) != 1 || got[0].seq != 1 {
+		t.Fatalf("deliver() = %+v, want packet 1", got)
+	}
+	if l.queuedBytes != 0 {
+		t.Errorf("queuedBytes = %d, want 0", l.queuedBytes)
+	}
+}
+
+func TestLink_Loss(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    LinkConfig
+		minPct float64
+		maxPct float64
+	}{
+		{"lossless", LinkConfig{}, 0, 0},
+		{"random", LinkConfig{LossRate: 0.05}, 4, 6},
+		// stationary bad share 0.02/(0.02+0.2), half of it lost
+		{"bursty", LinkConfig{Burst: GilbertElliott{PGoodToBad: 0.02, PBadToGood: 0.2, LossInBad: 0.5}}, 3.5, 5.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.CapacityKbps = 1000
+			l := newLink(tt.cfg, 42)
+			const n = 100000
+			lost := 0
+			for range n {
+				if l.lost() {
+					lost++
+				}
+			}
+			pct := float64(lost) * 100 / n
+			if pct < tt.minPct || pct > tt.maxPct {
+				t.Errorf("loss = %.2f%%, want [%.1f, %.1f]", pct, tt.minPct, tt.maxPct)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package sim
+
+import (
+	"math"
+	"time"
+
+	"github.com/pion/rtcp"
+)
+
+const (
+	// rtpClockRate is the video RTP timestamp rate used for the jitter estimate
+	rtpClockRate = 90000
+
+	// maxTotalLost is the largest cumulative loss a report block can carry
+	maxTotalLost = 0x7FFFFF
+)
+
+// receiver keeps the RFC 3550 reception statistics of a single media source
+type receiver struct {
+	started    bool
+	baseSeq    uint32
+	highestSeq uint32
+	received   int64
+
+	expectedPrior int64
+	receivedPrior int64
+
+	// jitter in RTP timestamp units
+	jitter      float64
+	lastTransit time.Duration
+
+	lastSR        uint32
+	lastSRArrival time.Time
+}
+
+// onPacket records a delivered RTP packet
+func (r *receiver) onPacket(seq uint32, sendTime, arrival time.Time) {
+	transit := arrival.Sub(sendTime)
+	if !r.started {
+		r.started = true
+		r.baseSeq = seq
+		r.highestSeq = seq
+	} else {
+		d := math.Abs((transit - r.lastTransit).Seconds()) * rtpClockRate
+		r.jitter += (d - r.jitter) / 16
+	}
+	r.lastTransit = transit
+	if seq > r.highestSeq {
+		r.highestSeq = seq
+	}
+	r.received++
+}
+
+// onSenderReport records the compact NTP timestamp of a delivered sender report
+func (r *receiver) onSenderReport(ntp uint32, arrival time.Time) {
+	r.lastSR = ntp
+	r.lastSRArrival = arrival
+}
+
+// report builds the report block for the interval since the previous call
+func (r *receiver) report(now time.Time, mediaSSRC uint32) rtcp.ReceptionReport {
+	block := rtcp.ReceptionReport{SSRC: mediaSSRC}
+	if r.started {
+		expected := int64(r.highestSeq-r.baseSeq) + 1
+		lost := min(max(expected-r.received, 0), maxTotalLost)
+
+		expectedInterval := expected - r.expectedPrior
+		lostInterval := expectedInterval - (r.received - r.receivedPrior)
+		r.expectedPrior = expected
+		r.receivedPrior = r.received
+		if expectedInterval > 0 && lostInterval > 0 {
+			block.FractionLost = uint8(min(lostInterval*256/expectedInterval, 255)) //nolint:gosec
+		}
+
+		block.TotalLost = uint32(lost) //nolint:gosec
+		block.LastSequenceNumber = r.highestSeq
+		block.Jitter = uint32(r.jitter)
+	}
+	if r.lastSR != 0 {
+		block.LastSenderReport = r.lastSR
+		block.Delay = uint32(now.Sub(r.lastSRArrival).Seconds() * 65536)
+	}
+	return block
+}
@@ -0,0 +1,53 @@
+package sim
+
+import (
+	"testing"
+	"time"
+
+	"github.com/arsperger/slowcast/pkg/ratecontrol"
+)
+
+func TestReceiver_Report(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	r := &receiver{}
+
+	if block := r.report(start, 1); block.LastSequenceNumber != 0 || block.LastSenderReport != 0 {
+		t.Errorf("report() before any packet = %+v, want empty", block)
+	}
+
+	// 10 packets sent, 2 lost
+	for seq := uint32(100); seq < 110; seq++ {
+		if seq == 103 || seq == 107 {
+			continue
+		}
+		send := start.Add(time.Duration(seq) * time.Millisecond)
+		r.onPacket(seq, send, send.Add(30*time.Millisecond))
+	}
+	sr := ratecontrol.NTPMiddle32(start)
+	r.onSenderReport(sr, start.Add(200*time.Millisecond))
+
+	block := r.report(start.Add(450*time.Millisecond), 7)
+	if block.SSRC != 7 {
+		t.Errorf("SSRC = %d, want 7", block.SSRC)
+	}
+	if block.LastSequenceNumber != 109 {
+		t.Errorf("LastSequenceNumber = %d, want 109", block.LastSequenceNumber)
+	}
+	if block.TotalLost != 2 {
+		t.Errorf("TotalLost = %d, want 2", block.TotalLost)
+	}
+	if block.FractionLost != 2*256/10 {
+		t.Errorf("FractionLost = %d, want %d", block.FractionLost, 2*256/10)
+	}
+	if block.Jitter != 0 {
+		t.Errorf("Jitter = %d, want 0 for a constant transit time", block.Jitter)
+	}
+	if block.LastSenderReport != sr || block.Delay != 65536/4 {
+		t.Errorf("LSR/DLSR = %d/%d, want %d/%d", block.LastSenderReport, block.Delay, sr, 65536/4)
+	}
+
+	// nothing new since the previous report
+	if block = r.report(start.Add(time.Second), 7); block.FractionLost != 0 || block.TotalLost != 2 {
+		t.Errorf("second report FractionLost/TotalLost = %d/%d, want 0/2", block.FractionLost, block.TotalLost)
+	}
+}
@@ -0,0 +1,268 @@
+// Package sim replays a rate controller against a simulated bottleneck link.
+// Time is driven by a simulated clock so long scenarios run in a fraction of
+// their duration and are reproducible for a given seed.
+package sim
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/pion/rtcp"
+
+	"github.com/arsperger/slowcast/pkg/ratecontrol"
+)
+
+const (
+	defaultStep           = time.Millisecond
+	defaultPacketSize     = 1200
+	defaultReportInterval = time.Second
+	defaultSampleInterval = 100 * time.Millisecond
+
+	senderSSRC   = 0x51C0CA57
+	receiverSSRC = 0x0EC0EC0E
+)
+
+// ErrInvalidConfig is returned by Run for an unusable scenario
+var ErrInvalidConfig = errors.New("invalid simulation config")
+
+// Config describes a simulation scenario, zero intervals use the defaults
+type Config struct {
+	Duration time.Duration
+	Link     LinkConfig
+	// Seed makes random and bursty loss reproducible
+	Seed uint64
+	// Step is the simulation tick, 1ms by default
+	Step time.Duration
+	// PacketSize is the RTP packet size in bytes, 1200 by default
+	PacketSize int
+	// ReportInterval is the sender and receiver report interval, 1s by default
+	ReportInterval time.Duration
+	// SampleInterval is the time series resolution, 100ms by default
+	SampleInterval time.Duration
+}
+
+// Sample is one point of the simulated time series
+type Sample struct {
+	// Time is the offset from the start of the run
+	Time          time.Duration
+	CapacityKbps  int
+	BitrateKbps   int
+	DeliveredKbps int
+	QueueDelay    time.Duration
+	// RTT, SmoothedRTT and LossRate are the controller estimates
+	RTT         float64
+	SmoothedRTT float64
+	LossRate    float64
+}
+
+// Result is the outcome of a simulation run
+type Result struct {
+	Samples     []Sample
+	SentPackets int64
+	LostPackets int64
+}
+
+// MeanBitrate returns the average target bitrate over all samples in Kbps
+func (r *Result) MeanBitrate() float64 {
+	if len(r.Samples) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, s := range r.Samples {
+		sum += float64(s.BitrateKbps)
+	}
+	return sum / float64(len(r.Samples))
+}
+
+// WriteCSV writes the time series with a header row
+func (r *Result) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	header := []string{
+		"time_s", "capacity_kbps", "bitrate_kbps", "delivered_kbps",
+		"queue_delay_ms", "rtt_s", "srtt_s", "loss_rate",
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for _, s := range r.Samples {
+		record := []string{
+			strconv.FormatFloat(s.Time.Seconds(), 'f', 3, 64),
+			strconv.Itoa(s.CapacityKbps),
+			strconv.Itoa(s.BitrateKbps),
+			strconv.Itoa(s.DeliveredKbps),
+			strconv.FormatFloat(float64(s.QueueDelay.Microseconds())/1000, 'f', 3, 64),
+			strconv.FormatFloat(s.RTT, 'f', 4, 64),
+			strconv.FormatFloat(s.SmoothedRTT, 'f', 4, 64),
+			strconv.FormatFloat(s.LossRate, 'f', 4, 64),
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// withDefaults fills the zero intervals and validates the scenario
+func (cfg Config) withDefaults() (Config, error) {
+	if cfg.Step == 0 {
+		cfg.Step = defaultStep
+	}
+	if cfg.PacketSize == 0 {
+		cfg.PacketSize = defaultPacketSize
+	}
+	if cfg.ReportInterval == 0 {
+		cfg.ReportInterval = defaultReportInterval
+	}
+	if cfg.SampleInterval == 0 {
+		cfg.SampleInterval = defaultSampleInterval
+	}
+	switch {
+	case cfg.Duration <= 0:
+		return cfg, fmt.Errorf("%w: duration %v", ErrInvalidConfig, cfg.Duration)
+	case cfg.Step < 0 || cfg.ReportInterval < cfg.Step || cfg.SampleInterval < cfg.Step:
+		return cfg, fmt.Errorf("%w: step %v must not exceed the report and sample intervals", ErrInvalidConfig, cfg.Step)
+	case cfg.PacketSize <= 0:
+		return cfg, fmt.Errorf("%w: packet size %d", ErrInvalidConfig, cfg.PacketSize)
+	case cfg.Link.CapacityKbps <= 0:
+		return cfg, fmt.Errorf("%w: link capacity %d Kbps", ErrInvalidConfig, cfg.Link.CapacityKbps)
+	}
+	for _, change := range cfg.Link.CapacityChanges {
+		if change.CapacityKbps <= 0 {
+			return cfg, fmt.Errorf("%w: link capacity %d Kbps at %v", ErrInvalidConfig, change.CapacityKbps, change.At)
+		}
+	}
+	return cfg, nil
+}
+
+// pendingRTCP is a report travelling to the sender or the receiver
+type pendingRTCP struct {
+	arrival time.Time
+	ntp     uint32
+	report  *rtcp.ReceiverReport
+}
+
+// Run drives the controller built by factory with receiver reports synthesized from
+// the simulated link. limits.Clock is replaced by the simulated clock. Only receiver
+// reports are fed back, so controllers relying on TWCC or RFC 8888 feedback run on
+// their receiver report fallback.
+func Run(cfg Config, factory ratecontrol.Factory, limits ratecontrol.Config) (*Result, error) {
+	cfg, err := cfg.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewClock(start)
+	limits.Clock = clock
+	controller, err := factory(limits)
+	if err != nil {
+		return nil, err
+	}
+
+	link := newLink(cfg.Link, cfg.Seed)
+	rx := &receiver{}
+	meter := ratecontrol.NewSendMeter(ratecontrol.DefaultSendWindow)
+	statsConsumer, consumeStats := controller.(ratecontrol.SendStatsConsumer)
+	result := &Result{}
+
+	var (
+		toReceiver     []pendingRTCP
+		toSender       []pendingRTCP
+		changes        = cfg.Link.CapacityChanges
+		bitrate        = limits.InitBitrate
+		credit         float64
+		seq            uint32
+		deliveredBytes int
+		// sender reports are offset by half an interval so DLSR is not zero
+		nextSR     = start.Add(cfg.ReportInterval / 2)
+		nextRR     = start.Add(cfg.ReportInterval)
+		nextSample = start.Add(cfg.SampleInterval)
+		end        = start.Add(cfg.Duration)
+	)
+
+	for clock.Now().Before(end) {
+		clock.Advance(cfg.Step)
+		now := clock.Now()
+		elapsed := now.Sub(start)
+
+		for len(changes) > 0 && changes[0].At <= elapsed {
+			link.setCapacity(changes[0].CapacityKbps)
+			changes = changes[1:]
+		}
+
+		// paced media at the current target
+		credit += float64(bitrate) * 1000 / 8 * cfg.Step.Seconds()
+		for credit >= float64(cfg.PacketSize) {
+			credit -= float64(cfg.PacketSize)
+			meter.OnPacketSent(ratecontrol.SentPacket{
+				SendTime:       now,
+				SSRC:           senderSSRC,
+				SequenceNumber: uint16(seq), //nolint:gosec // RTP sequence numbers wrap
+				Size:           cfg.PacketSize,
+			})
+			if !link.send(now, seq, cfg.PacketSize) {
+				result.LostPackets++
+			}
+			result.SentPackets++
+			seq++
+		}
+
+		for _, pkt := range link.deliver(now) {
+			rx.onPacket(pkt.seq, pkt.sendTime, pkt.arrival)
+			deliveredBytes += pkt.size
+		}
+
+		if !now.Before(nextSR) {
+			toReceiver = append(toReceiver, pendingRTCP{
+				arrival: now.Add(link.queueDelay(now) + cfg.Link.PropagationDelay),
+				ntp:     ratecontrol.NTPMiddle32(now),
+			})
+			nextSR = nextSR.Add(cfg.ReportInterval)
+		}
+		for len(toReceiver) > 0 && !toReceiver[0].arrival.After(now) {
+			rx.onSenderReport(toReceiver[0].ntp, toReceiver[0].arrival)
+			toReceiver = toReceiver[1:]
+		}
+
+		if !now.Before(nextRR) {
+			toSender = append(toSender, pendingRTCP{
+				arrival: now.Add(cfg.Link.PropagationDelay),
+				report: &rtcp.ReceiverReport{
+					SSRC:    receiverSSRC,
+					Reports: []rtcp.ReceptionReport{rx.report(now, senderSSRC)},
+				},
+			})
+			nextRR = nextRR.Add(cfg.ReportInterval)
+		}
+		for len(toSender) > 0 && !toSender[0].arrival.After(now) {
+			controller.OnRTCP(now, toSender[0].report)
+			if consumeStats {
+				statsConsumer.OnSendStats(now, meter.Stats(now))
+			}
+			bitrate = controller.TargetBitrate()
+			toSender = toSender[1:]
+		}
+
+		if !now.Before(nextSample) {
+			state := controller.State()
+			result.Samples = append(result.Samples, Sample{
+				Time:          elapsed,
+				CapacityKbps:  link.capacityKbps,
+				BitrateKbps:   bitrate,
+				DeliveredKbps: int(float64(deliveredBytes*8) / 1000 / cfg.SampleInterval.Seconds()),
+				QueueDelay:    link.queueDelay(now),
+				RTT:           state.RTTSample,
+				SmoothedRTT:   state.SmoothedRTT,
+				LossRate:      state.LossRate,
+			})
+			deliveredBytes = 0
+			nextSample = nextSample.Add(cfg.SampleInterval)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,259 @@
+package sim
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arsperger/slowcast/pkg/ratecontrol"
+	"github.com/arsperger/slowcast/pkg/tfrc"
+)
+
+func tfrcLimits() ratecontrol.Config {
+	return ratecontrol.Config{InitBitrate: 1000, MinBitrate: 500, MaxBitrate: 6000}
+}
+
+func TestRun_InvalidConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+	}{
+		{"no duration", Config{Link: LinkConfig{CapacityKbps: 1000}}},
+		{"no capacity", Config{Duration: time.Second}},
+		{"bad change", Config{
+			Duration: time.Second,
+			Link:     LinkConfig{CapacityKbps: 1000, CapacityChanges: []CapacityChange{{At: time.Second}}},
+		}},
+		{"step too large", Config{Duration: time.Second, Step: 2 * time.Second, Link: LinkConfig{CapacityKbps: 1000}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Run(tt.cfg, tfrc.NewController, tfrcLimits()); !errors.Is(err, ErrInvalidConfig) {
+				t.Errorf("Run() error = %v, want ErrInvalidConfig", err)
+			}
+		})
+	}
+}
+
+func TestRun_Deterministic(t *testing.T) {
+	cfg := Config{
+		Duration: 2 * time.Minute,
+		Seed:     7,
+		Link: LinkConfig{
+			CapacityKbps:     3000,
+			QueueBytes:       60000,
+			PropagationDelay: 30 * time.Millisecond,
+			LossRate:         0.01,
+			Burst:            GilbertElliott{PGoodToBad: 0.01, PBadToGood: 0.3, LossInBad: 0.5},
+		},
+	}
+	first, err := Run(cfg, tfrc.NewController, tfrcLimits())
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	second, err := Run(cfg, tfrc.NewController, tfrcLimits())
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if len(first.Samples) != int(cfg.Duration/defaultSampleInterval) {
+		t.Errorf("got %d samples, want %d", len(first.Samples), cfg.Duration/defaultSampleInterval)
+	}
+	if first.SentPackets != second.SentPackets || first.LostPackets != second.LostPackets {
+		t.Fatalf("runs differ: sent %d/%d lost %d/%d",
+			first.SentPackets, second.SentPackets, first.LostPackets, second.LostPackets)
+	}
+	for i := range first.Samples {
+		if first.Samples[i] != second.Samples[i] {
+			t.Fatalf("sample %d differs: %+v vs %+v", i, first.Samples[i], second.Samples[i])
+		}
+	}
+	if first.LostPackets == 0 {
+		t.Error("expected losses on a lossy link")
+	}
+}
+
+func TestRun_TfrcScenarios(t *testing.T) {
+	tests := []struct {
+		name    string
+		link    LinkConfig
+		minMean float64
+		maxMean float64
+		minRTT  float64
+		maxRTT  float64
+	}{
+		{
+			name:    "clean fat link reaches max",
+			link:    LinkConfig{CapacityKbps: 20000, PropagationDelay: 25 * time.Millisecond},
+			minMean: 5000,
+			maxMean: 6000,
+			minRTT:  0.045,
+			maxRTT:  0.06,
+		},
+		{
+			name: "lossy link backs off",
+			link: LinkConfig{
+				CapacityKbps:     20000,
+				PropagationDelay: 50 * time.Millisecond,
+				LossRate:         0.05,
+			},
+			minMean: 500,
+			maxMean: 3000,
+			minRTT:  0.095,
+			maxRTT:  0.12,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := Run(Config{Duration: 5 * time.Minute, Seed: 1, Link: tt.link}, tfrc.NewController, tfrcLimits())
+			if err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			// skip the ramp up
+			tail := &Result{Samples: res.Samples[len(res.Samples)/2:]}
+			if mean := tail.MeanBitrate(); mean < tt.minMean || mean > tt.maxMean {
+				t.Errorf("mean bitrate = %.0f Kbps, want [%.0f, %.0f]", mean, tt.minMean, tt.maxMean)
+			}
+			last := res.Samples[len(res.Samples)-1]
+			if last.RTT < tt.minRTT || last.RTT > tt.maxRTT {
+				t.Errorf("RTT = %.3fs, want [%.3f, %.3f]", last.RTT, tt.minRTT, tt.maxRTT)
+			}
+		})
+	}
+}
+
+func TestRun_CapacityDropFillsQueue(t *testing.T) {
+	cfg := Config{
+		Duration: time.Minute,
+		Link: LinkConfig{
+			CapacityKbps:     8000,
+			QueueBytes:       100000,
+			PropagationDelay: 20 * time.Millisecond,
+			CapacityChanges:  []CapacityChange{{At: 30 * time.Second, CapacityKbps: 1000}},
+		},
+	}
+	res, err := Run(cfg, tfrc.NewController, tfrcLimits())
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	var maxQueue time.Duration
+	for _, s := range res.Samples {
+		if s.Time > 31*time.Second {
+			if s.CapacityKbps != 1000 {
+				t.Fatalf("capacity at %v = %d, want 1000", s.Time, s.CapacityKbps)
+			}
+			maxQueue = max(maxQueue, s.QueueDelay)
+			if s.DeliveredKbps > 1100 {
+				t.Errorf("delivered %d Kbps above the 1000 Kbps bottleneck at %v", s.DeliveredKbps, s.Time)
+			}
+		}
+	}
+	if maxQueue < 100*time.Millisecond {
+		t.Errorf("max queue delay = %v, expected the bottleneck queue to build", maxQueue)
+	}
+	if res.LostPackets == 0 {
+		t.Error("expected tail drops once the queue is full")
+	}
+}
+
+// TestRun_LongScenario runs a few simulated minutes, SIM_SOAK=1 runs the 100 minute soak
+func TestRun_LongScenario(t *testing.T) {
+	if testing.Short() {
+		t.Skip("long scenario")
+	}
+	duration := 5 * time.Minute
+	if os.Getenv("SIM_SOAK") != "" {
+		duration = 100 * time.Minute
+	}
+	start := time.Now()
+	_, err := Run(Config{
+		Duration: duration,
+		Seed:     3,
+		Link:     LinkConfig{CapacityKbps: 4000, QueueBytes: 80000, PropagationDelay: 40 * time.Millisecond, LossRate: 0.001},
+	}, tfrc.NewController, tfrcLimits())
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	t.Logf("%v simulated in %v", duration, time.Since(start))
+}
+
+func TestResult_WriteCSV(t *testing.T) {
+	res := &Result{Samples: []Sample{{
+		Time:          1500 * time.Millisecond,
+		CapacityKbps:  2000,
+		BitrateKbps:   1200,
+		DeliveredKbps: 1190,
+		QueueDelay:    12500 * time.Microsecond,
+		RTT:           0.08,
+		SmoothedRTT:   0.075,
+		LossRate:      0.01,
+	}}}
+	var buf bytes.Buffer
+	if err := res.WriteCSV(&buf); err != nil {
+		t.Fatalf("WriteCSV() error = %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2", len(lines))
+	}
+	want := "1.500,2000,1200,1190,12.500,0.0800,0.0750,0.0100"
+	if lines[1] != want {
+		t.Errorf("row = %q, want %q", lines[1], want)
+	}
+}
+
+func TestRun_DeepBufferBacksOffOnDelay(t *testing.T) {
+	cfg := Config{
+		Duration: 5 * time.Minute,
+		Link: LinkConfig{
+			CapacityKbps: 3000,
+			// deep enough that the queue never overflows into loss
+			QueueBytes:       4000000,
+			PropagationDelay: 25 * time.Millisecond,
+		},
+	}
+	res, err := Run(cfg, tfrc.NewController, tfrcLimits())
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if res.LostPackets != 0 {
+		t.Fatalf("lost %d packets, want a lossless bufferbloat run", res.LostPackets)
+	}
+	tail := &Result{Samples: res.Samples[len(res.Samples)/2:]}
+	if mean := tail.MeanBitrate(); mean > 3300 {
+		t.Errorf("mean bitrate = %.0f Kbps, want the delay trend to keep it near the 3000 Kbps bottleneck", mean)
+	}
+	var maxQueue time.Duration
+	for _, s := range tail.Samples {
+		maxQueue = max(maxQueue, s.QueueDelay)
+	}
+	if maxQueue > time.Second {
+		t.Errorf("max queue delay = %v, want the standing queue bounded", maxQueue)
+	}
+}
+
+func TestRun_MeasuredPacketSize(t *testing.T) {
+	var controller *tfrc.Tfrc
+	factory := func(cfg ratecontrol.Config) (ratecontrol.RateController, error) {
+		rc, err := tfrc.NewController(cfg)
+		if err != nil {
+			return nil, err
+		}
+		controller, _ = rc.(*tfrc.Tfrc)
+		return rc, nil
+	}
+	cfg := Config{
+		Duration:   10 * time.Second,
+		PacketSize: 400,
+		Link:       LinkConfig{CapacityKbps: 4000, PropagationDelay: 20 * time.Millisecond},
+	}
+	if _, err := Run(cfg, factory, tfrcLimits()); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if got := controller.GetAvgPacketSize(); got != 400 {
+		t.Errorf("GetAvgPacketSize() = %v, want the simulated 400 byte packets", got)
+	}
+}
@@ -0,0 +1,57 @@
+package source
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrUnknownKind is returned by ParseKind for an unsupported source name
+var ErrUnknownKind = errors.New("unknown video source")
+
+// Kind is the type of video input
+type Kind int
+
+const (
+	// KindV4L2 captures a V4L2 camera
+	KindV4L2 Kind = iota
+	// KindTest generates a videotestsrc pattern
+	KindTest
+	// KindFile decodes a local file
+	KindFile
+	// KindRTSP pulls a stream from an RTSP server such as an IP camera
+	KindRTSP
+	// KindRTP receives an RTP stream on a UDP port
+	KindRTP
+	// KindSRT receives an MPEG-TS stream over SRT
+	KindSRT
+)
+
+// String returns the configuration name of the kind
+func (k Kind) String() string {
+	switch k {
+	case KindV4L2:
+		return "v4l2"
+	case KindTest:
+		return "test"
+	case KindFile:
+		return "file"
+	case KindRTSP:
+		return "rtsp"
+	case KindRTP:
+		return "rtp"
+	case KindSRT:
+		return "srt"
+	default:
+		return fmt.Sprintf("source(%d)", int(k))
+	}
+}
+
+// ParseKind parses v4l2, test, file, rtsp, rtp or srt
+func ParseKind(s string) (Kind, error) {
+	for _, k := range []Kind{KindV4L2, KindTest, KindFile, KindRTSP, KindRTP, KindSRT} {
+		if k.String() == s {
+			return k, nil
+		}
+	}
+	return KindV4L2, fmt.Errorf("%w: %q", ErrUnknownKind, s)
+}
@@ -0,0 +1,43 @@
+package source
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseKind(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Kind
+		wantErr bool
+	}{
+		{"v4l2", KindV4L2, false},
+		{"test", KindTest, false},
+		{"file", KindFile, false},
+		{"rtsp", KindRTSP, false},
+		{"rtp", KindRTP, false},
+		{"srt", KindSRT, false},
+		{"webcam", KindV4L2, true},
+		{"", KindV4L2, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseKind(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseKind() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrUnknownKind) {
+				t.Errorf("ParseKind() error = %v, want ErrUnknownKind", err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseKind() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKind_String(t *testing.T) {
+	if got := Kind(9).String(); got != "source(9)" {
+		t.Errorf("String() = %q, want source(9)", got)
+	}
+}
@@ -0,0 +1,178 @@
+// Package source describes the video inputs slowcast encodes as gst-launch bin descriptions:
+// a V4L2 camera, a test pattern, a looping local file, or RTSP, RTP and SRT network ingest.
+// Every source ends in raw video, with caps listing the preferred format first and a wider
+// fallback after it, so a camera or stream that can't match the preference still negotiates.
+package source
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ErrInvalidConfig is returned by New for unusable parameters
+var ErrInvalidConfig = errors.New("invalid source config")
+
+// Patterns are the videotestsrc pattern names
+var Patterns = []string{
+	"smpte", "snow", "black", "white", "red", "green", "blue", "checkers-1", "checkers-2",
+	"checkers-4", "checkers-8", "circular", "blink", "smpte75", "zone-plate", "gamut",
+	"chroma-zone-plate", "solid-color", "ball", "smpte100", "bar", "pinwheel", "spokes",
+	"gradient", "colors", "smpte-rp-219",
+}
+
+// encodingName matches an RTP encoding name such as H264 or VP8
+var encodingName = regexp.MustCompile(`^[A-Za-z0-9-]+$`)
+
+// Config selects the source and its parameters, each kind only reads its own fields
+type Config struct {
+	Kind Kind
+	// Device is the V4L2 device node
+	Device string
+	// Pattern is the videotestsrc pattern
+	Pattern string
+	// Location is the file path, or the rtsp:// or srt:// URI
+	Location string
+	// Loop restarts a file at its end
+	Loop bool
+	// Port and Encoding are the UDP port and the RTP encoding name of the RTP ingest
+	Port     int
+	Encoding string
+	// Latency is the jitter buffer of the network sources
+	Latency time.Duration
+	// Width, Height and FPS are the preferred capture format of the camera and the test pattern
+	Width  int
+	Height int
+	FPS    int
+	// Caps replaces the preferred capture format when set
+	Caps string
+}
+
+// DefaultConfig captures /dev/video0 at 640x480@30
+func DefaultConfig() Config {
+	return Config{
+		Kind:     KindV4L2,
+		Device:   "/dev/video0",
+		Pattern:  "smpte",
+		Loop:     true,
+		Port:     5004,
+		Encoding: "H264",
+		Latency:  200 * time.Millisecond,
+		Width:    640,
+		Height:   480,
+		FPS:      30,
+	}
+}
+
+// Source is a validated source configuration
+type Source struct {
+	cfg Config
+}
+
+// New validates the parameters the kind of cfg uses
+//
+//nolint:cyclop
+func New(cfg Config) (*Source, error) {
+	switch {
+	case cfg.Caps == "" && (cfg.Width <= 0 || cfg.Height <= 0 || cfg.FPS <= 0):
+		return nil, fmt.Errorf("%w: capture format %dx%d@%d", ErrInvalidConfig, cfg.Width, cfg.Height, cfg.FPS)
+	case cfg.Latency < 0:
+		return nil, fmt.Errorf("%w: latency %v", ErrInvalidConfig, cfg.Latency)
+	}
+	switch cfg.Kind {
+	case KindV4L2:
+		if cfg.Device == "" {
+			return nil, fmt.Errorf("%w: no v4l2 device", ErrInvalidConfig)
+		}
+	case KindTest:
+		if !slices.Contains(Patterns, cfg.Pattern) {
+			return nil, fmt.Errorf("%w: unknown test pattern %q", ErrInvalidConfig, cfg.Pattern)
+		}
+	case KindFile:
+		if cfg.Location == "" {
+			return nil, fmt.Errorf("%w: no file location", ErrInvalidConfig)
+		}
+	case KindRTSP, KindSRT:
+		// rtsps and rtspt are RTSP too
+		scheme, _, ok := strings.Cut(cfg.Location, "://")
+		if !ok || !strings.HasPrefix(scheme, cfg.Kind.String()) {
+			return nil, fmt.Errorf("%w: %q is not an %s URI", ErrInvalidConfig, cfg.Location, cfg.Kind)
+		}
+	case KindRTP:
+		if cfg.Port <= 0 || cfg.Port > 65535 {
+			return nil, fmt.Errorf("%w: rtp port %d", ErrInvalidConfig, cfg.Port)
+		}
+		if !encodingName.MatchString(cfg.Encoding) {
+			return nil, fmt.Errorf("%w: rtp encoding name %q", ErrInvalidConfig, cfg.Encoding)
+		}
+	default:
+		return nil, fmt.Errorf("%w: %v", ErrInvalidConfig, cfg.Kind)
+	}
+	return &Source{cfg: cfg}, nil
+}
+
+// Config returns the configuration of the source
+func (s *Source) Config() Config {
+	return s.cfg
+}
+
+// Live reports whether the source produces frames in real time, a file has to be paced to the clock
+func (s *Source) Live() bool {
+	return s.cfg.Kind != KindFile
+}
+
+// Loops reports whether the source restarts at its end
+func (s *Source) Loops() bool {
+	return s.cfg.Kind == KindFile && s.cfg.Loop
+}
+
+// Caps returns the capture caps of the camera and the test pattern, the preferred format first
+// and then any raw video, and for the camera MJPEG, decoded by the bin
+func (s *Source) Caps() string {
+	preferred := s.cfg.Caps
+	if preferred == "" {
+		preferred = fmt.Sprintf("video/x-raw,width=%d,height=%d,framerate=%d/1", s.cfg.Width, s.cfg.Height, s.cfg.FPS)
+	}
+	alternatives := []string{preferred, "video/x-raw"}
+	if s.cfg.Kind == KindV4L2 {
+		alternatives = append(alternatives, "image/jpeg")
+	}
+	return strings.Join(alternatives, ";")
+}
+
+// Description returns the gst-launch description of a bin whose only unlinked pad is its raw video
+// output. decodebin picks the decoders of files and streams, parsing links its dynamic pads
+func (s *Source) Description() string {
+	latency := s.cfg.Latency.Milliseconds()
+	switch s.cfg.Kind {
+	case KindV4L2:
+		return fmt.Sprintf("v4l2src device=%s ! capsfilter caps=%s ! decodebin ! video/x-raw ! videoconvert",
+			quote(s.cfg.Device), quote(s.Caps()))
+	case KindTest:
+		return fmt.Sprintf("videotestsrc is-live=true pattern=%s ! capsfilter caps=%s ! videoconvert",
+			s.cfg.Pattern, quote(s.Caps()))
+	case KindFile:
+		return fmt.Sprintf("filesrc location=%s ! decodebin ! video/x-raw ! videoconvert", quote(s.cfg.Location))
+	case KindRTSP:
+		return fmt.Sprintf("rtspsrc location=%s latency=%d ! application/x-rtp,media=video ! "+
+			"decodebin ! video/x-raw ! videoconvert", quote(s.cfg.Location), latency)
+	case KindRTP:
+		caps := fmt.Sprintf("application/x-rtp,media=video,clock-rate=90000,encoding-name=%s",
+			strings.ToUpper(s.cfg.Encoding))
+		return fmt.Sprintf("udpsrc port=%d caps=%s ! rtpjitterbuffer latency=%d ! "+
+			"decodebin ! video/x-raw ! videoconvert", s.cfg.Port, quote(caps), latency)
+	case KindSRT:
+		return fmt.Sprintf("srtsrc uri=%s latency=%d ! decodebin ! video/x-raw ! videoconvert",
+			quote(s.cfg.Location), latency)
+	default:
+		return ""
+	}
+}
+
+// quote returns s as a gst-launch double quoted string
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -0,0 +1,162 @@
+package source
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(c *Config)
+		wantErr bool
+	}{
+		{"defaults", func(*Config) {}, false},
+		{"no device", func(c *Config) { c.Device = "" }, true},
+		{"zero fps", func(c *Config) { c.FPS = 0 }, true},
+		{"zero fps with caps", func(c *Config) { c.FPS, c.Caps = 0, "video/x-raw,format=YUY2" }, false},
+		{"negative latency", func(c *Config) { c.Latency = -1 }, true},
+		{"test pattern", func(c *Config) { c.Kind, c.Pattern = KindTest, "ball" }, false},
+		{"unknown test pattern", func(c *Config) { c.Kind, c.Pattern = KindTest, "stripes" }, true},
+		{"file", func(c *Config) { c.Kind, c.Location = KindFile, "clip.mp4" }, false},
+		{"file without location", func(c *Config) { c.Kind = KindFile }, true},
+		{"rtsp", func(c *Config) { c.Kind, c.Location = KindRTSP, "rtsp://camera/stream" }, false},
+		{"rtsps", func(c *Config) { c.Kind, c.Location = KindRTSP, "rtsps://camera/stream" }, false},
+		{"rtsp with srt uri", func(c *Config) { c.Kind, c.Location = KindRTSP, "srt://camera:9000" }, true},
+		{"srt", func(c *Config) { c.Kind, c.Location = KindSRT, "srt://:9000?mode=listener" }, false},
+		{"srt with path", func(c *Config) { c.Kind, c.Location = KindSRT, "/tmp/clip.ts" }, true},
+		{"rtp", func(c *Config) { c.Kind = KindRTP }, false},
+		{"rtp port out of range", func(c *Config) { c.Kind, c.Port = KindRTP, 70000 }, true},
+		{"rtp bad encoding", func(c *Config) { c.Kind, c.Encoding = KindRTP, "H264,payload=96" }, true},
+		{"unknown kind", func(c *Config) { c.Kind = Kind(9) }, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			tt.modify(&cfg)
+			_, err := New(cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !errors.Is(err, ErrInvalidConfig) {
+				t.Errorf("error %v does not wrap ErrInvalidConfig", err)
+			}
+		})
+	}
+}
+
+func TestSource_Caps(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(c *Config)
+		want   string
+	}{
+		{
+			name:   "camera falls back to any raw video and MJPEG",
+			modify: func(*Config) {},
+			want:   "video/x-raw,width=640,height=480,framerate=30/1;video/x-raw;image/jpeg",
+		},
+		{
+			name:   "test pattern falls back to any raw video",
+			modify: func(c *Config) { c.Kind, c.Width, c.Height = KindTest, 1280, 720 },
+			want:   "video/x-raw,width=1280,height=720,framerate=30/1;video/x-raw",
+		},
+		{
+			name:   "caps replace the preferred format",
+			modify: func(c *Config) { c.Caps = "video/x-raw,format=YUY2,width=800,height=600" },
+			want:   "video/x-raw,format=YUY2,width=800,height=600;video/x-raw;image/jpeg",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			tt.modify(&cfg)
+			s, err := New(cfg)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			if got := s.Caps(); got != tt.want {
+				t.Errorf("Caps() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSource_Description(t *testing.T) {
+	tests := []struct {
+		name      string
+		modify    func(c *Config)
+		want      string
+		wantLive  bool
+		wantLoops bool
+	}{
+		{
+			name:   "v4l2",
+			modify: func(*Config) {},
+			want: `v4l2src device="/dev/video0" ` +
+				`! capsfilter caps="video/x-raw,width=640,height=480,framerate=30/1;video/x-raw;image/jpeg" ` +
+				`! decodebin ! video/x-raw ! videoconvert`,
+			wantLive: true,
+		},
+		{
+			name:   "test",
+			modify: func(c *Config) { c.Kind, c.Pattern = KindTest, "ball" },
+			want: `videotestsrc is-live=true pattern=ball ` +
+				`! capsfilter caps="video/x-raw,width=640,height=480,framerate=30/1;video/x-raw" ! videoconvert`,
+			wantLive: true,
+		},
+		{
+			name:      "file with quotes",
+			modify:    func(c *Config) { c.Kind, c.Location = KindFile, `/clips/"test" clip.mp4` },
+			want:      `filesrc location="/clips/\"test\" clip.mp4" ! decodebin ! video/x-raw ! videoconvert`,
+			wantLoops: true,
+		},
+		{
+			name:   "file without loop",
+			modify: func(c *Config) { c.Kind, c.Location, c.Loop = KindFile, "clip.mp4", false },
+			want:   `filesrc location="clip.mp4" ! decodebin ! video/x-raw ! videoconvert`,
+		},
+		{
+			name:   "rtsp",
+			modify: func(c *Config) { c.Kind, c.Location = KindRTSP, "rtsp://camera/stream" },
+			want: `rtspsrc location="rtsp://camera/stream" latency=200 ! application/x-rtp,media=video ` +
+				`! decodebin ! video/x-raw ! videoconvert`,
+			wantLive: true,
+		},
+		{
+			name:   "rtp",
+			modify: func(c *Config) { c.Kind, c.Encoding = KindRTP, "vp8" },
+			want: `udpsrc port=5004 caps="application/x-rtp,media=video,clock-rate=90000,encoding-name=VP8" ` +
+				`! rtpjitterbuffer latency=200 ! decodebin ! video/x-raw ! videoconvert`,
+			wantLive: true,
+		},
+		{
+			name:     "srt",
+			modify:   func(c *Config) { c.Kind, c.Location = KindSRT, "srt://:9000?mode=listener" },
+			want:     `srtsrc uri="srt://:9000?mode=listener" latency=200 ! decodebin ! video/x-raw ! videoconvert`,
+			wantLive: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			tt.modify(&cfg)
+			s, err := New(cfg)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			if got := s.Description(); got != tt.want {
+				t.Errorf("Description() = %q, want %q", got, tt.want)
+			}
+			if got := s.Live(); got != tt.wantLive {
+				t.Errorf("Live() = %v, want %v", got, tt.wantLive)
+			}
+			if got := s.Loops(); got != tt.wantLoops {
+				t.Errorf("Loops() = %v, want %v", got, tt.wantLoops)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+// Package statestore persists rate controller state in small versioned JSON files,
+// one per destination, so a restarted sender can resume from its last estimates.
+package statestore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Version is the version of the state file layout
+const Version = 1
+
+var (
+	// ErrNotFound is returned by Load when no state was saved for the key
+	ErrNotFound = errors.New("no saved controller state")
+	// ErrStale is returned by Load when the saved state is older than the max age
+	ErrStale = errors.New("saved controller state is too old")
+	// ErrMismatch is returned by Load for a file of another layout version or controller
+	ErrMismatch = errors.New("saved controller state does not match")
+)
+
+// file is the on-disk layout
+type file struct {
+	Version    int             `json:"version"`
+	Key        string          `json:"key"`
+	Controller string          `json:"controller"`
+	SavedAt    time.Time       `json:"saved_at"`
+	State      json.RawMessage `json:"state"`
+}
+
+// Store keeps one state file per key in a directory
+type Store struct {
+	dir string
+}
+
+// New creates a store in dir, the directory is created on the first save
+func New(dir string) *Store {
+	return &Store{dir: dir}
+}
+
+// path maps a destination key like host:port to a file name
+func (s *Store) path(key string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-':
+			return r
+		default:
+			return '_'
+		}
+	}, key)
+	return filepath.Join(s.dir, "slowcast-"+name+".json")
+}
+
+// Save writes the encoded state of controller for key, replacing the previous file atomically
+func (s *Store) Save(key, controller string, now time.Time, state []byte) error {
+	data, err := json.Marshal(file{
+		Version:    Version,
+		Key:        key,
+		Controller: controller,
+		SavedAt:    now.UTC(),
+		State:      state,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode state file: %w", err)
+	}
+	if err := os.MkdirAll(s.dir, 0o750); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(s.dir, ".slowcast-state-*")
+	if err != nil {
+		return fmt.Errorf("failed to create state file: %w", err)
+	}
+	defer func() {
+		// no-op once renamed
+		_ = os.Remove(tmp.Name())
+	}()
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path(key)); err != nil {
+		return fmt.Errorf("failed to replace state file: %w", err)
+	}
+	return nil
+}
+
+// Load returns the encoded state of controller saved for key no longer than maxAge before now
+func (s *Store) Load(key, controller string, now time.Time, maxAge time.Duration) ([]byte, error) {
+	data, err := os.ReadFile(s.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w for %s", ErrNotFound, key)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state file: %w", err)
+	}
+
+	var f file
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("failed to decode state file: %w", err)
+	}
+	switch {
+	case f.Version != Version:
+		return nil, fmt.Errorf("%w: version %d, want %d", ErrMismatch, f.Version, Version)
+	case f.Key != key:
+		return nil, fmt.Errorf("%w: key %s, want %s", ErrMismatch, f.Key, key)
+	case f.Controller != controller:
+		return nil, fmt.Errorf("%w: controller %s, want %s", ErrMismatch, f.Controller, controller)
+	}
+	if age := now.Sub(f.SavedAt); age > maxAge || age < 0 {
+		return nil, fmt.Errorf("%w: saved %v ago", ErrStale, age.Round(time.Second))
+	}
+	return f.State, nil
+}
@@ -0,0 +1,82 @@
+package statestore
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStore_SaveLoad(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	state := []byte(`{"current_bitrate":2500}`)
+
+	tests := []struct {
+		name       string
+		key        string
+		controller string
+		at         time.Time
+		wantErr    error
+	}{
+		{"recent", "10.0.0.1:6000", "tfrc", now.Add(time.Minute), nil},
+		{"stale", "10.0.0.1:6000", "tfrc", now.Add(time.Hour), ErrStale},
+		{"saved in the future", "10.0.0.1:6000", "tfrc", now.Add(-time.Minute), ErrStale},
+		{"other destination", "10.0.0.2:6000", "tfrc", now, ErrNotFound},
+		{"other controller", "10.0.0.1:6000", "gcc", now, ErrMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New(filepath.Join(t.TempDir(), "state"))
+			if err := s.Save("10.0.0.1:6000", "tfrc", now, state); err != nil {
+				t.Fatalf("Save() error = %v", err)
+			}
+			got, err := s.Load(tt.key, tt.controller, tt.at, 10*time.Minute)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Load() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && string(got) != string(state) {
+				t.Errorf("Load() = %s, want %s", got, state)
+			}
+		})
+	}
+}
+
+func TestStore_versionMismatch(t *testing.T) {
+	dir := t.TempDir()
+	s := New(dir)
+	data := []byte(`{"version":99,"key":"h:1","controller":"tfrc","saved_at":"2025-01-01T00:00:00Z","state":{}}`)
+	if err := os.WriteFile(s.path("h:1"), data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Load("h:1", "tfrc", time.Date(2025, 1, 1, 0, 0, 1, 0, time.UTC), time.Minute); !errors.Is(err, ErrMismatch) {
+		t.Errorf("Load() error = %v, want ErrMismatch", err)
+	}
+}
+
+func TestStore_overwrite(t *testing.T) {
+	dir := t.TempDir()
+	s := New(dir)
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, state := range []string{`{"a":1}`, `{"a":2}`} {
+		if err := s.Save("[::1]:6000", "tfrc", now, []byte(state)); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+	}
+	got, err := s.Load("[::1]:6000", "tfrc", now, time.Minute)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if string(got) != `{"a":2}` {
+		t.Errorf("Load() = %s, want the last save", got)
+	}
+
+	// only the state file is left behind
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "slowcast-___1__6000.json" {
+		t.Errorf("directory holds %v", entries)
+	}
+}
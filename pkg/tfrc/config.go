@@ -0,0 +1,131 @@
+package tfrc
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/arsperger/slowcast/pkg/ratecontrol"
+)
+
+const (
+	defaultAlpha      = 0.2
+	defaultPacketSize = 1200.0
+
+	// RTT history trend thresholds, ±20% of the older half average
+	defaultTrendIncrease = 1.2
+	defaultTrendDecrease = 0.8
+
+	// defaultMinFloor is the lowest bitrate in Kbps accepted by the default config
+	defaultMinFloor = 500
+)
+
+// ErrInvalidConfig is returned by NewWithConfig for unusable parameters
+var ErrInvalidConfig = errors.New("invalid TFRC config")
+
+// Config holds the bitrate limits in Kbps and the tuning of a TFRC controller
+type Config struct {
+	InitBitrate int
+	MinBitrate  int
+	MaxBitrate  int
+
+	// Alpha is the smoothing factor of the RTT and of the rate toward its target, in (0, 1]
+	Alpha float64
+	// PacketSize is the packet size in bytes of the throughput equation until packets are measured
+	PacketSize float64
+	// LossReports is the size of the RFC8083 loss event window
+	LossReports int
+	// RTTReports is the number of smoothed RTTs kept for the trend
+	RTTReports int
+	// TrendIncrease and TrendDecrease are the ratios of the newer to the older half of the
+	// RTT history above and below which the RTT counts as increasing or decreasing
+	TrendIncrease float64
+	TrendDecrease float64
+	// MinFloor is the lowest bitrate in Kbps any limit may be set to
+	MinFloor int
+
+	// REMBPolicy decides how REMB receiver estimates limit the rate
+	REMBPolicy REMBPolicy
+	// REMBBlendWeight is the share of the way to the REMB covered per update by REMBBlend, in (0, 1]
+	REMBBlendWeight float64
+	// REMBTimeout is how long a REMB is honored without being renewed
+	REMBTimeout time.Duration
+
+	// SenderReports matches the LSR of receiver reports against the sent sender reports,
+	// nil falls back to the LSR arithmetic
+	SenderReports *ratecontrol.SenderReportHistory
+	// ReferenceTimes matches the LastRR of DLRR sub-blocks against the sent XR Receiver
+	// Reference Time blocks, nil ignores DLRR blocks
+	ReferenceTimes *ratecontrol.SenderReportHistory
+
+	// Clock is the time source, nil means the wall clock
+	Clock ratecontrol.Clock
+}
+
+// DefaultConfig returns the default tuning with the given limits in Kbps
+func DefaultConfig(init, min, max int) Config { //nolint:predeclared
+	return Config{
+		InitBitrate:     init,
+		MinBitrate:      min,
+		MaxBitrate:      max,
+		Alpha:           defaultAlpha,
+		PacketSize:      defaultPacketSize,
+		LossReports:     maxLossReports,
+		RTTReports:      maxSmoothedRTTReports,
+		TrendIncrease:   defaultTrendIncrease,
+		TrendDecrease:   defaultTrendDecrease,
+		MinFloor:        defaultMinFloor,
+		REMBPolicy:      REMBCap,
+		REMBBlendWeight: defaultREMBBlendWeight,
+		REMBTimeout:     defaultREMBTimeout,
+	}
+}
+
+// Validate checks the limits against each other and the floor, and the tuning ranges
+func (c Config) Validate() error {
+	if err := validateLimits(c.InitBitrate, c.MinBitrate, c.MaxBitrate, c.MinFloor); err != nil {
+		return err
+	}
+	switch {
+	case c.Alpha <= 0 || c.Alpha > 1:
+		return fmt.Errorf("%w: alpha %v must be in (0, 1]", ErrInvalidConfig, c.Alpha)
+	case c.PacketSize <= 0:
+		return fmt.Errorf("%w: packet size %v must be positive", ErrInvalidConfig, c.PacketSize)
+	case c.LossReports <= 0:
+		return fmt.Errorf("%w: loss reports %d must be positive", ErrInvalidConfig, c.LossReports)
+	case c.RTTReports <= 2:
+		return fmt.Errorf("%w: RTT reports %d must be at least 3 for a trend", ErrInvalidConfig, c.RTTReports)
+	case c.TrendIncrease <= 1:
+		return fmt.Errorf("%w: trend increase %v must be above 1", ErrInvalidConfig, c.TrendIncrease)
+	case c.TrendDecrease <= 0 || c.TrendDecrease >= 1:
+		return fmt.Errorf("%w: trend decrease %v must be in (0, 1)", ErrInvalidConfig, c.TrendDecrease)
+	case c.REMBPolicy < REMBCap || c.REMBPolicy > REMBIgnore:
+		return fmt.Errorf("%w: %w", ErrInvalidConfig, fmt.Errorf("%w: %v", ErrUnknownREMBPolicy, c.REMBPolicy))
+	case c.REMBBlendWeight <= 0 || c.REMBBlendWeight > 1:
+		return fmt.Errorf("%w: REMB blend weight %v must be in (0, 1]", ErrInvalidConfig, c.REMBBlendWeight)
+	case c.REMBTimeout <= 0:
+		return fmt.Errorf("%w: REMB timeout %v must be positive", ErrInvalidConfig, c.REMBTimeout)
+	}
+	return nil
+}
+
+// validateLimits checks the initial bitrate and the rate limits in Kbps
+func validateLimits(init, min, max, floor int) error { //nolint:predeclared
+	if floor <= 0 {
+		return fmt.Errorf("%w: min floor %d must be positive", ErrInvalidConfig, floor)
+	}
+	if init < min || init > max {
+		return fmt.Errorf("%w: initial bitrate %d must be between min %d and max %d", ErrInvalidConfig, init, min, max)
+	}
+	if min <= 0 || max <= 0 || init <= 0 {
+		return fmt.Errorf("%w: bitrate limits must be positive: min %d, max %d", ErrInvalidConfig, min, max)
+	}
+	if min > max {
+		return fmt.Errorf("%w: min bitrate %d cannot be greater than max bitrate %d", ErrInvalidConfig, min, max)
+	}
+	if init < floor || min < floor || max < floor {
+		return fmt.Errorf("%w: bitrate must be at least %d Kbps: init %d, min %d, max %d",
+			ErrInvalidConfig, floor, init, min, max)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package tfrc
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(c *Config)
+		wantErr bool
+	}{
+		{"defaults", func(*Config) {}, false},
+		{"below default floor", func(c *Config) { c.MinBitrate = 100 }, true},
+		{"low bitrate profile", func(c *Config) { c.InitBitrate, c.MinBitrate, c.MinFloor = 200, 100, 50 }, false},
+		{"zero floor", func(c *Config) { c.MinFloor = 0 }, true},
+		{"init above max", func(c *Config) { c.InitBitrate = 5000 }, true},
+		{"zero alpha", func(c *Config) { c.Alpha = 0 }, true},
+		{"alpha above one", func(c *Config) { c.Alpha = 1.5 }, true},
+		{"zero packet size", func(c *Config) { c.PacketSize = 0 }, true},
+		{"zero loss reports", func(c *Config) { c.LossReports = 0 }, true},
+		{"short RTT history", func(c *Config) { c.RTTReports = 2 }, true},
+		{"increase threshold at one", func(c *Config) { c.TrendIncrease = 1 }, true},
+		{"decrease threshold at one", func(c *Config) { c.TrendDecrease = 1 }, true},
+		{"unknown REMB policy", func(c *Config) { c.REMBPolicy = REMBIgnore + 1 }, true},
+		{"zero REMB blend weight", func(c *Config) { c.REMBBlendWeight = 0 }, true},
+		{"zero REMB timeout", func(c *Config) { c.REMBTimeout = 0 }, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig(1000, 500, 4000)
+			tt.modify(&cfg)
+
+			got, err := NewWithConfig(cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewWithConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidConfig) {
+					t.Errorf("error %v does not wrap ErrInvalidConfig", err)
+				}
+				if got != nil {
+					t.Error("NewWithConfig() returned a controller with an error")
+				}
+			}
+		})
+	}
+}
+
+func TestNewWithConfig_tuning(t *testing.T) {
+	cfg := DefaultConfig(200, 100, 400)
+	cfg.MinFloor = 50
+	cfg.Alpha = 0.5
+	cfg.PacketSize = 600
+	cfg.RTTReports = 4
+
+	tfrc, err := NewWithConfig(cfg)
+	if err != nil {
+		t.Fatalf("NewWithConfig() error = %v", err)
+	}
+	if got := tfrc.currentBitrate; got != 200 {
+		t.Errorf("bitrate = %d, want 200", got)
+	}
+	if got := tfrc.GetAvgPacketSize(); got != 600 {
+		t.Errorf("packet size = %v, want 600", got)
+	}
+
+	// the history holds only RTTReports entries
+	for range 10 {
+		tfrc.smoothedRTTHistory.add(0.1)
+	}
+	if got := len(tfrc.smoothedRTTHistory.get()); got != 4 {
+		t.Errorf("RTT history length = %d, want 4", got)
+	}
+}
+
+func TestComputeRTTTrend_thresholds(t *testing.T) {
+	tests := []struct {
+		name     string
+		increase float64
+		want     int
+	}{
+		{"default threshold holds a 10% rise as stable", defaultTrendIncrease, 0},
+		{"tighter threshold reports a 10% rise", 1.05, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig(1000, 500, 4000)
+			cfg.TrendIncrease = tt.increase
+			tfrc, err := NewWithConfig(cfg)
+			if err != nil {
+				t.Fatalf("NewWithConfig() error = %v", err)
+			}
+			for _, rtt := range []float64{0.1, 0.1, 0.11, 0.11} {
+				tfrc.smoothedRTTHistory.add(rtt)
+			}
+			if got := tfrc.computeRTTTrend(); got != tt.want {
+				t.Errorf("computeRTTTrend() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
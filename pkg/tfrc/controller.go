@@ -0,0 +1,107 @@
+package tfrc
+
+import (
+	"time"
+
+	"github.com/pion/rtcp"
+
+	"github.com/arsperger/slowcast/pkg/ratecontrol"
+)
+
+// Name is the registry name of the TFRC controller
+const Name = "tfrc"
+
+var (
+	_ ratecontrol.RateController    = (*Tfrc)(nil)
+	_ ratecontrol.ProbeConsumer     = (*Tfrc)(nil)
+	_ ratecontrol.SendStatsConsumer = (*Tfrc)(nil)
+	_ ratecontrol.LossEstimator     = (*Tfrc)(nil)
+)
+
+// NewController is a ratecontrol.Factory creating a TFRC controller with the default tuning
+func NewController(cfg ratecontrol.Config) (ratecontrol.RateController, error) {
+	return NewFactory(DefaultConfig(0, 0, 0))(cfg)
+}
+
+// NewFactory returns a ratecontrol.Factory creating TFRC controllers with the tuning of tuning,
+// the bitrate limits and the clock come from the factory argument
+func NewFactory(tuning Config) ratecontrol.Factory {
+	return func(cfg ratecontrol.Config) (ratecontrol.RateController, error) {
+		tfrcCfg := tuning
+		tfrcCfg.InitBitrate = cfg.InitBitrate
+		tfrcCfg.MinBitrate = cfg.MinBitrate
+		tfrcCfg.MaxBitrate = cfg.MaxBitrate
+		tfrcCfg.Clock = cfg.Clock
+		tfrcCfg.SenderReports = cfg.SenderReports
+		tfrcCfg.ReferenceTimes = cfg.ReferenceTimes
+		return NewWithConfig(tfrcCfg)
+	}
+}
+
+// OnRTCP feeds every report block of a receiver report into PreProcessRTCP,
+// PreProcessDelay and PreProcessLossCounters, and the blocks of an extended report
+// into the same estimates
+func (t *Tfrc) OnRTCP(now time.Time, pkt rtcp.Packet) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch p := pkt.(type) {
+	case *rtcp.ReceiverReport:
+		for _, report := range p.Reports {
+			hasRTT := t.preProcessRTCP(now, report.LastSenderReport, report.Delay, report.FractionLost)
+			t.jitter = report.Jitter
+			if hasRTT {
+				// the RTT sample is only meaningful once the receiver saw a sender report
+				t.delayTrend.update(now, t.rttSampe, report.Jitter)
+			}
+			t.preProcessLossCounters(now, report.TotalLost, report.LastSequenceNumber)
+		}
+	case *rtcp.ExtendedReport:
+		t.onExtendedReport(now, p)
+	case *rtcp.ReceiverEstimatedMaximumBitrate:
+		t.remb.update(now, p)
+		return
+	default:
+		return
+	}
+	t.publish(now)
+}
+
+// OnProbeResult jumps the current bitrate up to a probed rate, capped at the max bitrate,
+// the 2*X_recv cap lets it through until X_recv is measured at the new rate
+func (t *Tfrc) OnProbeResult(now time.Time, deliveredKbps int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if deliveredKbps > t.currentBitrate {
+		t.currentBitrate = min(deliveredKbps, t.maxBitrate)
+		t.probedKbps = t.currentBitrate
+		t.probedAt = now
+		t.publish(now)
+	}
+}
+
+// OnSendStats replaces the packet size of the throughput equation with the measured one
+func (t *Tfrc) OnSendStats(_ time.Time, stats ratecontrol.SendStats) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if stats.AvgPacketSize > 0 {
+		t.avgPacketSize = stats.AvgPacketSize
+	}
+}
+
+// TargetBitrate returns the TFRC bitrate in Kbps
+func (t *Tfrc) TargetBitrate() int {
+	return t.ComputeTFRCBitrate()
+}
+
+// State returns the current TFRC estimates
+func (t *Tfrc) State() ratecontrol.State {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return ratecontrol.State{
+		Bitrate:     t.currentBitrate,
+		RTTSample:   t.rttSampe,
+		SmoothedRTT: t.smoothedRTT,
+		LossRate:    t.pSample,
+	}
+}
@@ -0,0 +1,158 @@
+package tfrc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pion/rtcp"
+
+	"github.com/arsperger/slowcast/pkg/ratecontrol"
+)
+
+func TestNewController(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     ratecontrol.Config
+		wantErr bool
+	}{
+		{
+			name:    "valid parameters",
+			cfg:     ratecontrol.Config{InitBitrate: 1000, MinBitrate: 500, MaxBitrate: 4000},
+			wantErr: false,
+		},
+		{
+			name:    "init above max",
+			cfg:     ratecontrol.Config{InitBitrate: 5000, MinBitrate: 500, MaxBitrate: 4000},
+			wantErr: true,
+		},
+		{
+			name:    "min too low",
+			cfg:     ratecontrol.Config{InitBitrate: 1000, MinBitrate: 100, MaxBitrate: 4000},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewController(tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewController() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && c.State().Bitrate != tt.cfg.InitBitrate {
+				t.Errorf("NewController() bitrate = %v, want %v", c.State().Bitrate, tt.cfg.InitBitrate)
+			}
+		})
+	}
+}
+
+func TestTfrc_OnRTCP(t *testing.T) {
+	tfrc := New(1000, 500, 4000)
+
+	// Packets other than RR are ignored
+	tfrc.OnRTCP(time.Now(), &rtcp.PictureLossIndication{})
+	if tfrc.lossReports.len() != 0 {
+		t.Errorf("OnRTCP() recorded %d loss reports for PLI, want 0", tfrc.lossReports.len())
+	}
+
+	rr := &rtcp.ReceiverReport{
+		Reports: []rtcp.ReceptionReport{
+			{SSRC: 1, FractionLost: 25},
+			{SSRC: 1, FractionLost: 50},
+		},
+	}
+	tfrc.OnRTCP(time.Now(), rr)
+
+	if tfrc.lossReports.len() != 2 {
+		t.Errorf("OnRTCP() recorded %d loss reports, want 2", tfrc.lossReports.len())
+	}
+
+	state := tfrc.State()
+	if state.LossRate != 50.0/256.0 {
+		t.Errorf("State() LossRate = %v, want %v", state.LossRate, 50.0/256.0)
+	}
+	if state.Bitrate != 1000 {
+		t.Errorf("State() Bitrate = %v, want %v", state.Bitrate, 1000)
+	}
+}
+
+func TestTfrc_OnProbeResult(t *testing.T) {
+	tests := []struct {
+		name      string
+		delivered int
+		want      int
+	}{
+		{"below current", 800, 1000},
+		{"jump", 2500, 2500},
+		{"capped at max", 9000, 4000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tfrc := New(1000, 500, 4000)
+			tfrc.OnProbeResult(time.Now(), tt.delivered)
+			if got := tfrc.State().Bitrate; got != tt.want {
+				t.Errorf("OnProbeResult() bitrate = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTfrc_OnSendStats(t *testing.T) {
+	tests := []struct {
+		name  string
+		stats ratecontrol.SendStats
+		want  float64
+	}{
+		{"nothing sent keeps the default", ratecontrol.SendStats{}, 1200},
+		{"static scene", ratecontrol.SendStats{Packets: 100, AvgPacketSize: 350}, 350},
+		{"high motion", ratecontrol.SendStats{Packets: 100, AvgPacketSize: 1180}, 1180},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tfrc := New(1000, 500, 4000)
+			tfrc.OnSendStats(time.Now(), tt.stats)
+			if got := tfrc.GetAvgPacketSize(); got != tt.want {
+				t.Errorf("GetAvgPacketSize() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// smaller packets lower the equation rate under the same loss and RTT
+	small := New(1000, 500, 4000)
+	large := New(1000, 500, 4000)
+	for _, tfrc := range []*Tfrc{small, large} {
+		tfrc.smoothedRTT = 0.1
+		tfrc.lossReports.add(0.05, 100*time.Millisecond)
+	}
+	small.OnSendStats(time.Now(), ratecontrol.SendStats{AvgPacketSize: 300})
+	if s, l := small.ComputeTFRCBitrate(), large.ComputeTFRCBitrate(); s >= l {
+		t.Errorf("ComputeTFRCBitrate() with 300 byte packets = %d, want below %d with 1200 bytes", s, l)
+	}
+}
+
+func TestTfrc_OnProbeResult_holdsAfterReport(t *testing.T) {
+	tfrc := New(1000, 500, 4000)
+	tfrc.slowStart = false
+	for range 5 {
+		tfrc.recordRTT(0.1) // stable RTT ramps toward the max
+	}
+	// packets per second the receiver gets at kbps
+	packets := func(kbps int) uint32 { return uint32(float64(kbps) * 1000 / 8 / tfrc.GetAvgPacketSize()) }
+
+	start := time.Now()
+	tfrc.PreProcessLossCounters(start, 0, 0)
+	tfrc.PreProcessLossCounters(start.Add(time.Second), 0, packets(1000))
+
+	tfrc.OnProbeResult(start.Add(1500*time.Millisecond), 3000)
+
+	// the next report still measured X_recv before the probe
+	tfrc.PreProcessLossCounters(start.Add(2*time.Second), 0, 2*packets(1000))
+	if got := tfrc.ComputeTFRCBitrate(); got < 3000 {
+		t.Fatalf("ComputeTFRCBitrate() = %d after the next RR, want the probed 3000 held", got)
+	}
+
+	// X_recv measured after the probe applies the cap again
+	tfrc.PreProcessLossCounters(start.Add(3*time.Second), 0, 3*packets(1000))
+	if got := tfrc.ComputeTFRCBitrate(); got > 2000 {
+		t.Errorf("ComputeTFRCBitrate() = %d, want capped at 2*X_recv", got)
+	}
+}
@@ -0,0 +1,165 @@
+package tfrc
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	// delayWindowSize is the number of RR delay samples in the trendline
+	delayWindowSize = 10
+
+	// minDelaySamples is needed before the trendline replaces computeRTTTrend
+	minDelaySamples = 3
+
+	// delaySmoothing weights the previous smoothed RTT in the trendline input
+	delaySmoothing = 0.5
+
+	// minDelayThreshold is the smallest RTT change over the window counted as a trend, seconds
+	minDelayThreshold = 0.005
+
+	// jitterThresholdGain scales the RR jitter into the trend threshold
+	jitterThresholdGain = 2.0
+
+	// jitterSmoothing weights the newest RR jitter sample
+	jitterSmoothing = 0.25
+
+	// maxQueueDelay is the queuing delay above the base RTT treated as overuse, seconds
+	maxQueueDelay = 0.1
+
+	// baseRTTWindow is how long the minimum RTT is trusted before it is renewed
+	baseRTTWindow = 10 * time.Minute
+
+	// rtpClockRate converts the RR jitter from RTP timestamp units to seconds
+	rtpClockRate = 90000
+
+	// delayBackoff is the multiplicative decrease applied on delay overuse
+	delayBackoff = 0.85
+)
+
+// delayUsage is the delay trend detector verdict
+type delayUsage int
+
+const (
+	delayStable delayUsage = iota
+	// delayIncreasing queues are building, hold the rate
+	delayIncreasing
+	// delayDecreasing queues are draining
+	delayDecreasing
+	// delayOverusing the standing queue is too long, back off
+	delayOverusing
+)
+
+type delaySample struct {
+	t     float64
+	delay float64
+}
+
+// delayTrendDetector fits a trendline through smoothed RTT samples and compares the
+// RTT growth over the window against a threshold that widens with the RR jitter
+type delayTrendDetector struct {
+	samples  []delaySample
+	first    time.Time
+	smoothed float64
+
+	// jitter is the smoothed interarrival jitter in seconds
+	jitter float64
+
+	baseRTT     float64
+	baseRTTTime time.Time
+	lastRTT     float64
+
+	usage delayUsage
+	// updates counts the RTT samples, the rate backs off at most once per sample
+	updates uint64
+}
+
+// update adds an RTT sample and the RR jitter in RTP timestamp units
+func (d *delayTrendDetector) update(now time.Time, rtt float64, jitter uint32) {
+	if rtt <= 0 {
+		return
+	}
+	jitterSec := float64(jitter) / rtpClockRate
+	if len(d.samples) == 0 {
+		d.first = now
+		d.smoothed = rtt
+		d.jitter = jitterSec
+	} else {
+		d.smoothed = delaySmoothing*d.smoothed + (1-delaySmoothing)*rtt
+		d.jitter = (1-jitterSmoothing)*d.jitter + jitterSmoothing*jitterSec
+	}
+	d.lastRTT = rtt
+	d.updates++
+
+	if d.baseRTT == 0 || rtt <= d.baseRTT || now.Sub(d.baseRTTTime) > baseRTTWindow {
+		d.baseRTT = rtt
+		d.baseRTTTime = now
+	}
+
+	d.samples = append(d.samples, delaySample{t: now.Sub(d.first).Seconds(), delay: d.smoothed})
+	if len(d.samples) > delayWindowSize {
+		d.samples = d.samples[1:]
+	}
+	d.usage = d.detect()
+}
+
+// ready reports whether the trendline has enough samples
+func (d *delayTrendDetector) ready() bool {
+	return len(d.samples) >= minDelaySamples
+}
+
+// queueDelay is the last RTT above the base RTT in seconds
+func (d *delayTrendDetector) queueDelay() float64 {
+	return math.Max(0, d.lastRTT-d.baseRTT)
+}
+
+// threshold is the RTT change over the window that counts as a trend
+func (d *delayTrendDetector) threshold() float64 {
+	return math.Max(minDelayThreshold, jitterThresholdGain*d.jitter)
+}
+
+func (d *delayTrendDetector) detect() delayUsage {
+	if !d.ready() {
+		return delayStable
+	}
+	threshold := d.threshold()
+	if d.queueDelay() > maxQueueDelay+threshold {
+		return delayOverusing
+	}
+
+	slope, ok := delaySlope(d.samples)
+	if !ok {
+		return delayStable
+	}
+	growth := slope * (d.samples[len(d.samples)-1].t - d.samples[0].t)
+	switch {
+	case growth > threshold:
+		return delayIncreasing
+	case growth < -threshold:
+		return delayDecreasing
+	default:
+		return delayStable
+	}
+}
+
+// delaySlope returns the least squares slope of the smoothed delay over time
+func delaySlope(samples []delaySample) (float64, bool) {
+	var sumX, sumY float64
+	for _, s := range samples {
+		sumX += s.t
+		sumY += s.delay
+	}
+	n := float64(len(samples))
+	avgX := sumX / n
+	avgY := sumY / n
+
+	var num, den float64
+	for _, s := range samples {
+		num += (s.t - avgX) * (s.delay - avgY)
+		den += (s.t - avgX) * (s.t - avgX)
+	}
+	if den == 0 {
+		return 0, false
+	}
+	return num / den, true
+}
@@ -0,0 +1,169 @@
+package tfrc
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDelayTrendDetector_detect(t *testing.T) {
+	tests := []struct {
+		name     string
+		rtts     []float64
+		jitter   uint32
+		expected delayUsage
+	}{
+		{
+			name:     "not enough samples",
+			rtts:     []float64{0.1, 0.2},
+			expected: delayStable,
+		},
+		{
+			name:     "stable",
+			rtts:     []float64{0.1, 0.101, 0.099, 0.1, 0.102, 0.1},
+			expected: delayStable,
+		},
+		{
+			name:     "increasing",
+			rtts:     []float64{0.1, 0.11, 0.12, 0.13, 0.14, 0.15},
+			expected: delayIncreasing,
+		},
+		{
+			name:     "decreasing",
+			rtts:     []float64{0.18, 0.17, 0.16, 0.15, 0.14, 0.13},
+			expected: delayDecreasing,
+		},
+		{
+			name:     "standing queue",
+			rtts:     []float64{0.1, 0.15, 0.2, 0.25, 0.3, 0.3},
+			expected: delayOverusing,
+		},
+		{
+			name: "jitter widens the threshold",
+			rtts: []float64{0.1, 0.11, 0.12, 0.13, 0.14, 0.15},
+			// 30ms of interarrival jitter
+			jitter:   2700,
+			expected: delayStable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &delayTrendDetector{}
+			now := time.Now()
+			for _, rtt := range tt.rtts {
+				d.update(now, rtt, tt.jitter)
+				now = now.Add(time.Second)
+			}
+			if d.usage != tt.expected {
+				t.Errorf("usage = %v, want %v", d.usage, tt.expected)
+			}
+		})
+	}
+}
+
+func TestDelayTrendDetector_baseRTT(t *testing.T) {
+	d := &delayTrendDetector{}
+	now := time.Now()
+
+	d.update(now, 0.1, 0)
+	d.update(now.Add(time.Second), 0.05, 0)
+	d.update(now.Add(2*time.Second), 0.08, 0)
+	if d.baseRTT != 0.05 {
+		t.Errorf("baseRTT = %v, want 0.05", d.baseRTT)
+	}
+	if got := d.queueDelay(); got < 0.029 || got > 0.031 {
+		t.Errorf("queueDelay() = %v, want 0.03", got)
+	}
+
+	// a stale minimum is replaced by the next sample
+	d.update(now.Add(baseRTTWindow+3*time.Second), 0.08, 0)
+	if d.baseRTT != 0.08 {
+		t.Errorf("baseRTT after window = %v, want 0.08", d.baseRTT)
+	}
+
+	// zero RTT samples are ignored
+	d.update(now.Add(baseRTTWindow+4*time.Second), 0, 0)
+	if len(d.samples) != 4 {
+		t.Errorf("samples = %d, want 4", len(d.samples))
+	}
+}
+
+func TestTfrc_ComputeTFRCBitrate_delay(t *testing.T) {
+	tests := []struct {
+		name     string
+		rtts     []float64
+		expected func(bitrate int) bool
+	}{
+		{
+			name:     "stable ramps up",
+			rtts:     []float64{0.1, 0.1, 0.1, 0.1},
+			expected: func(bitrate int) bool { return bitrate > 1000 },
+		},
+		{
+			name:     "increasing holds",
+			rtts:     []float64{0.1, 0.11, 0.12, 0.13},
+			expected: func(bitrate int) bool { return bitrate == 1000 },
+		},
+		{
+			name:     "standing queue backs off",
+			rtts:     []float64{0.1, 0.2, 0.3, 0.3},
+			expected: func(bitrate int) bool { return bitrate == 850 },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tfrc := New(1000, 500, 4000)
+			tfrc.smoothedRTT = 0.1
+			now := time.Now()
+			for _, rtt := range tt.rtts {
+				tfrc.rttSampe = rtt
+				tfrc.PreProcessDelay(now, 0)
+				now = now.Add(time.Second)
+			}
+			if bitrate := tfrc.ComputeTFRCBitrate(); !tt.expected(bitrate) {
+				t.Errorf("ComputeTFRCBitrate() = %d", bitrate)
+			}
+		})
+	}
+}
+
+func TestTfrc_ComputeTFRCBitrate_delayWithLoss(t *testing.T) {
+	tfrc := New(1000, 500, 4000)
+	tfrc.smoothedRTT = 0.1
+	tfrc.lossReports.add(0.001, 100*time.Millisecond)
+	now := time.Now()
+	for _, rtt := range []float64{0.1, 0.2, 0.3, 0.3} {
+		tfrc.rttSampe = rtt
+		tfrc.PreProcessDelay(now, 0)
+		now = now.Add(time.Second)
+	}
+
+	// the equation allows more than the current rate, the standing queue caps it
+	if bitrate := tfrc.ComputeTFRCBitrate(); bitrate >= 1000 {
+		t.Errorf("ComputeTFRCBitrate() = %d, want below 1000", bitrate)
+	}
+}
+
+func TestTfrc_ComputeTFRCBitrate_backOffOncePerSample(t *testing.T) {
+	tfrc := New(1000, 500, 4000)
+	tfrc.smoothedRTT = 0.1
+	now := time.Now()
+	for _, rtt := range []float64{0.1, 0.2, 0.3, 0.3} {
+		tfrc.rttSampe = rtt
+		tfrc.PreProcessDelay(now, 0)
+		now = now.Add(time.Second)
+	}
+
+	// polling without a new delay sample holds the back off
+	for range 5 {
+		if bitrate := tfrc.ComputeTFRCBitrate(); bitrate != 850 {
+			t.Fatalf("ComputeTFRCBitrate() = %d, want 850 until the next sample", bitrate)
+		}
+	}
+
+	tfrc.PreProcessDelay(now, 0)
+	if bitrate := tfrc.ComputeTFRCBitrate(); bitrate != 722 {
+		t.Errorf("ComputeTFRCBitrate() = %d after a new sample, want 722", bitrate)
+	}
+}
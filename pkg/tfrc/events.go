@@ -0,0 +1,123 @@
+package tfrc
+
+import (
+	"sync"
+	"time"
+)
+
+// Change flags the estimates that changed in an Event
+type Change uint8
+
+const (
+	// ChangeBitrate is set when the target bitrate changed
+	ChangeBitrate Change = 1 << iota
+	// ChangeRTT is set when the RTT sample or the smoothed RTT changed
+	ChangeRTT
+	// ChangeLoss is set when the fraction lost or the loss event rate changed
+	ChangeLoss
+
+	changeAll = ChangeBitrate | ChangeRTT | ChangeLoss
+)
+
+// Has reports whether all flags in c2 are set
+func (c Change) Has(c2 Change) bool {
+	return c&c2 == c2
+}
+
+// Event is the TFRC estimates at the time one of them changed, bitrate in Kbps, RTTs in seconds
+type Event struct {
+	Time          time.Time
+	Changes       Change
+	Bitrate       int
+	RTTSample     float64
+	SmoothedRTT   float64
+	LossFraction  float64
+	LossEventRate float64
+}
+
+type subscriber struct {
+	ch   chan Event
+	once sync.Once
+}
+
+// send delivers e without blocking, dropping the oldest queued event when the buffer is full
+// so a slow subscriber always ends up with the latest estimates
+func (s *subscriber) send(e Event) {
+	select {
+	case s.ch <- e:
+		return
+	default:
+	}
+	select {
+	case <-s.ch:
+	default:
+	}
+	select {
+	case s.ch <- e:
+	default:
+	}
+}
+
+// Subscribe returns a channel receiving an Event whenever the target bitrate, RTT or loss estimate
+// changes, starting with the current estimates, and a function closing it. Events are never waited
+// for, the oldest queued event is dropped when buffer events are pending
+func (t *Tfrc) Subscribe(buffer int) (<-chan Event, func()) {
+	s := &subscriber{ch: make(chan Event, max(buffer, 1))}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	current := t.published
+	current.Changes = changeAll
+	s.ch <- current
+	t.subscribers = append(t.subscribers, s)
+
+	return s.ch, func() { t.unsubscribe(s) }
+}
+
+func (t *Tfrc) unsubscribe(s *subscriber) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i, sub := range t.subscribers {
+		if sub == s {
+			t.subscribers = append(t.subscribers[:i], t.subscribers[i+1:]...)
+			break
+		}
+	}
+	s.once.Do(func() { close(s.ch) })
+}
+
+// event returns the current estimates flagged with changes
+func (t *Tfrc) event(now time.Time, changes Change) Event {
+	return Event{
+		Time:          now,
+		Changes:       changes,
+		Bitrate:       t.currentBitrate,
+		RTTSample:     t.rttSampe,
+		SmoothedRTT:   t.smoothedRTT,
+		LossFraction:  t.pSample,
+		LossEventRate: t.lossEventRate(),
+	}
+}
+
+// publish sends the estimates to the subscribers if they changed since the last event,
+// called with t.mu held
+func (t *Tfrc) publish(now time.Time) {
+	e := t.event(now, 0)
+	prev := t.published
+	if e.Bitrate != prev.Bitrate {
+		e.Changes |= ChangeBitrate
+	}
+	if e.RTTSample != prev.RTTSample || e.SmoothedRTT != prev.SmoothedRTT {
+		e.Changes |= ChangeRTT
+	}
+	if e.LossFraction != prev.LossFraction || e.LossEventRate != prev.LossEventRate {
+		e.Changes |= ChangeLoss
+	}
+	if e.Changes == 0 {
+		return
+	}
+	t.published = e
+	for _, s := range t.subscribers {
+		s.send(e)
+	}
+}
@@ -0,0 +1,139 @@
+package tfrc
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pion/rtcp"
+
+	"github.com/arsperger/slowcast/pkg/ratecontrol"
+)
+
+func TestTfrc_Subscribe(t *testing.T) {
+	tests := []struct {
+		name        string
+		update      func(tfrc *Tfrc)
+		wantChanges Change
+		wantEvent   bool
+	}{
+		{
+			name:      "no change",
+			update:    func(tfrc *Tfrc) { tfrc.OnProbeResult(time.Now(), 500) },
+			wantEvent: false,
+		},
+		{
+			name:        "probe raises the bitrate",
+			update:      func(tfrc *Tfrc) { tfrc.OnProbeResult(time.Now(), 2000) },
+			wantChanges: ChangeBitrate,
+			wantEvent:   true,
+		},
+		{
+			name: "receiver report with loss",
+			update: func(tfrc *Tfrc) {
+				tfrc.OnRTCP(time.Now(), &rtcp.ReceiverReport{Reports: []rtcp.ReceptionReport{{SSRC: 1, FractionLost: 64}}})
+			},
+			wantChanges: ChangeLoss,
+			wantEvent:   true,
+		},
+		{
+			name: "receiver report with an RTT sample",
+			update: func(tfrc *Tfrc) {
+				lsr := ratecontrol.NTPMiddle32(tfrc.clock.Now().Add(-100 * time.Millisecond))
+				tfrc.OnRTCP(time.Now(), &rtcp.ReceiverReport{Reports: []rtcp.ReceptionReport{{SSRC: 1, LastSenderReport: lsr}}})
+			},
+			wantChanges: ChangeRTT,
+			wantEvent:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tfrc := New(1000, 500, 4000)
+			events, unsubscribe := tfrc.Subscribe(4)
+			defer unsubscribe()
+
+			initial := <-events
+			if initial.Changes != changeAll || initial.Bitrate != 1000 {
+				t.Fatalf("initial event = %+v, want all changes at 1000 Kbps", initial)
+			}
+
+			tt.update(tfrc)
+
+			select {
+			case e := <-events:
+				if !tt.wantEvent {
+					t.Fatalf("unexpected event %+v", e)
+				}
+				if !e.Changes.Has(tt.wantChanges) {
+					t.Errorf("event changes = %b, want %b set", e.Changes, tt.wantChanges)
+				}
+				if state := tfrc.State(); e.Bitrate != state.Bitrate || e.LossFraction != state.LossRate {
+					t.Errorf("event %+v does not match state %+v", e, state)
+				}
+			default:
+				if tt.wantEvent {
+					t.Fatal("no event published")
+				}
+			}
+		})
+	}
+}
+
+func TestTfrc_SubscribeSlowConsumer(t *testing.T) {
+	tfrc := New(1000, 500, 4000)
+	events, unsubscribe := tfrc.Subscribe(1)
+
+	// the buffer holds the initial event, each probe replaces the pending one
+	for _, kbps := range []int{1500, 2000, 2500} {
+		tfrc.OnProbeResult(time.Now(), kbps)
+	}
+	if e := <-events; e.Bitrate != 2500 {
+		t.Errorf("pending event bitrate = %d, want the latest 2500", e.Bitrate)
+	}
+
+	unsubscribe()
+	unsubscribe()
+	tfrc.OnProbeResult(time.Now(), 3000)
+	if _, ok := <-events; ok {
+		t.Error("channel still open after unsubscribe")
+	}
+}
+
+func TestTfrc_concurrentUse(t *testing.T) {
+	tfrc := New(1000, 500, 4000)
+	events, unsubscribe := tfrc.Subscribe(16)
+
+	var consumer sync.WaitGroup
+	consumer.Add(1)
+	go func() {
+		defer consumer.Done()
+		for e := range events {
+			_ = e.Bitrate
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range 100 {
+				rr := &rtcp.ReceiverReport{Reports: []rtcp.ReceptionReport{{
+					SSRC:               1,
+					FractionLost:       uint8(i * j % 32), //nolint:gosec
+					LastSequenceNumber: uint32(j * 10),    //nolint:gosec
+				}}}
+				tfrc.OnRTCP(time.Now(), rr)
+				tfrc.TargetBitrate()
+				tfrc.State()
+				if _, err := tfrc.MarshalState(); err != nil {
+					t.Errorf("MarshalState() error = %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	unsubscribe()
+	consumer.Wait()
+}
@@ -0,0 +1,171 @@
+package tfrc
+
+import (
+	"math"
+	"time"
+
+	"github.com/arsperger/slowcast/pkg/ratecontrol"
+)
+
+const (
+	// nLossIntervals is the number of closed loss intervals kept, RFC 5348 section 5.4
+	nLossIntervals = 8
+
+	// lostCounterMask and lostCounterSign decode the 24 bit cumulative lost field
+	lostCounterSign = 0x800000
+	lostCounterMask = 0xFFFFFF
+)
+
+// lossIntervalHistory builds RFC 5348 loss intervals from the cumulative lost
+// and extended highest sequence number counters of successive receiver reports
+type lossIntervalHistory struct {
+	// closed intervals in packets, most recent first (I_1..I_n)
+	intervals []float64
+	// open interval in packets since the last loss event (I_0)
+	open float64
+
+	primed         bool
+	lastTotalLost  int64
+	lastHighestSeq uint32
+	lastReport     time.Time
+
+	// exact is set once XR Loss RLE patterns replace the RR counter estimate,
+	// nextSeq follows the last packet they covered
+	exact   bool
+	nextSeq uint16
+}
+
+func newLossIntervalHistory() *lossIntervalHistory {
+	return &lossIntervalHistory{
+		intervals: make([]float64, 0, nLossIntervals),
+	}
+}
+
+// lossIntervalWeight returns w_i of RFC 5348 section 5.4 for n = 8
+func lossIntervalWeight(i int) float64 {
+	if i < nLossIntervals/2 {
+		return 1.0
+	}
+	return 2.0 * float64(nLossIntervals-i) / float64(nLossIntervals+2)
+}
+
+// signedTotalLost decodes the 24 bit signed cumulative lost field
+func signedTotalLost(totalLost uint32) int64 {
+	v := int64(totalLost & lostCounterMask)
+	if v&lostCounterSign != 0 {
+		v -= 1 << 24
+	}
+	return v
+}
+
+// update consumes the counters of a receiver report, losses within one RTT are a single
+// loss event, so a report period of several RTTs may close several intervals
+func (h *lossIntervalHistory) update(now time.Time, totalLost, highestSeq uint32, rtt float64) {
+	lost := signedTotalLost(totalLost)
+	if !h.primed {
+		h.primed = true
+		h.lastTotalLost = lost
+		h.lastHighestSeq = highestSeq
+		h.lastReport = now
+		return
+	}
+
+	expected := int64(int32(highestSeq - h.lastHighestSeq)) //nolint:gosec
+	lostDelta := lost - h.lastTotalLost
+	elapsed := now.Sub(h.lastReport).Seconds()
+	h.lastTotalLost = lost
+	h.lastHighestSeq = highestSeq
+	h.lastReport = now
+
+	if h.exact || expected <= 0 {
+		return
+	}
+	if lostDelta <= 0 {
+		h.open += float64(expected)
+		return
+	}
+
+	// RR counters don't say when the losses happened, spread them over the RTTs of the period
+	events := int64(1)
+	if rtt > 0 {
+		events = max(1, int64(elapsed/rtt))
+	}
+	events = min(events, lostDelta, expected)
+	perEvent := float64(expected) / float64(events)
+
+	h.closeInterval(h.open + perEvent)
+	for i := int64(1); i < events; i++ {
+		h.closeInterval(perEvent)
+	}
+	h.open = 0
+}
+
+// addPattern consumes the per-packet receive status of an XR Loss RLE block, a loss more than
+// packetsPerRTT packets after the start of the last loss event starts a new one. Packets already
+// covered by an earlier overlapping block are skipped
+func (h *lossIntervalHistory) addPattern(p ratecontrol.LossPattern, packetsPerRTT float64) {
+	start := 0
+	if h.exact {
+		if ahead := int16(p.EndSeq() - h.nextSeq); ahead <= 0 { //nolint:gosec
+			return
+		}
+		start = max(0, int(int16(h.nextSeq-p.BeginSeq))/p.Step) //nolint:gosec
+	}
+	h.exact = true
+	h.primed = true
+	h.nextSeq = p.EndSeq()
+
+	for _, received := range p.Received[min(start, len(p.Received)):] {
+		if !received && (len(h.intervals) == 0 || h.open >= packetsPerRTT) {
+			h.closeInterval(math.Max(1, h.open))
+			h.open = 0
+		}
+		h.open += float64(p.Step)
+	}
+}
+
+func (h *lossIntervalHistory) closeInterval(interval float64) {
+	if len(h.intervals) >= nLossIntervals {
+		h.intervals = h.intervals[:nLossIntervals-1]
+	}
+	h.intervals = append([]float64{interval}, h.intervals...)
+}
+
+// lossEventRate returns p = 1 / I_mean of RFC 5348 section 5.4 with the
+// history discounting of section 5.5, 0 until the first loss event
+func (h *lossIntervalHistory) lossEventRate() float64 {
+	n := len(h.intervals)
+	if n == 0 {
+		return 0
+	}
+
+	// I_mean over the closed intervals only
+	var iTot1, wTot1 float64
+	for i := 0; i < n; i++ {
+		iTot1 += h.intervals[i] * lossIntervalWeight(i)
+		wTot1 += lossIntervalWeight(i)
+	}
+	iMean1 := iTot1 / wTot1
+
+	// discount the history when the open interval is much longer than the average
+	df := 1.0
+	if h.open > 2*iMean1 && h.open > 0 {
+		df = math.Max(0.5, 2*iMean1/h.open)
+	}
+
+	// I_mean including the open interval, older intervals shifted by one weight
+	iTot0 := h.open * lossIntervalWeight(0)
+	wTot0 := lossIntervalWeight(0)
+	for i := 1; i < nLossIntervals && i-1 < n; i++ {
+		w := lossIntervalWeight(i) * df
+		iTot0 += h.intervals[i-1] * w
+		wTot0 += w
+	}
+	iMean0 := iTot0 / wTot0
+
+	iMean := math.Max(iMean0, iMean1)
+	if iMean <= 0 {
+		return 0
+	}
+	return math.Min(1, 1/iMean)
+}
@@ -0,0 +1,173 @@
+package tfrc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pion/rtcp"
+)
+
+func TestLossIntervalWeight(t *testing.T) {
+	expected := []float64{1, 1, 1, 1, 0.8, 0.6, 0.4, 0.2}
+	for i, want := range expected {
+		if got := lossIntervalWeight(i); abs(got-want) > 1e-9 {
+			t.Errorf("lossIntervalWeight(%d) = %v, want %v", i, got, want)
+		}
+	}
+}
+
+func TestSignedTotalLost(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    uint32
+		expected int64
+	}{
+		{name: "zero", value: 0, expected: 0},
+		{name: "positive", value: 1234, expected: 1234},
+		{name: "negative from duplicates", value: 0xFFFFFF, expected: -1},
+		{name: "upper byte ignored", value: 0x01000005, expected: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := signedTotalLost(tt.value); got != tt.expected {
+				t.Errorf("signedTotalLost(%#x) = %v, want %v", tt.value, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestLossIntervalHistory_Update(t *testing.T) {
+	start := time.Now()
+
+	t.Run("first report only primes the counters", func(t *testing.T) {
+		h := newLossIntervalHistory()
+		h.update(start, 10, 5000, 0.1)
+		if !h.primed || h.open != 0 || len(h.intervals) != 0 {
+			t.Errorf("update() primed = %v, open = %v, intervals = %v", h.primed, h.open, h.intervals)
+		}
+	})
+
+	t.Run("no loss grows the open interval", func(t *testing.T) {
+		h := newLossIntervalHistory()
+		h.update(start, 0, 1000, 0.1)
+		h.update(start.Add(time.Second), 0, 1500, 0.1)
+		h.update(start.Add(2*time.Second), 0, 2000, 0.1)
+		if h.open != 1000 {
+			t.Errorf("update() open = %v, want %v", h.open, 1000)
+		}
+		if h.lossEventRate() != 0 {
+			t.Errorf("lossEventRate() = %v, want 0", h.lossEventRate())
+		}
+	})
+
+	t.Run("losses within one RTT are one event", func(t *testing.T) {
+		h := newLossIntervalHistory()
+		h.update(start, 0, 1000, 1.0)
+		h.update(start.Add(time.Second), 0, 1500, 1.0)
+		h.update(start.Add(2*time.Second), 5, 2000, 1.0)
+		if len(h.intervals) != 1 || h.intervals[0] != 1000 {
+			t.Errorf("update() intervals = %v, want [1000]", h.intervals)
+		}
+		if h.open != 0 {
+			t.Errorf("update() open = %v, want 0", h.open)
+		}
+	})
+
+	t.Run("losses spread over several RTTs close several intervals", func(t *testing.T) {
+		h := newLossIntervalHistory()
+		h.update(start, 0, 1000, 0.25)
+		h.update(start.Add(time.Second), 4, 1400, 0.25)
+		expected := []float64{100, 100, 100, 100}
+		if len(h.intervals) != len(expected) {
+			t.Fatalf("update() intervals = %v, want %v", h.intervals, expected)
+		}
+		for i := range expected {
+			if h.intervals[i] != expected[i] {
+				t.Errorf("update() intervals = %v, want %v", h.intervals, expected)
+			}
+		}
+	})
+
+	t.Run("sequence wraparound", func(t *testing.T) {
+		h := newLossIntervalHistory()
+		h.update(start, 0, 0xFFFFFF00, 0.1)
+		h.update(start.Add(time.Second), 0, 0x00000100, 0.1)
+		if h.open != 512 {
+			t.Errorf("update() open = %v, want %v", h.open, 512)
+		}
+	})
+
+	t.Run("history is bounded", func(t *testing.T) {
+		h := newLossIntervalHistory()
+		h.update(start, 0, 0, 10)
+		for i := 1; i <= 2*nLossIntervals; i++ {
+			h.update(start.Add(time.Duration(i)*time.Second), uint32(i), uint32(i*100), 10) //nolint:gosec
+		}
+		if len(h.intervals) != nLossIntervals {
+			t.Errorf("update() kept %d intervals, want %d", len(h.intervals), nLossIntervals)
+		}
+	})
+}
+
+func TestLossIntervalHistory_LossEventRate(t *testing.T) {
+	t.Run("equal intervals", func(t *testing.T) {
+		h := newLossIntervalHistory()
+		h.intervals = []float64{100, 100, 100, 100, 100, 100, 100, 100}
+		h.open = 50
+		// I_tot1 average is 100, the short open interval does not reduce it
+		if got := h.lossEventRate(); abs(got-0.01) > 1e-9 {
+			t.Errorf("lossEventRate() = %v, want %v", got, 0.01)
+		}
+	})
+
+	t.Run("long open interval counts", func(t *testing.T) {
+		h := newLossIntervalHistory()
+		h.intervals = []float64{100, 100, 100, 100}
+		h.open = 150
+		// I_tot0 = 150 + 3*100 + 0.8*100, W = 4.8
+		want := 4.8 / (150 + 300 + 80)
+		if got := h.lossEventRate(); abs(got-want) > 1e-9 {
+			t.Errorf("lossEventRate() = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("history discounting after a long loss-free period", func(t *testing.T) {
+		h := newLossIntervalHistory()
+		h.intervals = []float64{100, 100, 100, 100, 100, 100, 100, 100}
+		h.open = 1000
+		// DF = max(0.5, 2*100/1000) = 0.5, I_tot0 = 1000 + 0.5*100*5, W = 1 + 0.5*5
+		want := 3.5 / 1250
+		if got := h.lossEventRate(); abs(got-want) > 1e-9 {
+			t.Errorf("lossEventRate() = %v, want %v", got, want)
+		}
+	})
+}
+
+func TestTfrc_LowLossRate(t *testing.T) {
+	tfrc := New(1000, 500, 4000)
+	tfrc.smoothedRTT = 0.1
+	start := time.Now()
+
+	// 1 packet lost every 2000: FractionLost rounds to 0 but p must not
+	for i := 0; i <= 10; i++ {
+		rr := &rtcp.ReceiverReport{Reports: []rtcp.ReceptionReport{{
+			SSRC:               1,
+			FractionLost:       0,
+			TotalLost:          uint32(i),        //nolint:gosec
+			LastSequenceNumber: uint32(i * 2000), //nolint:gosec
+		}}}
+		tfrc.OnRTCP(start.Add(time.Duration(i)*time.Second), rr)
+	}
+
+	p := tfrc.lossEventRate()
+	if abs(p-1.0/2000.0) > 1e-6 {
+		t.Errorf("lossEventRate() = %v, want %v", p, 1.0/2000.0)
+	}
+	if got := tfrc.LossEventRate(); got != p {
+		t.Errorf("LossEventRate() = %v, want the loss interval rate %v", got, p)
+	}
+	if tfrc.computeLossEventRate() != 0 {
+		t.Errorf("computeLossEventRate() = %v, want 0", tfrc.computeLossEventRate())
+	}
+}
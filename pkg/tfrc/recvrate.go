@@ -0,0 +1,49 @@
+package tfrc
+
+import "time"
+
+// receiveRate derives X_recv of RFC 5348 from the packets the receiver got between successive
+// receiver reports, the RR counters only count packets so they are sized with the sent packet size
+type receiveRate struct {
+	primed         bool
+	lastTotalLost  int64
+	lastHighestSeq uint32
+	lastReport     time.Time
+
+	// xRecv is the receive rate in bytes/sec measured since from, only valid once two reports were seen
+	xRecv float64
+	from  time.Time
+	valid bool
+}
+
+// update consumes the RR counters, packetSize is the mean size of the packets sent in bytes
+func (r *receiveRate) update(now time.Time, totalLost, highestSeq uint32, packetSize float64) {
+	lost := signedTotalLost(totalLost)
+	if !r.primed {
+		r.primed = true
+		r.lastTotalLost = lost
+		r.lastHighestSeq = highestSeq
+		r.lastReport = now
+		return
+	}
+
+	expected := int64(int32(highestSeq - r.lastHighestSeq)) //nolint:gosec
+	received := max(0, expected-(lost-r.lastTotalLost))
+	elapsed := now.Sub(r.lastReport).Seconds()
+	from := r.lastReport
+	r.lastTotalLost = lost
+	r.lastHighestSeq = highestSeq
+	r.lastReport = now
+
+	if elapsed <= 0 {
+		return
+	}
+	r.xRecv = float64(received) * packetSize / elapsed
+	r.from = from
+	r.valid = true
+}
+
+// kbps returns X_recv in Kbps
+func (r *receiveRate) kbps() int {
+	return int(r.xRecv * 8 / 1000)
+}
@@ -0,0 +1,79 @@
+package tfrc
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReceiveRate_update(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	type report struct {
+		at         time.Duration
+		totalLost  uint32
+		highestSeq uint32
+	}
+	tests := []struct {
+		name       string
+		reports    []report
+		packetSize float64
+		wantValid  bool
+		wantKbps   int
+	}{
+		{
+			name:       "first report only primes",
+			reports:    []report{{0, 0, 100}},
+			packetSize: 1200,
+		},
+		{
+			name:       "all packets received",
+			reports:    []report{{0, 0, 100}, {time.Second, 0, 200}},
+			packetSize: 1200,
+			wantValid:  true,
+			wantKbps:   960,
+		},
+		{
+			name:       "lost packets are not received",
+			reports:    []report{{0, 0, 100}, {time.Second, 50, 200}},
+			packetSize: 1200,
+			wantValid:  true,
+			wantKbps:   480,
+		},
+		{
+			name:       "measured packet size",
+			reports:    []report{{0, 0, 100}, {2 * time.Second, 0, 300}},
+			packetSize: 400,
+			wantValid:  true,
+			wantKbps:   320,
+		},
+		{
+			name:       "quiet period",
+			reports:    []report{{0, 0, 100}, {time.Second, 0, 200}, {5 * time.Second, 0, 200}},
+			packetSize: 1200,
+			wantValid:  true,
+			wantKbps:   0,
+		},
+		{
+			name:       "sequence wrap",
+			reports:    []report{{0, 0, 0xFFFFFFF0}, {time.Second, 0, 0x50}},
+			packetSize: 1000,
+			wantValid:  true,
+			wantKbps:   768,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &receiveRate{}
+			for _, rep := range tt.reports {
+				r.update(start.Add(rep.at), rep.totalLost, rep.highestSeq, tt.packetSize)
+			}
+			if r.valid != tt.wantValid {
+				t.Fatalf("valid = %v, want %v", r.valid, tt.wantValid)
+			}
+			if got := r.kbps(); got != tt.wantKbps {
+				t.Errorf("kbps() = %d, want %d", got, tt.wantKbps)
+			}
+		})
+	}
+}
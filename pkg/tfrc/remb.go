@@ -0,0 +1,122 @@
+package tfrc
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pion/rtcp"
+)
+
+const (
+	defaultREMBBlendWeight = 0.5
+
+	// defaultREMBTimeout is how long a REMB limits the rate without being renewed
+	defaultREMBTimeout = 5 * time.Second
+)
+
+// ErrUnknownREMBPolicy is returned by ParseREMBPolicy for an unsupported policy name
+var ErrUnknownREMBPolicy = errors.New("unknown REMB policy")
+
+// REMBPolicy decides how receiver estimated maximum bitrates (REMB) limit the TFRC rate
+type REMBPolicy int
+
+const (
+	// REMBCap never sends above the lowest REMB
+	REMBCap REMBPolicy = iota
+	// REMBBlend moves the rate Config.REMBBlendWeight of the way down to the REMB on every update
+	REMBBlend
+	// REMBIgnore leaves the TFRC rate alone
+	REMBIgnore
+)
+
+// String returns the configuration name of the policy
+func (p REMBPolicy) String() string {
+	switch p {
+	case REMBCap:
+		return "cap"
+	case REMBBlend:
+		return "blend"
+	case REMBIgnore:
+		return "ignore"
+	default:
+		return fmt.Sprintf("remb-policy(%d)", int(p))
+	}
+}
+
+// ParseREMBPolicy parses cap, blend or ignore
+func ParseREMBPolicy(s string) (REMBPolicy, error) {
+	for _, p := range []REMBPolicy{REMBCap, REMBBlend, REMBIgnore} {
+		if p.String() == s {
+			return p, nil
+		}
+	}
+	return REMBCap, fmt.Errorf("%w: %q", ErrUnknownREMBPolicy, s)
+}
+
+type rembEstimate struct {
+	kbps int
+	at   time.Time
+}
+
+// rembLimits keeps the last REMB per media SSRC
+type rembLimits struct {
+	estimates map[uint32]rembEstimate
+}
+
+func newREMBLimits() *rembLimits {
+	return &rembLimits{estimates: make(map[uint32]rembEstimate)}
+}
+
+// update records the estimate for every SSRC the REMB names
+func (r *rembLimits) update(now time.Time, remb *rtcp.ReceiverEstimatedMaximumBitrate) {
+	e := rembEstimate{kbps: int(remb.Bitrate / 1000), at: now}
+	if len(remb.SSRCs) == 0 {
+		r.estimates[0] = e
+		return
+	}
+	for _, ssrc := range remb.SSRCs {
+		r.estimates[ssrc] = e
+	}
+}
+
+// kbps returns the lowest estimate renewed within timeout, stale estimates are dropped
+func (r *rembLimits) kbps(now time.Time, timeout time.Duration) (int, bool) {
+	lowest, ok := 0, false
+	for ssrc, e := range r.estimates {
+		if now.Sub(e.at) > timeout {
+			delete(r.estimates, ssrc)
+			continue
+		}
+		if !ok || e.kbps < lowest {
+			lowest, ok = e.kbps, true
+		}
+	}
+	return lowest, ok
+}
+
+// applyREMB limits rate by the receiver estimates according to the REMB policy,
+// the min bitrate still applies
+func (t *Tfrc) applyREMB(rate int) int {
+	remb, ok := t.remb.kbps(t.clock.Now(), t.cfg.REMBTimeout)
+	if !ok || rate <= remb {
+		return rate
+	}
+	switch t.cfg.REMBPolicy {
+	case REMBCap:
+		rate = remb
+	case REMBBlend:
+		rate -= int(t.cfg.REMBBlendWeight * float64(rate-remb))
+	case REMBIgnore:
+		return rate
+	}
+	t.currentBitrate = max(t.minBitrate, rate)
+	return t.currentBitrate
+}
+
+// REMB returns the lowest receiver estimated maximum bitrate in Kbps still in force
+func (t *Tfrc) REMB() (int, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.remb.kbps(t.clock.Now(), t.cfg.REMBTimeout)
+}
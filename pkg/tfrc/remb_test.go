@@ -0,0 +1,127 @@
+package tfrc
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pion/rtcp"
+)
+
+func TestParseREMBPolicy(t *testing.T) {
+	for _, p := range []REMBPolicy{REMBCap, REMBBlend, REMBIgnore} {
+		got, err := ParseREMBPolicy(p.String())
+		if err != nil || got != p {
+			t.Errorf("ParseREMBPolicy(%q) = %v, %v", p.String(), got, err)
+		}
+	}
+	if _, err := ParseREMBPolicy("max"); !errors.Is(err, ErrUnknownREMBPolicy) {
+		t.Errorf("ParseREMBPolicy(max) error = %v, want ErrUnknownREMBPolicy", err)
+	}
+}
+
+func TestTfrc_applyREMB(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy REMBPolicy
+		remb   []*rtcp.ReceiverEstimatedMaximumBitrate
+		age    time.Duration
+		rate   int
+		want   int
+	}{
+		{
+			name:   "no REMB",
+			policy: REMBCap,
+			rate:   3000,
+			want:   3000,
+		},
+		{
+			name:   "cap",
+			policy: REMBCap,
+			remb:   []*rtcp.ReceiverEstimatedMaximumBitrate{{Bitrate: 1500000, SSRCs: []uint32{1}}},
+			rate:   3000,
+			want:   1500,
+		},
+		{
+			name:   "rate below the REMB",
+			policy: REMBCap,
+			remb:   []*rtcp.ReceiverEstimatedMaximumBitrate{{Bitrate: 1500000, SSRCs: []uint32{1}}},
+			rate:   1000,
+			want:   1000,
+		},
+		{
+			name:   "lowest SSRC estimate wins",
+			policy: REMBCap,
+			remb: []*rtcp.ReceiverEstimatedMaximumBitrate{
+				{Bitrate: 2500000, SSRCs: []uint32{1}},
+				{Bitrate: 2000000, SSRCs: []uint32{2}},
+			},
+			rate: 3000,
+			want: 2000,
+		},
+		{
+			name:   "cap keeps the min bitrate",
+			policy: REMBCap,
+			remb:   []*rtcp.ReceiverEstimatedMaximumBitrate{{Bitrate: 100000, SSRCs: []uint32{1}}},
+			rate:   3000,
+			want:   500,
+		},
+		{
+			name:   "blend halfway",
+			policy: REMBBlend,
+			remb:   []*rtcp.ReceiverEstimatedMaximumBitrate{{Bitrate: 1000000, SSRCs: []uint32{1}}},
+			rate:   3000,
+			want:   2000,
+		},
+		{
+			name:   "ignore",
+			policy: REMBIgnore,
+			remb:   []*rtcp.ReceiverEstimatedMaximumBitrate{{Bitrate: 1000000, SSRCs: []uint32{1}}},
+			rate:   3000,
+			want:   3000,
+		},
+		{
+			name:   "expired REMB",
+			policy: REMBCap,
+			remb:   []*rtcp.ReceiverEstimatedMaximumBitrate{{Bitrate: 1000000, SSRCs: []uint32{1}}},
+			age:    defaultREMBTimeout + time.Second,
+			rate:   3000,
+			want:   3000,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := &fixedClock{now: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)}
+			cfg := DefaultConfig(1000, 500, 4000)
+			cfg.REMBPolicy = tt.policy
+			cfg.Clock = clock
+			tfrc, err := NewWithConfig(cfg)
+			if err != nil {
+				t.Fatalf("NewWithConfig() error = %v", err)
+			}
+
+			for _, remb := range tt.remb {
+				tfrc.OnRTCP(clock.now, remb)
+			}
+			clock.now = clock.now.Add(tt.age)
+
+			if got := tfrc.applyREMB(tt.rate); got != tt.want {
+				t.Errorf("applyREMB(%d) = %d, want %d", tt.rate, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTfrc_TargetBitrateREMB(t *testing.T) {
+	tfrc := New(1000, 500, 4000)
+	tfrc.OnProbeResult(time.Now(), 3000)
+	tfrc.OnRTCP(time.Now(), &rtcp.ReceiverEstimatedMaximumBitrate{Bitrate: 1200000, SSRCs: []uint32{1}})
+
+	if got := tfrc.TargetBitrate(); got > 1200 {
+		t.Errorf("TargetBitrate() = %d, want at most the 1200 Kbps REMB", got)
+	}
+	if got, ok := tfrc.REMB(); !ok || got != 1200 {
+		t.Errorf("REMB() = %d, %v, want 1200", got, ok)
+	}
+}
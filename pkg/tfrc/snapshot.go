@@ -0,0 +1,110 @@
+package tfrc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/arsperger/slowcast/pkg/ratecontrol"
+)
+
+// SnapshotVersion is the version of the Snapshot layout
+const SnapshotVersion = 1
+
+// ErrSnapshotVersion is returned by Restore for a snapshot of another layout version
+var ErrSnapshotVersion = errors.New("unsupported TFRC snapshot version")
+
+var _ ratecontrol.StateSnapshotter = (*Tfrc)(nil)
+
+// LossReportSnapshot is one entry of the RFC8083 loss event window
+type LossReportSnapshot struct {
+	Fraction float64       `json:"fraction"`
+	Interval time.Duration `json:"interval"`
+}
+
+// Snapshot is the TFRC state worth keeping across restarts, bitrates in Kbps.
+// LossIntervals and OpenInterval are the RFC 5348 loss interval history in packets,
+// a snapshot without SlowStart resumes out of slow start
+type Snapshot struct {
+	Version        int                  `json:"version"`
+	CurrentBitrate int                  `json:"current_bitrate"`
+	SmoothedRTT    float64              `json:"smoothed_rtt"`
+	RTTHistory     []float64            `json:"rtt_history"`
+	LossReports    []LossReportSnapshot `json:"loss_reports"`
+	AvgPacketSize  float64              `json:"avg_packet_size"`
+	SlowStart      bool                 `json:"slow_start"`
+	LossIntervals  []float64            `json:"loss_intervals"`
+	OpenInterval   float64              `json:"open_interval"`
+}
+
+// Snapshot returns a copy of the current estimates
+func (t *Tfrc) Snapshot() Snapshot {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := Snapshot{
+		Version:        SnapshotVersion,
+		CurrentBitrate: t.currentBitrate,
+		SmoothedRTT:    t.smoothedRTT,
+		RTTHistory:     append([]float64(nil), t.smoothedRTTHistory.get()...),
+		AvgPacketSize:  t.avgPacketSize,
+		SlowStart:      t.slowStart,
+		LossIntervals:  append([]float64(nil), t.lossHistory.intervals...),
+		OpenInterval:   t.lossHistory.open,
+	}
+	for _, r := range t.lossReports.get() {
+		s.LossReports = append(s.LossReports, LossReportSnapshot{Fraction: r.fraction, Interval: r.interval})
+	}
+	return s
+}
+
+// Restore resumes from a snapshot, the bitrate is clamped to the current limits. The loss
+// intervals carry on from the first receiver report counters seen after the restore
+func (t *Tfrc) Restore(s Snapshot) error {
+	if s.Version != SnapshotVersion {
+		return fmt.Errorf("%w: %d", ErrSnapshotVersion, s.Version)
+	}
+	if s.SmoothedRTT <= 0 {
+		return fmt.Errorf("invalid smoothed RTT %v in snapshot", s.SmoothedRTT)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.currentBitrate = max(t.minBitrate, min(s.CurrentBitrate, t.maxBitrate))
+	t.smoothedRTT = s.SmoothedRTT
+	t.smoothedRTTHistory = newSmoothedRTTHistoryAccumulator(t.cfg.RTTReports)
+	for _, rtt := range s.RTTHistory {
+		t.smoothedRTTHistory.add(rtt)
+	}
+	t.lossReports = newLossReportAccumulator(t.cfg.LossReports)
+	for _, r := range s.LossReports {
+		t.lossReports.add(r.Fraction, r.Interval)
+	}
+	if s.AvgPacketSize > 0 {
+		t.avgPacketSize = s.AvgPacketSize
+	}
+	t.slowStart = s.SlowStart
+	t.lossHistory = newLossIntervalHistory()
+	for i := len(s.LossIntervals) - 1; i >= 0; i-- {
+		t.lossHistory.closeInterval(s.LossIntervals[i])
+	}
+	t.lossHistory.open = s.OpenInterval
+	// the next report interval starts now, not when the snapshot was taken
+	t.lastLossReportTime = t.clock.Now()
+	t.publish(t.lastLossReportTime)
+	return nil
+}
+
+// MarshalState encodes the snapshot as JSON
+func (t *Tfrc) MarshalState() ([]byte, error) {
+	return json.Marshal(t.Snapshot())
+}
+
+// UnmarshalState restores a snapshot encoded by MarshalState
+func (t *Tfrc) UnmarshalState(data []byte) error {
+	var s Snapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("failed to decode TFRC snapshot: %w", err)
+	}
+	return t.Restore(s)
+}
@@ -0,0 +1,102 @@
+package tfrc
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTfrc_SnapshotRestore(t *testing.T) {
+	saved := New(1000, 500, 4000)
+	saved.currentBitrate = 2800
+	saved.smoothedRTT = 0.045
+	saved.avgPacketSize = 900
+	for _, rtt := range []float64{0.05, 0.047, 0.045} {
+		saved.smoothedRTTHistory.add(rtt)
+	}
+	saved.lossReports.add(0.01, 5*time.Second)
+	saved.lossReports.add(0, 5*time.Second)
+	saved.slowStart = false
+	saved.lossHistory.intervals = []float64{120, 80, 200}
+	saved.lossHistory.open = 40
+
+	data, err := saved.MarshalState()
+	if err != nil {
+		t.Fatalf("MarshalState() error = %v", err)
+	}
+
+	clock := &fixedClock{now: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)}
+	restored := NewWithClock(500, 500, 4000, clock)
+	restored.smoothedRTTHistory.add(0.3)
+	if err := restored.UnmarshalState(data); err != nil {
+		t.Fatalf("UnmarshalState() error = %v", err)
+	}
+
+	if got, want := restored.Snapshot(), saved.Snapshot(); !reflect.DeepEqual(got, want) {
+		t.Errorf("restored snapshot = %+v, want %+v", got, want)
+	}
+	if !restored.lastLossReportTime.Equal(clock.now) {
+		t.Errorf("lastLossReportTime = %v, want restore time %v", restored.lastLossReportTime, clock.now)
+	}
+	if got := restored.LossEventRate(); got != 0.005 {
+		t.Errorf("LossEventRate() = %v, want 0.005", got)
+	}
+	if restored.slowStart {
+		t.Error("restored controller is back in slow start")
+	}
+
+	// the first receiver report counters resume the restored loss intervals
+	restored.PreProcessLossCounters(clock.now, 10, 5000)
+	if got, want := restored.LossEventRate(), saved.lossHistory.lossEventRate(); got != want {
+		t.Errorf("LossEventRate() after the first RR = %v, want the saved interval history %v", got, want)
+	}
+}
+
+func TestTfrc_Restore(t *testing.T) {
+	tests := []struct {
+		name        string
+		snapshot    Snapshot
+		wantErr     error
+		wantBitrate int
+	}{
+		{
+			name:        "within limits",
+			snapshot:    Snapshot{Version: SnapshotVersion, CurrentBitrate: 3000, SmoothedRTT: 0.05},
+			wantBitrate: 3000,
+		},
+		{
+			name:        "clamped to the new max",
+			snapshot:    Snapshot{Version: SnapshotVersion, CurrentBitrate: 9000, SmoothedRTT: 0.05},
+			wantBitrate: 4000,
+		},
+		{
+			name:        "other version",
+			snapshot:    Snapshot{Version: SnapshotVersion + 1, CurrentBitrate: 3000, SmoothedRTT: 0.05},
+			wantErr:     ErrSnapshotVersion,
+			wantBitrate: 1000,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tfrc := New(1000, 500, 4000)
+			if err := tfrc.Restore(tt.snapshot); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Restore() error = %v, want %v", err, tt.wantErr)
+			}
+			if got := tfrc.State().Bitrate; got != tt.wantBitrate {
+				t.Errorf("bitrate = %d, want %d", got, tt.wantBitrate)
+			}
+		})
+	}
+
+	t.Run("invalid RTT", func(t *testing.T) {
+		if err := New(1000, 500, 4000).Restore(Snapshot{Version: SnapshotVersion}); err == nil {
+			t.Error("Restore() succeeded with a zero smoothed RTT")
+		}
+	})
+	t.Run("garbage", func(t *testing.T) {
+		if err := New(1000, 500, 4000).UnmarshalState([]byte("{")); err == nil {
+			t.Error("UnmarshalState() succeeded on truncated JSON")
+		}
+	})
+}
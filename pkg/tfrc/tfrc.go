@@ -1,22 +1,27 @@
 package tfrc
 
 import (
-	"fmt"
 	"math"
+	"sync"
 	"time"
+
+	"github.com/arsperger/slowcast/pkg/ratecontrol"
 )
 
 const (
 	maxSmoothedRTTReports = 10
 
 	// maxLossReports is the maximum number of loss reports to keep in the RFC8083 loss event window
-	// TODO: CB_INTERVAL = ceil(3*min(max(10*G*Tf, 10*Tr, 3*Tdr), max(15, 3*Td))/(3*Tdr)) as per RFC8083 4.2
+	// TODO: size by CB_INTERVAL = ceil(3*min(max(10*G*Tf, 10*Tr, 3*Tdr), max(15, 3*Td))/(3*Tdr)) as per RFC8083 4.2,
+	// the circuit breakers compute it in circuitbreaker.CircuitBreaker.Interval
 	maxLossReports = 10
-
-	ntpEpochOffset = 2208988800
 )
 
+// Tfrc is a TCP-Friendly Rate Control sender driven by RTCP receiver reports,
+// it is safe for concurrent use
 type Tfrc struct {
+	mu sync.Mutex
+
 	// TFRC parameters
 	smoothedRTT        float64
 	smoothedRTTHistory *smoothedRTTHistoryAccumulator
@@ -39,61 +44,137 @@ type Tfrc struct {
 	// RFC8083 loss event window
 	lossReports        *lossReportAccumulator
 	lastLossReportTime time.Time
+
+	// RFC5348 loss intervals from RR sequence counters
+	lossHistory *lossIntervalHistory
+
+	// delayTrend detects queues building from RTT samples and RR jitter
+	delayTrend *delayTrendDetector
+	// backoffRate is the delay back off of the delay sample backoffSample
+	backoffRate   int
+	backoffSample uint64
+
+	// jitter is the last interarrival jitter from an RR or XR Statistics Summary, RTP timestamp units
+	jitter uint32
+
+	// lossBursts are the burst and gap metrics of the last XR Loss RLE block
+	lossBursts ratecontrol.LossBursts
+
+	// remb holds the receiver estimated maximum bitrates limiting the rate
+	remb *rembLimits
+
+	// RFC5348 section 4.3 slow start until the first loss event, capped at 2*X_recv
+	slowStart    bool
+	lastDoubling time.Time
+	recvRate     *receiveRate
+
+	// probedKbps is a rate confirmed by a bandwidth probe at probedAt, it stays above the
+	// 2*X_recv cap until X_recv is measured over an interval after the probe
+	probedKbps int
+	probedAt   time.Time
+
+	// cfg is the tuning the controller was created with
+	cfg Config
+
+	// subscribers receive an Event when the published estimates change
+	subscribers []*subscriber
+	published   Event
+
+	// clock is the time source for RTT samples
+	clock ratecontrol.Clock
 }
 
+// New creates a TFRC controller with the default tuning, bitrates in Kbps, it panics on invalid limits
 func New(init, min, max int) *Tfrc { //nolint:predeclared
-	if init < min || init > max {
-		panic(fmt.Sprintf("Initial bitrate %d must be between min %d and max %d", init, min, max))
-	}
-	if min <= 0 || max <= 0 || init <= 0 {
-		panic(fmt.Sprintf("Bitrate limits must be positive: min %d, max %d", min, max))
-	}
-	if min > max {
-		panic(fmt.Sprintf("Min bitrate %d cannot be greater than max bitrate %d", min, max))
-	}
-	if init < 500 || min < 500 || max < 500 {
-		panic(fmt.Sprintf("Bitrate must be at least 500 Kbps: init %d, min %d, max %d", init, min, max))
-	}
-
-	currentBitrate := init
-	minBitrate := min
-	maxBitrate := max
+	return NewWithClock(init, min, max, ratecontrol.SystemClock{})
+}
 
-	smoothedRTTHistoryAccumulator := newSmoothedRTTHistoryAccumulator(maxSmoothedRTTReports)
-	if smoothedRTTHistoryAccumulator == nil {
-		panic("Failed to create smoothedRTTHistoryAccumulator")
+// NewWithClock creates a TFRC controller reading the time from clock, nil means the wall clock,
+// it panics on invalid limits
+func NewWithClock(init, min, max int, clock ratecontrol.Clock) *Tfrc { //nolint:predeclared
+	cfg := DefaultConfig(init, min, max)
+	cfg.Clock = clock
+	t, err := NewWithConfig(cfg)
+	if err != nil {
+		panic(err.Error())
 	}
+	return t
+}
 
-	lossReportAccumulator := newLossReportAccumulator(maxLossReports)
-	if lossReportAccumulator == nil {
-		panic("Failed to create lossReportAccumulator")
+// NewWithConfig creates a TFRC controller, an invalid config is returned as an error
+func NewWithConfig(cfg Config) (*Tfrc, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
 	}
+	clock := ratecontrol.ClockOrSystem(cfg.Clock)
 
-	return &Tfrc{
-		smoothedRTTHistory: smoothedRTTHistoryAccumulator,
+	t := &Tfrc{
+		smoothedRTTHistory: newSmoothedRTTHistoryAccumulator(cfg.RTTReports),
 		smoothedRTT:        0.1, // initial RTT estimate
-		ttrParamsAlpha:     0.2, // smoothing factor
-		avgPacketSize:      1200.0,
-		minBitrate:         minBitrate,
-		maxBitrate:         maxBitrate,
-		pSample:            0.0,                   // last fraction lost sample
-		rttSampe:           0.0,                   // last RTT sample
-		currentBitrate:     currentBitrate,        // initial bitrate in Kbps
-		lossReports:        lossReportAccumulator, // RFC8083 loss event window
-		lastLossReportTime: time.Now(),
+		ttrParamsAlpha:     cfg.Alpha,
+		avgPacketSize:      cfg.PacketSize,
+		minBitrate:         cfg.MinBitrate,
+		maxBitrate:         cfg.MaxBitrate,
+		pSample:            0.0,                                       // last fraction lost sample
+		rttSampe:           0.0,                                       // last RTT sample
+		currentBitrate:     cfg.InitBitrate,                           // initial bitrate in Kbps
+		lossReports:        newLossReportAccumulator(cfg.LossReports), // RFC8083 loss event window
+		lastLossReportTime: clock.Now(),
+		lossHistory:        newLossIntervalHistory(),
+		delayTrend:         &delayTrendDetector{},
+		slowStart:          true,
+		recvRate:           &receiveRate{},
+		remb:               newREMBLimits(),
+		cfg:                cfg,
+		clock:              clock,
 	}
+	t.published = t.event(clock.Now(), 0)
+	return t, nil
 }
 
 // PreProcessRTCP processes RTCP packets before computing bitrate
 func (t *Tfrc) PreProcessRTCP(now time.Time, lsr, delay uint32, fractionLost uint8) {
-	// 1. Compute RTT sample from LSR and delay
-	rttSampe := t.computeRTTSample(lsr, delay)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.preProcessRTCP(now, lsr, delay, fractionLost)
+	t.publish(now)
+}
+
+// preProcessRTCP reports whether the report carried an RTT sample
+func (t *Tfrc) preProcessRTCP(now time.Time, lsr, delay uint32, fractionLost uint8) bool {
+	// 1. Compute RTT sample from LSR and delay, samples not matching a sent SR are rejected
+	rttSampe, ok := t.computeRTTSample(lsr, delay)
 
 	// 2. Update smoothed RTT ring buffer
-	t.updateSmoothedRTT(rttSampe)
+	if ok {
+		t.updateSmoothedRTT(rttSampe)
+	}
 
 	// 3. compute loss event rate and record loss event
 	t.recordLossEvent(fractionLost, now)
+	return ok
+}
+
+// PreProcessLossCounters feeds the RR cumulative lost and extended highest sequence number
+// into the RFC5348 loss interval history and the receive rate X_recv
+func (t *Tfrc) PreProcessLossCounters(now time.Time, totalLost, highestSeq uint32) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.preProcessLossCounters(now, totalLost, highestSeq)
+	t.publish(now)
+}
+
+func (t *Tfrc) preProcessLossCounters(now time.Time, totalLost, highestSeq uint32) {
+	t.lossHistory.update(now, totalLost, highestSeq, t.smoothedRTT)
+	t.recvRate.update(now, totalLost, highestSeq, t.avgPacketSize)
+}
+
+// PreProcessDelay feeds the last RTT sample and the RR interarrival jitter
+// into the delay trend detector
+func (t *Tfrc) PreProcessDelay(now time.Time, jitter uint32) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.delayTrend.update(now, t.rttSampe, jitter)
 }
 
 // recordLossEvent appends fractionLost sample and interval
@@ -106,9 +187,28 @@ func (t *Tfrc) recordLossEvent(fractionLost uint8, now time.Time) {
 
 // GetLastFraction Return the last recorded fraction lost
 func (t *Tfrc) GetLastFraction() float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 	return t.pSample
 }
 
+// LossEventRate returns the RFC5348 loss event rate the throughput equation uses,
+// the RFC8083 fraction lost average until the receiver reports carried sequence counters
+func (t *Tfrc) LossEventRate() float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.lossEventRate()
+}
+
+// lossEventRate returns the RFC5348 loss event rate once the loss interval history
+// has seen sequence counters, and the RFC8083 fraction lost average before that
+func (t *Tfrc) lossEventRate() float64 {
+	if t.lossHistory.primed {
+		return t.lossHistory.lossEventRate()
+	}
+	return t.computeLossEventRate()
+}
+
 // computeLossEventRate calculates p via RFC8083 time-weighted average
 func (t *Tfrc) computeLossEventRate() float64 {
 	var num, den float64
@@ -145,28 +245,56 @@ func (t *Tfrc) computeRTTTrend() int {
 	}
 	oldAvg := oldSum / float64(half)
 	newAvg := newSum / float64(n-half)
-	// Thresholds ±20%
-	if newAvg > oldAvg*1.2 {
+	// Thresholds ±20% by default
+	if newAvg > oldAvg*t.cfg.TrendIncrease {
 		return 1
-	} else if newAvg < oldAvg*0.8 {
+	} else if newAvg < oldAvg*t.cfg.TrendDecrease {
 		return -1
 	}
 	return 0
 }
 
-// ComputeRTTSample computes RTT sample based on LSR and delay
-func (t *Tfrc) computeRTTSample(lsr, delay uint32) float64 {
-	now32 := nowMiddle32()
-	rtt := max(now32-(lsr+delay), 0)
-	t.rttSampe = float64(rtt) / 65536.0
-	return t.rttSampe
+// delayUsage returns the delay trend detector verdict, or the RTT history trend
+// until the detector has enough samples
+func (t *Tfrc) delayUsage() delayUsage {
+	if t.delayTrend.ready() {
+		return t.delayTrend.usage
+	}
+	switch t.computeRTTTrend() {
+	case 1:
+		return delayIncreasing
+	case -1:
+		return delayDecreasing
+	default:
+		return delayStable
+	}
+}
+
+// computeRTTSample computes RTT sample based on LSR and delay, matched against the sent
+// sender reports when they are recorded
+func (t *Tfrc) computeRTTSample(lsr, delay uint32) (float64, bool) {
+	rtt, ok := t.cfg.SenderReports.RTT(t.clock.Now(), lsr, delay)
+	if !ok {
+		return 0, false
+	}
+	t.rttSampe = rtt
+	return t.rttSampe, true
 }
 
 // GetRttSample returns the last RTT sample
 func (t *Tfrc) GetRttSample() float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 	return t.rttSampe
 }
 
+// ReceiveRate returns X_recv in Kbps, ok is false until two receiver reports carried counters
+func (t *Tfrc) ReceiveRate() (int, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.recvRate.kbps(), t.recvRate.valid
+}
+
 // updateSmoothedRTT applies exponential smoothing to the RTT sample
 // Smooth RTT: R <- 0.8·R + 0.2·RTT_sample (RTT_sample from LSR/DLSR)
 func (t *Tfrc) updateSmoothedRTT(rtt float64) {
@@ -176,79 +304,141 @@ func (t *Tfrc) updateSmoothedRTT(rtt float64) {
 
 // GetSmoothedRTT returns the current smoothed RTT
 func (t *Tfrc) GetSmoothedRTT() float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 	return t.smoothedRTT
 }
 
-// NowMiddle32 returns the "LSR"‐style 32‐bit value:
-// upper 16 bits = least significant 16 bits of seconds since NTP epoch
-// lower 16 bits = most significant 16 bits of the fractional second
-//
-//nolint:gosec
-func nowMiddle32() uint32 {
-	t := time.Now().UTC()
-	// Full seconds since NTP epoch
-	secs := uint64(t.Unix()) + ntpEpochOffset
-	// Full 32‐bit fraction of a second
-	frac := uint64(t.Nanosecond()) * (1 << 32) / 1e9
-
-	// Take low 16 bits of secs, high 16 bits of frac
-	secs16 := uint32(secs & 0xFFFF)
-	frac16 := uint32(frac >> 16)
-
-	return (secs16 << 16) | frac16
+// GetAvgPacketSize returns the packet size in bytes used by the throughput equation
+func (t *Tfrc) GetAvgPacketSize() float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.avgPacketSize
 }
 
 // ComputeTFRCBitrate computes the TFRC bitrate based on RFC 5348 and RFC 8083
 func (t *Tfrc) ComputeTFRCBitrate() int {
-	var trend int
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	rate := t.applyREMB(t.computeTFRCBitrate())
+	t.publish(t.clock.Now())
+	return rate
+}
 
+func (t *Tfrc) computeTFRCBitrate() int {
 	// TODO: #VOP-40 fmt.Printf("Current bitrate: %d Kbps\n", t.currentBitrate)
 
-	// 1. Calculate loss-event rate p via RFC8083
-	p := t.computeLossEventRate()
+	// 1. Calculate loss-event rate p via RFC5348 loss intervals
+	p := t.lossEventRate()
 	// TODO: #VOP-40 fmt.Printf("Loss event rate p=%.4f\n", p)
+	if p > 0 {
+		// the first loss event ends slow start
+		t.slowStart = false
+	}
 
 	// 2. Check if loss is zero
 	// TODO: #VOP-32 improve this approach: if RTT is stable/decreasing, cautiously increase bitrate 5%?
 	if p <= 0 {
-		trend = t.computeRTTTrend()
 		var target int
-		switch trend {
-		case 1:
+		switch t.delayUsage() {
+		case delayOverusing:
+			// standing queue: back off before it turns into loss
+			t.slowStart = false
+			return t.backOff()
+		case delayIncreasing:
 			// RTT increasing: hold current bitrate
 			// TODO: #VOP-40 fmt.Printf("RTT increasing, holding current bitrate: %d Kbps\n", t.currentBitrate)
 			return t.currentBitrate
-		case -1, 0:
+		case delayStable, delayDecreasing:
+			if t.slowStart && t.recvRate.valid {
+				return t.slowStartRate()
+			}
 			// RTT stable or decreasing: ramp toward ceiling
 			// TODO: #VOP-40 fmt.Printf("RTT stable or decreasing, ramping toward max bitrate: %d Kbps\n", t.maxBitrate)
 			target = t.maxBitrate
 		}
-		return t.smoothRate(t.currentBitrate, target)
+		return t.capToReceiveRate(t.smoothRate(t.currentBitrate, target))
 	}
 
-	// 3. Calculate RTO and terms
-	R := t.smoothedRTT //nolint:gocritic // alignment with RFC 5348
-	rto := 4 * R
-	term1 := R * math.Sqrt(2*p/3)
-	term2 := rto * (3 * math.Sqrt(3*p/8) * p * (1 + 32*p*p))
-	if term1+term2 <= 0 {
+	// 3-4. Throughput in bytes/sec
+	x := Throughput(t.avgPacketSize, t.smoothedRTT, p)
+	if x <= 0 {
 		// FIXME: we must never reach this point..
 		// TODO: VOP-40 fmt.Println("Invalid TFRC parameters, using current bitrate")
 		return t.currentBitrate
 	}
-	// fmt.Printf("RTT=%.3fs, p=%.4f, RTO=%.3fs, term1=%.4f, term2=%.4f\n", t.smoothedRTT, p, rto, term1, term2)
-
-	// 4. Throughput in bytes/sec
-	x := t.avgPacketSize / (term1 + term2)
 	// TODO: VOP-40 fmt.Printf("TFRC x=%.4f bytes/sec\n", x)
 	// Convert to Kbps
 	targetKbps := int(x * 8 / 1000)
 	// fmt.Printf("TFRC target=%d Kbps\n", targetKbps)
 
-	// TODO: 5. clamp targetKbps to min/max bitrate?
+	// 5. never above the delay-based back off while the queue is too long
+	if t.delayTrend.ready() && t.delayTrend.usage == delayOverusing {
+		targetKbps = min(targetKbps, t.delayBackoffRate())
+	}
+
+	// TODO: clamp targetKbps to min/max bitrate?
+
+	// 6. Smooth toward target, never above twice the rate the receiver got
+	return t.capToReceiveRate(t.smoothRate(t.currentBitrate, targetKbps))
+}
+
+// Throughput returns the RFC 5348 throughput equation in bytes/sec for packet size s in bytes,
+// round trip time R in seconds and loss event rate p, or 0 when the parameters give no bound
+func Throughput(s, R, p float64) float64 { //nolint:gocritic // alignment with RFC 5348
+	// Calculate RTO and terms
+	rto := 4 * R
+	term1 := R * math.Sqrt(2*p/3)
+	term2 := rto * (3 * math.Sqrt(3*p/8) * p * (1 + 32*p*p))
+	if term1+term2 <= 0 {
+		return 0
+	}
+	return s / (term1 + term2)
+}
+
+// slowStartRate doubles the rate at most once per RTT, RFC 5348 section 4.3
+func (t *Tfrc) slowStartRate() int {
+	now := t.clock.Now()
+	if now.Sub(t.lastDoubling).Seconds() < t.smoothedRTT {
+		return t.currentBitrate
+	}
+	t.lastDoubling = now
+	t.currentBitrate = min(2*t.currentBitrate, t.maxBitrate)
+	return t.capToReceiveRate(t.currentBitrate)
+}
 
-	// 6. Smooth toward target
-	return t.smoothRate(t.currentBitrate, targetKbps)
+// capToReceiveRate limits rate to 2*X_recv once the receive rate is known, the min bitrate
+// and a rate probed since the last X_recv interval still apply
+func (t *Tfrc) capToReceiveRate(rate int) int {
+	if t.recvRate.valid {
+		limit := 2 * t.recvRate.kbps()
+		if t.probedKbps > 0 {
+			if t.recvRate.from.Before(t.probedAt) {
+				limit = max(limit, t.probedKbps)
+			} else {
+				t.probedKbps = 0
+			}
+		}
+		rate = max(t.minBitrate, min(rate, limit))
+	}
+	t.currentBitrate = rate
+	return rate
+}
+
+// backOff applies the multiplicative decrease on delay overuse, the rate is held
+// until the next delay sample
+func (t *Tfrc) backOff() int {
+	t.currentBitrate = max(t.minBitrate, min(t.currentBitrate, t.delayBackoffRate()))
+	return t.currentBitrate
+}
+
+// delayBackoffRate returns the rate allowed under delay overuse, decreased once per new delay sample
+func (t *Tfrc) delayBackoffRate() int {
+	if t.backoffSample != t.delayTrend.updates {
+		t.backoffSample = t.delayTrend.updates
+		t.backoffRate = int(float64(t.currentBitrate) * delayBackoff)
+	}
+	return t.backoffRate
 }
 
 // smoothRate applies exponential smoothing toward target
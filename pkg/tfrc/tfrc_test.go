@@ -3,6 +3,10 @@ package tfrc
 import (
 	"testing"
 	"time"
+
+	"github.com/pion/rtcp"
+
+	"github.com/arsperger/slowcast/pkg/ratecontrol"
 )
 
 func TestNew(t *testing.T) {
@@ -118,9 +122,9 @@ func TestTfrc_PreProcessRTCP(t *testing.T) {
 
 	// Prepare RTCP data
 	now := time.Now()
-	var lsr uint32 = 0x12345678   // Example LSR value
-	var delay uint32 = 0x00001234 // Example delay value
-	var fractionLost uint8 = 25   // About 10% loss (25/256)
+	lsr := ratecontrol.NTPMiddle32(now.Add(-150 * time.Millisecond)) // SR sent 150ms ago
+	delay := uint32(50 * 65536 / 1000)                               // held 50ms by the receiver
+	var fractionLost uint8 = 25                                      // About 10% loss (25/256)
 
 	// Process RTCP data
 	tfrc.PreProcessRTCP(now, lsr, delay, fractionLost)
@@ -229,6 +233,10 @@ func TestTfrc_computeLossEventRate(t *testing.T) {
 	if abs(rate-expectedRate) > 0.001 {
 		t.Errorf("computeLossEventRate() = %v, want approximately %v", rate, expectedRate)
 	}
+
+	if got := tfrc.LossEventRate(); got != rate {
+		t.Errorf("LossEventRate() = %v, want %v", got, rate)
+	}
 }
 
 func TestTfrc_smoothRate(t *testing.T) {
@@ -323,82 +331,161 @@ func TestTfrc_ComputeTFRCBitrate(t *testing.T) {
 	})
 }
 
-func TestNowMiddle32(t *testing.T) {
-	// Test 1: Basic format check
-	val := nowMiddle32()
+type fixedClock struct {
+	now time.Time
+}
+
+func (c *fixedClock) Now() time.Time {
+	return c.now
+}
+
+func TestTfrc_NewWithClock(t *testing.T) {
+	clock := &fixedClock{now: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)}
+	tfrc := NewWithClock(1000, 500, 4000, clock)
 
-	// The value should be non-zero
-	if val == 0 {
-		t.Error("nowMiddle32() returned 0")
+	if !tfrc.lastLossReportTime.Equal(clock.now) {
+		t.Errorf("NewWithClock() lastLossReportTime = %v, want %v", tfrc.lastLossReportTime, clock.now)
 	}
 
-	// Test 2: Components should be 16 bits each
-	secs := (val >> 16)
-	frac := (val & 0xFFFF)
+	// SR sent 150ms ago, held 50ms by the receiver
+	lsr := ratecontrol.NTPMiddle32(clock.now.Add(-150 * time.Millisecond))
+	delay := uint32(50 * 65536 / 1000)
+	if got, ok := tfrc.computeRTTSample(lsr, delay); !ok || abs(got-0.1) > 0.001 {
+		t.Errorf("computeRTTSample() = %v, want 0.1", got)
+	}
 
-	if secs > 0xFFFF {
-		t.Errorf("Seconds component exceeds 16 bits: %d", secs)
+	if NewWithClock(1000, 500, 4000, nil).clock == nil {
+		t.Error("NewWithClock(nil) left the clock unset")
 	}
+}
 
-	if frac > 0xFFFF {
-		t.Errorf("Fraction component exceeds 16 bits: %d", frac)
+// Helper function for floating point comparison
+func abs(x float64) float64 {
+	if x < 0 {
+		return -x
 	}
+	return x
+}
 
-	// Test 3: Values should generally increase over time
-	time.Sleep(10 * time.Millisecond)
-	val2 := nowMiddle32()
-
-	// Calculate difference with potential wrap-around
-	diff := int64(val2) - int64(val)
-	if diff <= 0 {
-		// Only acceptable if we're at a 16-bit seconds boundary rollover
-		secs1 := val >> 16
-		secs2 := val2 >> 16
-		if secs1 != 0xFFFF || secs2 != 0 {
-			t.Errorf("nowMiddle32() did not increase as expected: %d -> %d", val, val2)
-		}
+func TestThroughput(t *testing.T) {
+	tests := []struct {
+		name string
+		s    float64
+		rtt  float64
+		p    float64
+		want float64
+	}{
+		{"no loss", 1200, 0.1, 0, 0},
+		{"no rtt", 1200, 0, 0.01, 0},
+		// 1200 / (0.1*sqrt(0.02/3) + 0.4*3*sqrt(0.03/8)*0.01*(1+32*0.0001))
+		{"1% loss 100ms", 1200, 0.1, 0.01, 134799},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Throughput(tt.s, tt.rtt, tt.p); abs(got-tt.want) > 1 {
+				t.Errorf("Throughput() = %.0f, want %.0f", got, tt.want)
+			}
+		})
 	}
+}
+
+func TestTfrc_slowStart(t *testing.T) {
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
 
-	// Test 4: Check a longer interval
-	time.Sleep(100 * time.Millisecond)
-	val3 := nowMiddle32()
-
-	// The value should increase noticeably over 100ms
-	diff = int64(val3) - int64(val2)
-	if diff <= 0 {
-		// Only acceptable if we're at a 16-bit seconds boundary rollover
-		secs2 := val2 >> 16
-		secs3 := val3 >> 16
-		if secs2 != 0xFFFF || secs3 != 0 {
-			t.Errorf("nowMiddle32() did not increase after 100ms: %d -> %d", val2, val3)
+	// primes the receive rate with xRecvKbps, in 1200 byte packets over one second, and a stable RTT
+	withReceiveRate := func(tfrc *Tfrc, xRecvKbps int) {
+		for range 3 {
+			tfrc.smoothedRTTHistory.add(0.1)
 		}
+		tfrc.PreProcessLossCounters(start, 0, 0)
+		tfrc.PreProcessLossCounters(start.Add(time.Second), 0, uint32(xRecvKbps*1000/8/1200)) //nolint:gosec
 	}
 
-	// Test 5: Verify value corresponds roughly to current time
-	currentTime := time.Now().UTC()
-	expectedSecs := uint64(currentTime.Unix()) + ntpEpochOffset
-	expectedSecs16 := uint32(expectedSecs & 0xFFFF)
+	t.Run("doubles once per RTT", func(t *testing.T) {
+		clock := &fixedClock{now: start}
+		tfrc := NewWithClock(1000, 500, 8000, clock)
+		withReceiveRate(tfrc, 1200)
 
-	// Allow small difference due to execution time
-	secsDiff := absDiff(secs, expectedSecs16)
-	if secsDiff > 1 {
-		t.Errorf("Seconds component doesn't match current time: got %d, expected ~%d",
-			secs, expectedSecs16)
-	}
+		if got := tfrc.ComputeTFRCBitrate(); got != 2000 {
+			t.Errorf("first doubling = %d, want 2000", got)
+		}
+		clock.now = clock.now.Add(50 * time.Millisecond)
+		if got := tfrc.ComputeTFRCBitrate(); got != 2000 {
+			t.Errorf("within one RTT = %d, want 2000", got)
+		}
+	})
+
+	t.Run("capped at twice the receive rate", func(t *testing.T) {
+		tfrc := NewWithClock(2000, 500, 8000, &fixedClock{now: start})
+		withReceiveRate(tfrc, 1200)
+
+		// 2*X_recv with 125 packets of 1200 bytes per second
+		if got := tfrc.ComputeTFRCBitrate(); got != 2400 {
+			t.Errorf("ComputeTFRCBitrate() = %d, want 2400", got)
+		}
+	})
+
+	t.Run("no overshoot after a quiet period", func(t *testing.T) {
+		tfrc := NewWithClock(4000, 500, 8000, &fixedClock{now: start})
+		withReceiveRate(tfrc, 4000)
+		tfrc.slowStart = false
+		tfrc.PreProcessLossCounters(start.Add(6*time.Second), 0, uint32(4000*1000/8/1200)+10)
+
+		if got := tfrc.ComputeTFRCBitrate(); got != 500 {
+			t.Errorf("ComputeTFRCBitrate() = %d, want the 500 Kbps min", got)
+		}
+	})
+
+	t.Run("first loss event ends slow start", func(t *testing.T) {
+		tfrc := NewWithClock(1000, 500, 8000, &fixedClock{now: start})
+		withReceiveRate(tfrc, 1000)
+		tfrc.PreProcessLossCounters(start.Add(2*time.Second), 5, 200)
+
+		if got := tfrc.ComputeTFRCBitrate(); got >= 2000 {
+			t.Errorf("ComputeTFRCBitrate() = %d, want no doubling after loss", got)
+		}
+		if tfrc.slowStart {
+			t.Error("slow start still active after a loss event")
+		}
+	})
 }
 
-// Helper function for absolute difference
-func absDiff(a, b uint32) uint32 {
-	if a > b {
-		return a - b
+func TestTfrc_senderReportHistory(t *testing.T) {
+	clock := &fixedClock{now: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)}
+	history := ratecontrol.NewSenderReportHistory(ratecontrol.DefaultSenderReportAge)
+	history.OnSenderReport(clock.now, &rtcp.SenderReport{SSRC: 1, NTPTime: ratecontrol.NTPTime(clock.now)})
+	lsr := ratecontrol.NTPMiddle32(clock.now)
+
+	cfg := DefaultConfig(1000, 500, 4000)
+	cfg.Clock = clock
+	cfg.SenderReports = history
+	tfrc, err := NewWithConfig(cfg)
+	if err != nil {
+		t.Fatalf("NewWithConfig() error = %v", err)
 	}
-	return b - a
-}
+	clock.now = clock.now.Add(150 * time.Millisecond)
+	delay := uint32(50 * 65536 / 1000)
 
-// Helper function for floating point comparison
-func abs(x float64) float64 {
-	if x < 0 {
-		return -x
+	tests := []struct {
+		name    string
+		lsr     uint32
+		wantRTT float64
+	}{
+		{"matching SR", lsr, 0.1},
+		{"unknown SR keeps the last sample", lsr - 65536, 0.1},
+		{"no SR keeps the last sample", 0, 0.1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tfrc.OnRTCP(clock.now, &rtcp.ReceiverReport{Reports: []rtcp.ReceptionReport{{
+				SSRC: 1, LastSenderReport: tt.lsr, Delay: delay,
+			}}})
+			if got := tfrc.GetRttSample(); abs(got-tt.wantRTT) > 0.001 {
+				t.Errorf("RTT sample = %v, want %v", got, tt.wantRTT)
+			}
+		})
+	}
+	if got := tfrc.smoothedRTTHistory.len(); got != 1 {
+		t.Errorf("smoothed RTT history has %d samples, want only the matching one", got)
 	}
-	return x
 }
@@ -0,0 +1,51 @@
+package tfrc
+
+import (
+	"time"
+
+	"github.com/pion/rtcp"
+
+	"github.com/arsperger/slowcast/pkg/ratecontrol"
+)
+
+// onExtendedReport feeds the RFC 3611 blocks of an XR packet: Loss RLE into the loss interval
+// history and the burst metrics, Statistics Summary jitter into the delay trend and DLRR
+// answering a sent reference time into the RTT. Receiver Reference Time blocks ask the sender for a DLRR and carry nothing for it
+func (t *Tfrc) onExtendedReport(now time.Time, xr *rtcp.ExtendedReport) {
+	for _, block := range xr.Reports {
+		switch b := block.(type) {
+		case *rtcp.LossRLEReportBlock:
+			pattern := ratecontrol.DecodeLossRLE(b)
+			t.lossBursts = ratecontrol.AnalyzeLoss(pattern, ratecontrol.DefaultGmin)
+			t.lossHistory.addPattern(pattern, t.packetsPerRTT())
+		case *rtcp.StatisticsSummaryReportBlock:
+			if b.JitterReports {
+				// the deviation widens the delay trend threshold like a larger RR jitter would
+				t.jitter = b.MeanJitter + b.DevJitter
+			}
+		case *rtcp.DLRRReportBlock:
+			for _, report := range b.Reports {
+				rtt, ok := t.cfg.ReferenceTimes.DLRR(now, report)
+				if !ok {
+					continue
+				}
+				t.rttSampe = rtt
+				t.updateSmoothedRTT(rtt)
+				t.delayTrend.update(now, rtt, t.jitter)
+			}
+		}
+	}
+}
+
+// packetsPerRTT returns the packets sent in one smoothed RTT at the current rate, at least one
+func (t *Tfrc) packetsPerRTT() float64 {
+	bytesPerSec := float64(t.currentBitrate) * 1000 / 8
+	return max(1, bytesPerSec*t.smoothedRTT/t.avgPacketSize)
+}
+
+// LossBursts returns the burst and gap metrics of the last XR Loss RLE block
+func (t *Tfrc) LossBursts() ratecontrol.LossBursts {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.lossBursts
+}
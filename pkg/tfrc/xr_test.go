@@ -0,0 +1,163 @@
+package tfrc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pion/rtcp"
+
+	"github.com/arsperger/slowcast/pkg/ratecontrol"
+)
+
+// lossPattern builds a loss pattern from a string of '.' received and 'x' lost packets
+func lossPattern(begin uint16, s string) ratecontrol.LossPattern {
+	p := ratecontrol.LossPattern{BeginSeq: begin, Step: 1}
+	for _, c := range s {
+		p.Received = append(p.Received, c == '.')
+	}
+	return p
+}
+
+func TestLossIntervalHistory_AddPattern(t *testing.T) {
+	tests := []struct {
+		name          string
+		patterns      []ratecontrol.LossPattern
+		packetsPerRTT float64
+		wantIntervals []float64
+		wantOpen      float64
+	}{
+		{
+			name:          "no loss",
+			patterns:      []ratecontrol.LossPattern{lossPattern(0, "..........")},
+			packetsPerRTT: 4,
+			wantOpen:      10,
+		},
+		{
+			name:          "losses within one RTT are one event",
+			patterns:      []ratecontrol.LossPattern{lossPattern(0, "....x.x.x...")},
+			packetsPerRTT: 5,
+			wantIntervals: []float64{4},
+			wantOpen:      8,
+		},
+		{
+			name:          "losses an RTT apart close an interval",
+			patterns:      []ratecontrol.LossPattern{lossPattern(0, "..x.....x...")},
+			packetsPerRTT: 3,
+			wantIntervals: []float64{6, 2},
+			wantOpen:      4,
+		},
+		{
+			name: "overlapping blocks are counted once",
+			patterns: []ratecontrol.LossPattern{
+				lossPattern(100, "..x..."),
+				lossPattern(103, "...x.."),
+				lossPattern(100, "..x..."),
+			},
+			packetsPerRTT: 2,
+			wantIntervals: []float64{4, 2},
+			wantOpen:      3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newLossIntervalHistory()
+			for _, p := range tt.patterns {
+				h.addPattern(p, tt.packetsPerRTT)
+			}
+			if len(h.intervals) != len(tt.wantIntervals) {
+				t.Fatalf("intervals = %v, want %v", h.intervals, tt.wantIntervals)
+			}
+			for i := range tt.wantIntervals {
+				if h.intervals[i] != tt.wantIntervals[i] {
+					t.Errorf("intervals = %v, want %v", h.intervals, tt.wantIntervals)
+				}
+			}
+			if h.open != tt.wantOpen {
+				t.Errorf("open = %v, want %v", h.open, tt.wantOpen)
+			}
+		})
+	}
+}
+
+func TestTfrc_ExtendedReport(t *testing.T) {
+	clock := &fixedClock{now: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)}
+	tfrc := NewWithClock(1000, 500, 4000, clock)
+	sentAt := clock.now.Add(-150 * time.Millisecond)
+	tfrc.cfg.ReferenceTimes = ratecontrol.NewSenderReportHistory(ratecontrol.DefaultSenderReportAge)
+	tfrc.cfg.ReferenceTimes.OnReferenceTime(sentAt, 1, ratecontrol.NTPTime(sentAt))
+
+	// DLRR answering a reference time sent 150ms ago, held 50ms by the receiver
+	lastRR := ratecontrol.NTPMiddle32(sentAt)
+	tfrc.OnRTCP(clock.now, &rtcp.ExtendedReport{SenderSSRC: 2, Reports: []rtcp.ReportBlock{
+		&rtcp.DLRRReportBlock{Reports: []rtcp.DLRRReport{{SSRC: 1, LastRR: lastRR, DLRR: 3277}}},
+	}})
+	if got := tfrc.GetRttSample(); got < 0.099 || got > 0.101 {
+		t.Errorf("RTT sample after DLRR = %v, want 0.1", got)
+	}
+
+	// jitter of the statistics summary
+	tfrc.OnRTCP(clock.now, &rtcp.ExtendedReport{SenderSSRC: 2, Reports: []rtcp.ReportBlock{
+		&rtcp.StatisticsSummaryReportBlock{SSRC: 1, JitterReports: true, MeanJitter: 900, DevJitter: 90},
+	}})
+	if tfrc.jitter != 990 {
+		t.Errorf("jitter after statistics summary = %d, want 990", tfrc.jitter)
+	}
+
+	// a burst of losses, then RR counters no longer drive the loss intervals
+	tfrc.OnRTCP(clock.now, &rtcp.ExtendedReport{SenderSSRC: 2, Reports: []rtcp.ReportBlock{
+		&rtcp.LossRLEReportBlock{SSRC: 1, BeginSeq: 0, EndSeq: 200, Chunks: []rtcp.Chunk{
+			0x4000 | 100, // 100 received
+			4,            // 4 lost
+			0x4000 | 96,  // 96 received
+		}},
+	}})
+	bursts := tfrc.LossBursts()
+	if bursts.Lost != 4 || bursts.Bursts != 1 || bursts.BurstLossShare() != 1 {
+		t.Errorf("LossBursts() = %+v, want one burst of 4 losses", bursts)
+	}
+	if len(tfrc.lossHistory.intervals) != 1 || tfrc.lossHistory.intervals[0] != 100 {
+		t.Errorf("loss intervals = %v, want [100]", tfrc.lossHistory.intervals)
+	}
+
+	tfrc.PreProcessLossCounters(clock.now, 0, 1000)
+	tfrc.PreProcessLossCounters(clock.now.Add(time.Second), 50, 2000)
+	if len(tfrc.lossHistory.intervals) != 1 {
+		t.Errorf("loss intervals after RR counters = %v, want unchanged", tfrc.lossHistory.intervals)
+	}
+}
+
+func TestTfrc_DLRRMatchesReferenceTime(t *testing.T) {
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	history := ratecontrol.NewSenderReportHistory(ratecontrol.DefaultSenderReportAge)
+	history.OnReferenceTime(start, 1, ratecontrol.NTPTime(start))
+	lastRR := ratecontrol.NTPMiddle32(start)
+
+	tests := []struct {
+		name    string
+		history *ratecontrol.SenderReportHistory
+		report  rtcp.DLRRReport
+		at      time.Duration
+		wantRTT float64
+	}{
+		{"matching reference time", history, rtcp.DLRRReport{SSRC: 1, LastRR: lastRR, DLRR: 3277}, 150 * time.Millisecond, 0.1},
+		{"forged LastRR", history, rtcp.DLRRReport{SSRC: 1, LastRR: lastRR + 1, DLRR: 3277}, 150 * time.Millisecond, 0},
+		{"sub-block of another SSRC", history, rtcp.DLRRReport{SSRC: 2, LastRR: lastRR, DLRR: 3277}, 150 * time.Millisecond, 0},
+		{"stale LastRR", history, rtcp.DLRRReport{SSRC: 1, LastRR: lastRR, DLRR: 3277}, 2 * time.Minute, 0},
+		{"no reference time sent", nil, rtcp.DLRRReport{SSRC: 1, LastRR: lastRR, DLRR: 3277}, 150 * time.Millisecond, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := &fixedClock{now: start.Add(tt.at)}
+			tfrc := NewWithClock(1000, 500, 4000, clock)
+			tfrc.cfg.ReferenceTimes = tt.history
+			tfrc.OnRTCP(clock.now, &rtcp.ExtendedReport{SenderSSRC: 2, Reports: []rtcp.ReportBlock{
+				&rtcp.DLRRReportBlock{Reports: []rtcp.DLRRReport{tt.report}},
+			}})
+			if got := tfrc.GetRttSample(); got < tt.wantRTT-0.001 || got > tt.wantRTT+0.001 {
+				t.Errorf("RTT sample after DLRR = %v, want %v", got, tt.wantRTT)
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/go-gst/go-gst/gst"
+	"github.com/go-gst/go-gst/gst/app"
+	"github.com/pion/rtcp"
+
+	"github.com/arsperger/slowcast/pkg/probe"
+	"github.com/arsperger/slowcast/pkg/ratecontrol"
+)
+
+const (
+	// maxSendWait bounds how long a packet is held waiting for the congestion window
+	maxSendWait = 200 * time.Millisecond
+
+	// probePacingInterval is how often the due probe packets are pushed
+	probePacingInterval = time.Millisecond
+)
+
+// forEachBuffer calls f for the buffer or every buffer of the list carried by a probe
+func forEachBuffer(info *gst.PadProbeInfo, f func(buf *gst.Buffer)) {
+	if info.Type()&gst.PadProbeTypeBuffer != 0 {
+		f(info.GetBuffer())
+	}
+	if info.Type()&gst.PadProbeTypeBufferList != 0 {
+		info.GetBufferList().ForEach(func(buf *gst.Buffer, _ uint) bool {
+			f(buf)
+			return true
+		})
+	}
+}
+
+// addSendProbe reports every RTP packet leaving rtpsession to the packet observer
+func (s *SlowCast) addSendProbe(pad *gst.Pad, observer ratecontrol.PacketObserver) {
+	pad.AddProbe(gst.PadProbeTypeBuffer|gst.PadProbeTypeBufferList,
+		func(_ *gst.Pad, info *gst.PadProbeInfo) gst.PadProbeReturn {
+			now := time.Now()
+			forEachBuffer(info, func(buf *gst.Buffer) {
+				s.onRTPSent(now, buf.Bytes(), observer)
+			})
+			return gst.PadProbeOK
+		})
+}
+
+func (s *SlowCast) onRTPSent(now time.Time, data []byte, observer ratecontrol.PacketObserver) {
+	pkt, err := ratecontrol.ParseRTP(now, data, twccExtensionID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "RTP parse error: %v\n", err)
+		return
+	}
+	observer.OnPacketSent(pkt)
+}
+
+// addSenderReportProbe records every sender report leaving rtpsession, receiver report LSRs
+// are matched against them for exact RTT samples
+func (s *SlowCast) addSenderReportProbe(pad *gst.Pad) {
+	pad.AddProbe(gst.PadProbeTypeBuffer|gst.PadProbeTypeBufferList,
+		func(_ *gst.Pad, info *gst.PadProbeInfo) gst.PadProbeReturn {
+			now := time.Now()
+			forEachBuffer(info, func(buf *gst.Buffer) {
+				s.onRTCPSent(now, buf.Bytes())
+			})
+			return gst.PadProbeOK
+		})
+}
+
+func (s *SlowCast) onRTCPSent(now time.Time, data []byte) {
+	pkts, err := rtcp.Unmarshal(data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Sent RTCP unmarshal error: %v\n", err)
+		return
+	}
+	for _, pkt := range pkts {
+		if sr, ok := pkt.(*rtcp.SenderReport); ok {
+			s.senderReports.OnSenderReport(now, sr)
+		}
+	}
+}
+
+// addQueueProbes mirrors the RTP queue into the limiter, drops the packets it discards at the
+// queue output and holds the others until the congestion window has room for them
+func (s *SlowCast) addQueueProbes(queue *gst.Element, limiter ratecontrol.SendLimiter) error {
+	sinkPad := queue.GetStaticPad("sink")
+	if sinkPad == nil {
+		return fmt.Errorf("failed to get RTP queue sink pad")
+	}
+	srcPad := queue.GetStaticPad("src")
+	if srcPad == nil {
+		return fmt.Errorf("failed to get RTP queue src pad")
+	}
+
+	sinkPad.AddProbe(gst.PadProbeTypeBuffer|gst.PadProbeTypeBufferList,
+		func(_ *gst.Pad, info *gst.PadProbeInfo) gst.PadProbeReturn {
+			now := time.Now()
+			forEachBuffer(info, func(buf *gst.Buffer) {
+				if pkt, err := ratecontrol.ParseRTP(now, buf.Bytes(), 0); err == nil {
+					limiter.OnPacketQueued(now, pkt.SSRC, pkt.SequenceNumber, pkt.Size)
+				}
+			})
+			return gst.PadProbeOK
+		})
+
+	srcPad.AddProbe(gst.PadProbeTypeBuffer|gst.PadProbeTypeBufferList,
+		func(_ *gst.Pad, info *gst.PadProbeInfo) gst.PadProbeReturn {
+			now := time.Now()
+			keep := true
+			forEachBuffer(info, func(buf *gst.Buffer) {
+				pkt, err := ratecontrol.ParseRTP(now, buf.Bytes(), 0)
+				if err == nil && !limiter.OnPacketDequeued(now, pkt.SSRC, pkt.SequenceNumber) {
+					keep = false
+				}
+			})
+			if !keep {
+				// the packets of a list were queued together and are discarded together
+				return gst.PadProbeDrop
+			}
+
+			// blocks the queue streaming thread, packets keep piling up in the queue meanwhile
+			deadline := time.Now().Add(maxSendWait)
+			for !limiter.CanSend(time.Now()) && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond)
+			}
+			return gst.PadProbeOK
+		})
+	return nil
+}
+
+// runProbePacer pushes the due bandwidth probing packets into the probe appsrc
+func (s *SlowCast) runProbePacer(ctx context.Context, src *app.Source) {
+	ticker := time.NewTicker(probePacingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			for {
+				pkt, ok := s.prober.NextPacket(now)
+				if !ok {
+					break
+				}
+				if ret := src.PushBuffer(gst.NewBufferFromBytes(pkt)); ret != gst.FlowOK {
+					fmt.Fprintf(os.Stderr, "Probe push error: %v\n", ret)
+				}
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// mediaOnly hides the bandwidth probing padding from an observer measuring the media packets
+type mediaOnly struct {
+	observer ratecontrol.PacketObserver
+}
+
+// OnPacketSent forwards every packet but the probes
+func (m mediaOnly) OnPacketSent(pkt ratecontrol.SentPacket) {
+	if pkt.SSRC == probeSSRC {
+		return
+	}
+	m.observer.OnPacketSent(pkt)
+}
+
+// onProbeResult logs a probe cluster and lets the controller jump to a confirmed rate
+func (s *SlowCast) onProbeResult(now time.Time, result probe.Result) {
+	logEntry := map[string]interface{}{
+		"type":      "probe_result",
+		"cluster":   result.ClusterID,
+		"target":    result.TargetKbps,
+		"delivered": result.DeliveredKbps,
+		"confirmed": result.Confirmed,
+	}
+	if jsonEntry, err := json.Marshal(logEntry); err == nil {
+		fmt.Println(string(jsonEntry))
+	}
+	if !result.Confirmed {
+		return
+	}
+	if consumer, ok := s.controller.(ratecontrol.ProbeConsumer); ok {
+		consumer.OnProbeResult(now, result.DeliveredKbps)
+	}
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/pion/rtcp"
+)
+
+// logREMB logs an RTCP_REMB entry, the controller applies the estimate with the REMB policy
+func logREMB(elapsed float64, remb *rtcp.ReceiverEstimatedMaximumBitrate) {
+	logEntry := map[string]interface{}{
+		"type":     "RTCP_REMB",
+		"receiver": remb.SenderSSRC,
+		"elapsed":  fmt.Sprintf("%.3f", elapsed),
+		"bitrate":  int(remb.Bitrate / 1000),
+		"ssrcs":    remb.SSRCs,
+	}
+	if jsonEntry, err := json.Marshal(logEntry); err == nil {
+		fmt.Println(string(jsonEntry))
+	}
+}
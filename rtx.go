@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"time"
+
+	"github.com/go-gst/go-gst/gst"
+	"github.com/pion/rtcp"
+
+	"github.com/arsperger/slowcast/pkg/rtx"
+)
+
+// retransmissionRequest is the upstream event rtpsession and the RTCP listener send rtprtxsend
+const retransmissionRequest = "GstRTPRetransmissionRequest"
+
+// setupRTX enables RFC 4588 retransmissions using at most maxShare of the target bitrate,
+// with random media and RTX SSRCs that are logged for the receiver
+func (s *SlowCast) setupRTX(maxShare float64) error {
+	mediaSSRC, rtxSSRC := rand.Uint32(), rand.Uint32()
+	for mediaSSRC == probeSSRC || rtxSSRC == probeSSRC || rtxSSRC == mediaSSRC {
+		mediaSSRC, rtxSSRC = rand.Uint32(), rand.Uint32()
+	}
+	cfg := rtx.DefaultConfig(mediaSSRC, rtxSSRC)
+	cfg.MaxShare = maxShare
+	if s.fec != nil {
+		// the media reaches rtprtxsend wrapped in RED
+		cfg.MediaPayloadType = s.fec.Config().REDPayloadType
+	}
+	retransmitter, err := rtx.New(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create retransmitter: %w", err)
+	}
+	retransmitter.OnBitrate(s.bitrate())
+	s.rtx = retransmitter
+
+	logEntry := map[string]interface{}{
+		"type":     "rtx",
+		"ssrc":     cfg.MediaSSRC,
+		"pt":       cfg.MediaPayloadType,
+		"rtx_ssrc": cfg.SSRC,
+		"rtx_pt":   cfg.PayloadType,
+		"sdp":      cfg.SDP(),
+	}
+	if jsonEntry, err := json.Marshal(logEntry); err == nil {
+		fmt.Println(string(jsonEntry))
+	}
+	return nil
+}
+
+// newRTXSender creates the rtprtxsend element keeping the sent media packets, retransmission
+// requests reaching it from rtpsession or the RTCP listener are only let through within the budget
+func (s *SlowCast) newRTXSender() (*gst.Element, error) {
+	cfg := s.rtx.Config()
+	rtxSend, err := gst.NewElementWithProperties("rtprtxsend", map[string]interface{}{
+		"name": "rtxsend",
+		"payload-type-map": gst.NewStructureFromString(
+			fmt.Sprintf("application/x-rtp-pt-map, %d=(uint)%d", cfg.MediaPayloadType, cfg.PayloadType)),
+		"ssrc-map": gst.NewStructureFromString(
+			fmt.Sprintf("application/x-rtp-ssrc-map, %d=(uint)%d", cfg.MediaSSRC, cfg.SSRC)),
+		"max-size-time": uint(cfg.MaxAge.Milliseconds()), //nolint:gosec
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create rtprtxsend: %w", err)
+	}
+
+	srcPad := rtxSend.GetStaticPad("src")
+	if srcPad == nil {
+		return nil, fmt.Errorf("failed to get rtprtxsend src pad")
+	}
+	srcPad.AddProbe(gst.PadProbeTypeEventUpstream,
+		func(_ *gst.Pad, info *gst.PadProbeInfo) gst.PadProbeReturn {
+			ssrc, seq, ok := parseRetransmissionRequest(info.GetEvent())
+			if !ok || s.rtx.Allow(time.Now(), ssrc, seq) {
+				return gst.PadProbeOK
+			}
+			return gst.PadProbeDrop
+		})
+	return rtxSend, nil
+}
+
+// parseRetransmissionRequest returns the packet a retransmission request event asks for
+func parseRetransmissionRequest(ev *gst.Event) (uint32, uint16, bool) {
+	if ev == nil || ev.Type() != gst.EventTypeCustomUpstream {
+		return 0, 0, false
+	}
+	st := ev.GetStructure()
+	if st == nil || st.Name() != retransmissionRequest {
+		return 0, 0, false
+	}
+	ssrc, err := st.GetValue("ssrc")
+	if err != nil {
+		return 0, 0, false
+	}
+	seq, err := st.GetValue("seqnum")
+	if err != nil {
+		return 0, 0, false
+	}
+	ssrcUint, ok := ssrc.(uint)
+	if !ok {
+		return 0, 0, false
+	}
+	seqUint, ok := seq.(uint)
+	if !ok {
+		return 0, 0, false
+	}
+	return uint32(ssrcUint), uint16(seqUint), true //nolint:gosec
+}
+
+// onNack asks rtprtxsend to retransmit the packets of a Generic NACK and logs an RTCP_NACK entry
+func (s *SlowCast) onNack(now time.Time, elapsed float64, nack *rtcp.TransportLayerNack) {
+	var seqs []uint16
+	for i := range nack.Nacks {
+		seqs = append(seqs, nack.Nacks[i].PacketList()...)
+	}
+	logEntry := map[string]interface{}{
+		"type":      "RTCP_NACK",
+		"receiver":  nack.SenderSSRC,
+		"SSRC":      nack.MediaSSRC,
+		"elapsed":   fmt.Sprintf("%.3f", elapsed),
+		"requested": len(seqs),
+	}
+
+	if s.rtx != nil {
+		before := s.rtx.Stats()
+		s.requestRetransmissions(nack.MediaSSRC, seqs)
+		after := s.rtx.Stats()
+		logEntry["retransmitted"] = after.Retransmitted - before.Retransmitted
+		logEntry["over_budget"] = after.OverBudget - before.OverBudget
+		logEntry["rtx_rate"] = s.rtx.RateKbps(now)
+	}
+
+	if jsonEntry, err := json.Marshal(logEntry); err == nil {
+		fmt.Println(string(jsonEntry))
+	}
+}
+
+// requestRetransmissions sends rtprtxsend a retransmission request per sequence number
+func (s *SlowCast) requestRetransmissions(ssrc uint32, seqs []uint16) {
+	rtxSend, err := s.stream.GetElementByName("rtxsend")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "rtprtxsend element lookup error: %v\n", err)
+		return
+	}
+	srcPad := rtxSend.GetStaticPad("src")
+	if srcPad == nil {
+		fmt.Fprintf(os.Stderr, "Failed to get rtprtxsend src pad\n")
+		return
+	}
+	for _, seq := range seqs {
+		st := gst.NewStructure(retransmissionRequest)
+		if err := st.SetValue("ssrc", uint(ssrc)); err != nil {
+			fmt.Fprintf(os.Stderr, "Retransmission request error: %v\n", err)
+			return
+		}
+		if err := st.SetValue("seqnum", uint(seq)); err != nil {
+			fmt.Fprintf(os.Stderr, "Retransmission request error: %v\n", err)
+			return
+		}
+		srcPad.SendEvent(gst.NewCustomEvent(gst.EventTypeCustomUpstream, st))
+	}
+}
@@ -3,19 +3,36 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"net"
 	"os"
 	"os/signal"
 	"strconv"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/go-gst/go-glib/glib"
 	"github.com/go-gst/go-gst/gst"
+	"github.com/go-gst/go-gst/gst/app"
 	"github.com/pion/rtcp"
 
+	"github.com/arsperger/slowcast/pkg/aggregate"
+	"github.com/arsperger/slowcast/pkg/circuitbreaker"
+	"github.com/arsperger/slowcast/pkg/encoder"
+	"github.com/arsperger/slowcast/pkg/fec"
+	"github.com/arsperger/slowcast/pkg/gcc"
+	"github.com/arsperger/slowcast/pkg/keyframe"
+	"github.com/arsperger/slowcast/pkg/ladder"
+	"github.com/arsperger/slowcast/pkg/nada"
+	"github.com/arsperger/slowcast/pkg/probe"
+	"github.com/arsperger/slowcast/pkg/ratecontrol"
+	"github.com/arsperger/slowcast/pkg/rtx"
+	"github.com/arsperger/slowcast/pkg/scream"
+	"github.com/arsperger/slowcast/pkg/source"
+	"github.com/arsperger/slowcast/pkg/statestore"
 	"github.com/arsperger/slowcast/pkg/tfrc"
 )
 
@@ -23,17 +40,55 @@ const (
 	appName    = "SlowCast"
 	appVersion = "0.1.0"
 	appDesc    = "Adaptive bitrate video streaming with TFRC"
+
+	// twccExtensionID is the RTP header extension id of the transport-wide sequence number
+	twccExtensionID = 1
+
+	// probeSSRC is the SSRC of the bandwidth probing padding packets
+	probeSSRC = 0x50524F42
+
+	// rtcpInterval is the minimum RTCP interval of rtpsession, the circuit breakers use it as Td
+	rtcpInterval = 5 * time.Second
+
+	// stateSaveInterval is how often the controller state is persisted while streaming
+	stateSaveInterval = 10 * time.Second
 )
 
 type SlowCast struct {
-	minBitrate     int
-	maxBitrate     int
+	minBitrate int
+	maxBitrate int
+
+	// applyMu serializes the bitrate changes of the RTCP and circuit breaker goroutines, so the
+	// encoder, ladder, RTX and FEC shares are updated in one order
+	applyMu sync.Mutex
+	// rateMu guards currentBitrate and lastChange, written from the RTCP and circuit breaker goroutines
+	rateMu         sync.Mutex
 	currentBitrate int
 	lastChange     time.Time
+
 	changeInterval time.Duration
 	stream         *gst.Pipeline
 	mainLoop       *glib.MainLoop
 	debugEnabled   bool
+	controller     ratecontrol.RateController
+	breakers       *circuitbreaker.Group
+	prober         *probe.Prober
+	rtx            *rtx.Retransmitter
+	keyframes      *keyframe.Limiter
+	fec            *fec.Redundancy
+	ladder         *ladder.Ladder
+	encoder        encoder.Backend
+	source         *source.Source
+	sendMeter      *ratecontrol.SendMeter
+	sentHistory    *ratecontrol.SentHistory
+	senderReports  *ratecontrol.SenderReportHistory
+	referenceTimes *ratecontrol.SenderReportHistory
+	stateStore     *statestore.Store
+	stateKey       string
+	controllerName string
+
+	// xrReferenceTime sends XR Receiver Reference Time blocks to the receivers for DLRR RTT samples
+	xrReferenceTime bool
 }
 
 // TODO: configurable
@@ -47,7 +102,281 @@ func (s *SlowCast) MakeSlowCast(debug bool) *SlowCast {
 		stream:         nil,
 		mainLoop:       nil,
 		debugEnabled:   debug,
+		controller:     nil,
+		breakers:       nil,
+		prober:         nil,
+		rtx:            nil,
+		keyframes:      nil,
+		fec:            nil,
+		ladder:         nil,
+		encoder:        encoder.DefaultBackend(),
+		source:         nil,
+		sendMeter:      ratecontrol.NewSendMeter(ratecontrol.DefaultSendWindow),
+		sentHistory:    ratecontrol.NewSentHistory(ratecontrol.DefaultFeedbackHistoryAge),
+		senderReports:  ratecontrol.NewSenderReportHistory(ratecontrol.DefaultSenderReportAge),
+		referenceTimes: ratecontrol.NewSenderReportHistory(ratecontrol.DefaultSenderReportAge),
+	}
+}
+
+// newRegistry returns the registry of rate controllers selectable at startup,
+// TFRC controllers are created with tfrcTuning
+func newRegistry(tfrcTuning tfrc.Config) (*ratecontrol.Registry, error) {
+	registry := ratecontrol.NewRegistry()
+	if err := registry.Register(tfrc.Name, tfrc.NewFactory(tfrcTuning)); err != nil {
+		return nil, err
+	}
+	if err := registry.Register(gcc.Name, gcc.NewController); err != nil {
+		return nil, err
+	}
+	if err := registry.Register(scream.Name, scream.NewController); err != nil {
+		return nil, err
+	}
+	if err := registry.Register(nada.Name, nada.NewController); err != nil {
+		return nil, err
+	}
+	return registry, nil
+}
+
+// setupController creates one rate controller registered under name per receiver,
+// aggregated with the receiver policy
+func (s *SlowCast) setupController(name string, receivers aggregate.Config, tfrcTuning tfrc.Config) error {
+	registry, err := newRegistry(tfrcTuning)
+	if err != nil {
+		return fmt.Errorf("failed to create rate controller registry: %w", err)
+	}
+	factory, err := registry.Factory(name)
+	if err != nil {
+		return fmt.Errorf("failed to create rate controller: %w", err)
+	}
+	controller, err := aggregate.New(receivers, factory, ratecontrol.Config{
+		InitBitrate:    s.currentBitrate,
+		MinBitrate:     s.minBitrate,
+		MaxBitrate:     s.maxBitrate,
+		SenderReports:  s.senderReports,
+		ReferenceTimes: s.referenceTimes,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create rate controller: %w", err)
+	}
+	s.controller = controller
+	return nil
+}
+
+// setupProber enables bandwidth probing above the current rate
+func (s *SlowCast) setupProber() error {
+	prober, err := probe.New(probe.DefaultConfig(probeSSRC, s.maxBitrate))
+	if err != nil {
+		return fmt.Errorf("failed to create prober: %w", err)
+	}
+	s.prober = prober
+	return nil
+}
+
+// setupStateStore resumes the controller from the state saved for the destination key
+// when it is younger than maxAge, and keeps saving it to dir
+func (s *SlowCast) setupStateStore(dir, key, controllerName string, maxAge time.Duration) {
+	s.stateStore = statestore.New(dir)
+	s.stateKey = key
+	s.controllerName = controllerName
+
+	snapshotter, ok := s.controller.(ratecontrol.StateSnapshotter)
+	if !ok {
+		return
+	}
+	data, err := s.stateStore.Load(key, controllerName, time.Now(), maxAge)
+	if err != nil {
+		fmt.Printf("Not resuming controller state: %v\n", err)
+		return
+	}
+	if err := snapshotter.UnmarshalState(data); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to restore controller state: %v\n", err)
+		return
+	}
+	s.currentBitrate = s.controller.State().Bitrate
+	fmt.Printf("Resumed controller state for %s at %d Kbps\n", key, s.currentBitrate)
+}
+
+// saveState persists the controller state for the destination
+func (s *SlowCast) saveState() {
+	if s.stateStore == nil {
+		return
+	}
+	snapshotter, ok := s.controller.(ratecontrol.StateSnapshotter)
+	if !ok {
+		return
+	}
+	data, err := snapshotter.MarshalState()
+	if err != nil {
+		if !errors.Is(err, ratecontrol.ErrStateUnsupported) {
+			fmt.Fprintf(os.Stderr, "Failed to snapshot controller state: %v\n", err)
+		}
+		return
+	}
+	if err := s.stateStore.Save(s.stateKey, s.controllerName, time.Now(), data); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to save controller state: %v\n", err)
+	}
+}
+
+// receiverAggregationConfig reads the multi-receiver aggregation policy from the environment
+func receiverAggregationConfig() (aggregate.Config, error) {
+	cfg := aggregate.DefaultConfig()
+	if value, ok := os.LookupEnv("RECEIVER_AGGREGATION"); ok {
+		policy, err := aggregate.ParsePolicy(value)
+		if err != nil {
+			return cfg, fmt.Errorf("RECEIVER_AGGREGATION: %w", err)
+		}
+		cfg.Policy = policy
+	}
+	if value, ok := os.LookupEnv("RECEIVER_PERCENTILE"); ok {
+		percentile, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return cfg, fmt.Errorf("RECEIVER_PERCENTILE: %w", err)
+		}
+		cfg.Percentile = percentile
+	}
+	if value, ok := os.LookupEnv("RECEIVER_IDLE_TIMEOUT"); ok {
+		timeout, err := time.ParseDuration(value)
+		if err != nil {
+			return cfg, fmt.Errorf("RECEIVER_IDLE_TIMEOUT: %w", err)
+		}
+		cfg.IdleTimeout = timeout
+	}
+	return cfg, nil
+}
+
+// tfrcConfig reads the TFRC REMB policy from the environment
+func tfrcConfig() (tfrc.Config, error) {
+	cfg := tfrc.DefaultConfig(0, 0, 0)
+	if value, ok := os.LookupEnv("REMB_POLICY"); ok {
+		policy, err := tfrc.ParseREMBPolicy(value)
+		if err != nil {
+			return cfg, fmt.Errorf("REMB_POLICY: %w", err)
+		}
+		cfg.REMBPolicy = policy
+	}
+	if value, ok := os.LookupEnv("REMB_BLEND_WEIGHT"); ok {
+		weight, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return cfg, fmt.Errorf("REMB_BLEND_WEIGHT: %w", err)
+		}
+		cfg.REMBBlendWeight = weight
+	}
+	return cfg, nil
+}
+
+// receiverState returns the estimates of the controller of one receiver,
+// or the aggregated ones when the receiver is unknown
+func (s *SlowCast) receiverState(receiverSSRC, mediaSSRC uint32) ratecontrol.State {
+	if lister, ok := s.controller.(aggregate.ReceiverLister); ok {
+		key := aggregate.ReceiverKey{ReceiverSSRC: receiverSSRC, MediaSSRC: mediaSSRC}
+		for _, r := range lister.Receivers() {
+			if r.Key == key {
+				return r.State
+			}
+		}
+	}
+	return s.controller.State()
+}
+
+// circuitBreakerConfig reads the circuit breaker actions from the environment
+func circuitBreakerConfig() (circuitbreaker.Config, error) {
+	cfg := circuitbreaker.DefaultConfig()
+	cfg.RTCPInterval = rtcpInterval
+	actions := []struct {
+		env    string
+		action *circuitbreaker.Action
+	}{
+		{"CB_MEDIA_TIMEOUT_ACTION", &cfg.MediaTimeoutAction},
+		{"CB_RTCP_TIMEOUT_ACTION", &cfg.RTCPTimeoutAction},
+		{"CB_CONGESTION_ACTION", &cfg.CongestionAction},
+		{"CB_USABILITY_ACTION", &cfg.UsabilityAction},
+	}
+	for _, a := range actions {
+		value, ok := os.LookupEnv(a.env)
+		if !ok {
+			continue
+		}
+		action, err := circuitbreaker.ParseAction(value)
+		if err != nil {
+			return cfg, fmt.Errorf("%s: %w", a.env, err)
+		}
+		*a.action = action
 	}
+	return cfg, nil
+}
+
+// setupCircuitBreaker creates the RFC 8083 circuit breakers, one per receiver and media stream
+func (s *SlowCast) setupCircuitBreaker(cfg circuitbreaker.Config) error {
+	breakers, err := circuitbreaker.NewGroup(cfg, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to create circuit breaker: %w", err)
+	}
+	s.breakers = breakers
+	return nil
+}
+
+// expireBreakers drops the circuit breakers of the receivers the controller expired
+func (s *SlowCast) expireBreakers() {
+	lister, ok := s.controller.(aggregate.ReceiverLister)
+	if !ok {
+		return
+	}
+	receivers := lister.Receivers()
+	keys := make([]circuitbreaker.Key, 0, len(receivers))
+	for _, r := range receivers {
+		keys = append(keys, circuitbreaker.Key(r.Key))
+	}
+	s.breakers.Retain(keys)
+}
+
+// handleTrip applies the action of a tripped circuit breaker, pause and min-rate
+// are lifted after the retry delay
+func (s *SlowCast) handleTrip(trip *circuitbreaker.Trip) {
+	if trip == nil {
+		return
+	}
+	logEntry := map[string]interface{}{
+		"type":        "circuit_breaker",
+		"breaker":     trip.Breaker.String(),
+		"action":      trip.Action.String(),
+		"reason":      trip.Reason,
+		"retry_after": trip.RetryAfter.Seconds(),
+		"receiver":    trip.Key.ReceiverSSRC,
+		"SSRC":        trip.Key.MediaSSRC,
+	}
+	if jsonEntry, err := json.Marshal(logEntry); err == nil {
+		fmt.Println(string(jsonEntry))
+	}
+
+	switch trip.Action {
+	case circuitbreaker.ActionPause:
+		if err := s.stream.SetState(gst.StatePaused); err != nil {
+			fmt.Fprintf(os.Stderr, "Circuit breaker: failed to pause pipeline: %v\n", err)
+		}
+		time.AfterFunc(trip.RetryAfter, func() { s.resumeAfterTrip(trip) })
+	case circuitbreaker.ActionMinRate:
+		s.applyMu.Lock()
+		s.setNewBitrate(time.Now(), s.minBitrate)
+		s.applyMu.Unlock()
+		time.AfterFunc(trip.RetryAfter, func() { s.resumeAfterTrip(trip) })
+	case circuitbreaker.ActionStop:
+		fmt.Println("Circuit breaker: stopping pipeline")
+		s.mainLoop.Quit()
+	case circuitbreaker.ActionNone:
+		// report only
+	}
+}
+
+// resumeAfterTrip lifts pause or min-rate and restarts the circuit breaker checks
+func (s *SlowCast) resumeAfterTrip(trip *circuitbreaker.Trip) {
+	if trip.Action == circuitbreaker.ActionPause {
+		if err := s.stream.SetState(gst.StatePlaying); err != nil {
+			fmt.Fprintf(os.Stderr, "Circuit breaker: failed to resume pipeline: %v\n", err)
+			return
+		}
+	}
+	s.breakers.Reset(time.Now())
+	fmt.Printf("Circuit breaker: %s lifted after %v\n", trip.Breaker, trip.RetryAfter)
 }
 
 func (s *SlowCast) dumpPipelineDot() {
@@ -81,14 +410,13 @@ func (s *SlowCast) setupRTCPListener(srcHost string, srcPort int) {
 		}
 	}()
 
-	// Initialize TFRC with initial bitrate and limits
-	controller := tfrc.New(s.currentBitrate, s.minBitrate, s.maxBitrate)
-
 	timeStarted := time.Now()
+	// last XR reference time sent to each receiver RTCP address
+	lastReferenceTime := make(map[string]time.Time)
 
 	buf := make([]byte, 1500)
 	for {
-		n, _, err := conn.ReadFrom(buf)
+		n, addr, err := conn.ReadFrom(buf)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error reading RTCP: %v\n", err)
 			continue
@@ -100,58 +428,154 @@ func (s *SlowCast) setupRTCPListener(srcHost string, srcPort int) {
 		}
 
 		now := time.Now()
+		elapsed := time.Since(timeStarted).Seconds()
 
+		feedback := false
 		for _, pkt := range pkts {
+			if s.rtx != nil {
+				// the RTX stream must not show up as a second media stream
+				if pkt = s.rtx.FilterFeedback(pkt); pkt == nil {
+					continue
+				}
+			}
+			if s.prober != nil {
+				// nor the probe padding, whose receive rate is padding only
+				if pkt = s.prober.FilterFeedback(pkt); pkt == nil {
+					continue
+				}
+			}
+			// Feed every packet, the controller picks the feedback it understands
+			s.controller.OnRTCP(now, pkt)
+			feedback = feedback || isRateFeedback(pkt)
+			if s.prober != nil {
+				for _, result := range s.prober.OnRTCP(now, pkt) {
+					s.onProbeResult(now, result)
+				}
+			}
+
 			switch rr := pkt.(type) {
 			case *rtcp.ReceiverReport:
+				// the congestion breaker compares what was actually sent, not the encoder target
+				sendingKbps := s.sendMeter.Stats(now).RateKbps
 				for _, report := range rr.Reports {
-
-					elapsed := time.Since(timeStarted).Seconds()
-					// Get RTCP report data
-					controller.PreProcessRTCP(now, report.LastSenderReport, report.Delay, report.FractionLost)
-
-					// fmt.Printf("{RTCP [%d] RR: elapsed=%.3f loss=%.6f, rtt=%.4fs, smoothed RTT=%.4fs, jitter=%d\n",
-					//	report.SSRC, elapsed, controller.GetLastFraction(), controller.GetRttSample(), controller.GetSmoothedRTT(), report.Jitter)
-
-					fmt.Printf("{\"SSRC\": %d, \"elapsed\": %.3f, \"loss\": %.6f, \"rtt\": %.4f, \"smoothed_rtt\": %.4f, \"jitter\": %d, \"type\": \"RTCP_RR\"}\n",
-						report.SSRC, elapsed, controller.GetLastFraction(), controller.GetRttSample(), controller.GetSmoothedRTT(), report.Jitter)
-
-					// Pace updates
-					if time.Since(s.lastChange) < s.changeInterval {
-						fmt.Printf("Pacing updates: %v\n", time.Since(s.lastChange))
-						continue
-					}
-
-					newBr := controller.ComputeTFRCBitrate()
-					if newBr != s.currentBitrate {
-						s.setNewBitrate(newBr)
-						s.lastChange = now
-						// fmt.Printf("Updated bitrate %d -> %d Kbps\n", s.currentBitrate, newBr)
-						fmt.Printf("{\"SSRC\": %d, \"elapsed\": %.3f, \"loss\": %.6f, \"rtt\": %.4f, \"smoothed_rtt\": %.4f, \"bitrate_new\": %d, \"type\": \"computed_bitrate\"}\n",
-							report.SSRC, elapsed, controller.GetLastFraction(), controller.GetRttSample(), controller.GetSmoothedRTT(), newBr)
-
-						// TODO: change resolution and framerate based on new bitrate
-					}
+					state := s.receiverState(rr.SSRC, report.SSRC)
+					fmt.Printf("{\"SSRC\": %d, \"receiver\": %d, \"elapsed\": %.3f, \"loss\": %.6f, \"rtt\": %.4f, \"smoothed_rtt\": %.4f, \"jitter\": %d, \"type\": \"RTCP_RR\"}\n",
+						report.SSRC, rr.SSRC, elapsed, state.LossRate, state.RTTSample, state.SmoothedRTT, report.Jitter)
+					key := circuitbreaker.Key{ReceiverSSRC: rr.SSRC, MediaSSRC: report.SSRC}
+					s.handleTrip(s.breakers.OnReport(now, key, report, state.RTTSample, sendingKbps))
+				}
+				if s.xrReferenceTime && len(rr.Reports) > 0 && now.Sub(lastReferenceTime[addr.String()]) >= rtcpInterval {
+					sendReferenceTime(conn, addr, rr.Reports[0].SSRC, now, s.referenceTimes)
+					lastReferenceTime[addr.String()] = now
+				}
+			case *rtcp.ExtendedReport:
+				logExtendedReport(now, elapsed, rr, s.referenceTimes)
+			case *rtcp.CCFeedbackReport:
+				s.onCCFeedback(now, elapsed, rr)
+			case *rtcp.ReceiverEstimatedMaximumBitrate:
+				logREMB(elapsed, rr)
+			case *rtcp.TransportLayerNack:
+				s.onNack(now, elapsed, rr)
+			case *rtcp.PictureLossIndication, *rtcp.FullIntraRequest:
+				if s.keyframes != nil {
+					s.onKeyframeRequest(now, elapsed, pkt)
 				}
 			default:
 				// ignore
 			}
 		}
+
+		s.expireBreakers()
+
+		// REMB, NACK, PLI and the like carry no new loss or delay sample to advance the rate on
+		if feedback {
+			s.updateBitrate(now, elapsed)
+		}
 	}
 }
 
-//nolint:gosec
-func (s *SlowCast) setNewBitrate(kbps int) {
-	enc, err := s.stream.GetElementByName("encoder")
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Encoder element lookup error: %v\n", err)
+// isRateFeedback reports whether pkt carries the loss, RTT or delay feedback the controllers
+// compute a new target from
+func isRateFeedback(pkt rtcp.Packet) bool {
+	switch pkt.(type) {
+	case *rtcp.ReceiverReport, *rtcp.ExtendedReport, *rtcp.TransportLayerCC, *rtcp.CCFeedbackReport:
+		return true
+	default:
+		return false
+	}
+}
+
+// updateBitrate asks the controller for a new target and applies it to the encoder
+func (s *SlowCast) updateBitrate(now time.Time, elapsed float64) {
+	s.applyMu.Lock()
+	defer s.applyMu.Unlock()
+
+	// Hold pause and min-rate while a circuit breaker is tripped
+	if s.breakers.Tripped() {
 		return
 	}
-	if err := enc.Set("bitrate", uint(kbps)); err != nil {
-		fmt.Fprintf(os.Stderr, "Error setting encoder bitrate: %v\n", err)
+
+	// Pace updates
+	if sinceChange := s.sinceLastChange(now); sinceChange < s.changeInterval {
+		fmt.Printf("Pacing updates: %v\n", sinceChange)
 		return
 	}
+
+	if consumer, ok := s.controller.(ratecontrol.SendStatsConsumer); ok {
+		consumer.OnSendStats(now, s.sendMeter.Stats(now))
+	}
+	newBr := s.controller.TargetBitrate()
+	if s.rtx != nil {
+		// retransmissions are sent out of the same target, the encoder gets the rest
+		s.rtx.OnBitrate(newBr)
+		newBr = max(s.minBitrate, newBr-s.rtx.RateKbps(now))
+	}
+	if s.fec != nil {
+		// FEC packets are sent on top of the encoder output, both have to fit the target
+		newBr = max(s.minBitrate, s.updateFEC(elapsed, newBr))
+	}
+	if s.prober != nil {
+		s.prober.OnBitrate(now, newBr, s.controller.State().LossRate)
+	}
+	if newBr != s.bitrate() {
+		s.setNewBitrate(now, newBr)
+		state := s.controller.State()
+		fmt.Printf("{\"elapsed\": %.3f, \"loss\": %.6f, \"rtt\": %.4f, \"smoothed_rtt\": %.4f, \"bitrate_new\": %d, \"type\": \"computed_bitrate\"}\n",
+			elapsed, state.LossRate, state.RTTSample, state.SmoothedRTT, newBr)
+	}
+}
+
+// bitrate returns the bitrate last applied to the encoder in Kbps
+func (s *SlowCast) bitrate() int {
+	s.rateMu.Lock()
+	defer s.rateMu.Unlock()
+	return s.currentBitrate
+}
+
+// sinceLastChange returns the time since the encoder bitrate was last changed
+func (s *SlowCast) sinceLastChange(now time.Time) time.Duration {
+	s.rateMu.Lock()
+	defer s.rateMu.Unlock()
+	return now.Sub(s.lastChange)
+}
+
+// setNewBitrate applies kbps to the encoder and its rung of the ladder and records it as changed at now.
+// An encoder without a runtime bitrate gets it when the ladder reconfigures it. The caller holds applyMu
+func (s *SlowCast) setNewBitrate(now time.Time, kbps int) {
+	if s.encoder.Runtime {
+		if err := s.setEncoderBitrate(kbps); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return
+		}
+	}
+	s.rateMu.Lock()
 	s.currentBitrate = kbps
+	s.lastChange = now
+	s.rateMu.Unlock()
+
+	if s.ladder != nil {
+		s.applyLadder(kbps)
+	}
 }
 
 // FIXME: need refactoring
@@ -171,15 +595,35 @@ func (s *SlowCast) createPipeline(sinkHost, srcHost string, sinkPort, srcPort in
 	}
 
 	// Video source and encoding elements
-	src, err := gst.NewElementWithProperties("v4l2src", map[string]interface{}{"device": "/dev/video0"})
+	srcBin, err := s.newSourceBin()
 	if err != nil {
-		return fmt.Errorf("failed to create v4l2src: %w", err)
+		return err
 	}
 
-	capsIn := gst.NewCapsFromString("video/x-raw,width=640,height=480,framerate=30/1")
-	capsFilterIn, err := gst.NewElementWithProperties("capsfilter", map[string]interface{}{"caps": capsIn})
+	// a file is decoded as fast as possible, identity paces it to the clock
+	pace, err := gst.NewElementWithProperties("identity", map[string]interface{}{"sync": !s.source.Live()})
 	if err != nil {
-		return fmt.Errorf("failed to create capsfilter in: %w", err)
+		return fmt.Errorf("failed to create identity: %w", err)
+	}
+
+	// videorate only drops frames down to its max rate and videoscale keeps the aspect ratio,
+	// both are set by the ladder
+	rate, err := gst.NewElementWithProperties("videorate", map[string]interface{}{
+		"name":      "rate",
+		"drop-only": true,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create videorate: %w", err)
+	}
+	if s.ladder != nil {
+		if err = rate.Set("max-rate", s.ladder.Current().FPS); err != nil {
+			return fmt.Errorf("failed to set videorate max rate: %w", err)
+		}
+	}
+
+	scale, err := gst.NewElement("videoscale")
+	if err != nil {
+		return fmt.Errorf("failed to create videoscale: %w", err)
 	}
 
 	convert, err := gst.NewElement("videoconvert")
@@ -188,32 +632,46 @@ func (s *SlowCast) createPipeline(sinkHost, srcHost string, sinkPort, srcPort in
 	}
 
 	capsOut := gst.NewCapsFromString("video/x-raw,format=I420,width=640,height=480")
-	capsFilterOut, err := gst.NewElementWithProperties("capsfilter", map[string]interface{}{"caps": capsOut})
+	if s.ladder != nil {
+		capsOut = ladderCaps(s.ladder.Current())
+	}
+	capsFilterOut, err := gst.NewElementWithProperties("capsfilter", map[string]interface{}{
+		"name": "scalecaps",
+		"caps": capsOut,
+	})
 	if err != nil {
 		return fmt.Errorf("failed to create capsfilter out: %w", err)
 	}
 
-	// Video encoder x264enc software encoder
-	encoder, err := gst.NewElementWithProperties("x264enc", map[string]interface{}{
-		"name":    "encoder",
-		"bitrate": uint(s.currentBitrate), //nolint:gosec
-		"tune":    "zerolatency",
-	})
+	// Video encoder and its RTP payloader
+	encoder, pay, err := s.newEncoder()
 	if err != nil {
-		return fmt.Errorf("failed to create x264enc: %w", err)
+		return err
 	}
 
-	// RTP payloading element
-	pay, err := gst.NewElementWithProperties("rtph264pay", map[string]interface{}{
-		"pt":              uint(96),
-		"config-interval": 1,
-	})
-	if err != nil {
-		return fmt.Errorf("failed to create rtph264pay: %w", err)
+	// rtpsession turns PLI and FIR into force key unit events, limited like the ones of the RTCP listener
+	if s.keyframes != nil {
+		if err = s.addKeyUnitProbe(encoder); err != nil {
+			return err
+		}
+	}
+
+	if s.rtx != nil {
+		// rtprtxsend maps the media SSRC to the RTX SSRC announced to the receiver
+		if err = pay.Set("ssrc", uint(s.rtx.Config().MediaSSRC)); err != nil {
+			return fmt.Errorf("failed to set %s ssrc: %w", s.encoder.Payloader, err)
+		}
 	}
 
 	// RTP caps to explicitly set media type and payload
-	rtpCaps := gst.NewCapsFromString("application/x-rtp,media=video,encoding-name=H264,payload=96")
+	rtpCapsStr := fmt.Sprintf("application/x-rtp,media=video,encoding-name=%s,payload=96", s.encoder.EncodingName)
+	extmap := fmt.Sprintf(",extmap-%d=(string)\"%s\"", twccExtensionID, ratecontrol.TransportWideCCURI)
+	observer, observePackets := s.controller.(ratecontrol.PacketObserver)
+	if observePackets || s.prober != nil {
+		// the payloader adds the transport-wide sequence number extension from the extmap field
+		rtpCapsStr += extmap
+	}
+	rtpCaps := gst.NewCapsFromString(rtpCapsStr)
 	rtpCapsFilter, err := gst.NewElementWithProperties("capsfilter", map[string]interface{}{"caps": rtpCaps})
 	if err != nil {
 		return fmt.Errorf("failed to create RTP capsfilter: %w", err)
@@ -229,7 +687,7 @@ func (s *SlowCast) createPipeline(sinkHost, srcHost string, sinkPort, srcPort in
 	if err = rtpSession.Set("rtp-profile", uint64(2)); err != nil { // 1 - AVP, 2 = AVPF
 		fmt.Println("Warning: failed to set rtp-profile, using default")
 	}
-	if err = rtpSession.Set("rtcp-min-interval", uint64(5000000000)); err != nil { // 5 seconds in us
+	if err = rtpSession.Set("rtcp-min-interval", uint64(rtcpInterval)); err != nil { // in ns
 		return fmt.Errorf("failed to set rtcp-min-interval: %w", err)
 	}
 	if err = rtpSession.Set("rtcp-fraction", 0.05); err != nil {
@@ -284,14 +742,15 @@ func (s *SlowCast) createPipeline(sinkHost, srcHost string, sinkPort, srcPort in
 	}
 
 	// Add all elements to pipeline
-	if err = pipeline.AddMany(src, capsFilterIn, convert, capsFilterOut,
+	if err = pipeline.AddMany(srcBin.Element, pace, rate, scale, convert, capsFilterOut,
 		encoder, pay, rtpCapsFilter, rtpSession, rtpFunnel,
 		rtpSink, rtcpSink, rtcpSrc); err != nil {
 		return fmt.Errorf("failed to add elements to pipeline: %w", err)
 	}
 
 	// Link video capture elements
-	if err = gst.ElementLinkMany(src, capsFilterIn, convert, capsFilterOut, encoder, pay, rtpCapsFilter); err != nil {
+	if err = gst.ElementLinkMany(srcBin.Element, pace, rate, scale, convert, capsFilterOut,
+		encoder, pay, rtpCapsFilter); err != nil {
 		return fmt.Errorf("failed to link video elements: %w", err)
 	}
 
@@ -306,6 +765,100 @@ func (s *SlowCast) createPipeline(sinkHost, srcHost string, sinkPort, srcPort in
 		return fmt.Errorf("failed to get rtpsession send_rtp_sink pad")
 	}
 
+	// FEC packets are added to the media and both are wrapped in RED before any queueing
+	if s.fec != nil {
+		fecEnc, redEnc, err := s.newFECEncoders()
+		if err != nil {
+			return err
+		}
+		if err = pipeline.AddMany(fecEnc, redEnc); err != nil {
+			return fmt.Errorf("failed to add FEC encoders to pipeline: %w", err)
+		}
+		if err = gst.ElementLinkMany(rtpCapsFilter, fecEnc, redEnc); err != nil {
+			return fmt.Errorf("failed to link FEC encoders: %w", err)
+		}
+		rtpCapsFilterSrcPad = redEnc.GetStaticPad("src")
+	}
+
+	// Window-based controllers hold packets in an RTP queue in front of rtpsession
+	if limiter, ok := s.controller.(ratecontrol.SendLimiter); ok {
+		rtpQueue, err := gst.NewElementWithProperties("queue", map[string]interface{}{
+			"name":             "rtpqueue",
+			"max-size-buffers": uint(0),
+			"max-size-bytes":   uint(0),
+			"max-size-time":    uint64(time.Second),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create RTP queue: %w", err)
+		}
+		if err = pipeline.Add(rtpQueue); err != nil {
+			return fmt.Errorf("failed to add RTP queue to pipeline: %w", err)
+		}
+		rtpQueueSinkPad := rtpQueue.GetStaticPad("sink")
+		if rtpQueueSinkPad == nil {
+			return fmt.Errorf("failed to get RTP queue sink pad")
+		}
+		if rtpCapsFilterSrcPad.Link(rtpQueueSinkPad) != gst.PadLinkOK {
+			return fmt.Errorf("failed to link RTP capsfilter to RTP queue")
+		}
+		if err = s.addQueueProbes(rtpQueue, limiter); err != nil {
+			return err
+		}
+		rtpCapsFilterSrcPad = rtpQueue.GetStaticPad("src")
+	}
+
+	// Probe padding packets join the media in the funnel, rtpsession numbers both
+	// with one transport-wide sequence
+	if s.prober != nil {
+		// the padding has a payload type of its own, receivers drop it instead of decoding it
+		probeCaps := gst.NewCapsFromString(fmt.Sprintf("application/x-rtp,media=video,clock-rate=90000,payload=%d",
+			s.prober.Config().PayloadType) + extmap)
+		probeSrc, err := gst.NewElementWithProperties("appsrc", map[string]interface{}{
+			"name":         "rtpprobe",
+			"caps":         probeCaps,
+			"is-live":      true,
+			"format":       gst.FormatTime,
+			"do-timestamp": true,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create probe appsrc: %w", err)
+		}
+		if err = pipeline.Add(probeSrc); err != nil {
+			return fmt.Errorf("failed to add probe appsrc to pipeline: %w", err)
+		}
+		funnelSinkPad := rtpFunnel.GetRequestPad("sink_%u")
+		if funnelSinkPad == nil {
+			return fmt.Errorf("failed to get RTP funnel sink pad")
+		}
+		if rtpCapsFilterSrcPad.Link(funnelSinkPad) != gst.PadLinkOK {
+			return fmt.Errorf("failed to link RTP capsfilter to RTP funnel")
+		}
+		if err = probeSrc.Link(rtpFunnel); err != nil {
+			return fmt.Errorf("failed to link probe appsrc to RTP funnel: %w", err)
+		}
+		rtpCapsFilterSrcPad = rtpFunnel.GetStaticPad("src")
+	}
+
+	// rtprtxsend sits right in front of rtpsession, which turns the NACKs it receives into
+	// retransmission requests sent upstream, and the RTX stream gets its own sender reports
+	if s.rtx != nil {
+		rtxSend, err := s.newRTXSender()
+		if err != nil {
+			return err
+		}
+		if err = pipeline.Add(rtxSend); err != nil {
+			return fmt.Errorf("failed to add rtprtxsend to pipeline: %w", err)
+		}
+		rtxSinkPad := rtxSend.GetStaticPad("sink")
+		if rtxSinkPad == nil {
+			return fmt.Errorf("failed to get rtprtxsend sink pad")
+		}
+		if rtpCapsFilterSrcPad.Link(rtxSinkPad) != gst.PadLinkOK {
+			return fmt.Errorf("failed to link RTP capsfilter to rtprtxsend")
+		}
+		rtpCapsFilterSrcPad = rtxSend.GetStaticPad("src")
+	}
+
 	if rtpCapsFilterSrcPad.Link(rtpSessionSinkPad) != gst.PadLinkOK {
 		return fmt.Errorf("failed to link RTP capsfilter to rtpsession")
 	}
@@ -325,6 +878,18 @@ func (s *SlowCast) createPipeline(sinkHost, srcHost string, sinkPort, srcPort in
 	if rtpSessionSrcPad.Link(rtpSinkPad) != gst.PadLinkOK {
 		return fmt.Errorf("failed to link rtpsession to RTP sink")
 	}
+
+	s.addSendProbe(rtpSessionSrcPad, mediaOnly{observer: s.sendMeter})
+	s.addSendProbe(rtpSessionSrcPad, s.sentHistory)
+	if s.rtx != nil {
+		s.addSendProbe(rtpSessionSrcPad, s.rtx)
+	}
+	if observePackets {
+		s.addSendProbe(rtpSessionSrcPad, observer)
+	}
+	if s.prober != nil {
+		s.addSendProbe(rtpSessionSrcPad, s.prober)
+	}
 	// End of RTP sink linking
 
 	// Link rtpsession send_rtcp_src to RTCP sink
@@ -341,6 +906,7 @@ func (s *SlowCast) createPipeline(sinkHost, srcHost string, sinkPort, srcPort in
 	if rtcpSrcPad.Link(rtcpSinkPad) != gst.PadLinkOK {
 		return fmt.Errorf("failed to link rtpsession to RTCP sink")
 	}
+	s.addSenderReportProbe(rtcpSrcPad)
 	// End of RTCP sink linking
 
 	// Link RTCP source to rtpsession recv_rtcp_sink
@@ -404,6 +970,38 @@ func (s *SlowCast) runPipeline() error {
 		}
 	}()
 
+	// Persist the controller state, and once more on the way out
+	defer s.saveState()
+	if s.stateStore != nil {
+		go func(ctx context.Context) {
+			ticker := time.NewTicker(stateSaveInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					s.saveState()
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(runCtx)
+	}
+
+	// RTCP timeout circuit breaker, checked between reports
+	go func(ctx context.Context) {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				s.expireBreakers()
+				s.handleTrip(s.breakers.Check(now))
+			case <-ctx.Done():
+				return
+			}
+		}
+	}(runCtx)
+
 	// polling bitrate in a separate goroutine
 	go func(ctx context.Context, pipeline *gst.Pipeline) {
 		ticker := time.NewTicker(100 * time.Millisecond)
@@ -420,18 +1018,22 @@ func (s *SlowCast) runPipeline() error {
 		for {
 			select {
 			case <-ticker.C:
-				bitrateVal, errGet := encoder.GetProperty("bitrate")
+				bitrateVal, errGet := encoder.GetProperty(s.encoder.BitrateProperty)
 				if errGet != nil {
 					// Log error but continue, as element might be in a transient state
 					fmt.Fprintf(os.Stderr, "Bitrate Polling: Failed to get bitrate property: %v\n", errGet)
 					continue
 				}
-				if bitrateUint, ok := bitrateVal.(uint); ok {
+				if bitrateKbps, ok := s.encoder.Kbps(bitrateVal); ok {
 					elapsed := time.Since(startTime).Seconds()
+					stats := s.sendMeter.Stats(time.Now())
 					logEntry := map[string]interface{}{
-						"type":    "poll_bitrate",
-						"elapsed": fmt.Sprintf("%.3f", elapsed),
-						"bitrate": bitrateUint,
+						"type":            "poll_bitrate",
+						"elapsed":         fmt.Sprintf("%.3f", elapsed),
+						"bitrate":         bitrateKbps,
+						"send_rate":       stats.RateKbps,
+						"avg_packet_size": fmt.Sprintf("%.1f", stats.AvgPacketSize),
+						"sent_packets":    stats.Packets,
 					}
 					jsonEntry, err := json.Marshal(logEntry)
 					if err != nil {
@@ -440,7 +1042,7 @@ func (s *SlowCast) runPipeline() error {
 						fmt.Println(string(jsonEntry))
 					}
 				} else {
-					fmt.Fprintf(os.Stderr, "Bitrate Polling: Bitrate property is not of type uint, got %T\n", bitrateVal)
+					fmt.Fprintf(os.Stderr, "Bitrate Polling: Bitrate property is not an integer, got %T\n", bitrateVal)
 				}
 			case <-ctx.Done():
 				fmt.Println("Bitrate Polling: Stopped.")
@@ -462,6 +1064,15 @@ func (s *SlowCast) runPipeline() error {
 	}
 	fmt.Println("Pipeline is PLAYING. Starting main loop and bitrate polling...")
 
+	if s.prober != nil {
+		probeSrc, err := s.stream.GetElementByName("rtpprobe")
+		if err != nil {
+			return fmt.Errorf("failed to get probe appsrc: %w", err)
+		}
+		s.prober.OnBitrate(time.Now(), s.bitrate(), 0)
+		go s.runProbePacer(runCtx, app.SrcFromElement(probeSrc))
+	}
+
 	return s.mainLoop.RunError()
 }
 
@@ -487,6 +1098,19 @@ func main() {
 	sinkPortStr := getEnv("UDP_SINK_PORT", "6000")
 	srcHost := getEnv("UDP_SRC_HOST", "127.0.0.1")
 	srcPortStr := getEnv("UDP_SRC_PORT", "6000")
+	controllerName := getEnv("RATE_CONTROLLER", tfrc.Name)
+	probingStr := getEnv("BANDWIDTH_PROBING", "false")
+	keyframeIntervalStr := getEnv("KEYFRAME_MIN_INTERVAL", "1s")
+	fecStr := getEnv("FEC", "false")
+	fecMaxPercentageStr := getEnv("FEC_MAX_PERCENTAGE", "50")
+	rtxStr := getEnv("RTX", "false")
+	rtxMaxShareStr := getEnv("RTX_MAX_SHARE", "0.25")
+	encoderStr := getEnv("VIDEO_ENCODER", encoder.DefaultBackend().Name)
+	ladderStr := getEnv("BITRATE_LADDER", "")
+	ladderHysteresisStr := getEnv("LADDER_HYSTERESIS", "0.1")
+	stateDir := getEnv("STATE_DIR", "")
+	stateMaxAgeStr := getEnv("STATE_MAX_AGE", "10m")
+	xrReferenceTimeStr := getEnv("RTCP_XR_REFERENCE_TIME", "false")
 
 	sinkPort, err := strconv.Atoi(sinkPortStr)
 	if err != nil {
@@ -510,6 +1134,140 @@ func main() {
 		fmt.Println("Debug mode enabled - will generate pipeline DOT file")
 	}
 
+	receivers, err := receiverAggregationConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid receiver aggregation configuration: %v\n", err)
+		os.Exit(1)
+	}
+	tfrcTuning, err := tfrcConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid TFRC configuration: %v\n", err)
+		os.Exit(1)
+	}
+	if err = slow.setupController(controllerName, receivers, tfrcTuning); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to set up rate controller: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Using rate controller: %s, receiver aggregation: %s, REMB policy: %s\n",
+		controllerName, receivers.Policy, tfrcTuning.REMBPolicy)
+
+	if stateDir != "" {
+		stateMaxAge, parseErr := time.ParseDuration(stateMaxAgeStr)
+		if parseErr != nil {
+			fmt.Printf("Warning: Invalid STATE_MAX_AGE '%s', using default 10m\n", stateMaxAgeStr)
+			stateMaxAge = 10 * time.Minute
+		}
+		slow.setupStateStore(stateDir, net.JoinHostPort(sinkHost, strconv.Itoa(sinkPort)), controllerName, stateMaxAge)
+	}
+
+	slow.xrReferenceTime, err = strconv.ParseBool(xrReferenceTimeStr)
+	if err != nil {
+		fmt.Printf("Warning: Invalid RTCP_XR_REFERENCE_TIME '%s', XR reference time disabled\n", xrReferenceTimeStr)
+	}
+
+	probing, err := strconv.ParseBool(probingStr)
+	if err != nil {
+		fmt.Printf("Warning: Invalid BANDWIDTH_PROBING '%s', probing disabled\n", probingStr)
+	}
+	if probing {
+		if err = slow.setupProber(); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to set up bandwidth probing: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("Bandwidth probing enabled")
+	}
+
+	keyframeInterval, err := time.ParseDuration(keyframeIntervalStr)
+	if err != nil {
+		fmt.Printf("Warning: Invalid KEYFRAME_MIN_INTERVAL '%s', using default 1s\n", keyframeIntervalStr)
+		keyframeInterval = time.Second
+	}
+	if err = slow.setupKeyframes(keyframeInterval); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to set up key frame requests: %v\n", err)
+		os.Exit(1)
+	}
+
+	fecEnabled, err := strconv.ParseBool(fecStr)
+	if err != nil {
+		fmt.Printf("Warning: Invalid FEC '%s', FEC disabled\n", fecStr)
+	}
+	if fecEnabled {
+		fecMaxPercentage, parseErr := strconv.Atoi(fecMaxPercentageStr)
+		if parseErr != nil {
+			fmt.Printf("Warning: Invalid FEC_MAX_PERCENTAGE '%s', using default 50\n", fecMaxPercentageStr)
+			fecMaxPercentage = 50
+		}
+		if err = slow.setupFEC(fecMaxPercentage); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to set up FEC: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("Adaptive FEC enabled")
+	}
+
+	rtxEnabled, err := strconv.ParseBool(rtxStr)
+	if err != nil {
+		fmt.Printf("Warning: Invalid RTX '%s', retransmissions disabled\n", rtxStr)
+	}
+	if rtxEnabled {
+		rtxMaxShare, parseErr := strconv.ParseFloat(rtxMaxShareStr, 64)
+		if parseErr != nil {
+			fmt.Printf("Warning: Invalid RTX_MAX_SHARE '%s', using default 0.25\n", rtxMaxShareStr)
+			rtxMaxShare = 0.25
+		}
+		if err = slow.setupRTX(rtxMaxShare); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to set up retransmissions: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("RTX retransmissions enabled")
+	}
+
+	sourceCfg, err := sourceConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid video source configuration: %v\n", err)
+		os.Exit(1)
+	}
+	if err = slow.setupSource(sourceCfg); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to set up video source: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Video source: %s\n", slow.source.Description())
+
+	backend, err := encoder.ParseBackend(encoderStr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid VIDEO_ENCODER, one of %v: %v\n", encoder.Names(), err)
+		os.Exit(1)
+	}
+	slow.setupEncoder(backend)
+
+	ladderConfig := ladder.DefaultConfig()
+	if ladderStr != "" {
+		rungs, parseErr := ladder.Parse(ladderStr)
+		if parseErr != nil {
+			fmt.Printf("Warning: Invalid BITRATE_LADDER '%s', using the default ladder: %v\n", ladderStr, parseErr)
+		} else {
+			ladderConfig.Rungs = rungs
+		}
+	}
+	if ladderConfig.Hysteresis, err = strconv.ParseFloat(ladderHysteresisStr, 64); err != nil {
+		fmt.Printf("Warning: Invalid LADDER_HYSTERESIS '%s', using default 0.1\n", ladderHysteresisStr)
+		ladderConfig.Hysteresis = 0.1
+	}
+	if err = slow.setupLadder(ladderConfig); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to set up bitrate ladder: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Bitrate ladder: %v\n", ladderConfig.Rungs)
+
+	breakerConfig, err := circuitBreakerConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid circuit breaker configuration: %v\n", err)
+		os.Exit(1)
+	}
+	if err = slow.setupCircuitBreaker(breakerConfig); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to set up circuit breaker: %v\n", err)
+		os.Exit(1)
+	}
+
 	err = slow.createPipeline(sinkHost, srcHost, sinkPort, srcPort)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to create pipeline: %v\n", err)
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/go-gst/go-gst/gst"
+
+	"github.com/arsperger/slowcast/pkg/source"
+)
+
+// sourceConfig reads the video source from the environment
+func sourceConfig() (source.Config, error) {
+	cfg := source.DefaultConfig()
+	if value, ok := os.LookupEnv("VIDEO_SOURCE"); ok {
+		kind, err := source.ParseKind(value)
+		if err != nil {
+			return cfg, fmt.Errorf("VIDEO_SOURCE: %w", err)
+		}
+		cfg.Kind = kind
+	}
+	for key, dst := range map[string]*string{
+		"VIDEO_DEVICE":       &cfg.Device,
+		"VIDEO_PATTERN":      &cfg.Pattern,
+		"VIDEO_LOCATION":     &cfg.Location,
+		"VIDEO_RTP_ENCODING": &cfg.Encoding,
+		"VIDEO_CAPS":         &cfg.Caps,
+	} {
+		if value, ok := os.LookupEnv(key); ok {
+			*dst = value
+		}
+	}
+	if value, ok := os.LookupEnv("VIDEO_LOOP"); ok {
+		loop, err := strconv.ParseBool(value)
+		if err != nil {
+			return cfg, fmt.Errorf("VIDEO_LOOP: %w", err)
+		}
+		cfg.Loop = loop
+	}
+	if value, ok := os.LookupEnv("VIDEO_RTP_PORT"); ok {
+		port, err := strconv.Atoi(value)
+		if err != nil {
+			return cfg, fmt.Errorf("VIDEO_RTP_PORT: %w", err)
+		}
+		cfg.Port = port
+	}
+	if value, ok := os.LookupEnv("VIDEO_LATENCY"); ok {
+		latency, err := time.ParseDuration(value)
+		if err != nil {
+			return cfg, fmt.Errorf("VIDEO_LATENCY: %w", err)
+		}
+		cfg.Latency = latency
+	}
+	return cfg, nil
+}
+
+// setupSource validates the video source
+func (s *SlowCast) setupSource(cfg source.Config) error {
+	src, err := source.New(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create video source: %w", err)
+	}
+	s.source = src
+	return nil
+}
+
+// newSourceBin creates the bin of the video source, a looping source restarts at its end
+func (s *SlowCast) newSourceBin() (*gst.Bin, error) {
+	bin, err := gst.NewBinFromString(s.source.Description(), true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s source: %w", s.source.Config().Kind, err)
+	}
+	if s.source.Loops() {
+		srcPad := bin.GetStaticPad("src")
+		if srcPad == nil {
+			return nil, fmt.Errorf("failed to get source src pad")
+		}
+		addLoopProbe(srcPad)
+	}
+	return bin, nil
+}
+
+// addLoopProbe turns the EOS leaving pad into a flushing seek back to the start. The flush is
+// kept inside the source bin and the pad offset grows by the length of every pass, so the
+// encoder sees one stream with a running time that keeps increasing
+func addLoopProbe(pad *gst.Pad) {
+	var end time.Duration
+	pad.AddProbe(gst.PadProbeTypeBuffer|gst.PadProbeTypeEventDownstream,
+		func(pad *gst.Pad, info *gst.PadProbeInfo) gst.PadProbeReturn {
+			if buf := info.GetBuffer(); buf != nil {
+				if pts := buf.PresentationTimestamp().AsDuration(); pts != nil {
+					bufEnd := *pts
+					if duration := buf.Duration().AsDuration(); duration != nil {
+						bufEnd += *duration
+					}
+					end = max(end, bufEnd)
+				}
+				return gst.PadProbeOK
+			}
+			ev := info.GetEvent()
+			if ev == nil {
+				return gst.PadProbeOK
+			}
+			switch ev.Type() {
+			case gst.EventTypeFlushStart, gst.EventTypeFlushStop:
+				return gst.PadProbeDrop
+			case gst.EventTypeEOS:
+				pad.SetOffset(pad.GetOffset() + end.Nanoseconds())
+				fmt.Printf("Looping video source after %v\n", end)
+				end = 0
+				// seeking from the streaming thread would deadlock
+				go func() {
+					seek := gst.NewSeekEvent(1.0, gst.FormatTime, gst.SeekFlagFlush|gst.SeekFlagKeyUnit,
+						gst.SeekTypeSet, 0, gst.SeekTypeNone, -1)
+					if !pad.SendEvent(seek) {
+						fmt.Fprintf(os.Stderr, "Failed to loop the video source\n")
+					}
+				}()
+				return gst.PadProbeDrop
+			default:
+				return gst.PadProbeOK
+			}
+		})
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/pion/rtcp"
+
+	"github.com/arsperger/slowcast/pkg/ratecontrol"
+)
+
+// logExtendedReport writes an RTCP_XR log entry for every RFC 3611 block the sender uses,
+// DLRR RTTs are matched against the reference times sent
+func logExtendedReport(now time.Time, elapsed float64, xr *rtcp.ExtendedReport, referenceTimes *ratecontrol.SenderReportHistory) {
+	for _, block := range xr.Reports {
+		logEntry := map[string]interface{}{
+			"type":     "RTCP_XR",
+			"receiver": xr.SenderSSRC,
+			"elapsed":  fmt.Sprintf("%.3f", elapsed),
+		}
+		switch b := block.(type) {
+		case *rtcp.LossRLEReportBlock:
+			bursts := ratecontrol.AnalyzeLoss(ratecontrol.DecodeLossRLE(b), ratecontrol.DefaultGmin)
+			logEntry["block"] = "loss_rle"
+			logEntry["SSRC"] = b.SSRC
+			logEntry["loss"] = fmt.Sprintf("%.6f", bursts.LossRate())
+			logEntry["burst_density"] = fmt.Sprintf("%.4f", bursts.BurstDensity())
+			logEntry["gap_density"] = fmt.Sprintf("%.4f", bursts.GapDensity())
+			logEntry["mean_burst"] = fmt.Sprintf("%.1f", bursts.MeanBurstLength())
+			logEntry["burst_loss_share"] = fmt.Sprintf("%.4f", bursts.BurstLossShare())
+		case *rtcp.StatisticsSummaryReportBlock:
+			logEntry["block"] = "statistics_summary"
+			logEntry["SSRC"] = b.SSRC
+			logEntry["lost"] = b.LostPackets
+			logEntry["duplicated"] = b.DupPackets
+			logEntry["mean_jitter"] = b.MeanJitter
+			logEntry["dev_jitter"] = b.DevJitter
+		case *rtcp.ReceiverReferenceTimeReportBlock:
+			logEntry["block"] = "receiver_reference_time"
+			logEntry["ntp"] = b.NTPTimestamp
+		case *rtcp.DLRRReportBlock:
+			logEntry["block"] = "dlrr"
+			rtts := make([]string, 0, len(b.Reports))
+			for _, report := range b.Reports {
+				if rtt, ok := referenceTimes.DLRR(now, report); ok {
+					rtts = append(rtts, fmt.Sprintf("%.4f", rtt))
+				}
+			}
+			logEntry["rtt"] = rtts
+		default:
+			continue
+		}
+		if jsonEntry, err := json.Marshal(logEntry); err == nil {
+			fmt.Println(string(jsonEntry))
+		}
+	}
+}
+
+// sendReferenceTime sends an XR Receiver Reference Time block to the RTCP address of a receiver,
+// receivers supporting RFC 3611 answer with a DLRR block giving an RTT sample independent of the SR timing.
+// The block is recorded in referenceTimes so the DLRR is matched against it
+func sendReferenceTime(conn *net.UDPConn, addr net.Addr, ssrc uint32, now time.Time, referenceTimes *ratecontrol.SenderReportHistory) {
+	ntp := ratecontrol.NTPTime(now)
+	buf, err := rtcp.Marshal([]rtcp.Packet{&rtcp.ExtendedReport{
+		SenderSSRC: ssrc,
+		Reports: []rtcp.ReportBlock{
+			&rtcp.ReceiverReferenceTimeReportBlock{NTPTimestamp: ntp},
+		},
+	}})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "RTCP XR marshal error: %v\n", err)
+		return
+	}
+	if _, err := conn.WriteTo(buf, addr); err != nil {
+		fmt.Fprintf(os.Stderr, "Error sending RTCP XR: %v\n", err)
+		return
+	}
+	referenceTimes.OnReferenceTime(now, ssrc, ntp)
+}